@@ -0,0 +1,512 @@
+// Package asm is a small SM83 assembler with a RGBDS-like syntax, used to build test ROMs
+package asm
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/disasm"
+	"github.com/Guillem96/gameboy-tools/exprparse"
+)
+
+// Memory types of the sections: start and end address, first and last bank
+var memoryTypes = map[string]struct {
+	start, end         int
+	firstBank, maxBank int
+	rom                bool
+}{
+	"ROM0":  {0x0000, 0x4000, 0, 0, true},
+	"ROMX":  {0x4000, 0x8000, 1, 511, true},
+	"VRAM":  {0x8000, 0xA000, 0, 1, false},
+	"SRAM":  {0xA000, 0xC000, 0, 15, false},
+	"WRAM0": {0xC000, 0xD000, 0, 0, false},
+	"WRAMX": {0xD000, 0xE000, 1, 7, false},
+	"OAM":   {0xFE00, 0xFEA0, 0, 0, false},
+	"HRAM":  {0xFF80, 0xFFFF, 0, 0, false},
+}
+
+// Program is an assembled program
+type Program struct {
+	// Banks are the ROM banks, the bytes not written by any section are ROMPadding
+	Banks [][]uint8
+	// Symbols are the labels, as written in a RGBDS .sym file
+	Symbols *disasm.Symbols
+}
+
+// symbol is a label or a constant
+type symbol struct {
+	value   int
+	bank    int
+	isLabel bool
+}
+
+// section is the memory area where the code and the data are placed
+type section struct {
+	name     string
+	memType  string
+	bank     int
+	start    int
+	pc       int
+	romBytes bool
+}
+
+// item is a statement that emits bytes, encoded in the second pass
+type item struct {
+	src   source
+	sect  *section
+	addr  int
+	scope string // global label of the local labels
+	in    *instruction
+	data  []expr // db and dw
+	str   []string
+	width int // 1 for db, 2 for dw
+	fill  expr
+	count int
+}
+
+type assembler struct {
+	symbols  map[string]symbol
+	sections []*section
+	next     map[string]int // first free address of each memory type and bank
+	items    []*item
+	banks    [][]uint8
+	written  [][]bool
+	labels   *disasm.Symbols
+
+	scope    string // global label of the local labels, in the first pass
+	current  *item  // item being encoded, in the second pass
+	emitting bool
+}
+
+// Assemble assembles a program. The name is used in the error messages
+func Assemble(r io.Reader, name string) (*Program, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines, err := expandMacros(name, string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	a := &assembler{symbols: map[string]symbol{}, next: map[string]int{}, labels: disasm.NewSymbols()}
+	for _, l := range lines {
+		if err := a.layout(l); err != nil {
+			return nil, fmt.Errorf("%s: %v", l.src, err)
+		}
+	}
+	a.emitting = true
+	for _, it := range a.items {
+		if err := a.emit(it); err != nil {
+			return nil, fmt.Errorf("%s: %v", it.src, err)
+		}
+	}
+	if len(a.banks) < 2 {
+		a.bank(1)
+	}
+	return &Program{Banks: a.banks, Symbols: a.labels}, nil
+}
+
+// AssembleString assembles the program in the string
+func AssembleString(src string) (*Program, error) {
+	return Assemble(strings.NewReader(src), "<input>")
+}
+
+// layout defines the labels and constants and places the statements of a line (first pass)
+func (a *assembler) layout(l line) error {
+	text := l.text
+	if label, rest, ok := splitLabel(text); ok {
+		if err := a.defineLabel(label); err != nil {
+			return err
+		}
+		text = rest
+	}
+	text = strings.TrimSpace(text)
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+
+	directive := strings.ToUpper(fields[0])
+	args := strings.TrimSpace(text[len(fields[0]):])
+	if directive == "DEF" {
+		// DEF name EQU value or DEF name = value
+		return a.defineConstant(args)
+	}
+	if len(fields) > 2 && (strings.EqualFold(fields[1], "EQU") || fields[1] == "=") {
+		return a.defineConstant(text)
+	}
+
+	switch directive {
+	case "SECTION":
+		return a.openSection(args)
+	case "DB", "DW":
+		width := 1
+		if directive == "DW" {
+			width = 2
+		}
+		return a.layoutData(l, args, width)
+	case "DS":
+		return a.layoutSpace(l, args)
+	}
+	in, err := parseInstruction(text)
+	if err != nil {
+		return err
+	}
+	return a.place(&item{src: l.src, in: in}, in.size())
+}
+
+// splitLabel splits a label definition ("Name:", "Name::", ".local:" or ".local") from the
+// statement
+func splitLabel(text string) (string, string, bool) {
+	trimmed := strings.TrimLeft(text, " \t")
+	i := 0
+	for i < len(trimmed) && exprparse.IsIdentChar(trimmed[i]) {
+		i++
+	}
+	if i > 1 && trimmed[0] == '.' && strings.TrimSpace(trimmed[i:]) == "" {
+		return trimmed[:i], "", true
+	}
+	if i == 0 || i >= len(trimmed) || trimmed[i] != ':' || trimmed[0] >= '0' && trimmed[0] <= '9' {
+		return "", text, false
+	}
+	rest := trimmed[i+1:]
+	rest = strings.TrimPrefix(rest, ":")
+	return trimmed[:i], rest, true
+}
+
+// currentScope returns the global label of the local labels
+func (a *assembler) currentScope() string {
+	if a.emitting {
+		return a.current.scope
+	}
+	return a.scope
+}
+
+// fullName returns the name of a label, prefixing local labels with their global label
+func fullName(scope, name string) string {
+	if strings.HasPrefix(name, ".") {
+		return scope + name
+	}
+	return name
+}
+
+func (a *assembler) defineLabel(name string) error {
+	s := a.currentSection()
+	if s == nil {
+		return fmt.Errorf("label %s outside of a section", name)
+	}
+	full := fullName(a.scope, name)
+	if _, ok := a.symbols[full]; ok {
+		return fmt.Errorf("%s is already defined", full)
+	}
+	a.symbols[full] = symbol{value: s.pc, bank: s.bank, isLabel: true}
+	a.labels.Add(s.bank, uint16(s.pc), full)
+	if !strings.HasPrefix(name, ".") {
+		a.scope = name
+	}
+	return nil
+}
+
+func (a *assembler) defineConstant(text string) error {
+	var name, value string
+	fields := strings.Fields(text)
+	switch {
+	case len(fields) > 2 && strings.EqualFold(fields[1], "EQU"):
+		name = fields[0]
+		value = strings.TrimSpace(text[strings.Index(strings.ToUpper(text), "EQU")+3:])
+	case len(fields) > 2 && fields[1] == "=":
+		name = fields[0]
+		value = strings.TrimSpace(text[strings.Index(text, "=")+1:])
+	default:
+		return fmt.Errorf("expected DEF name EQU value")
+	}
+	if _, ok := a.symbols[name]; ok {
+		return fmt.Errorf("%s is already defined", name)
+	}
+	e, err := parseExpr(value)
+	if err != nil {
+		return err
+	}
+	v, err := e(a)
+	if err != nil {
+		return err
+	}
+	a.symbols[name] = symbol{value: v}
+	return nil
+}
+
+// openSection parses SECTION "name", TYPE[$addr], BANK[n]. Sections without an address start
+// where the previous section of the same type and bank ended
+func (a *assembler) openSection(args string) error {
+	parts := splitArgs(args)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "\"") {
+		return fmt.Errorf("expected SECTION \"name\", TYPE[addr], BANK[n]")
+	}
+	s := &section{name: strings.Trim(parts[0], "\"")}
+
+	memType, addr, hasAddr, err := a.bracketArg(parts[1])
+	if err != nil {
+		return err
+	}
+	if hasAddr && addr < 0 {
+		return fmt.Errorf("negative section address %d", addr)
+	}
+	s.memType = strings.ToUpper(memType)
+	t, ok := memoryTypes[s.memType]
+	if !ok {
+		return fmt.Errorf("unknown memory type %q", memType)
+	}
+	s.bank, s.romBytes = t.firstBank, t.rom
+	for _, p := range parts[2:] {
+		opt, v, hasValue, err := a.bracketArg(p)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(opt, "BANK") || !hasValue {
+			return fmt.Errorf("unexpected section option %q", p)
+		}
+		if v < t.firstBank || v > t.maxBank {
+			return fmt.Errorf("invalid bank %d for %s", v, s.memType)
+		}
+		s.bank = v
+	}
+
+	key := fmt.Sprintf("%s:%d", s.memType, s.bank)
+	s.start = addr
+	if !hasAddr {
+		s.start = t.start
+		if next, ok := a.next[key]; ok {
+			s.start = next
+		}
+	}
+	if s.start < t.start || s.start >= t.end {
+		return fmt.Errorf("address $%04X is outside of %s", s.start, s.memType)
+	}
+	s.pc = s.start
+	a.sections = append(a.sections, s)
+	return nil
+}
+
+// bracketArg parses "NAME[expr]" or "NAME", reporting whether there was a value
+func (a *assembler) bracketArg(arg string) (string, int, bool, error) {
+	i := strings.Index(arg, "[")
+	if i < 0 {
+		return strings.TrimSpace(arg), 0, false, nil
+	}
+	if !strings.HasSuffix(arg, "]") {
+		return "", 0, false, fmt.Errorf("expected ] in %q", arg)
+	}
+	e, err := parseExpr(arg[i+1 : len(arg)-1])
+	if err != nil {
+		return "", 0, false, err
+	}
+	v, err := e(a)
+	return strings.TrimSpace(arg[:i]), v, true, err
+}
+
+func (a *assembler) currentSection() *section {
+	if len(a.sections) == 0 {
+		return nil
+	}
+	return a.sections[len(a.sections)-1]
+}
+
+// place assigns the address of the current section to an item and advances it
+func (a *assembler) place(it *item, size int) error {
+	s := a.currentSection()
+	if s == nil {
+		return fmt.Errorf("code or data outside of a section")
+	}
+	if (it.in != nil || it.data != nil) && !s.romBytes {
+		return fmt.Errorf("only ds is allowed in %s sections", s.memType)
+	}
+	if s.pc+size > memoryTypes[s.memType].end {
+		return fmt.Errorf("section %q does not fit in %s", s.name, s.memType)
+	}
+	it.sect, it.addr, it.scope = s, s.pc, a.scope
+	s.pc += size
+	a.next[fmt.Sprintf("%s:%d", s.memType, s.bank)] = s.pc
+	a.items = append(a.items, it)
+	return nil
+}
+
+func (a *assembler) layoutData(l line, args string, width int) error {
+	it := &item{src: l.src, width: width}
+	size := 0
+	for _, arg := range splitArgs(args) {
+		if width == 1 && strings.HasPrefix(arg, "\"") {
+			if len(arg) < 2 || !strings.HasSuffix(arg, "\"") {
+				return fmt.Errorf("unterminated string %s", arg)
+			}
+			str := arg[1 : len(arg)-1]
+			it.data, it.str = append(it.data, nil), append(it.str, str)
+			size += len(str)
+			continue
+		}
+		e, err := parseExpr(arg)
+		if err != nil {
+			return err
+		}
+		it.data, it.str = append(it.data, e), append(it.str, "")
+		size += width
+	}
+	if size == 0 {
+		return fmt.Errorf("expected values")
+	}
+	return a.place(it, size)
+}
+
+func (a *assembler) layoutSpace(l line, args string) error {
+	parts := splitArgs(args)
+	if len(parts) == 0 || len(parts) > 2 {
+		return fmt.Errorf("expected ds count[, fill]")
+	}
+	e, err := parseExpr(parts[0])
+	if err != nil {
+		return err
+	}
+	n, err := e(a)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return fmt.Errorf("negative size %d", n)
+	}
+	it := &item{src: l.src, count: n}
+	if len(parts) == 2 {
+		if it.fill, err = parseExpr(parts[1]); err != nil {
+			return err
+		}
+	}
+	return a.place(it, n)
+}
+
+// splitArgs splits the arguments separated by commas outside of strings and brackets
+func splitArgs(args string) []string {
+	var parts []string
+	depth, quoted, start := 0, false, 0
+	for i := 0; i < len(args); i++ {
+		switch c := args[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(args[start:i]))
+			start = i + 1
+		}
+	}
+	if rest := strings.TrimSpace(args[start:]); rest != "" || len(parts) > 0 {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+// emit encodes an item into its ROM bank (second pass)
+func (a *assembler) emit(it *item) error {
+	a.current = it
+	var out []uint8
+	switch {
+	case it.in != nil:
+		code, err := it.in.encode(a, uint16(it.addr))
+		if err != nil {
+			return err
+		}
+		out = code
+	case it.data != nil:
+		for i, e := range it.data {
+			if e == nil {
+				out = append(out, it.str[i]...)
+				continue
+			}
+			v, err := e(a)
+			if err != nil {
+				return err
+			}
+			if it.width == 1 && (v < -128 || v > 0xFF) || it.width == 2 && (v < -0x8000 || v > 0xFFFF) {
+				return fmt.Errorf("value $%X does not fit in %d bits", v, it.width*8)
+			}
+			out = append(out, uint8(v))
+			if it.width == 2 {
+				out = append(out, uint8(v>>8))
+			}
+		}
+	case it.sect.romBytes:
+		fill := int(cartridge.ROMPadding)
+		if it.fill != nil {
+			v, err := it.fill(a)
+			if err != nil {
+				return err
+			}
+			fill = v
+		}
+		out = make([]uint8, it.count)
+		for i := range out {
+			out[i] = uint8(fill)
+		}
+	default:
+		return nil // ds in RAM only reserves space
+	}
+
+	bank := a.bank(it.sect.bank)
+	base := memoryTypes[it.sect.memType].start
+	for i, v := range out {
+		off := it.addr - base + i
+		if a.written[it.sect.bank][off] {
+			return fmt.Errorf("section %q overlaps at %02X:%04X", it.sect.name, it.sect.bank, it.addr+i)
+		}
+		a.written[it.sect.bank][off] = true
+		bank[off] = v
+	}
+	return nil
+}
+
+// bank returns a ROM bank, adding the missing ones
+func (a *assembler) bank(n int) []uint8 {
+	for len(a.banks) <= n {
+		b := make([]uint8, cartridge.ROMBankSize)
+		for i := range b {
+			b[i] = cartridge.ROMPadding
+		}
+		a.banks = append(a.banks, b)
+		a.written = append(a.written, make([]bool, cartridge.ROMBankSize))
+	}
+	return a.banks[n]
+}
+
+// symbol implements env
+func (a *assembler) symbol(name string) (int, error) {
+	if s, ok := a.symbols[fullName(a.currentScope(), name)]; ok {
+		return s.value, nil
+	}
+	return 0, fmt.Errorf("undefined symbol %s", name)
+}
+
+// bankOf implements env
+func (a *assembler) bankOf(name string) (int, error) {
+	s, ok := a.symbols[fullName(a.currentScope(), name)]
+	if !ok || !s.isLabel {
+		return 0, fmt.Errorf("BANK of %s, which is not a label", name)
+	}
+	return s.bank, nil
+}
+
+// pc implements env. It is the address of the instruction or data being encoded, or the end
+// of the current section in the first pass
+func (a *assembler) pc() (int, error) {
+	if a.emitting {
+		return a.current.addr, nil
+	}
+	s := a.currentSection()
+	if s == nil {
+		return 0, fmt.Errorf("@ outside of a section")
+	}
+	return s.pc, nil
+}
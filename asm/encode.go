@@ -0,0 +1,185 @@
+package asm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/disasm"
+)
+
+// Operand kinds of the instruction patterns
+const (
+	operandNone = iota
+	operandN8   // 8 bits immediate
+	operandN16  // 16 bits immediate or address
+	operandHigh // FF00-FFFF address of LDH, encoded as its low byte
+	operandRel  // JR destination, encoded as an offset from the next instruction
+	operandS8   // signed offset of ADD SP and LD HL, SP+
+)
+
+// pattern is the normalized syntax of an instruction: prefix, operand and suffix
+type pattern struct {
+	prefix, suffix string
+	operand        int
+	opcode         []uint8
+}
+
+// size returns the number of bytes of the instruction
+func (p pattern) size() int {
+	switch p.operand {
+	case operandNone:
+		return len(p.opcode)
+	case operandN16:
+		return len(p.opcode) + 2
+	}
+	return len(p.opcode) + 1
+}
+
+var (
+	exactPatterns   = map[string][]uint8{} // instructions without operands, normalized
+	operandPatterns []pattern              // by decreasing length of the fixed text
+)
+
+// Placeholders that the decoder prints for operand bytes of 0xA5 at address 0, in the order
+// they are replaced
+var placeholders = []struct {
+	text    string
+	operand int
+}{
+	{"$A5A5", operandN16},
+	{"$FFA5", operandHigh},
+	{"$FFA7", operandRel}, // 0002 - 91
+	{"-91", operandS8},
+	{"$A5", operandN8},
+}
+
+// The patterns are built from the disassembler, so the assembler accepts its output
+func init() {
+	add := func(code []uint8) {
+		in := disasm.Decode(func(addr uint16) uint8 {
+			if int(addr) < len(code) {
+				return code[addr]
+			}
+			return 0xA5
+		}, 0)
+		if in.Flow == disasm.FlowInvalid {
+			return
+		}
+		text := strings.ToLower(normalize(in.String()))
+		for _, p := range placeholders {
+			if i := strings.Index(text, strings.ToLower(p.text)); i >= 0 {
+				operandPatterns = append(operandPatterns, pattern{text[:i], text[i+len(p.text):], p.operand, code})
+				return
+			}
+		}
+		exactPatterns[text] = code
+	}
+	for op := 0; op < 0x100; op++ {
+		if op != 0xCB && op != 0x10 {
+			add([]uint8{uint8(op)})
+		}
+	}
+	for op := 0; op < 0x100; op++ {
+		add([]uint8{0xCB, uint8(op)})
+	}
+	exactPatterns["stop"] = []uint8{0x10, 0x00}
+
+	sort.SliceStable(operandPatterns, func(i, j int) bool {
+		a, b := operandPatterns[i], operandPatterns[j]
+		return len(a.prefix)+len(a.suffix) > len(b.prefix)+len(b.suffix)
+	})
+}
+
+// instruction is a parsed instruction, encoded once the symbols are known
+type instruction struct {
+	pattern
+	arg expr
+}
+
+// normalize keeps one space after the mnemonic and removes the other spaces outside of
+// quotes, so RLCA and RLC A stay different
+func normalize(text string) string {
+	text = strings.TrimSpace(text)
+	i := strings.IndexAny(text, " \t")
+	if i < 0 {
+		return text
+	}
+	var b strings.Builder
+	b.WriteString(text[:i] + " ")
+	var quote uint8
+	for j := i; j < len(text); j++ {
+		c := text[j]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && (c == ' ' || c == '\t'):
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// parseInstruction matches the instruction with the patterns. Spaces and case are ignored,
+// except in the operand
+func parseInstruction(text string) (*instruction, error) {
+	compact := normalize(text)
+	if code, ok := exactPatterns[strings.ToLower(compact)]; ok {
+		return &instruction{pattern: pattern{opcode: code}}, nil
+	}
+	lower := strings.ToLower(compact)
+	for _, p := range operandPatterns {
+		if len(compact) <= len(p.prefix)+len(p.suffix) || !strings.HasPrefix(lower, p.prefix) || !strings.HasSuffix(lower, p.suffix) {
+			continue
+		}
+		arg, err := parseExpr(compact[len(p.prefix) : len(compact)-len(p.suffix)])
+		if err != nil {
+			continue
+		}
+		return &instruction{pattern: p, arg: arg}, nil
+	}
+	return nil, fmt.Errorf("invalid instruction %q", text)
+}
+
+// encode returns the bytes of the instruction at the address
+func (in *instruction) encode(e env, addr uint16) ([]uint8, error) {
+	code := append([]uint8(nil), in.opcode...)
+	if in.operand == operandNone {
+		return code, nil
+	}
+	v, err := in.arg(e)
+	if err != nil {
+		return nil, err
+	}
+
+	switch in.operand {
+	case operandN8:
+		if v < -128 || v > 0xFF {
+			return nil, fmt.Errorf("value $%X does not fit in 8 bits", v)
+		}
+	case operandN16:
+		if v < -0x8000 || v > 0xFFFF {
+			return nil, fmt.Errorf("value $%X does not fit in 16 bits", v)
+		}
+		return append(code, uint8(v), uint8(v>>8)), nil
+	case operandHigh:
+		if v >= 0xFF00 && v <= 0xFFFF {
+			v &= 0xFF
+		} else if v < 0 || v > 0xFF {
+			return nil, fmt.Errorf("address $%X is not in $FF00-$FFFF", v)
+		}
+	case operandRel:
+		v -= int(addr) + 2
+		if v < -128 || v > 127 {
+			return nil, fmt.Errorf("jump of %d bytes is out of range", v)
+		}
+	case operandS8:
+		if v < -128 || v > 127 {
+			return nil, fmt.Errorf("offset %d does not fit in 8 bits", v)
+		}
+	}
+	return append(code, uint8(v)), nil
+}
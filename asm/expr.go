@@ -0,0 +1,137 @@
+package asm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/exprparse"
+)
+
+// env resolves the symbols of an expression
+type env interface {
+	symbol(name string) (int, error)
+	bankOf(name string) (int, error)
+	pc() (int, error)
+}
+
+// expr is a parsed expression, evaluated once the symbols are known
+type expr func(e env) (int, error)
+
+// Functions of one argument. BANK takes a label instead
+var unaryFuncs = map[string]func(v int) int{
+	"high": func(v int) int { return v >> 8 & 0xFF },
+	"low":  func(v int) int { return v & 0xFF },
+}
+
+// parseExpr parses an expression with C operators, numbers ($FF, %1010, 0xFF or decimal),
+// characters ('A' or "A"), symbols, @ (the address of the current instruction), HIGH(), LOW() and
+// BANK(label)
+func parseExpr(src string) (expr, error) {
+	tp, err := exprparse.NewParser(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tp}
+	e, err := p.binary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Done(); err != nil {
+		return nil, fmt.Errorf("%v in %q", err, src)
+	}
+	return e, nil
+}
+
+type parser struct {
+	*exprparse.Parser
+}
+
+func (p *parser) binary() (expr, error) {
+	return exprparse.Binary(p.Parser, p.unary, binaryExpr)
+}
+
+func binaryExpr(op string, l, r expr) expr {
+	return func(e env) (int, error) {
+		a, err := l(e)
+		if err != nil {
+			return 0, err
+		}
+		b, err := r(e)
+		if err != nil {
+			return 0, err
+		}
+		return exprparse.Apply(op, a, b)
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	op := p.Peek()
+	if op != "!" && op != "~" && op != "-" && op != "+" {
+		return p.primary()
+	}
+	p.Pos++
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(e env) (int, error) {
+		v, err := operand(e)
+		switch op {
+		case "!":
+			return exprparse.BoolInt(v == 0), err
+		case "~":
+			return ^v, err
+		case "-":
+			return -v, err
+		}
+		return v, err
+	}, nil
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.Next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case t == "(":
+		inner, err := p.binary()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.Expect(")")
+	case t == "@":
+		return func(e env) (int, error) { return e.pc() }, nil
+	case t[0] == '\'' || t[0] == '"':
+		v := int(t[1])
+		return func(env) (int, error) { return v, nil }, nil
+	}
+
+	if v, ok := exprparse.ParseNumber(t); ok {
+		return func(env) (int, error) { return v, nil }, nil
+	}
+	if c := t[0]; c >= '0' && c <= '9' || c == '$' || c == '%' {
+		return nil, fmt.Errorf("invalid number %q", t)
+	}
+	if !exprparse.IsIdentChar(t[0]) {
+		return nil, fmt.Errorf("unexpected %q", t)
+	}
+
+	name := strings.ToLower(t)
+	if p.Peek() == "(" && (unaryFuncs[name] != nil || name == "bank") {
+		p.Pos++
+		if name == "bank" {
+			label := p.Next()
+			return func(e env) (int, error) { return e.bankOf(label) }, p.Expect(")")
+		}
+		arg, err := p.binary()
+		if err != nil {
+			return nil, err
+		}
+		f := unaryFuncs[name]
+		return func(e env) (int, error) {
+			v, err := arg(e)
+			return f(v), err
+		}, p.Expect(")")
+	}
+	return func(e env) (int, error) { return e.symbol(t) }, nil
+}
@@ -0,0 +1,138 @@
+package asm
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxMacroDepth limits the macros invoked by other macros, to stop recursive ones
+const maxMacroDepth = 64
+
+// source is the position of a line, for the error messages
+type source struct {
+	file string
+	line int
+}
+
+func (s source) String() string {
+	return fmt.Sprintf("%s:%d", s.file, s.line)
+}
+
+// line is a line of source without comments
+type line struct {
+	src  source
+	text string
+}
+
+type macro struct {
+	name string
+	body []string
+}
+
+// expander replaces the macro invocations by the macro bodies
+type expander struct {
+	macros map[string]*macro
+	unique int // \@ counter
+	out    []line
+}
+
+// expandMacros removes the comments and the macro definitions and expands the invocations.
+// Macros are defined with "MACRO name" (or "name: MACRO") and "ENDM", and take up to 9
+// arguments: \1 to \9. \@ is unique to each invocation and _NARG is the number of arguments
+func expandMacros(file, src string) ([]line, error) {
+	x := &expander{macros: map[string]*macro{}}
+	var current *macro
+	var start source
+	for i, text := range strings.Split(src, "\n") {
+		src := source{file, i + 1}
+		text = stripComment(strings.TrimRight(text, "\r"))
+		fields := strings.Fields(text)
+
+		if current != nil {
+			if len(fields) > 0 && strings.EqualFold(fields[0], "ENDM") {
+				x.macros[current.name] = current
+				current = nil
+				continue
+			}
+			current.body = append(current.body, text)
+			continue
+		}
+
+		switch {
+		case len(fields) == 2 && strings.EqualFold(fields[0], "MACRO"):
+			current, start = &macro{name: fields[1]}, src
+			continue
+		case len(fields) == 2 && strings.EqualFold(fields[1], "MACRO") && strings.HasSuffix(fields[0], ":"):
+			current, start = &macro{name: strings.TrimRight(fields[0], ":")}, src
+			continue
+		case len(fields) > 0 && strings.EqualFold(fields[0], "ENDM"):
+			return nil, fmt.Errorf("%s: ENDM without MACRO", src)
+		}
+		if err := x.expand(src, text, 0); err != nil {
+			return nil, err
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("%s: macro %s without ENDM", start, current.name)
+	}
+	return x.out, nil
+}
+
+// expand adds a line, expanding it if it invokes a macro
+func (x *expander) expand(src source, text string, depth int) error {
+	stmt := text
+	if label, rest, ok := splitLabel(text); ok {
+		x.out = append(x.out, line{src, label + ":"})
+		stmt = rest
+	}
+	fields := strings.Fields(stmt)
+	if len(fields) == 0 {
+		return nil
+	}
+	m, ok := x.macros[fields[0]]
+	if !ok {
+		x.out = append(x.out, line{src, stmt})
+		return nil
+	}
+	if depth >= maxMacroDepth {
+		return fmt.Errorf("%s: macros nested too deep in %s", src, m.name)
+	}
+
+	args := splitArgs(strings.TrimSpace(stmt[strings.Index(stmt, fields[0])+len(fields[0]):]))
+	if len(args) > 9 {
+		return fmt.Errorf("%s: macro %s takes up to 9 arguments", src, m.name)
+	}
+	x.unique++
+	replacements := []string{`\@`, fmt.Sprintf("_%d", x.unique), "_NARG", strconv.Itoa(len(args))}
+	for i := 1; i <= 9; i++ {
+		arg := ""
+		if i <= len(args) {
+			arg = args[i-1]
+		}
+		replacements = append(replacements, fmt.Sprintf(`\%d`, i), arg)
+	}
+	r := strings.NewReplacer(replacements...)
+	for _, body := range m.body {
+		if err := x.expand(src, r.Replace(body), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripComment removes the comment starting with ; outside of strings
+func stripComment(text string) string {
+	quoted := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				return text[:i]
+			}
+		}
+	}
+	return text
+}
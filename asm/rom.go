@@ -0,0 +1,29 @@
+package asm
+
+import (
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// Header are the cartridge header fields written by Build
+type Header = cartridge.HeaderFields
+
+// Build returns a cartridge with the program, padded to the ROM size with ROMPadding. Like
+// rgbfix, the logo, the header fields and both checksums are written over 0104-014F
+func (p *Program) Build(h Header) (*cartridge.Cartridge, error) {
+	banks := make([][]uint8, len(p.Banks))
+	for i, b := range p.Banks {
+		banks[i] = append([]uint8(nil), b...)
+	}
+	return cartridge.BuildCartridge(banks, h)
+}
+
+// BuildROM assembles a program and builds its cartridge
+func BuildROM(src string, h Header) (*cartridge.Cartridge, error) {
+	p, err := Assemble(strings.NewReader(src), h.Title)
+	if err != nil {
+		return nil, err
+	}
+	return p.Build(h)
+}
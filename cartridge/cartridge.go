@@ -3,6 +3,7 @@ package cartridge
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -11,7 +12,8 @@ import (
 type Cartridge struct {
 	Header   *CartridgeHeader
 	ROMBanks [][]uint8
-	RAMBanks [][]uint
+	RAMBanks [][]uint8
+	RTC      *RTC // MBC3 real time clock, nil if unknown or not present
 }
 
 // NewCartridge creates a pointer to a Cartridge struct
@@ -27,17 +29,7 @@ func NewCartridge(h *CartridgeHeader, rbs [][]uint8) *Cartridge {
 // the cartridge header at the address range 014E-014F. Actually, Game Boy does not validate this
 // checksum, therefore there might be games outthere that contain an invalid checksum.
 func (c *Cartridge) Validate() error {
-	nb := 0
-	var result uint16
-	result = 0
-	for _, bank := range c.ROMBanks {
-		for _, b := range bank {
-			if nb != 0x14E && nb != 0x14F {
-				result += uint16(b)
-			}
-			nb += 1
-		}
-	}
+	result := ComputeGlobalChecksum(c.Bytes())
 
 	b0 := uint8(result & 0xFF)
 	b1 := uint8((result & 0xFF00) >> 8)
@@ -51,6 +43,39 @@ func (c *Cartridge) Validate() error {
 	return nil
 }
 
+// ComputeGlobalChecksum adds all the bytes of the ROM image except the two global checksum bytes
+func ComputeGlobalChecksum(rom []uint8) uint16 {
+	var result uint16
+	for i, b := range rom {
+		if i != 0x14E && i != 0x14F {
+			result += uint16(b)
+		}
+	}
+	return result
+}
+
+// Bytes returns all the ROM banks concatenated, as they would be stored in a ROM file
+func (c *Cartridge) Bytes() []uint8 {
+	rom := make([]uint8, 0, len(c.ROMBanks)*ROMBankSize)
+	for _, bank := range c.ROMBanks {
+		rom = append(rom, bank...)
+	}
+	return rom
+}
+
+// Info returns the decoded header fields including the global checksum validity
+func (c *Cartridge) Info() *HeaderInfo {
+	info := c.Header.Info()
+	valid := c.Validate() == nil
+	info.GlobalChecksum.Valid = &valid
+	return info
+}
+
+// WriteInfo writes the cartridge information to w using the given format
+func (c *Cartridge) WriteInfo(w io.Writer, f InfoFormat) error {
+	return c.Info().Write(w, f)
+}
+
 // Save serializes the cartridge in a binary file storing all the ROM banks sequentially
 func (c *Cartridge) Save(fname string) error {
 	f, err := os.Create(fname)
@@ -0,0 +1,112 @@
+package cartridge
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Guillem96/gameboy-tools/gbproxy"
+)
+
+// ROM bank registers. MBC2 selects the bank with A8 set, MBC5 has a 9th bank bit at 3000
+const (
+	romBankAddr     = 0x2000
+	mbc2ROMBankAddr = 0x2100
+	mbc5ROMBankHigh = 0x3000
+)
+
+// Dumper reads the ROM of a cartridge through a GameBoyProxy, switching banks with the
+// controller declared in the header
+type Dumper struct {
+	l      *log.Logger
+	p      gbproxy.GameBoyProxy
+	header *CartridgeHeader
+}
+
+// NewDumper creates a dumper that reads the cartridge connected to the proxy
+func NewDumper(p gbproxy.GameBoyProxy) *Dumper {
+	return &Dumper{
+		p: p,
+		l: log.New(os.Stdout, "[GB Dumper]", log.LstdFlags),
+	}
+}
+
+// SetLogOutput changes where the dumper progress messages are written (stdout by default)
+func (d *Dumper) SetLogOutput(w io.Writer) {
+	d.l.SetOutput(w)
+}
+
+// ReadHeader reads the cartridge header from bank 0
+func (d *Dumper) ReadHeader() (*CartridgeHeader, error) {
+	if d.header != nil {
+		return d.header, nil
+	}
+
+	d.l.Println("Reading ROM header data.")
+	bytes := make([]uint8, 0x150)
+	for i := range bytes {
+		bytes[i] = readByte(d.p, uint(i))
+	}
+	h, err := ROMHeaderFromBytes(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("reading cartridge header: %v", err)
+	}
+	d.header = h
+	return h, nil
+}
+
+// ReadCartridge dumps all the ROM banks of the cartridge
+func (d *Dumper) ReadCartridge() (*Cartridge, error) {
+	h, err := d.ReadHeader()
+	if err != nil {
+		return nil, err
+	}
+	n := h.GetNumROMBanks()
+	if n == 0 {
+		return nil, fmt.Errorf("unknown ROM size code 0x%02x", h.ROMSize)
+	}
+	if h.HasMBC() && !h.IsMBC1() && !h.IsMBC2() && !h.IsMBC3() && !h.IsMBC5() {
+		return nil, fmt.Errorf("unsupported cartridge type: %v", h.CartridgeTypeText())
+	}
+
+	d.l.Printf("The cartridge has %d banks.\n", n)
+	banks := make([][]uint8, n)
+	for bank := range banks {
+		base := d.selectROMBank(bank)
+		banks[bank] = make([]uint8, ROMBankSize)
+		for i := range banks[bank] {
+			banks[bank][i] = readByte(d.p, base+uint(i))
+		}
+	}
+	if h.IsMBC1() {
+		writeRegister(d.p, bankingModeRAM, 0x00)
+	}
+	return NewCartridge(h, banks), nil
+}
+
+// selectROMBank maps the bank and returns the address where it can be read. MBC1 cannot map
+// banks 20, 40 and 60 at 4000, so they are read at 0000 in the advanced banking mode
+func (d *Dumper) selectROMBank(bank int) uint {
+	h := d.header
+	switch {
+	case bank == 0:
+		return 0x0000
+	case h.IsMBC1():
+		writeRegister(d.p, romBankAddr, uint8(bank&0x1F))
+		writeRegister(d.p, ramBankAddr, uint8(bank>>5&0x03))
+		if bank&0x1F == 0 {
+			writeRegister(d.p, bankingModeRAM, 0x01)
+			return 0x0000
+		}
+		writeRegister(d.p, bankingModeRAM, 0x00)
+	case h.IsMBC2():
+		writeRegister(d.p, mbc2ROMBankAddr, uint8(bank&0x0F))
+	case h.IsMBC3():
+		writeRegister(d.p, romBankAddr, uint8(bank&0x7F))
+	case h.IsMBC5():
+		writeRegister(d.p, romBankAddr, uint8(bank))
+		writeRegister(d.p, mbc5ROMBankHigh, uint8(bank>>8&0x01))
+	}
+	return 0x4000
+}
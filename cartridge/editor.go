@@ -0,0 +1,267 @@
+package cartridge
+
+import (
+	"fmt"
+)
+
+// Header field offsets inside bank 0
+const (
+	logoAddr             = 0x104
+	titleAddr            = 0x134
+	manufacturerCodeAddr = 0x13F
+	cgbFlagAddr          = 0x143
+	newLicenseeAddr      = 0x144
+	sgbFlagAddr          = 0x146
+	cartridgeTypeAddr    = 0x147
+	romSizeAddr          = 0x148
+	ramSizeAddr          = 0x149
+	destinationAddr      = 0x14A
+	oldLicenseeAddr      = 0x14B
+	versionAddr          = 0x14C
+	headerChecksumAddr   = 0x14D
+	globalChecksumAddr   = 0x14E
+)
+
+// ROMPadding is the value used to fill new ROM banks when a ROM is enlarged
+const ROMPadding uint8 = 0xFF
+
+// HeaderEditor modifies the header stored in the first ROM bank of a cartridge. Setters can be
+// chained, the first error found is reported by Apply, which also fixes both checksums and
+// reloads Cartridge.Header, similar to what rgbfix does
+type HeaderEditor struct {
+	c        *Cartridge
+	bank0    []uint8
+	banks    int
+	titleLen int
+	err      error
+}
+
+// EditHeader returns an editor for the cartridge header. Nothing is written to the cartridge
+// until Apply is called
+func (c *Cartridge) EditHeader() *HeaderEditor {
+	e := &HeaderEditor{c: c, banks: len(c.ROMBanks)}
+	if len(c.ROMBanks) == 0 || len(c.ROMBanks[0]) < HeaderEnd {
+		e.err = fmt.Errorf("cartridge has no header to edit")
+		return e
+	}
+	e.bank0 = append([]uint8(nil), c.ROMBanks[0]...)
+	return e
+}
+
+func (e *HeaderEditor) fail(format string, args ...interface{}) *HeaderEditor {
+	if e.err == nil {
+		e.err = fmt.Errorf(format, args...)
+	}
+	return e
+}
+
+func (e *HeaderEditor) set(addr int, value uint8) *HeaderEditor {
+	if e.err == nil {
+		e.bank0[addr] = value
+	}
+	return e
+}
+
+// SetTitle writes the title padding it with zeros. Titles are up to 16 characters long, 15 if
+// the CGB flag is set. Setting the title overwrites the manufacturer code, so set it afterwards
+func (e *HeaderEditor) SetTitle(title string) *HeaderEditor {
+	if e.err != nil {
+		return e
+	}
+
+	maxLen := cgbFlagAddr - titleAddr + 1
+	if e.bank0[cgbFlagAddr]&CGBEnhancedFlag != 0 {
+		maxLen--
+	}
+	if len(title) > maxLen {
+		return e.fail("title %q is longer than %d characters", title, maxLen)
+	}
+	e.titleLen = len(title)
+	for i := 0; i < maxLen; i++ {
+		var b uint8
+		if i < len(title) {
+			b = title[i]
+		}
+		e.bank0[titleAddr+i] = b
+	}
+	return e
+}
+
+// SetManufacturerCode writes the 4 character manufacturer code found on newer cartridges
+func (e *HeaderEditor) SetManufacturerCode(code string) *HeaderEditor {
+	if len(code) != 4 {
+		return e.fail("manufacturer code %q must be 4 characters long", code)
+	}
+	for i := 0; i < 4; i++ {
+		e.set(manufacturerCodeAddr+i, code[i])
+	}
+	return e
+}
+
+// SetCGBFlag writes the raw CGB flag. A CGB flag is stored in the last title character, so it
+// fails if the title written by SetTitle is 16 characters long
+func (e *HeaderEditor) SetCGBFlag(flag uint8) *HeaderEditor {
+	if flag&CGBEnhancedFlag != 0 && e.titleLen > cgbFlagAddr-titleAddr {
+		return e.fail("the CGB flag would overwrite the last character of a %d character title", e.titleLen)
+	}
+	return e.set(cgbFlagAddr, flag)
+}
+
+// SetCGBMode writes the CGB flag matching the given mode
+func (e *HeaderEditor) SetCGBMode(mode CGBMode) *HeaderEditor {
+	switch mode {
+	case CGBEnhanced:
+		return e.SetCGBFlag(CGBEnhancedFlag)
+	case CGBOnly:
+		return e.SetCGBFlag(CGBOnlyFlag)
+	}
+	return e.SetCGBFlag(0x00)
+}
+
+// SetSGB enables or disables the SGB functions. The SGB only honours this flag when the old
+// licensee code is 0x33 (see SetLicensee)
+func (e *HeaderEditor) SetSGB(enabled bool) *HeaderEditor {
+	if enabled {
+		return e.set(sgbFlagAddr, 0x03)
+	}
+	return e.set(sgbFlagAddr, 0x00)
+}
+
+// SetCartridgeType writes the cartridge type (MBC and hardware features)
+func (e *HeaderEditor) SetCartridgeType(cartType uint8) *HeaderEditor {
+	return e.set(cartridgeTypeAddr, cartType)
+}
+
+// SetROMSize writes the ROM size code. When Apply is called the ROM banks are padded with
+// ROMPadding or truncated to match the new size
+func (e *HeaderEditor) SetROMSize(size uint8) *HeaderEditor {
+	nb, ok := romBanks[size]
+	if !ok {
+		return e.fail("unknown ROM size code 0x%02x", size)
+	}
+	e.banks = nb
+	return e.set(romSizeAddr, size)
+}
+
+// SetRAMSize writes the RAM size code
+func (e *HeaderEditor) SetRAMSize(size uint8) *HeaderEditor {
+	if _, ok := ramSizes[size]; !ok {
+		return e.fail("unknown RAM size code 0x%02x", size)
+	}
+	return e.set(ramSizeAddr, size)
+}
+
+// SetDestination writes the destination code
+func (e *HeaderEditor) SetDestination(d Destination) *HeaderEditor {
+	return e.set(destinationAddr, uint8(d))
+}
+
+// SetLicensee writes a two character new licensee code and sets the old licensee code to 0x33
+func (e *HeaderEditor) SetLicensee(code string) *HeaderEditor {
+	if len(code) != 2 {
+		return e.fail("new licensee code %q must be 2 characters long", code)
+	}
+	e.set(newLicenseeAddr, code[0])
+	e.set(newLicenseeAddr+1, code[1])
+	return e.set(oldLicenseeAddr, UseNewLicensee)
+}
+
+// SetOldLicensee writes the old licensee code
+func (e *HeaderEditor) SetOldLicensee(code uint8) *HeaderEditor {
+	return e.set(oldLicenseeAddr, code)
+}
+
+// SetVersion writes the mask ROM version number
+func (e *HeaderEditor) SetVersion(version uint8) *HeaderEditor {
+	return e.set(versionAddr, version)
+}
+
+// FixLogo overwrites the logo with the genuine Nintendo logo
+func (e *HeaderEditor) FixLogo() *HeaderEditor {
+	if e.err == nil {
+		copy(e.bank0[logoAddr:], NintendoLogo[:])
+	}
+	return e
+}
+
+// Apply writes the edited header to the first ROM bank, resizes the ROM if needed and fixes
+// both checksums
+func (e *HeaderEditor) Apply() error {
+	if e.err != nil {
+		return e.err
+	}
+
+	banks := e.c.ROMBanks
+	if e.banks < len(banks) {
+		banks = banks[:e.banks]
+	}
+	for len(banks) < e.banks {
+		pad := make([]uint8, ROMBankSize)
+		for i := range pad {
+			pad[i] = ROMPadding
+		}
+		banks = append(banks, pad)
+	}
+	banks[0] = e.bank0
+	e.c.ROMBanks = banks
+
+	return e.c.FixChecksums()
+}
+
+// FixChecksums recomputes the header checksum (014D) and the global checksum (014E-014F) and
+// writes them to the first ROM bank. Cartridge.Header is reloaded afterwards
+func (c *Cartridge) FixChecksums() error {
+	if len(c.ROMBanks) == 0 || len(c.ROMBanks[0]) < HeaderEnd {
+		return fmt.Errorf("cartridge has no header to fix")
+	}
+
+	bank0 := c.ROMBanks[0]
+	h, err := ROMHeaderFromBytes(bank0)
+	if err != nil {
+		return err
+	}
+	bank0[headerChecksumAddr] = h.ComputeHeaderChecksum()
+
+	sum := ComputeGlobalChecksum(c.Bytes())
+	bank0[globalChecksumAddr] = uint8(sum >> 8)
+	bank0[globalChecksumAddr+1] = uint8(sum)
+
+	c.Header, err = ROMHeaderFromBytes(bank0)
+	return err
+}
+
+// HeaderFields are the header fields written by BuildCartridge
+type HeaderFields struct {
+	Title         string
+	CartridgeType uint8
+	ROMSize       uint8
+	RAMSize       uint8
+	CGBFlag       uint8
+}
+
+// BuildCartridge returns a cartridge with the given ROM banks, padded to the ROM size with
+// ROMPadding. Like rgbfix, the genuine logo, the header fields and both checksums are written
+// over 0104-014F
+func BuildCartridge(banks [][]uint8, h HeaderFields) (*Cartridge, error) {
+	declared, ok := romBanks[h.ROMSize]
+	if !ok {
+		return nil, fmt.Errorf("unknown ROM size code 0x%02x", h.ROMSize)
+	}
+	if len(banks) > declared {
+		return nil, fmt.Errorf("%d ROM banks do not fit in a ROM size of %d banks", len(banks), declared)
+	}
+
+	c := NewCartridge(nil, banks)
+	err := c.EditHeader().
+		SetCGBFlag(h.CGBFlag).
+		SetTitle(h.Title).
+		SetCartridgeType(h.CartridgeType).
+		SetROMSize(h.ROMSize).
+		SetRAMSize(h.RAMSize).
+		FixLogo().
+		Apply()
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
@@ -0,0 +1,40 @@
+package cartridge
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// Hashes holds the digests commonly used to identify ROM dumps, hex encoded in lowercase
+type Hashes struct {
+	CRC32  string `json:"crc32"`
+	MD5    string `json:"md5"`
+	SHA1   string `json:"sha1"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+// HashBytes computes the CRC32, MD5, SHA-1 and SHA-256 of the given data
+func HashBytes(data []uint8) Hashes {
+	crc := crc32.NewIEEE()
+	m := md5.New()
+	s1 := sha1.New()
+	s256 := sha256.New()
+	io.MultiWriter(crc, m, s1, s256).Write(data)
+
+	return Hashes{
+		CRC32:  fmt.Sprintf("%08x", crc.Sum32()),
+		MD5:    hex.EncodeToString(m.Sum(nil)),
+		SHA1:   hex.EncodeToString(s1.Sum(nil)),
+		SHA256: hex.EncodeToString(s256.Sum(nil)),
+	}
+}
+
+// Hashes returns the digests of the whole ROM, as it would be stored in a file
+func (c *Cartridge) Hashes() Hashes {
+	return HashBytes(c.Bytes())
+}
@@ -48,18 +48,73 @@ const (
 	ROM2MB   uint8 = 0x06
 	ROM4MB   uint8 = 0x07
 	ROM8MB   uint8 = 0x08
+	// Sizes only seen in a few unofficial documents, kept for completeness
+	ROM1_1MB uint8 = 0x52
+	ROM1_2MB uint8 = 0x53
+	ROM1_5MB uint8 = 0x54
+)
+
+// Bank sizes in bytes
+const (
+	ROMBankSize = 0x4000
+	RAMBankSize = 0x2000
+	MBC2RAMSize = 0x200
 )
 
 // RAM Sizes
 const (
 	None     uint8 = 0x00
-	Unused   uint8 = 0x01
+	Unused   uint8 = 0x01 // Never used by a licensed cartridge, some sources claim it means 2KB
+	RAM2KB   uint8 = Unused
 	RAM8KB   uint8 = 0x02
 	RAM32KB  uint8 = 0x03
 	RAM128KB uint8 = 0x04
 	RAM64KB  uint8 = 0x05
 )
 
+// CGB Flags (0143)
+const (
+	CGBEnhancedFlag uint8 = 0x80
+	CGBOnlyFlag     uint8 = 0xC0
+)
+
+// CGBMode tells how the cartridge behaves on a Game Boy Color
+type CGBMode uint8
+
+const (
+	DMGMode     CGBMode = iota // Monochrome game, no CGB features
+	CGBEnhanced                // Works on DMG but uses the CGB features when available
+	CGBOnly                    // Only runs on a Game Boy Color
+)
+
+func (m CGBMode) String() string {
+	switch m {
+	case CGBEnhanced:
+		return "CGB Enhanced"
+	case CGBOnly:
+		return "CGB Only"
+	}
+	return "DMG"
+}
+
+// Destination is the region where the cartridge was supposed to be sold (014A)
+type Destination uint8
+
+const (
+	Japanese Destination = 0x00
+	Overseas Destination = 0x01
+)
+
+func (d Destination) String() string {
+	switch d {
+	case Japanese:
+		return "Japanese"
+	case Overseas:
+		return "Overseas only"
+	}
+	return "Unknown"
+}
+
 // CartridgeHeader contains all the information stored in the GB cartridge header
 type CartridgeHeader struct {
 	rawBytes         []uint8
@@ -79,16 +134,24 @@ type CartridgeHeader struct {
 	GlobalChecksum   []uint8
 }
 
+// HeaderEnd is the first address after the cartridge header
+const HeaderEnd = 0x150
+
 // ROMHeaderFromBytes loads the given bytes into the CartridgeHeader structure and returns a
-// reference to the recently created structure
-func ROMHeaderFromBytes(bytes []uint8) *CartridgeHeader {
+// reference to the recently created structure. The bytes must contain at least the first 0x150
+// bytes of the ROM
+func ROMHeaderFromBytes(bytes []uint8) (*CartridgeHeader, error) {
+	if len(bytes) < HeaderEnd {
+		return nil, fmt.Errorf("header needs 0x%x bytes but only 0x%x were provided", HeaderEnd, len(bytes))
+	}
+
 	return &CartridgeHeader{
 		rawBytes:         bytes,
 		NintendoLogo:     bytes[0x104:0x134],
 		Title:            bytes[0x134:0x144],
 		ManufacturerCode: bytes[0x13F:0x143],
 		CGBFlag:          bytes[0x143],
-		LicenseeCode:     bytes[0x144:0x145],
+		LicenseeCode:     bytes[0x144:0x146],
 		SGBFlag:          bytes[0x146],
 		CartridgeType:    bytes[0x147],
 		ROMSize:          bytes[0x148],
@@ -98,28 +161,28 @@ func ROMHeaderFromBytes(bytes []uint8) *CartridgeHeader {
 		MaskROMVersion:   bytes[0x14C],
 		HeaderChecksum:   bytes[0x14D],
 		GlobalChecksum:   bytes[0x14E:0x150],
-	}
+	}, nil
 }
 
-func (ch *CartridgeHeader) PrintInfo() {
-	fmt.Println("*** Cartridge Header ***")
-	fmt.Println("Title:", string(ch.Title))
-	fmt.Printf("Header Checksum: 0x%02x\n", ch.HeaderChecksum)
-	fmt.Printf("Global Checksum: 0x%02x 0x%02x\n", ch.GlobalChecksum[0], ch.GlobalChecksum[1])
-	fmt.Println("Cartridge Type:", ch.CartridgeTypeText())
-	fmt.Print("Supports SGB: ")
-	if ch.SupportsSGB() {
-		fmt.Println("YES")
-	} else {
-		fmt.Println("NO")
+// CGBMode decodes the CGB flag. Bit 7 enables the CGB features and bit 6 tells that the game
+// does not work on monochrome systems
+func (ch *CartridgeHeader) CGBMode() CGBMode {
+	if ch.CGBFlag&CGBOnlyFlag == CGBOnlyFlag {
+		return CGBOnly
+	} else if ch.CGBFlag&CGBEnhancedFlag == CGBEnhancedFlag {
+		return CGBEnhanced
 	}
-	fmt.Println("# ROM Banks:", ch.GetNumROMBanks())
-	fmt.Println("# RAM Banks:", ch.GetNumRAMBanks())
+	return DMGMode
 }
 
 // IsGBCOnly returns true if the cartridge can only run in a GameBoy color
 func (ch *CartridgeHeader) IsGBCOnly() bool {
-	return ch.CGBFlag == 0xC0
+	return ch.CGBMode() == CGBOnly
+}
+
+// SupportsGBC returns true if the cartridge uses the GameBoy color features (either CGB only or enhanced)
+func (ch *CartridgeHeader) SupportsGBC() bool {
+	return ch.CGBMode() != DMGMode
 }
 
 // SupportsSGB returns true if the cartridge supports Super GameBoy
@@ -148,6 +211,11 @@ func (ch *CartridgeHeader) IsMBC3() bool {
 		ch.CartridgeType == MBC3TimerBattery || ch.CartridgeType == MBC3TimerRAMBattery
 }
 
+// HasTimer returns true if the cartridge has a MBC3 real time clock
+func (ch *CartridgeHeader) HasTimer() bool {
+	return ch.CartridgeType == MBC3TimerBattery || ch.CartridgeType == MBC3TimerRAMBattery
+}
+
 // IsMBC5 returns true if the cartridge is MBC5 type
 func (ch *CartridgeHeader) IsMBC5() bool {
 	return ch.CartridgeType == MBC5 || ch.CartridgeType == MBC5RAM || ch.CartridgeType == MBC5RAMBattery ||
@@ -167,7 +235,8 @@ func (ch *CartridgeHeader) HasRAM() bool {
 		ch.CartridgeType == ROMRAMBattery || ch.CartridgeType == MMM01RAM || ch.CartridgeType == MMM01RAMBattery ||
 		ch.CartridgeType == MBC3RAMBattery || ch.CartridgeType == MBC3RAM || ch.CartridgeType == MBC5RumbleRAMBattery ||
 		ch.CartridgeType == MBC7SensorRumbleRAMBattery || ch.CartridgeType == HuC1RAMBattery ||
-		ch.CartridgeType == MBC5RAMBattery || ch.CartridgeType == MBC5RumbleRAM
+		ch.CartridgeType == MBC5RAMBattery || ch.CartridgeType == MBC5RumbleRAM || ch.CartridgeType == MBC5RAM ||
+		ch.CartridgeType == MBC3TimerRAMBattery || ch.CartridgeType == PocketCamera || ch.CartridgeType == HuC3
 }
 
 func (ch *CartridgeHeader) CartridgeTypeText() string {
@@ -199,36 +268,108 @@ func (ch *CartridgeHeader) CartridgeTypeText() string {
 	return msg
 }
 
+var romBanks = map[uint8]int{
+	ROM32KB:  2,
+	ROM64KB:  4,
+	ROM128KB: 8,
+	ROM256KB: 16,
+	ROM512KB: 32,
+	ROM1MB:   64,
+	ROM2MB:   128,
+	ROM4MB:   256,
+	ROM8MB:   512,
+	ROM1_1MB: 72,
+	ROM1_2MB: 80,
+	ROM1_5MB: 96,
+}
+
+var ramSizes = map[uint8]int{
+	None:     0,
+	RAM2KB:   0x800,
+	RAM8KB:   RAMBankSize,
+	RAM32KB:  4 * RAMBankSize,
+	RAM64KB:  8 * RAMBankSize,
+	RAM128KB: 16 * RAMBankSize,
+}
+
+// IsKnownROMSize returns true if the ROM size code is one of the documented ones
+func (ch *CartridgeHeader) IsKnownROMSize() bool {
+	_, ok := romBanks[ch.ROMSize]
+	return ok
+}
+
+// IsKnownRAMSize returns true if the RAM size code is one of the documented ones
+func (ch *CartridgeHeader) IsKnownRAMSize() bool {
+	_, ok := ramSizes[ch.RAMSize]
+	return ok
+}
+
 // GetNumROMBanks returns the number of ROM banks in the cartridge
 func (ch *CartridgeHeader) GetNumROMBanks() int {
-	return map[uint8]int{
-		ROM32KB:  2,
-		ROM64KB:  4,
-		ROM128KB: 8,
-		ROM256KB: 16,
-		ROM512KB: 32,
-		ROM1MB:   64,
-		ROM2MB:   128,
-		ROM4MB:   256,
-		ROM8MB:   512,
-	}[ch.ROMSize]
-}
-
-// GetNumRAMBanks returns the number of RAM banks in the cartridge
+	return romBanks[ch.ROMSize]
+}
+
+// ROMSizeBytes returns the ROM size declared in the header in bytes
+func (ch *CartridgeHeader) ROMSizeBytes() int {
+	return ch.GetNumROMBanks() * ROMBankSize
+}
+
+// GetNumRAMBanks returns the number of RAM banks in the cartridge. A 2KB RAM is reported as one
+// (partially used) bank
 func (ch *CartridgeHeader) GetNumRAMBanks() int {
-	return map[uint8]int{
-		None:     0,
-		Unused:   0,
-		RAM8KB:   1,
-		RAM32KB:  4,
-		RAM64KB:  8,
-		RAM128KB: 16,
-	}[ch.RAMSize]
+	return (ch.RAMSizeBytes() + RAMBankSize - 1) / RAMBankSize
+}
+
+// RAMSizeBytes returns the external RAM size declared in the header in bytes
+func (ch *CartridgeHeader) RAMSizeBytes() int {
+	return ramSizes[ch.RAMSize]
+}
+
+// SaveSizeBytes returns the size of the battery backed save. It matches RAMSizeBytes except for
+// MBC2 cartridges, which have 512 half bytes of built-in RAM stored as 512 bytes
+func (ch *CartridgeHeader) SaveSizeBytes() int {
+	if ch.IsMBC2() {
+		return MBC2RAMSize
+	}
+	return ch.RAMSizeBytes()
+}
+
+// Licensee returns the publisher of the game. If the old licensee code is 0x33 the two
+// character new licensee code is used
+func (ch *CartridgeHeader) Licensee() Licensee {
+	if ch.OldLicenseeCode == UseNewLicensee {
+		code := string(ch.LicenseeCode)
+		return Licensee{Code: code, Name: NewLicenseeName(code)}
+	}
+	return Licensee{
+		Code: fmt.Sprintf("%02X", ch.OldLicenseeCode),
+		Name: OldLicenseeName(ch.OldLicenseeCode),
+	}
+}
+
+// Destination returns whether the game is meant to be sold in Japan or overseas
+func (ch *CartridgeHeader) Destination() Destination {
+	return Destination(ch.DestinationCode)
+}
+
+// Version returns the mask ROM version number of the game, usually 0
+func (ch *CartridgeHeader) Version() int {
+	return int(ch.MaskROMVersion)
 }
 
 // Validate runs the checksum procedure and compares te result agains the byte located at
 // 0x14D. If the result matches with the predefined checksum means that the dump has been successful
 func (ch *CartridgeHeader) Validate() error {
+	valid := ch.ComputeHeaderChecksum() == ch.HeaderChecksum
+	if !valid {
+		return errors.New("invalid header checksum")
+	} else {
+		return nil
+	}
+}
+
+// ComputeHeaderChecksum computes the checksum of the header bytes 0134-014C as done by the boot ROM
+func (ch *CartridgeHeader) ComputeHeaderChecksum() uint8 {
 	var x uint
 	x = 0x00
 
@@ -236,11 +377,9 @@ func (ch *CartridgeHeader) Validate() error {
 		x = x - uint(ch.rawBytes[i]) - 1
 		x = x & 0xFF
 	}
+	return uint8(x)
+}
 
-	valid := uint8(x) == ch.HeaderChecksum
-	if !valid {
-		return errors.New("invalid header checksum")
-	} else {
-		return nil
-	}
+func (ch *CartridgeHeader) globalChecksumValue() uint16 {
+	return uint16(ch.GlobalChecksum[0])<<8 | uint16(ch.GlobalChecksum[1])
 }
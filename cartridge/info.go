@@ -0,0 +1,188 @@
+package cartridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// InfoFormat selects how the cartridge information is rendered by WriteInfo
+type InfoFormat string
+
+const (
+	FormatText InfoFormat = "text"
+	FormatJSON InfoFormat = "json"
+	FormatYAML InfoFormat = "yaml"
+)
+
+// ParseInfoFormat converts a user provided string (ie. a command line flag) into an InfoFormat
+func ParseInfoFormat(s string) (InfoFormat, error) {
+	switch f := InfoFormat(strings.ToLower(s)); f {
+	case FormatText, FormatJSON, FormatYAML:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown output format %q (expected text, json or yaml)", s)
+}
+
+// ChecksumInfo holds a checksum value stored in the header alongside its validity. Valid is nil
+// when the validity cannot be computed (ie. the global checksum when only the header is available)
+type ChecksumInfo struct {
+	Value uint16 `json:"value" yaml:"value"`
+	Valid *bool  `json:"valid,omitempty" yaml:"valid,omitempty"`
+}
+
+// HeaderInfo is the decoded, machine readable version of the CartridgeHeader
+type HeaderInfo struct {
+	Title            string       `json:"title" yaml:"title"`
+	ManufacturerCode string       `json:"manufacturer_code" yaml:"manufacturer_code"`
+	CGBFlag          uint8        `json:"cgb_flag" yaml:"cgb_flag"`
+	CGBMode          string       `json:"cgb_mode" yaml:"cgb_mode"`
+	CGBOnly          bool         `json:"cgb_only" yaml:"cgb_only"`
+	SGB              bool         `json:"sgb" yaml:"sgb"`
+	CartridgeType    uint8        `json:"cartridge_type" yaml:"cartridge_type"`
+	CartridgeTypeTxt string       `json:"cartridge_type_name" yaml:"cartridge_type_name"`
+	ROMBanks         int          `json:"rom_banks" yaml:"rom_banks"`
+	ROMSize          int          `json:"rom_size" yaml:"rom_size"`
+	RAMBanks         int          `json:"ram_banks" yaml:"ram_banks"`
+	RAMSize          int          `json:"ram_size" yaml:"ram_size"`
+	LicenseeCode     string       `json:"licensee_code" yaml:"licensee_code"`
+	Licensee         string       `json:"licensee" yaml:"licensee"`
+	Destination      string       `json:"destination" yaml:"destination"`
+	Version          uint8        `json:"version" yaml:"version"`
+	HeaderChecksum   ChecksumInfo `json:"header_checksum" yaml:"header_checksum"`
+	GlobalChecksum   ChecksumInfo `json:"global_checksum" yaml:"global_checksum"`
+}
+
+// TitleText returns the cartridge title without the NUL padding. On CGB cartridges the last
+// title byte is the CGB flag, so it is left out
+func (ch *CartridgeHeader) TitleText() string {
+	title := ch.Title
+	if ch.SupportsGBC() {
+		title = title[:len(title)-1]
+	}
+	if i := strings.IndexByte(string(title), 0x00); i >= 0 {
+		title = title[:i]
+	}
+	return strings.TrimRight(string(title), " ")
+}
+
+// Identifier returns a string identifying the game: the title plus the global checksum
+// (ie. "TETRIS-BF16")
+func (ch *CartridgeHeader) Identifier() string {
+	return fmt.Sprintf("%s-%04X", ch.TitleText(), ch.globalChecksumValue())
+}
+
+// ManufacturerCodeText returns the 4 character manufacturer code. Older cartridges use this area
+// for the title, in that case an empty string is returned
+func (ch *CartridgeHeader) ManufacturerCodeText() string {
+	for _, b := range ch.ManufacturerCode {
+		if (b < 'A' || b > 'Z') && (b < '0' || b > '9') {
+			return ""
+		}
+	}
+	return string(ch.ManufacturerCode)
+}
+
+// Info returns the decoded header fields. The global checksum validity is left empty because
+// it can only be computed with the whole cartridge (see Cartridge.Info)
+func (ch *CartridgeHeader) Info() *HeaderInfo {
+	headerValid := ch.Validate() == nil
+	licensee := ch.Licensee()
+	return &HeaderInfo{
+		Title:            ch.TitleText(),
+		ManufacturerCode: ch.ManufacturerCodeText(),
+		CGBFlag:          ch.CGBFlag,
+		CGBMode:          ch.CGBMode().String(),
+		CGBOnly:          ch.IsGBCOnly(),
+		SGB:              ch.SupportsSGB(),
+		CartridgeType:    ch.CartridgeType,
+		CartridgeTypeTxt: ch.CartridgeTypeText(),
+		ROMBanks:         ch.GetNumROMBanks(),
+		ROMSize:          ch.ROMSizeBytes(),
+		RAMBanks:         ch.GetNumRAMBanks(),
+		RAMSize:          ch.RAMSizeBytes(),
+		LicenseeCode:     licensee.Code,
+		Licensee:         licensee.Name,
+		Destination:      ch.Destination().String(),
+		Version:          ch.MaskROMVersion,
+		HeaderChecksum:   ChecksumInfo{Value: uint16(ch.HeaderChecksum), Valid: &headerValid},
+		GlobalChecksum:   ChecksumInfo{Value: ch.globalChecksumValue()},
+	}
+}
+
+// WriteInfo writes the header information to w using the given format
+func (ch *CartridgeHeader) WriteInfo(w io.Writer, f InfoFormat) error {
+	return ch.Info().Write(w, f)
+}
+
+// PrintInfo prints the header information to the standard output in a human readable format
+func (ch *CartridgeHeader) PrintInfo() {
+	if err := ch.WriteInfo(os.Stdout, FormatText); err != nil {
+		fmt.Println("Error printing cartridge info:", err)
+	}
+}
+
+// Write renders the header information to w using the given format
+func (hi *HeaderInfo) Write(w io.Writer, f InfoFormat) error {
+	switch f {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(hi)
+	case FormatYAML:
+		out, err := yaml.Marshal(hi)
+		if err != nil {
+			return fmt.Errorf("encoding header as yaml: %v", err)
+		}
+		_, err = w.Write(out)
+		return err
+	case FormatText:
+		return hi.writeText(w)
+	}
+	return fmt.Errorf("unknown output format %q", f)
+}
+
+func (hi *HeaderInfo) writeText(w io.Writer) error {
+	lines := []string{
+		"*** Cartridge Header ***",
+		fmt.Sprintf("Title: %s", hi.Title),
+		fmt.Sprintf("Manufacturer Code: %s", hi.ManufacturerCode),
+		fmt.Sprintf("Header Checksum: 0x%02x%s", hi.HeaderChecksum.Value, validText(hi.HeaderChecksum.Valid)),
+		fmt.Sprintf("Global Checksum: 0x%04x%s", hi.GlobalChecksum.Value, validText(hi.GlobalChecksum.Valid)),
+		fmt.Sprintf("Cartridge Type: %s", hi.CartridgeTypeTxt),
+		fmt.Sprintf("CGB Mode: %s (0x%02x)", hi.CGBMode, hi.CGBFlag),
+		fmt.Sprintf("Supports SGB: %s", yesNo(hi.SGB)),
+		fmt.Sprintf("# ROM Banks: %d (%d bytes)", hi.ROMBanks, hi.ROMSize),
+		fmt.Sprintf("# RAM Banks: %d (%d bytes)", hi.RAMBanks, hi.RAMSize),
+		fmt.Sprintf("Licensee: %s (%s)", hi.Licensee, hi.LicenseeCode),
+		fmt.Sprintf("Destination: %s", hi.Destination),
+		fmt.Sprintf("Version: %d", hi.Version),
+	}
+	for _, l := range lines {
+		if _, err := fmt.Fprintln(w, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validText(valid *bool) string {
+	if valid == nil {
+		return ""
+	}
+	if *valid {
+		return " (OK)"
+	}
+	return " (INVALID)"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "YES"
+	}
+	return "NO"
+}
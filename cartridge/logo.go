@@ -0,0 +1,218 @@
+package cartridge
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Reference: https://gbdev.io/pandocs/The_Cartridge_Header.html#0104-0133--nintendo-logo
+
+// Size of the logo bitmap scrolled by the boot ROM
+const (
+	LogoWidth  = 48
+	LogoHeight = 8
+)
+
+// LogoBitmap is the logo bitmap by rows, true for the dark pixels
+type LogoBitmap [LogoHeight][LogoWidth]bool
+
+// logoPixel returns the pixel of a logo bit. Each byte holds two rows of a 4x4 block, high
+// nibble first. The first 24 bytes are the 12 blocks of the top half and the rest the bottom half
+func logoPixel(offset int, bit uint) (x, y int) {
+	half, i := offset/(len(NintendoLogo)/2), offset%(len(NintendoLogo)/2)
+	x = i/2*4 + int(3-bit%4)
+	y = half*4 + i%2*2
+	if bit < 4 {
+		y++
+	}
+	return x, y
+}
+
+// DecodeLogo decodes the 48 logo bytes of the header into the bitmap shown by the boot ROM.
+// Missing bytes are blank
+func DecodeLogo(data []uint8) LogoBitmap {
+	var b LogoBitmap
+	for offset := 0; offset < len(data) && offset < len(NintendoLogo); offset++ {
+		for bit := uint(0); bit < 8; bit++ {
+			x, y := logoPixel(offset, bit)
+			b[y][x] = data[offset]>>bit&1 == 1
+		}
+	}
+	return b
+}
+
+// Encode returns the 48 logo bytes of the bitmap
+func (b LogoBitmap) Encode() []uint8 {
+	data := make([]uint8, len(NintendoLogo))
+	for offset := range data {
+		for bit := uint(0); bit < 8; bit++ {
+			if x, y := logoPixel(offset, bit); b[y][x] {
+				data[offset] |= 1 << bit
+			}
+		}
+	}
+	return data
+}
+
+// LogoBit is a logo bit that differs from the genuine logo
+type LogoBit struct {
+	Offset int  // byte of the logo, 0-47 (address 0104 + Offset)
+	Bit    uint // bit of the byte, which is also the data line D0-D7 it was read through
+	X, Y   int  // pixel of the bitmap
+	Set    bool // the bit is 1 and should be 0
+}
+
+func (lb LogoBit) String() string {
+	return fmt.Sprintf("$%04X bit %d (%d,%d) reads %d", 0x104+lb.Offset, lb.Bit, lb.X, lb.Y, boolBit(lb.Set))
+}
+
+func boolBit(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// CompareLogo returns the bits of the logo bytes that differ from the genuine logo, in logo
+// order. Missing bytes are compared as 0
+func CompareLogo(data []uint8) []LogoBit {
+	var diffs []LogoBit
+	for offset, want := range NintendoLogo {
+		var got uint8
+		if offset < len(data) {
+			got = data[offset]
+		}
+		for bit := uint(8); bit > 0; bit-- {
+			if mask := uint8(1) << (bit - 1); got&mask != want&mask {
+				x, y := logoPixel(offset, bit-1)
+				diffs = append(diffs, LogoBit{offset, bit - 1, x, y, got&mask != 0})
+			}
+		}
+	}
+	return diffs
+}
+
+// LogoDiff returns the bits of the header logo that differ from the genuine logo
+func (ch *CartridgeHeader) LogoDiff() []LogoBit {
+	return CompareLogo(ch.NintendoLogo)
+}
+
+// LogoDataLine counts the wrong bits read through a data line
+type LogoDataLine struct {
+	Line    uint
+	Set     int // bits read as 1 that should be 0
+	Cleared int // bits read as 0 that should be 1
+}
+
+// LogoDataLines groups the wrong bits by data line, returning only the lines with errors
+func LogoDataLines(diffs []LogoBit) []LogoDataLine {
+	var lines [8]LogoDataLine
+	for _, d := range diffs {
+		lines[d.Bit].Line = d.Bit
+		if d.Set {
+			lines[d.Bit].Set++
+		} else {
+			lines[d.Bit].Cleared++
+		}
+	}
+	var out []LogoDataLine
+	for _, l := range lines {
+		if l.Set+l.Cleared > 0 {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// Stuck returns true if the line reads always 0 or always 1, as happens when it is not
+// connected: every genuine bit of the other value is wrong
+func (l LogoDataLine) Stuck() bool {
+	ones := 0
+	for _, b := range NintendoLogo {
+		ones += int(b >> l.Line & 1)
+	}
+	return l.Set == 0 && l.Cleared == ones || l.Cleared == 0 && l.Set == len(NintendoLogo)-ones
+}
+
+func (l LogoDataLine) String() string {
+	s := fmt.Sprintf("D%d: %d bits read as 1, %d bits read as 0", l.Line, l.Set, l.Cleared)
+	if l.Stuck() {
+		s += fmt.Sprintf(" (stuck at %d)", boolBit(l.Set > 0))
+	}
+	return s
+}
+
+// Characters of the ASCII logo
+const (
+	logoDark    = '#'
+	logoLight   = '.'
+	logoExtra   = '+' // dark pixel that should be light
+	logoMissing = '-' // light pixel that should be dark
+)
+
+// Colors of the logo image: light and dark pixels, and the wrong ones
+var logoPalette = color.Palette{
+	color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+	color.RGBA{0x00, 0x00, 0x00, 0xFF},
+	color.RGBA{0xE0, 0x20, 0x20, 0xFF},
+	color.RGBA{0x40, 0x80, 0xF0, 0xFF},
+}
+
+// logoColors returns the palette index of each pixel: light, dark, extra or missing
+func logoColors(data []uint8) [LogoHeight][LogoWidth]uint8 {
+	var px [LogoHeight][LogoWidth]uint8
+	got, want := DecodeLogo(data), DecodeLogo(NintendoLogo[:])
+	for y := range px {
+		for x := range px[y] {
+			switch {
+			case got[y][x] && !want[y][x]:
+				px[y][x] = 2
+			case !got[y][x] && want[y][x]:
+				px[y][x] = 3
+			case got[y][x]:
+				px[y][x] = 1
+			}
+		}
+	}
+	return px
+}
+
+// LogoASCII draws the logo with # for dark pixels and . for light ones. Pixels that differ from
+// the genuine logo are drawn as + (dark) and - (light)
+func LogoASCII(data []uint8) string {
+	chars := []byte{logoLight, logoDark, logoExtra, logoMissing}
+	var sb strings.Builder
+	for _, row := range logoColors(data) {
+		for _, c := range row {
+			sb.WriteByte(chars[c])
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// LogoImage draws the logo scaled by the given factor. Pixels that differ from the genuine logo
+// are drawn in red (dark) and blue (light)
+func LogoImage(data []uint8, scale int) *image.Paletted {
+	if scale < 1 {
+		scale = 1
+	}
+	img := image.NewPaletted(image.Rect(0, 0, LogoWidth*scale, LogoHeight*scale), logoPalette)
+	for y, row := range logoColors(data) {
+		for x, c := range row {
+			for i := 0; i < scale*scale; i++ {
+				img.SetColorIndex(x*scale+i%scale, y*scale+i/scale, c)
+			}
+		}
+	}
+	return img
+}
+
+// WriteLogoPNG writes the logo image as PNG
+func WriteLogoPNG(w io.Writer, data []uint8, scale int) error {
+	return png.Encode(w, LogoImage(data, scale))
+}
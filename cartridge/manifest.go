@@ -0,0 +1,145 @@
+package cartridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// ManifestVersion is the version of the manifest file format
+const ManifestVersion = 1
+
+// DumpInfo describes how a cartridge was dumped
+type DumpInfo struct {
+	Backend     string `json:"backend,omitempty"`      // ie. "rpi" or "file"
+	Timing      string `json:"timing,omitempty"`       // ie. the wait time between pin changes
+	MappingFile string `json:"mapping_file,omitempty"` // Pin mapping used by the backend
+}
+
+// BankHashes holds the hashes of a single ROM bank
+type BankHashes struct {
+	Bank  int    `json:"bank"`
+	CRC32 string `json:"crc32"`
+	MD5   string `json:"md5"`
+	SHA1  string `json:"sha1"`
+}
+
+// SaveInfo describes the battery backed RAM contents at dump time
+type SaveInfo struct {
+	Size   int    `json:"size"`
+	Hashes Hashes `json:"hashes"`
+}
+
+// Manifest is a sidecar file describing a dump so it can be audited and re-checked later
+type Manifest struct {
+	Version   int          `json:"version"`
+	CreatedAt time.Time    `json:"created_at"`
+	Size      int          `json:"size"`
+	Hashes    Hashes       `json:"hashes"`
+	Banks     []BankHashes `json:"banks"`
+	Header    *HeaderInfo  `json:"header"`
+	Save      *SaveInfo    `json:"save,omitempty"`
+	RTC       *RTC         `json:"rtc,omitempty"`
+	Dump      DumpInfo     `json:"dump"`
+}
+
+// Manifest hashes the cartridge contents and returns the manifest describing them
+func (c *Cartridge) Manifest(d DumpInfo) *Manifest {
+	rom := c.Bytes()
+	m := &Manifest{
+		Version:   ManifestVersion,
+		CreatedAt: time.Now().UTC(),
+		Size:      len(rom),
+		Hashes:    HashBytes(rom),
+		Header:    c.Info(),
+		RTC:       c.RTC,
+		Dump:      d,
+	}
+
+	for i, bank := range c.ROMBanks {
+		h := HashBytes(bank)
+		m.Banks = append(m.Banks, BankHashes{Bank: i, CRC32: h.CRC32, MD5: h.MD5, SHA1: h.SHA1})
+	}
+
+	if ram := c.RAM(); len(ram) > 0 {
+		m.Save = &SaveInfo{Size: len(ram), Hashes: HashBytes(ram)}
+	}
+	return m
+}
+
+// ManifestPath returns the sidecar manifest file name for a ROM file
+func ManifestPath(romFile string) string {
+	return romFile + ".manifest.json"
+}
+
+// Write encodes the manifest as indented JSON
+func (m *Manifest) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(m)
+}
+
+// WriteFile stores the manifest in fname
+func (m *Manifest) WriteFile(fname string) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return fmt.Errorf("creating manifest %v: %v", fname, err)
+	}
+	defer f.Close()
+
+	if err := m.Write(f); err != nil {
+		return fmt.Errorf("writing manifest %v: %v", fname, err)
+	}
+	return nil
+}
+
+// ReadManifest loads a manifest previously stored with WriteFile
+func ReadManifest(fname string) (*Manifest, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest: %v", err)
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("parsing manifest %v: %v", fname, err)
+	}
+	if m.Version > ManifestVersion {
+		return nil, fmt.Errorf("manifest %v has version %d, only up to %d is supported", fname, m.Version, ManifestVersion)
+	}
+	return m, nil
+}
+
+// Check compares the cartridge contents against the manifest and returns a description of
+// every difference found (ie. banks affected by bit rot). No differences means the contents
+// are the same as when the manifest was created
+func (m *Manifest) Check(c *Cartridge) []string {
+	var problems []string
+	rom := c.Bytes()
+	if len(rom) != m.Size {
+		problems = append(problems, fmt.Sprintf("ROM is %v but the manifest says %v", formatSize(len(rom)), formatSize(m.Size)))
+	}
+	if h := HashBytes(rom); h.SHA1 != m.Hashes.SHA1 {
+		problems = append(problems, fmt.Sprintf("ROM SHA-1 is %s but the manifest says %s", h.SHA1, m.Hashes.SHA1))
+	}
+
+	for _, b := range m.Banks {
+		if b.Bank >= len(c.ROMBanks) {
+			problems = append(problems, fmt.Sprintf("bank %d is missing", b.Bank))
+			continue
+		}
+		if h := HashBytes(c.ROMBanks[b.Bank]); h.SHA1 != b.SHA1 {
+			problems = append(problems, fmt.Sprintf("bank %d SHA-1 is %s but the manifest says %s", b.Bank, h.SHA1, b.SHA1))
+		}
+	}
+
+	if m.Save != nil && len(c.RAMBanks) > 0 {
+		if h := HashBytes(c.RAM()); h.SHA1 != m.Save.Hashes.SHA1 {
+			problems = append(problems, fmt.Sprintf("save SHA-1 is %s but the manifest says %s", h.SHA1, m.Save.Hashes.SHA1))
+		}
+	}
+	return problems
+}
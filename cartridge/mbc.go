@@ -0,0 +1,349 @@
+package cartridge
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Reference: https://gbdev.io/pandocs/MBCs.html
+
+// MBC is a memory bank controller. It maps the cartridge ROM banks at 0000-7FFF and the external
+// RAM (or the clock registers) at A000-BFFF, and is configured writing to the ROM area. Reads and
+// writes of the RAM area go to the Cartridge.RAMBanks, so saves can be written after running a
+// game
+type MBC interface {
+	Read(addr uint16) uint8
+	Write(addr uint16, v uint8)
+
+	// ROMBank returns the bank mapped at 4000-7FFF
+	ROMBank() int
+
+	// RAMBank returns the bank mapped at A000-BFFF, or -1 if the external RAM is disabled
+	RAMBank() int
+
+	// SaveState writes the registers of the controller, the RAM and the clock
+	SaveState(w io.Writer) error
+	// LoadState restores a state written by SaveState for the same cartridge
+	LoadState(r io.Reader) error
+}
+
+// Ticker is implemented by the MBCs with a real time clock. Tick advances the clock by the given
+// number of Game Boy clock cycles (4194304 per second)
+type Ticker interface {
+	Tick(cycles int)
+}
+
+// CyclesPerSecond is the Game Boy clock frequency
+const CyclesPerSecond = 4194304
+
+// NewMBC returns the memory bank controller declared in the cartridge header. The RAM banks of
+// the cartridge are allocated if they were not loaded from a save
+func NewMBC(c *Cartridge) (MBC, error) {
+	if len(c.ROMBanks) == 0 {
+		return nil, fmt.Errorf("cartridge has no ROM banks")
+	}
+	if size := c.Header.SaveSizeBytes(); len(c.RAMBanks) == 0 && size > 0 {
+		c.SetRAM(make([]uint8, size))
+	}
+
+	base := mbcBase{c: c, romBank: 1}
+	h := c.Header
+	switch {
+	case !h.HasMBC():
+		base.ramEnabled = true
+		return &noMBC{base}, nil
+	case h.IsMBC1():
+		return &mbc1{mbcBase: base, bank1: 1}, nil
+	case h.IsMBC2():
+		return &mbc2{base}, nil
+	case h.IsMBC3():
+		if h.HasTimer() && c.RTC == nil {
+			c.RTC = &RTC{}
+		}
+		return &mbc3{mbcBase: base}, nil
+	case h.IsMBC5():
+		return &mbc5{base}, nil
+	}
+	return nil, fmt.Errorf("unsupported cartridge type: %v", h.CartridgeTypeText())
+}
+
+// mbcBase holds the state shared by all the controllers
+type mbcBase struct {
+	c          *Cartridge
+	romBank    int
+	ramBank    int
+	ramEnabled bool
+}
+
+func (m *mbcBase) readROM(bank int, addr uint16) uint8 {
+	return m.c.ROMBanks[bank%len(m.c.ROMBanks)][addr&(ROMBankSize-1)]
+}
+
+func (m *mbcBase) ramAt(bank int, addr uint16) (*uint8, bool) {
+	if !m.ramEnabled || len(m.c.RAMBanks) == 0 {
+		return nil, false
+	}
+	b := m.c.RAMBanks[bank%len(m.c.RAMBanks)]
+	off := int(addr - 0xA000)
+	if off >= len(b) {
+		return nil, false
+	}
+	return &b[off], true
+}
+
+func (m *mbcBase) readRAM(bank int, addr uint16) uint8 {
+	if v, ok := m.ramAt(bank, addr); ok {
+		return *v
+	}
+	return 0xFF
+}
+
+func (m *mbcBase) writeRAM(bank int, addr uint16, v uint8) {
+	if p, ok := m.ramAt(bank, addr); ok {
+		*p = v
+	}
+}
+
+func (m *mbcBase) ROMBank() int {
+	return m.romBank % len(m.c.ROMBanks)
+}
+
+func (m *mbcBase) RAMBank() int {
+	if !m.ramEnabled || len(m.c.RAMBanks) == 0 {
+		return -1
+	}
+	return m.ramBank % len(m.c.RAMBanks)
+}
+
+// noMBC is a 32KB ROM with an optional 8KB RAM
+type noMBC struct {
+	mbcBase
+}
+
+func (m *noMBC) Read(addr uint16) uint8 {
+	if addr < 0x8000 {
+		return m.readROM(int(addr/ROMBankSize), addr)
+	}
+	return m.readRAM(0, addr)
+}
+
+func (m *noMBC) Write(addr uint16, v uint8) {
+	if addr >= 0xA000 {
+		m.writeRAM(0, addr, v)
+	}
+}
+
+// mbc1 supports up to 2MB ROM and 32KB RAM. The 2 bits register selects either the upper ROM
+// bank bits or the RAM bank, depending on the banking mode
+type mbc1 struct {
+	mbcBase
+	bank1 uint8 // 5 bits
+	bank2 uint8 // 2 bits
+	mode  uint8
+}
+
+func (m *mbc1) Read(addr uint16) uint8 {
+	switch {
+	case addr < 0x4000:
+		bank := 0
+		if m.mode == 1 {
+			bank = int(m.bank2) << 5
+		}
+		return m.readROM(bank, addr)
+	case addr < 0x8000:
+		return m.readROM(m.romBank, addr)
+	}
+	return m.readRAM(m.ramBank, addr)
+}
+
+func (m *mbc1) Write(addr uint16, v uint8) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnabled = v&0x0F == 0x0A
+	case addr < 0x4000:
+		m.bank1 = v & 0x1F
+		if m.bank1 == 0 {
+			m.bank1 = 1
+		}
+	case addr < 0x6000:
+		m.bank2 = v & 0x03
+	case addr < 0x8000:
+		m.mode = v & 0x01
+	default:
+		m.writeRAM(m.ramBank, addr, v)
+		return
+	}
+
+	m.romBank = int(m.bank2)<<5 | int(m.bank1)
+	m.ramBank = 0
+	if m.mode == 1 {
+		m.ramBank = int(m.bank2)
+	}
+}
+
+// mbc2 supports up to 256KB ROM and has 512 half bytes of built-in RAM, mirrored over A000-BFFF
+type mbc2 struct {
+	mbcBase
+}
+
+func (m *mbc2) Read(addr uint16) uint8 {
+	switch {
+	case addr < 0x4000:
+		return m.readROM(0, addr)
+	case addr < 0x8000:
+		return m.readROM(m.romBank, addr)
+	}
+	return m.readRAM(0, 0xA000+addr&(MBC2RAMSize-1)) | 0xF0
+}
+
+func (m *mbc2) Write(addr uint16, v uint8) {
+	switch {
+	case addr < 0x4000 && addr&0x100 == 0:
+		m.ramEnabled = v&0x0F == 0x0A
+	case addr < 0x4000:
+		m.romBank = int(v & 0x0F)
+		if m.romBank == 0 {
+			m.romBank = 1
+		}
+	case addr >= 0xA000:
+		m.writeRAM(0, 0xA000+addr&(MBC2RAMSize-1), v&0x0F)
+	}
+}
+
+// mbc3 supports up to 2MB ROM, 32KB RAM and a real time clock, whose registers are mapped at
+// A000-BFFF selecting banks 08-0C
+type mbc3 struct {
+	mbcBase
+	latched   RTC
+	latch     uint8
+	subsecond int
+}
+
+func (m *mbc3) Read(addr uint16) uint8 {
+	switch {
+	case addr < 0x4000:
+		return m.readROM(0, addr)
+	case addr < 0x8000:
+		return m.readROM(m.romBank, addr)
+	case m.ramBank >= rtcSecondsReg:
+		if !m.ramEnabled || m.c.RTC == nil {
+			return 0xFF
+		}
+		return m.readRTC(&m.latched)
+	}
+	return m.readRAM(m.ramBank, addr)
+}
+
+func (m *mbc3) readRTC(r *RTC) uint8 {
+	switch m.ramBank {
+	case rtcSecondsReg:
+		return r.Seconds
+	case rtcSecondsReg + 1:
+		return r.Minutes
+	case rtcSecondsReg + 2:
+		return r.Hours
+	case rtcSecondsReg + 3:
+		return r.DL()
+	case rtcSecondsReg + 4:
+		return r.DH()
+	}
+	return 0xFF
+}
+
+func (m *mbc3) Write(addr uint16, v uint8) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnabled = v&0x0F == 0x0A
+	case addr < 0x4000:
+		m.romBank = int(v & 0x7F)
+		if m.romBank == 0 {
+			m.romBank = 1
+		}
+	case addr < 0x6000:
+		m.ramBank = int(v & 0x0F)
+	case addr < 0x8000:
+		if m.latch == 0x00 && v == 0x01 && m.c.RTC != nil {
+			m.latched = *m.c.RTC
+		}
+		m.latch = v
+	case m.ramBank >= rtcSecondsReg:
+		if m.ramEnabled && m.c.RTC != nil {
+			m.writeRTC(v)
+		}
+	default:
+		m.writeRAM(m.ramBank, addr, v)
+	}
+}
+
+func (m *mbc3) writeRTC(v uint8) {
+	r := m.c.RTC
+	switch m.ramBank {
+	case rtcSecondsReg:
+		r.Seconds = v & 0x3F
+		m.subsecond = 0
+	case rtcSecondsReg + 1:
+		r.Minutes = v & 0x3F
+	case rtcSecondsReg + 2:
+		r.Hours = v & 0x1F
+	case rtcSecondsReg + 3:
+		r.SetDL(v)
+	case rtcSecondsReg + 4:
+		r.SetDH(v)
+	}
+}
+
+func (m *mbc3) RAMBank() int {
+	if m.ramBank >= rtcSecondsReg {
+		return -1
+	}
+	return m.mbcBase.RAMBank()
+}
+
+// Tick advances the clock with the emulated time, so runs are reproducible
+func (m *mbc3) Tick(cycles int) {
+	if m.c.RTC == nil || m.c.RTC.Halt {
+		return
+	}
+	m.subsecond += cycles
+	for m.subsecond >= CyclesPerSecond {
+		m.subsecond -= CyclesPerSecond
+		m.c.RTC.Advance(time.Second)
+	}
+}
+
+// mbc5 supports up to 8MB ROM and 128KB RAM. Unlike the other controllers bank 0 can be mapped
+// at 4000-7FFF
+type mbc5 struct {
+	mbcBase
+}
+
+func (m *mbc5) Read(addr uint16) uint8 {
+	switch {
+	case addr < 0x4000:
+		return m.readROM(0, addr)
+	case addr < 0x8000:
+		return m.readROM(m.romBank, addr)
+	}
+	return m.readRAM(m.ramBank, addr)
+}
+
+func (m *mbc5) Write(addr uint16, v uint8) {
+	switch {
+	case addr < 0x2000:
+		m.ramEnabled = v&0x0F == 0x0A
+	case addr < 0x3000:
+		m.romBank = m.romBank&0x100 | int(v)
+	case addr < 0x4000:
+		m.romBank = m.romBank&0xFF | int(v&0x01)<<8
+	case addr < 0x6000:
+		// Bit 3 drives the rumble motor on rumble cartridges
+		if m.c.Header.CartridgeType == MBC5Rumble || m.c.Header.CartridgeType == MBC5RumbleRAM ||
+			m.c.Header.CartridgeType == MBC5RumbleRAMBattery {
+			v &= 0x07
+		}
+		m.ramBank = int(v & 0x0F)
+	case addr >= 0xA000:
+		m.writeRAM(m.ramBank, addr, v)
+	}
+}
@@ -0,0 +1,148 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mbcState is the state shared by all the controllers, followed by the RAM contents
+type mbcState struct {
+	ROMBank    int32
+	RAMBank    int32
+	RAMEnabled bool
+	RAMSize    uint32
+	HasRTC     bool
+	RTC        rtcState
+}
+
+// rtcState holds the clock registers. The timestamp is not saved, the emulated clock only
+// advances with the emulated time
+type rtcState struct {
+	Seconds, Minutes, Hours uint8
+	Days                    uint16
+	Halt, DayCarry          bool
+}
+
+func newRTCState(r *RTC) rtcState {
+	return rtcState{r.Seconds, r.Minutes, r.Hours, r.Days, r.Halt, r.DayCarry}
+}
+
+func (s rtcState) restore(r *RTC) {
+	r.Seconds, r.Minutes, r.Hours, r.Days, r.Halt, r.DayCarry = s.Seconds, s.Minutes, s.Hours, s.Days, s.Halt, s.DayCarry
+}
+
+func (m *mbcBase) ramSize() int {
+	size := 0
+	for _, bank := range m.c.RAMBanks {
+		size += len(bank)
+	}
+	return size
+}
+
+// SaveState writes the registers of the controller, the RAM and the clock
+func (m *mbcBase) SaveState(w io.Writer) error {
+	s := mbcState{
+		ROMBank:    int32(m.romBank),
+		RAMBank:    int32(m.ramBank),
+		RAMEnabled: m.ramEnabled,
+		RAMSize:    uint32(m.ramSize()),
+		HasRTC:     m.c.RTC != nil,
+	}
+	if m.c.RTC != nil {
+		s.RTC = newRTCState(m.c.RTC)
+	}
+	if err := binary.Write(w, binary.LittleEndian, s); err != nil {
+		return err
+	}
+	for _, bank := range m.c.RAMBanks {
+		if _, err := w.Write(bank); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadState restores a state written by SaveState for the same cartridge
+func (m *mbcBase) LoadState(r io.Reader) error {
+	var s mbcState
+	if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("reading MBC state: %v", err)
+	}
+	if int(s.RAMSize) != m.ramSize() || s.HasRTC != (m.c.RTC != nil) {
+		return fmt.Errorf("MBC state does not match the cartridge")
+	}
+	// MBC5 has the most banks: 9 bits for the ROM and 4 bits for the RAM (MBC3 clock registers
+	// are RAM banks 08-0C)
+	if s.ROMBank < 0 || s.ROMBank > 0x1FF || s.RAMBank < 0 || s.RAMBank > 0x0F {
+		return fmt.Errorf("invalid MBC banks %d and %d in state", s.ROMBank, s.RAMBank)
+	}
+	for _, bank := range m.c.RAMBanks {
+		if _, err := io.ReadFull(r, bank); err != nil {
+			return fmt.Errorf("reading RAM state: %v", err)
+		}
+	}
+
+	m.romBank, m.ramBank, m.ramEnabled = int(s.ROMBank), int(s.RAMBank), s.RAMEnabled
+	if m.c.RTC != nil {
+		s.RTC.restore(m.c.RTC)
+	}
+	return nil
+}
+
+// SaveState writes the shared state and the banking registers
+func (m *mbc1) SaveState(w io.Writer) error {
+	if err := m.mbcBase.SaveState(w); err != nil {
+		return err
+	}
+	_, err := w.Write([]uint8{m.bank1, m.bank2, m.mode})
+	return err
+}
+
+// LoadState restores a state written by SaveState
+func (m *mbc1) LoadState(r io.Reader) error {
+	if err := m.mbcBase.LoadState(r); err != nil {
+		return err
+	}
+	var regs [3]uint8
+	if _, err := io.ReadFull(r, regs[:]); err != nil {
+		return fmt.Errorf("reading MBC1 state: %v", err)
+	}
+	if regs[0] == 0 || regs[0] > 0x1F || regs[1] > 0x03 || regs[2] > 0x01 {
+		return fmt.Errorf("invalid MBC1 registers % x in state", regs)
+	}
+	m.bank1, m.bank2, m.mode = regs[0], regs[1], regs[2]
+	return nil
+}
+
+// mbc3State holds the latched clock registers and the time elapsed in the current second
+type mbc3State struct {
+	Latched   rtcState
+	Latch     uint8
+	Subsecond int32
+}
+
+// SaveState writes the shared state and the latched clock
+func (m *mbc3) SaveState(w io.Writer) error {
+	if err := m.mbcBase.SaveState(w); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, mbc3State{newRTCState(&m.latched), m.latch, int32(m.subsecond)})
+}
+
+// LoadState restores a state written by SaveState
+func (m *mbc3) LoadState(r io.Reader) error {
+	if err := m.mbcBase.LoadState(r); err != nil {
+		return err
+	}
+	var s mbc3State
+	if err := binary.Read(r, binary.LittleEndian, &s); err != nil {
+		return fmt.Errorf("reading MBC3 state: %v", err)
+	}
+	if s.Subsecond < 0 || s.Subsecond >= CyclesPerSecond {
+		return fmt.Errorf("invalid MBC3 clock state")
+	}
+	s.Latched.restore(&m.latched)
+	m.latch, m.subsecond = s.Latch, int(s.Subsecond)
+	return nil
+}
@@ -0,0 +1,48 @@
+package cartridge
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// SetRAM splits the save data into RAM banks. The last bank is shorter for cartridges with
+// less than 8KB of RAM (2KB RAM or MBC2)
+func (c *Cartridge) SetRAM(data []uint8) {
+	c.RAMBanks = nil
+	for start := 0; start < len(data); start += RAMBankSize {
+		end := start + RAMBankSize
+		if end > len(data) {
+			end = len(data)
+		}
+		c.RAMBanks = append(c.RAMBanks, append([]uint8(nil), data[start:end]...))
+	}
+}
+
+// RAM returns all the RAM banks concatenated, as they are stored in a .sav file
+func (c *Cartridge) RAM() []uint8 {
+	ram := make([]uint8, 0, len(c.RAMBanks)*RAMBankSize)
+	for _, bank := range c.RAMBanks {
+		ram = append(ram, bank...)
+	}
+	return ram
+}
+
+// LoadSaveFile reads a .sav file into the RAM banks. Saves with a RTC footer appended by
+// emulators also load the clock registers, advanced to the current time
+func (c *Cartridge) LoadSaveFile(fname string) error {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return fmt.Errorf("reading save file: %v", err)
+	}
+	_, err = c.ImportSave(data, time.Now())
+	return err
+}
+
+// WriteSaveFile writes the RAM banks to a raw .sav file
+func (c *Cartridge) WriteSaveFile(fname string) error {
+	if err := ioutil.WriteFile(fname, c.RAM(), 0644); err != nil {
+		return fmt.Errorf("writing save file: %v", err)
+	}
+	return nil
+}
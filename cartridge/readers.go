@@ -1,8 +1,9 @@
 package cartridge
 
 import (
-	"bufio"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 )
@@ -26,6 +27,11 @@ func NewFileROMReader(fname string) *FileROMReader {
 	}
 }
 
+// SetLogOutput changes where the reader progress messages are written (stdout by default)
+func (frr *FileROMReader) SetLogOutput(w io.Writer) {
+	frr.l.SetOutput(w)
+}
+
 // ReadHeader reads the whole cartridge header
 func (frr *FileROMReader) ReadHeader() (*CartridgeHeader, error) {
 	err := frr.loadROMInMemory()
@@ -39,8 +45,11 @@ func (frr *FileROMReader) ReadHeader() (*CartridgeHeader, error) {
 	}
 
 	frr.l.Println("Reading ROM header data.")
-	bytes := frr.inmemfile[:0x150]
-	frr.header = ROMHeaderFromBytes(bytes)
+	h, err := ROMHeaderFromBytes(frr.inmemfile)
+	if err != nil {
+		return nil, fmt.Errorf("reading cartridge header from %v: %v", frr.fname, err)
+	}
+	frr.header = h
 	return frr.header, nil
 }
 
@@ -51,16 +60,14 @@ func (frr *FileROMReader) ReadCartridge() (*Cartridge, error) {
 		return nil, err
 	}
 
-	// Dump Rom banks
-	nb := h.GetNumROMBanks()
-	banks := make([][]uint8, nb)
-	frr.l.Printf("The cartridge has %d banks.\n", nb)
-
-	romSize := 0x4000
-	for b := 0; b < nb; b++ {
-		start := b * romSize
-		end := start + romSize
-		banks[b] = frr.inmemfile[start:end]
+	frr.l.Printf("The cartridge has %d banks.\n", h.GetNumROMBanks())
+	banks, err := splitROMBanks(h, frr.inmemfile)
+	if err != nil {
+		return nil, fmt.Errorf("reading %v: %v", frr.fname, err)
+	}
+	if len(frr.inmemfile) > h.ROMSizeBytes() {
+		frr.l.Printf("Ignoring %d trailing bytes after the declared ROM size.\n",
+			len(frr.inmemfile)-h.ROMSizeBytes())
 	}
 
 	// TODO: RAM is in a separate file in this case
@@ -68,35 +75,65 @@ func (frr *FileROMReader) ReadCartridge() (*Cartridge, error) {
 	return NewCartridge(h, banks), nil
 }
 
+// CartridgeFromBytes parses a whole ROM image. An error is returned if the header cannot be
+// parsed or if the image is smaller than the ROM size declared in the header
+func CartridgeFromBytes(rom []uint8) (*Cartridge, error) {
+	h, err := ROMHeaderFromBytes(rom)
+	if err != nil {
+		return nil, err
+	}
+
+	banks, err := splitROMBanks(h, rom)
+	if err != nil {
+		return nil, err
+	}
+	return NewCartridge(h, banks), nil
+}
+
+func splitROMBanks(h *CartridgeHeader, rom []uint8) ([][]uint8, error) {
+	if !h.IsKnownROMSize() {
+		return nil, fmt.Errorf("unknown ROM size code 0x%02x in header", h.ROMSize)
+	}
+
+	declared := h.ROMSizeBytes()
+	if len(rom) < declared {
+		return nil, fmt.Errorf("file is %v but header declares %v", formatSize(len(rom)), formatSize(declared))
+	}
+
+	nb := h.GetNumROMBanks()
+	banks := make([][]uint8, nb)
+	for b := 0; b < nb; b++ {
+		start := b * ROMBankSize
+		end := start + ROMBankSize
+		banks[b] = rom[start:end]
+	}
+	return banks, nil
+}
+
+// formatSize formats a number of bytes using the units commonly used for Game Boy ROMs
+func formatSize(size int) string {
+	switch {
+	case size >= 1024*1024 && size%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", size/(1024*1024))
+	case size >= 1024 && size%1024 == 0:
+		return fmt.Sprintf("%dKB", size/1024)
+	case size >= 1024:
+		return fmt.Sprintf("%.1fKB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
+
 func (frr *FileROMReader) loadROMInMemory() error {
 	if frr.inmemfile == nil {
 		rb, err := loadFile(frr.fname)
-		frr.inmemfile = rb
 		if err != nil {
 			return err
 		}
+		frr.inmemfile = rb
 	}
 	return nil
 }
 
 func loadFile(fname string) ([]byte, error) {
-	file, err := os.Open(fname)
-
-	if err != nil {
-		return nil, err
-	}
-	defer file.Close()
-
-	stats, statsErr := file.Stat()
-	if statsErr != nil {
-		return nil, statsErr
-	}
-
-	size := stats.Size()
-	bytes := make([]byte, size)
-
-	bufr := bufio.NewReader(file)
-	_, err = bufr.Read(bytes)
-
-	return bytes, err
+	return ioutil.ReadFile(fname)
 }
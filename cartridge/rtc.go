@@ -0,0 +1,81 @@
+package cartridge
+
+import "time"
+
+// Reference: https://gbdev.io/pandocs/MBC3.html#the-clock-counter-registers
+
+// RTC holds the MBC3 real time clock registers
+type RTC struct {
+	Seconds  uint8  `json:"seconds"`   // 08h - RTC S
+	Minutes  uint8  `json:"minutes"`   // 09h - RTC M
+	Hours    uint8  `json:"hours"`     // 0Ah - RTC H
+	Days     uint16 `json:"days"`      // 0Bh - RTC DL and bit 0 of 0Ch - RTC DH
+	Halt     bool   `json:"halt"`      // Bit 6 of 0Ch - RTC DH
+	DayCarry bool   `json:"day_carry"` // Bit 7 of 0Ch - RTC DH
+	// When the registers were read, used to know how much time passed while the cartridge was
+	// not powered
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// DL returns the lower 8 bits of the day counter register
+func (r *RTC) DL() uint8 {
+	return uint8(r.Days)
+}
+
+// DH returns the RTC DH register: bit 0 is the day counter 9th bit, bit 6 halt and bit 7 the
+// day counter carry
+func (r *RTC) DH() uint8 {
+	dh := uint8(r.Days>>8) & 0x01
+	if r.Halt {
+		dh |= 0x40
+	}
+	if r.DayCarry {
+		dh |= 0x80
+	}
+	return dh
+}
+
+// SetDL sets the lower 8 bits of the day counter
+func (r *RTC) SetDL(v uint8) {
+	r.Days = r.Days&0x100 | uint16(v)
+}
+
+// SetDH sets the day counter 9th bit, the halt flag and the day carry from the DH register value
+func (r *RTC) SetDH(v uint8) {
+	r.Days = r.Days&0xFF | uint16(v&0x01)<<8
+	r.Halt = v&0x40 != 0
+	r.DayCarry = v&0x80 != 0
+}
+
+// Day counter limit, when it overflows the day carry flag is set
+const rtcMaxDays = 512
+
+// Advance moves the clock forward, as the cartridge battery would while it is not powered.
+// Nothing happens if the clock is halted
+func (r *RTC) Advance(d time.Duration) {
+	if r.Halt || d <= 0 {
+		return
+	}
+
+	secs := int64(r.Seconds) + int64(r.Minutes)*60 + int64(r.Hours)*3600 + int64(r.Days)*86400
+	secs += int64(d / time.Second)
+
+	days := secs / 86400
+	if days >= rtcMaxDays {
+		r.DayCarry = true
+		days %= rtcMaxDays
+	}
+	r.Days = uint16(days)
+	r.Hours = uint8(secs % 86400 / 3600)
+	r.Minutes = uint8(secs % 3600 / 60)
+	r.Seconds = uint8(secs % 60)
+}
+
+// AdvanceTo moves the clock forward to the given time using the timestamp of the registers, and
+// updates the timestamp. The registers are kept as they are if they have no timestamp
+func (r *RTC) AdvanceTo(t time.Time) {
+	if !r.Timestamp.IsZero() {
+		r.Advance(t.Sub(r.Timestamp))
+	}
+	r.Timestamp = t
+}
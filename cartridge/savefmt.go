@@ -0,0 +1,185 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Reference: https://bgb.bircd.org/rtcsave.html
+
+// SaveFormat is the layout used by an emulator to store the MBC3 clock in a .sav file
+type SaveFormat int
+
+const (
+	// RawSave only contains the RAM, this is what is stored in the cartridge
+	RawSave SaveFormat = iota
+	// VBAMSave appends a 48 bytes footer, also used by mGBA
+	VBAMSave
+	// BGBSave appends a 44 bytes footer, the VBA-M one with a 32 bits timestamp
+	BGBSave
+	// SameBoySave stores MBC3 clocks with the 48 bytes footer. SameBoy has its own layouts only
+	// for HuC3 and TPP1 clocks, which are not supported
+	SameBoySave
+)
+
+// RTC footer sizes
+const (
+	rtcFooterSize      = 48
+	rtcShortFooterSize = 44
+)
+
+var saveFormatNames = map[SaveFormat]string{
+	RawSave:     "raw",
+	VBAMSave:    "vbam",
+	BGBSave:     "bgb",
+	SameBoySave: "sameboy",
+}
+
+func (f SaveFormat) String() string {
+	if name, ok := saveFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("SaveFormat(%d)", int(f))
+}
+
+// ParseSaveFormat returns the save format with the given name (raw, vbam, mgba, bgb or sameboy)
+func ParseSaveFormat(name string) (SaveFormat, error) {
+	name = strings.ToLower(name)
+	if name == "mgba" {
+		return VBAMSave, nil
+	}
+	for f, n := range saveFormatNames {
+		if n == name {
+			return f, nil
+		}
+	}
+	return RawSave, fmt.Errorf("unknown save format %q", name)
+}
+
+func (f SaveFormat) footerSize() int {
+	switch f {
+	case VBAMSave, SameBoySave:
+		return rtcFooterSize
+	case BGBSave:
+		return rtcShortFooterSize
+	}
+	return 0
+}
+
+// EncodeSave returns the .sav file contents in the given format. The clock registers are stored
+// both as the current and the latched values. A nil clock is only valid for raw saves
+func EncodeSave(f SaveFormat, ram []uint8, rtc *RTC) ([]uint8, error) {
+	size := f.footerSize()
+	if size == 0 {
+		return append([]uint8(nil), ram...), nil
+	}
+	if rtc == nil {
+		return nil, fmt.Errorf("%v saves need the clock registers", f)
+	}
+
+	footer := make([]uint8, size)
+	regs := []uint8{rtc.Seconds, rtc.Minutes, rtc.Hours, rtc.DL(), rtc.DH()}
+	for i, v := range regs {
+		binary.LittleEndian.PutUint32(footer[i*4:], uint32(v))
+		binary.LittleEndian.PutUint32(footer[(i+len(regs))*4:], uint32(v))
+	}
+
+	var ts int64
+	if !rtc.Timestamp.IsZero() {
+		ts = rtc.Timestamp.Unix()
+	}
+	if size == rtcFooterSize {
+		binary.LittleEndian.PutUint64(footer[40:], uint64(ts))
+	} else {
+		binary.LittleEndian.PutUint32(footer[40:], uint32(ts))
+	}
+	return append(append([]uint8(nil), ram...), footer...), nil
+}
+
+// DecodeSave splits a .sav file in RAM and clock registers. The format is detected from the
+// number of bytes after the RAM (saveSize). The clock is nil for raw saves
+func DecodeSave(data []uint8, saveSize int) ([]uint8, *RTC, SaveFormat, error) {
+	if len(data) < saveSize {
+		return nil, nil, RawSave, fmt.Errorf("save file is %v but cartridge has %v of RAM", formatSize(len(data)), formatSize(saveSize))
+	}
+
+	ram, footer := data[:saveSize], data[saveSize:]
+	var f SaveFormat
+	switch len(footer) {
+	case 0:
+		return ram, nil, RawSave, nil
+	case rtcFooterSize:
+		f = VBAMSave
+	case rtcShortFooterSize:
+		f = BGBSave
+	default:
+		return nil, nil, RawSave, fmt.Errorf("unknown %d bytes footer after the save", len(footer))
+	}
+
+	reg := func(i int) uint8 { return uint8(binary.LittleEndian.Uint32(footer[i*4:])) }
+	rtc := &RTC{Seconds: reg(0), Minutes: reg(1), Hours: reg(2)}
+	rtc.SetDL(reg(3))
+	rtc.SetDH(reg(4))
+
+	var ts int64
+	if f == VBAMSave {
+		ts = int64(binary.LittleEndian.Uint64(footer[40:]))
+	} else {
+		ts = int64(binary.LittleEndian.Uint32(footer[40:]))
+	}
+	if ts != 0 {
+		rtc.Timestamp = time.Unix(ts, 0).UTC()
+	}
+	return ram, rtc, f, nil
+}
+
+// ImportSave loads a .sav file in any of the supported formats. The clock is advanced to the
+// given time, so it accounts for the time passed since the emulator wrote the file
+func (c *Cartridge) ImportSave(data []uint8, now time.Time) (SaveFormat, error) {
+	ram, rtc, f, err := DecodeSave(data, c.Header.SaveSizeBytes())
+	if err != nil {
+		return f, err
+	}
+	if rtc != nil && !c.Header.HasTimer() {
+		return f, fmt.Errorf("save has a clock but the cartridge has no timer")
+	}
+
+	c.SetRAM(ram)
+	if rtc != nil {
+		rtc.AdvanceTo(now)
+		c.RTC = rtc
+	}
+	return f, nil
+}
+
+// ExportSave returns the save in the given format with the clock advanced to the given time
+func (c *Cartridge) ExportSave(f SaveFormat, now time.Time) ([]uint8, error) {
+	var rtc *RTC
+	if f != RawSave {
+		if !c.Header.HasTimer() {
+			return nil, fmt.Errorf("cartridge has no timer")
+		}
+		if c.RTC == nil {
+			return nil, fmt.Errorf("clock registers are unknown")
+		}
+		clock := *c.RTC
+		clock.AdvanceTo(now)
+		rtc = &clock
+	}
+	return EncodeSave(f, c.RAM(), rtc)
+}
+
+// ExportSaveFile writes the save to a .sav file in the given format
+func (c *Cartridge) ExportSaveFile(fname string, f SaveFormat) error {
+	data, err := c.ExportSave(f, time.Now())
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		return fmt.Errorf("writing save file: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package cartridge
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/gbproxy"
+)
+
+// Reference: https://gbdev.io/pandocs/MBC1.html
+
+// MBC registers and external RAM addresses
+const (
+	ramEnableAddr  = 0x0000
+	ramBankAddr    = 0x4000
+	bankingModeRAM = 0x6000
+	sramAddr       = 0xA000
+
+	ramEnableValue  = 0x0A
+	ramDisableValue = 0x00
+)
+
+// The cartridge CS pin (active when accessing A000-BFFF) is not exposed by the GameBoyProxy,
+// so it must be handled by the hardware (ie. driven from A15/A13)
+
+func writeRegister(p gbproxy.GameBoyProxy, addr uint, value uint8) {
+	p.SetWriteMode()
+	p.SelectAddress(addr)
+	p.Write(value)
+}
+
+func readByte(p gbproxy.GameBoyProxy, addr uint) uint8 {
+	p.SetReadMode()
+	p.SelectAddress(addr)
+	return p.Read()
+}
+
+// sramBanks enables the external RAM and calls f for each RAM bank once it is mapped at A000
+func sramBanks(p gbproxy.GameBoyProxy, h *CartridgeHeader, f func(bank, size int)) error {
+	size := h.SaveSizeBytes()
+	if size == 0 {
+		return fmt.Errorf("cartridge has no RAM")
+	}
+
+	writeRegister(p, ramEnableAddr, ramEnableValue)
+	if h.IsMBC1() {
+		// RAM banking mode, needed to switch banks on 32KB RAM carts
+		writeRegister(p, bankingModeRAM, 0x01)
+	}
+
+	for bank := 0; bank*RAMBankSize < size; bank++ {
+		if !h.IsMBC2() {
+			writeRegister(p, ramBankAddr, uint8(bank))
+		}
+		bankSize := size - bank*RAMBankSize
+		if bankSize > RAMBankSize {
+			bankSize = RAMBankSize
+		}
+		f(bank, bankSize)
+	}
+
+	if h.IsMBC1() {
+		writeRegister(p, bankingModeRAM, 0x00)
+	}
+	writeRegister(p, ramEnableAddr, ramDisableValue)
+	return nil
+}
+
+// ReadSRAM reads the battery backed RAM of the cartridge through the proxy
+func ReadSRAM(p gbproxy.GameBoyProxy, h *CartridgeHeader) ([]uint8, error) {
+	ram := make([]uint8, 0, h.SaveSizeBytes())
+	err := sramBanks(p, h, func(bank, size int) {
+		for i := 0; i < size; i++ {
+			v := readByte(p, uint(sramAddr+i))
+			if h.IsMBC2() {
+				v |= 0xF0 // Only the lower 4 bits are wired
+			}
+			ram = append(ram, v)
+		}
+	})
+	return ram, err
+}
+
+// WriteSRAM writes the given save to the battery backed RAM of the cartridge through the proxy.
+// The save must have the size declared in the header
+func WriteSRAM(p gbproxy.GameBoyProxy, h *CartridgeHeader, ram []uint8) error {
+	if len(ram) != h.SaveSizeBytes() {
+		return fmt.Errorf("save is %v but cartridge has %v of RAM", formatSize(len(ram)), formatSize(h.SaveSizeBytes()))
+	}
+
+	return sramBanks(p, h, func(bank, size int) {
+		for i := 0; i < size; i++ {
+			writeRegister(p, uint(sramAddr+i), ram[bank*RAMBankSize+i])
+		}
+	})
+}
+
+// MBC3 clock registers, selected writing their number to the RAM bank register
+const (
+	rtcSecondsReg = 0x08
+	rtcLatchAddr  = 0x6000
+)
+
+// ReadRTC latches and reads the MBC3 clock registers through the proxy
+func ReadRTC(p gbproxy.GameBoyProxy, h *CartridgeHeader) (*RTC, error) {
+	if !h.HasTimer() {
+		return nil, fmt.Errorf("cartridge has no timer")
+	}
+
+	writeRegister(p, ramEnableAddr, ramEnableValue)
+	writeRegister(p, rtcLatchAddr, 0x00)
+	writeRegister(p, rtcLatchAddr, 0x01)
+
+	var regs [5]uint8
+	for i := range regs {
+		writeRegister(p, ramBankAddr, uint8(rtcSecondsReg+i))
+		regs[i] = readByte(p, sramAddr)
+	}
+	writeRegister(p, ramEnableAddr, ramDisableValue)
+
+	rtc := &RTC{Seconds: regs[0] & 0x3F, Minutes: regs[1] & 0x3F, Hours: regs[2] & 0x1F, Timestamp: time.Now().UTC()}
+	rtc.SetDL(regs[3])
+	rtc.SetDH(regs[4])
+	return rtc, nil
+}
+
+// WriteRTC sets the MBC3 clock registers through the proxy. The clock is halted while the
+// registers are written so it does not tick in between
+func WriteRTC(p gbproxy.GameBoyProxy, h *CartridgeHeader, rtc *RTC) error {
+	if !h.HasTimer() {
+		return fmt.Errorf("cartridge has no timer")
+	}
+
+	writeRegister(p, ramEnableAddr, ramEnableValue)
+	writeRegister(p, ramBankAddr, rtcSecondsReg+4)
+	writeRegister(p, sramAddr, rtc.DH()|0x40)
+
+	regs := []uint8{rtc.Seconds, rtc.Minutes, rtc.Hours, rtc.DL(), rtc.DH()}
+	for i, v := range regs {
+		writeRegister(p, ramBankAddr, uint8(rtcSecondsReg+i))
+		writeRegister(p, sramAddr, v)
+	}
+	writeRegister(p, ramEnableAddr, ramDisableValue)
+	return nil
+}
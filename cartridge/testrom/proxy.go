@@ -0,0 +1,57 @@
+package testrom
+
+import (
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// Proxy is a virtual GameBoyProxy that emulates the bus of a cartridge with its memory bank
+// controller, to test the dumper and the save tools without hardware
+type Proxy struct {
+	Cartridge *cartridge.Cartridge
+	MBC       cartridge.MBC
+	Reads     int // number of bytes read
+	Writes    int // number of bytes written
+	addr      uint
+}
+
+// NewProxy connects a cartridge to a virtual proxy
+func NewProxy(c *cartridge.Cartridge) (*Proxy, error) {
+	m, err := cartridge.NewMBC(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Proxy{Cartridge: c, MBC: m}, nil
+}
+
+// SetReadMode is a no-op, the direction is given by the Read and Write calls
+func (p *Proxy) SetReadMode() {}
+
+// SetWriteMode is a no-op, the direction is given by the Read and Write calls
+func (p *Proxy) SetWriteMode() {}
+
+// SelectAddress sets the address of the next read or write
+func (p *Proxy) SelectAddress(addr uint) {
+	p.addr = addr
+}
+
+// Read returns the byte at the selected address. Addresses outside of the cartridge read 0xFF
+func (p *Proxy) Read() uint8 {
+	p.Reads++
+	if !p.cartridgeAddr() {
+		return 0xFF
+	}
+	return p.MBC.Read(uint16(p.addr))
+}
+
+// Write writes a MBC register or the external RAM
+func (p *Proxy) Write(v uint8) {
+	p.Writes++
+	if p.cartridgeAddr() {
+		p.MBC.Write(uint16(p.addr), v)
+	}
+}
+
+// cartridgeAddr returns true if the selected address is the ROM or the external RAM
+func (p *Proxy) cartridgeAddr() bool {
+	return p.addr < 0x8000 || p.addr >= 0xA000 && p.addr < 0xC000
+}
@@ -0,0 +1,266 @@
+package cartridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// NintendoLogo is the logo stored in every licensed cartridge (0104-0133). The boot ROM refuses
+// to run the game if the logo in the header does not match this one
+var NintendoLogo = [48]uint8{
+	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00,
+	0x0C, 0x00, 0x0D, 0x00, 0x08, 0x11, 0x1F, 0x88, 0x89, 0x00, 0x0E, 0xDC, 0xCC,
+	0x6E, 0xE6, 0xDD, 0xDD, 0xD9, 0x99, 0xBB, 0xBB, 0x67, 0x63, 0x6E, 0x0E, 0xEC,
+	0xCC, 0xDD, 0xDC, 0x99, 0x9F, 0xBB, 0xB9, 0x33, 0x3E,
+}
+
+// cgbLogoCheckLen is the number of logo bytes checked by the CGB boot ROM (top half of the logo)
+const cgbLogoCheckLen = 0x18
+
+// Severity of a validation check result
+type Severity int
+
+const (
+	SeverityOK Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "WARN"
+	case SeverityError:
+		return "FAIL"
+	}
+	return "PASS"
+}
+
+// MarshalText encodes the severity as PASS, WARN or FAIL
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Check is the result of a single validation check
+type Check struct {
+	Name     string   `json:"name"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// ValidationReport gathers the result of all the checks run against a ROM image
+type ValidationReport struct {
+	Checks []Check `json:"checks"`
+}
+
+func (r *ValidationReport) add(name string, s Severity, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, Check{Name: name, Severity: s, Message: fmt.Sprintf(format, args...)})
+}
+
+// Worst returns the highest severity found in the report
+func (r *ValidationReport) Worst() Severity {
+	worst := SeverityOK
+	for _, c := range r.Checks {
+		if c.Severity > worst {
+			worst = c.Severity
+		}
+	}
+	return worst
+}
+
+// OK returns true if none of the checks failed. Warnings are allowed
+func (r *ValidationReport) OK() bool {
+	return r.Worst() < SeverityError
+}
+
+// Find returns the check with the given name
+func (r *ValidationReport) Find(name string) (Check, bool) {
+	for _, c := range r.Checks {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Check{}, false
+}
+
+// Write prints one line per check with the format `[PASS] name: message`
+func (r *ValidationReport) Write(w io.Writer) error {
+	for _, c := range r.Checks {
+		if _, err := fmt.Fprintf(w, "[%s] %s: %s\n", c.Severity, c.Name, c.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteJSON encodes the report as JSON
+func (r *ValidationReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// Names of the checks run by ValidateROM
+const (
+	CheckHeader         = "header"
+	CheckLogo           = "nintendo logo"
+	CheckHeaderChecksum = "header checksum"
+	CheckGlobalChecksum = "global checksum"
+	CheckFileSize       = "file size"
+	CheckPowerOfTwo     = "power of two size"
+	CheckTypeSize       = "cartridge type vs ROM size"
+	CheckRAMSize        = "RAM size"
+)
+
+// Maximum ROM and RAM sizes addressable by each kind of MBC
+type mbcLimits struct {
+	name   string
+	maxROM int
+	maxRAM int
+}
+
+func (ch *CartridgeHeader) mbcLimits() (mbcLimits, bool) {
+	switch {
+	case !ch.HasMBC():
+		return mbcLimits{"ROM only", 32 * 1024, 8 * 1024}, true
+	case ch.IsMBC1():
+		return mbcLimits{"MBC1", 2 * 1024 * 1024, 32 * 1024}, true
+	case ch.IsMBC2():
+		return mbcLimits{"MBC2", 256 * 1024, 0}, true
+	case ch.IsMBC3():
+		return mbcLimits{"MBC3", 2 * 1024 * 1024, 32 * 1024}, true
+	case ch.IsMBC5():
+		return mbcLimits{"MBC5", 8 * 1024 * 1024, 128 * 1024}, true
+	}
+	return mbcLimits{}, false
+}
+
+// ValidateROM runs every known check against a whole ROM image (as read from a file) and
+// returns a report with the result of each one
+func ValidateROM(rom []uint8) *ValidationReport {
+	r := &ValidationReport{}
+	h, err := ROMHeaderFromBytes(rom)
+	if err != nil {
+		r.add(CheckHeader, SeverityError, "%v", err)
+		return r
+	}
+
+	r.checkLogo(h)
+	r.checkHeaderChecksum(h)
+	r.checkGlobalChecksum(h, rom)
+	r.checkFileSize(h, rom)
+	r.checkTypeSize(h)
+	r.checkRAMSize(h)
+	return r
+}
+
+// ValidationReport runs all the validation checks against the cartridge ROM banks
+func (c *Cartridge) ValidationReport() *ValidationReport {
+	return ValidateROM(c.Bytes())
+}
+
+func (r *ValidationReport) checkLogo(h *CartridgeHeader) {
+	full, top := 0, 0
+	for i, b := range NintendoLogo {
+		if h.NintendoLogo[i] != b {
+			full++
+			if i < cgbLogoCheckLen {
+				top++
+			}
+		}
+	}
+
+	switch {
+	case full == 0:
+		r.add(CheckLogo, SeverityOK, "matches the genuine logo")
+	case top == 0:
+		r.add(CheckLogo, SeverityWarning, "%d bytes differ in the bottom half, only a CGB will boot it", full)
+	default:
+		r.add(CheckLogo, SeverityError, "%d bytes differ from the genuine logo", full)
+	}
+}
+
+func (r *ValidationReport) checkHeaderChecksum(h *CartridgeHeader) {
+	expected := h.ComputeHeaderChecksum()
+	if expected == h.HeaderChecksum {
+		r.add(CheckHeaderChecksum, SeverityOK, "0x%02x", h.HeaderChecksum)
+	} else {
+		r.add(CheckHeaderChecksum, SeverityError, "expected 0x%02x found 0x%02x, the boot ROM will lock up",
+			expected, h.HeaderChecksum)
+	}
+}
+
+func (r *ValidationReport) checkGlobalChecksum(h *CartridgeHeader, rom []uint8) {
+	expected := ComputeGlobalChecksum(rom)
+	found := h.globalChecksumValue()
+	if expected == found {
+		r.add(CheckGlobalChecksum, SeverityOK, "0x%04x", found)
+	} else {
+		// The Game Boy never verifies the global checksum
+		r.add(CheckGlobalChecksum, SeverityWarning, "expected 0x%04x found 0x%04x", expected, found)
+	}
+}
+
+func (r *ValidationReport) checkFileSize(h *CartridgeHeader, rom []uint8) {
+	if !h.IsKnownROMSize() {
+		r.add(CheckFileSize, SeverityError, "unknown ROM size code 0x%02x", h.ROMSize)
+	} else if declared := h.ROMSizeBytes(); len(rom) < declared {
+		r.add(CheckFileSize, SeverityError, "file is %v but header declares %v", formatSize(len(rom)), formatSize(declared))
+	} else if len(rom) > declared {
+		r.add(CheckFileSize, SeverityWarning, "file is %v but header declares %v (overdump?)",
+			formatSize(len(rom)), formatSize(declared))
+	} else {
+		r.add(CheckFileSize, SeverityOK, "%v", formatSize(len(rom)))
+	}
+
+	if size := len(rom); size >= 2*ROMBankSize && size&(size-1) == 0 {
+		r.add(CheckPowerOfTwo, SeverityOK, "%v", formatSize(size))
+	} else {
+		r.add(CheckPowerOfTwo, SeverityWarning, "%v is not a power of two of at least 32KB", formatSize(size))
+	}
+}
+
+func (r *ValidationReport) checkTypeSize(h *CartridgeHeader) {
+	limits, ok := h.mbcLimits()
+	if !ok {
+		r.add(CheckTypeSize, SeverityWarning, "can not check cartridge type 0x%02x", h.CartridgeType)
+		return
+	}
+
+	if !h.IsKnownROMSize() {
+		r.add(CheckTypeSize, SeverityError, "unknown ROM size code 0x%02x", h.ROMSize)
+	} else if h.ROMSizeBytes() > limits.maxROM {
+		r.add(CheckTypeSize, SeverityError, "%v can not address %v of ROM (max %v)",
+			limits.name, formatSize(h.ROMSizeBytes()), formatSize(limits.maxROM))
+	} else {
+		r.add(CheckTypeSize, SeverityOK, "%v with %v of ROM", limits.name, formatSize(h.ROMSizeBytes()))
+	}
+}
+
+func (r *ValidationReport) checkRAMSize(h *CartridgeHeader) {
+	if !h.IsKnownRAMSize() {
+		r.add(CheckRAMSize, SeverityError, "unknown RAM size code 0x%02x", h.RAMSize)
+		return
+	}
+
+	size := h.RAMSizeBytes()
+	limits, ok := h.mbcLimits()
+	switch {
+	case h.IsMBC2() && size != 0:
+		r.add(CheckRAMSize, SeverityWarning, "MBC2 has built-in RAM but header declares %v", formatSize(size))
+	case h.IsMBC2():
+		r.add(CheckRAMSize, SeverityOK, "MBC2 built-in 512x4 bits RAM")
+	case h.HasRAM() && size == 0:
+		r.add(CheckRAMSize, SeverityError, "cartridge type has RAM but header declares no RAM")
+	case !h.HasRAM() && size != 0:
+		r.add(CheckRAMSize, SeverityWarning, "cartridge type has no RAM but header declares %v", formatSize(size))
+	case ok && size > limits.maxRAM:
+		r.add(CheckRAMSize, SeverityError, "%v can not address %v of RAM (max %v)",
+			limits.name, formatSize(size), formatSize(limits.maxRAM))
+	case size == 0:
+		r.add(CheckRAMSize, SeverityOK, "no RAM")
+	default:
+		r.add(CheckRAMSize, SeverityOK, "%v", formatSize(size))
+	}
+}
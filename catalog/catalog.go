@@ -0,0 +1,273 @@
+// Package catalog keeps track of a physical cartridge collection. Every dump, save snapshot and
+// note is appended as a JSON line to a local file, so the catalog can be versioned, merged
+// or inspected with standard text tools.
+package catalog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// RecordType identifies the kind of event stored in a catalog line
+type RecordType string
+
+const (
+	DumpRecord RecordType = "dump"
+	SaveRecord RecordType = "save"
+	NoteRecord RecordType = "note"
+)
+
+// Record is a single line of the catalog file
+type Record struct {
+	Type   RecordType `json:"type"`
+	CartID string     `json:"cart_id"`
+	Time   time.Time  `json:"time"`
+
+	// Dump records
+	Header        *cartridge.HeaderInfo `json:"header,omitempty"`
+	ROM           *cartridge.Hashes     `json:"rom,omitempty"`
+	ROMSize       int                   `json:"rom_size,omitempty"`
+	UnstableReads int                   `json:"unstable_reads,omitempty"` // bytes that changed between read passes
+
+	// Save records
+	Save *cartridge.SaveInfo `json:"save,omitempty"`
+
+	Notes string `json:"notes,omitempty"`
+}
+
+// Cart aggregates every record of a physical cartridge
+type Cart struct {
+	ID     string
+	Header *cartridge.HeaderInfo // from the latest dump
+	Dumps  []Record
+	Saves  []Record
+	Notes  []Record
+}
+
+// LatestDump returns the most recent dump of the cartridge
+func (c *Cart) LatestDump() (Record, bool) {
+	if len(c.Dumps) == 0 {
+		return Record{}, false
+	}
+	return c.Dumps[len(c.Dumps)-1], true
+}
+
+// LatestSave returns the most recent save snapshot of the cartridge
+func (c *Cart) LatestSave() (Record, bool) {
+	if len(c.Saves) == 0 {
+		return Record{}, false
+	}
+	return c.Saves[len(c.Saves)-1], true
+}
+
+// SaveChanged returns true if the latest save snapshot differs from the previous one
+func (c *Cart) SaveChanged() bool {
+	if len(c.Saves) < 2 {
+		return false
+	}
+	last, prev := c.Saves[len(c.Saves)-1], c.Saves[len(c.Saves)-2]
+	return last.Save.Hashes.SHA1 != prev.Save.Hashes.SHA1
+}
+
+// Unstable returns true if any dump reported unstable reads or if dumps of the same cartridge
+// produced different ROMs
+func (c *Cart) Unstable() bool {
+	hashes := map[string]bool{}
+	for _, d := range c.Dumps {
+		if d.UnstableReads > 0 {
+			return true
+		}
+		if d.ROM != nil {
+			hashes[d.ROM.SHA1] = true
+		}
+	}
+	return len(hashes) > 1
+}
+
+// CartID returns the default identifier of a cartridge: its title plus the global checksum.
+// Use explicit identifiers (ie. a label on the cartridge) to tell apart copies of the same game
+func CartID(c *cartridge.Cartridge) string {
+	return c.Header.Identifier()
+}
+
+// Catalog is an append only collection of records stored as JSON lines
+type Catalog struct {
+	path  string
+	carts map[string]*Cart
+}
+
+// Open loads the catalog stored in path. The file is created on the first write
+func Open(path string) (*Catalog, error) {
+	cat := &Catalog{path: path, carts: map[string]*Cart{}}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return cat, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening catalog: %v", err)
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", path, line, err)
+		}
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", path, line, err)
+		}
+		cat.index(r)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("reading catalog: %v", err)
+	}
+	return cat, nil
+}
+
+// validate checks that the record has the fields its type requires. The catalog can be edited
+// by hand, so the records read back are not trusted
+func (r *Record) validate() error {
+	switch {
+	case r.CartID == "":
+		return fmt.Errorf("record without cartridge id")
+	case r.Type == DumpRecord && r.ROM == nil:
+		return fmt.Errorf("dump record without rom hashes")
+	case r.Type == SaveRecord && r.Save == nil:
+		return fmt.Errorf("save record without save hashes")
+	}
+	return nil
+}
+
+func (cat *Catalog) index(r Record) {
+	c, ok := cat.carts[r.CartID]
+	if !ok {
+		c = &Cart{ID: r.CartID}
+		cat.carts[r.CartID] = c
+	}
+
+	switch r.Type {
+	case DumpRecord:
+		c.Dumps = append(c.Dumps, r)
+		if r.Header != nil {
+			c.Header = r.Header
+		}
+	case SaveRecord:
+		c.Saves = append(c.Saves, r)
+	case NoteRecord:
+		c.Notes = append(c.Notes, r)
+	}
+}
+
+// Append stores a record at the end of the catalog file
+func (cat *Catalog) Append(r Record) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if r.Time.IsZero() {
+		r.Time = time.Now().UTC()
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("encoding record: %v", err)
+	}
+
+	f, err := os.OpenFile(cat.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening catalog: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing catalog: %v", err)
+	}
+	cat.index(r)
+	return nil
+}
+
+// DumpOptions holds the dump quality information recorded alongside a dump
+type DumpOptions struct {
+	UnstableReads int
+	Notes         string
+}
+
+// AddDump records a dump of the cartridge. If the cartridge has RAM banks a save snapshot is
+// recorded as well
+func (cat *Catalog) AddDump(id string, c *cartridge.Cartridge, opts DumpOptions) error {
+	rom := c.Bytes()
+	hashes := cartridge.HashBytes(rom)
+	now := time.Now().UTC()
+
+	err := cat.Append(Record{
+		Type:          DumpRecord,
+		CartID:        id,
+		Time:          now,
+		Header:        c.Info(),
+		ROM:           &hashes,
+		ROMSize:       len(rom),
+		UnstableReads: opts.UnstableReads,
+		Notes:         opts.Notes,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(c.RAMBanks) > 0 {
+		return cat.AddSave(id, c.RAM(), now)
+	}
+	return nil
+}
+
+// AddSave records a save snapshot taken at the given time
+func (cat *Catalog) AddSave(id string, ram []uint8, at time.Time) error {
+	return cat.Append(Record{
+		Type:   SaveRecord,
+		CartID: id,
+		Time:   at,
+		Save:   &cartridge.SaveInfo{Size: len(ram), Hashes: cartridge.HashBytes(ram)},
+	})
+}
+
+// AddNote records a free text note about the cartridge (ie. "label damaged")
+func (cat *Catalog) AddNote(id, notes string) error {
+	return cat.Append(Record{Type: NoteRecord, CartID: id, Notes: notes})
+}
+
+// Cart returns the cartridge with the given identifier
+func (cat *Catalog) Cart(id string) (*Cart, bool) {
+	c, ok := cat.carts[id]
+	return c, ok
+}
+
+// Carts returns every cartridge sorted by identifier
+func (cat *Catalog) Carts() []*Cart {
+	return cat.Query()
+}
+
+// Query returns the cartridges matching all the filters sorted by identifier
+func (cat *Catalog) Query(filters ...Filter) []*Cart {
+	var carts []*Cart
+next:
+	for _, c := range cat.carts {
+		for _, f := range filters {
+			if !f(c) {
+				continue next
+			}
+		}
+		carts = append(carts, c)
+	}
+
+	sort.Slice(carts, func(i, j int) bool { return carts[i].ID < carts[j].ID })
+	return carts
+}
@@ -0,0 +1,47 @@
+package catalog
+
+import (
+	"strings"
+	"time"
+)
+
+// Filter selects cartridges in a catalog query
+type Filter func(*Cart) bool
+
+// MBC matches cartridges whose type starts with the given name (ie. "MBC3" or "ROM")
+func MBC(name string) Filter {
+	name = strings.ToUpper(name)
+	return func(c *Cart) bool {
+		return c.Header != nil && strings.HasPrefix(strings.ToUpper(c.Header.CartridgeTypeTxt), name)
+	}
+}
+
+// TitleContains matches cartridges whose title contains s (case insensitive)
+func TitleContains(s string) Filter {
+	s = strings.ToUpper(s)
+	return func(c *Cart) bool {
+		return c.Header != nil && strings.Contains(strings.ToUpper(c.Header.Title), s)
+	}
+}
+
+// SaveChanged matches cartridges whose latest save snapshot differs from the previous backup
+func SaveChanged() Filter {
+	return func(c *Cart) bool {
+		return c.SaveChanged()
+	}
+}
+
+// UnstableReads matches cartridges with unstable dumps
+func UnstableReads() Filter {
+	return func(c *Cart) bool {
+		return c.Unstable()
+	}
+}
+
+// NotBackedUpSince matches cartridges without save snapshots after t
+func NotBackedUpSince(t time.Time) Filter {
+	return func(c *Cart) bool {
+		s, ok := c.LatestSave()
+		return !ok || s.Time.Before(t)
+	}
+}
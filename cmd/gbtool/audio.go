@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func runAudio(args []string) int {
+	fs := newFlagSet("audio", "rom.gb out.wav")
+	seconds := fs.Float64("seconds", 10, "seconds of audio to render")
+	rate := fs.Int("rate", emu.DefaultSampleRate, "sample rate of the WAV file")
+	fs.Parse(args)
+	if fs.NArg() != 2 || *seconds <= 0 || *rate <= 0 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := readCartridge(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	gb, err := emu.New(c)
+	if err != nil {
+		return fail("%v", err)
+	}
+	gb.Bus.APU.SampleRate = *rate
+	gb.RunFor(int(*seconds * cartridge.CyclesPerSecond))
+
+	f, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer f.Close()
+	if err := emu.WriteWAV(f, gb.Samples(), *rate); err != nil {
+		return fail("%v", err)
+	}
+	return 0
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/catalog"
+)
+
+const defaultCatalog = "catalog.jsonl"
+
+func catalogUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: gbtool catalog <add|save|note|list|show> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "  add   [--id ID] [--save game.sav] [--unstable N] [--notes TEXT] rom.gb")
+	fmt.Fprintln(os.Stderr, "  save  --id ID game.sav")
+	fmt.Fprintln(os.Stderr, "  note  --id ID TEXT")
+	fmt.Fprintln(os.Stderr, "  list  [--mbc MBC3] [--title TEXT] [--save-changed] [--unstable]")
+	fmt.Fprintln(os.Stderr, "  show  ID")
+}
+
+func runCatalog(args []string) int {
+	if len(args) == 0 {
+		catalogUsage()
+		return 2
+	}
+
+	switch args[0] {
+	case "add":
+		return runCatalogAdd(args[1:])
+	case "save":
+		return runCatalogSave(args[1:])
+	case "note":
+		return runCatalogNote(args[1:])
+	case "list":
+		return runCatalogList(args[1:])
+	case "show":
+		return runCatalogShow(args[1:])
+	}
+	catalogUsage()
+	return 2
+}
+
+func runCatalogAdd(args []string) int {
+	fs := newFlagSet("catalog add", "rom.gb")
+	db := fs.String("db", defaultCatalog, "catalog file")
+	id := fs.String("id", "", "cartridge identifier (default: title and global checksum)")
+	save := fs.String("save", "", "save file dumped alongside the ROM")
+	unstable := fs.Int("unstable", 0, "number of bytes that changed between read passes")
+	notes := fs.String("notes", "", "dump quality notes")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cat, err := catalog.Open(*db)
+	if err != nil {
+		return fail("%v", err)
+	}
+	c, err := readCartridge(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	if *save != "" {
+		if err := c.LoadSaveFile(*save); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	cartID := *id
+	if cartID == "" {
+		cartID = catalog.CartID(c)
+	}
+	if err := cat.AddDump(cartID, c, catalog.DumpOptions{UnstableReads: *unstable, Notes: *notes}); err != nil {
+		return fail("%v", err)
+	}
+	fmt.Printf("%s: added to %s as %s\n", fs.Arg(0), *db, cartID)
+	return 0
+}
+
+func runCatalogSave(args []string) int {
+	fs := newFlagSet("catalog save", "game.sav")
+	db := fs.String("db", defaultCatalog, "catalog file")
+	id := fs.String("id", "", "cartridge identifier (required)")
+	fs.Parse(args)
+	if *id == "" || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cat, err := catalog.Open(*db)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if _, ok := cat.Cart(*id); !ok {
+		return fail("unknown cartridge %q", *id)
+	}
+	ram, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := cat.AddSave(*id, ram, time.Now().UTC()); err != nil {
+		return fail("%v", err)
+	}
+	return 0
+}
+
+func runCatalogNote(args []string) int {
+	fs := newFlagSet("catalog note", "TEXT")
+	db := fs.String("db", defaultCatalog, "catalog file")
+	id := fs.String("id", "", "cartridge identifier (required)")
+	fs.Parse(args)
+	if *id == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cat, err := catalog.Open(*db)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := cat.AddNote(*id, strings.Join(fs.Args(), " ")); err != nil {
+		return fail("%v", err)
+	}
+	return 0
+}
+
+func runCatalogList(args []string) int {
+	fs := newFlagSet("catalog list", "")
+	db := fs.String("db", defaultCatalog, "catalog file")
+	mbc := fs.String("mbc", "", "only cartridges with this mapper (ie. MBC3)")
+	title := fs.String("title", "", "only cartridges whose title contains this text")
+	saveChanged := fs.Bool("save-changed", false, "only cartridges whose save changed since the previous backup")
+	unstable := fs.Bool("unstable", false, "only cartridges with unstable reads")
+	fs.Parse(args)
+
+	cat, err := catalog.Open(*db)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	var filters []catalog.Filter
+	if *mbc != "" {
+		filters = append(filters, catalog.MBC(*mbc))
+	}
+	if *title != "" {
+		filters = append(filters, catalog.TitleContains(*title))
+	}
+	if *saveChanged {
+		filters = append(filters, catalog.SaveChanged())
+	}
+	if *unstable {
+		filters = append(filters, catalog.UnstableReads())
+	}
+
+	for _, c := range cat.Query(filters...) {
+		title, cartType := "?", "?"
+		if c.Header != nil {
+			title, cartType = c.Header.Title, c.Header.CartridgeTypeTxt
+		}
+		fmt.Printf("%-24s %-16s %-28s dumps=%d saves=%d\n", c.ID, title, cartType, len(c.Dumps), len(c.Saves))
+	}
+	return 0
+}
+
+func runCatalogShow(args []string) int {
+	fs := newFlagSet("catalog show", "ID")
+	db := fs.String("db", defaultCatalog, "catalog file")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	cat, err := catalog.Open(*db)
+	if err != nil {
+		return fail("%v", err)
+	}
+	c, ok := cat.Cart(fs.Arg(0))
+	if !ok {
+		return fail("unknown cartridge %q", fs.Arg(0))
+	}
+
+	if c.Header != nil {
+		c.Header.Write(os.Stdout, cartridge.FormatText)
+	}
+	for _, d := range c.Dumps {
+		fmt.Printf("dump %s sha1=%s unstable=%d %s\n", d.Time.Format(time.RFC3339), d.ROM.SHA1, d.UnstableReads, d.Notes)
+	}
+	for _, s := range c.Saves {
+		fmt.Printf("save %s sha1=%s size=%d\n", s.Time.Format(time.RFC3339), s.Save.Hashes.SHA1, s.Save.Size)
+	}
+	for _, n := range c.Notes {
+		fmt.Printf("note %s %s\n", n.Time.Format(time.RFC3339), n.Notes)
+	}
+	return 0
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/debug"
+	"github.com/Guillem96/gameboy-tools/disasm"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func runDebug(args []string) int {
+	fs := newFlagSet("debug", "rom.gb")
+	symFile := fs.String("sym", "", "RGBDS symbol file with the labels (default rom.sym if it exists)")
+	gdbAddr := fs.String("gdb", "", "serve the GDB remote protocol on this address (ie. localhost:2159) instead of the prompt")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := readCartridge(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	gb, err := emu.New(c)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	var syms *disasm.Symbols
+	if *symFile == "" {
+		fname := strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + ".sym"
+		if _, err := os.Stat(fname); err == nil {
+			*symFile = fname
+		}
+	}
+	if *symFile != "" {
+		if syms, err = disasm.LoadSymbols(*symFile); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	d := debug.New(gb, syms)
+	if *gdbAddr != "" {
+		l, err := net.Listen("tcp", *gdbAddr)
+		if err != nil {
+			return fail("%v", err)
+		}
+		defer l.Close()
+		fmt.Fprintf(os.Stderr, "gbtool: waiting for GDB on %s\n", l.Addr())
+		if err := d.ServeGDB(l); err != nil {
+			return fail("%v", err)
+		}
+		return 0
+	}
+
+	// Ctrl+C stops the execution instead of exiting
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			d.Interrupt()
+		}
+	}()
+
+	if err := d.Run(os.Stdin, os.Stdout); err != nil {
+		return fail("%v", err)
+	}
+	return 0
+}
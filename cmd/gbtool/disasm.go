@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Guillem96/gameboy-tools/disasm"
+)
+
+func runDisasm(args []string) int {
+	fs := newFlagSet("disasm", "rom.gb [out.asm]")
+	symFile := fs.String("sym", "", "RGBDS symbol file with the labels to use")
+	fs.Parse(args)
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := readCartridge(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	var syms *disasm.Symbols
+	if *symFile != "" {
+		if syms, err = disasm.LoadSymbols(*symFile); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	d := disasm.Analyze(c, syms)
+	out := os.Stdout
+	if fs.NArg() == 2 {
+		if out, err = os.Create(fs.Arg(1)); err != nil {
+			return fail("%v", err)
+		}
+		defer out.Close()
+	}
+	if err := d.WriteRGBDS(out); err != nil {
+		return fail("%v", err)
+	}
+	for _, b := range d.Unresolved {
+		fmt.Fprintf(os.Stderr, "gbtool: unresolved bank of the branch to $%04X at %02X:%04X\n", b.Target, b.Bank, b.Addr)
+	}
+	return 0
+}
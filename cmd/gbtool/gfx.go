@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"image/png"
+	"os"
+	"strconv"
+
+	"github.com/Guillem96/gameboy-tools/gfx"
+)
+
+func gfxUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: gbtool gfx <extract|import> --bank N --offset HEX --count N [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "  extract rom.gb out.png")
+	fmt.Fprintln(os.Stderr, "  import  rom.gb in.png [out.gb]")
+	fmt.Fprintln(os.Stderr, "\nThe offset is relative to the bank (0000-3FFF). Imported tiles use the same layout")
+	fmt.Fprintln(os.Stderr, "flags as the extracted sheet, and the ROM is patched in place unless out.gb is given.")
+}
+
+func runGfx(args []string) int {
+	if len(args) == 0 {
+		gfxUsage()
+		return 2
+	}
+
+	action := args[0]
+	fs := newFlagSet("gfx "+action, "")
+	fs.Usage = gfxUsage
+	bank := fs.Int("bank", 0, "ROM bank of the tiles")
+	offset := fs.String("offset", "0", "offset of the first tile in the bank, in hexadecimal")
+	count := fs.Int("count", 256, "number of tiles")
+	format := fs.String("format", "2bpp", "tile format: 2bpp or 1bpp")
+	palette := fs.String("palette", "", "colors 0 to 3 as RGB hex, e.g. ffffff,aaaaaa,555555,000000")
+	perRow := fs.Int("width", 16, "tiles per row of the sheet")
+	tall := fs.Bool("tall", false, "8x16 mode, pairs of tiles are stacked")
+	fs.Parse(args[1:])
+
+	o := gfx.Options{TilesPerRow: *perRow, Tall: *tall}
+	var err error
+	if o.Format, err = gfx.ParseFormat(*format); err != nil {
+		return fail("%v", err)
+	}
+	if *palette != "" {
+		if o.Palette, err = gfx.ParsePalette(*palette); err != nil {
+			return fail("%v", err)
+		}
+	}
+	off, err := strconv.ParseUint(*offset, 16, 16)
+	if err != nil {
+		return fail("invalid offset %q", *offset)
+	}
+
+	switch {
+	case action == "extract" && fs.NArg() == 2:
+		c, err := readCartridge(fs.Arg(0))
+		if err != nil {
+			return fail("%v", err)
+		}
+		img, err := gfx.ExtractTiles(c, *bank, int(off), *count, o)
+		if err != nil {
+			return fail("%v", err)
+		}
+		f, err := os.Create(fs.Arg(1))
+		if err != nil {
+			return fail("%v", err)
+		}
+		defer f.Close()
+		if err := png.Encode(f, img); err != nil {
+			return fail("writing %v: %v", fs.Arg(1), err)
+		}
+	case action == "import" && (fs.NArg() == 2 || fs.NArg() == 3):
+		c, err := readCartridge(fs.Arg(0))
+		if err != nil {
+			return fail("%v", err)
+		}
+		f, err := os.Open(fs.Arg(1))
+		if err != nil {
+			return fail("%v", err)
+		}
+		img, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			return fail("reading %v: %v", fs.Arg(1), err)
+		}
+		if err := gfx.PatchTiles(c, *bank, int(off), *count, img, o); err != nil {
+			return fail("%v", err)
+		}
+		out := fs.Arg(0)
+		if fs.NArg() == 3 {
+			out = fs.Arg(2)
+		}
+		if err := c.Save(out); err != nil {
+			return fail("%v", err)
+		}
+	default:
+		gfxUsage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+func runInfo(args []string) int {
+	fs := newFlagSet("info", "rom.gb")
+	format := fs.String("format", "text", "output format: text, json or yaml")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	f, err := cartridge.ParseInfoFormat(*format)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	c, err := readCartridge(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	if err := c.WriteInfo(os.Stdout, f); err != nil {
+		return fail("%v", err)
+	}
+	return 0
+}
+
+func runValidate(args []string) int {
+	fs := newFlagSet("validate", "rom.gb")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	rom, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	r := cartridge.ValidateROM(rom)
+	if *asJSON {
+		err = r.WriteJSON(os.Stdout)
+	} else {
+		err = r.Write(os.Stdout)
+	}
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	if !r.OK() {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+func runLogo(args []string) int {
+	fs := newFlagSet("logo", "rom.gb")
+	out := fs.String("png", "", "also write the logo as PNG to this file")
+	scale := fs.Int("scale", 8, "pixel size of the PNG logo")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	frr := cartridge.NewFileROMReader(fs.Arg(0))
+	frr.SetLogOutput(ioutil.Discard)
+	h, err := frr.ReadHeader()
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	fmt.Print(cartridge.LogoASCII(h.NintendoLogo))
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return fail("%v", err)
+		}
+		defer f.Close()
+		if err := cartridge.WriteLogoPNG(f, h.NintendoLogo, *scale); err != nil {
+			return fail("writing %v: %v", *out, err)
+		}
+	}
+
+	diffs := h.LogoDiff()
+	if len(diffs) == 0 {
+		fmt.Println("\nThe logo matches the genuine logo")
+		return 0
+	}
+	fmt.Printf("\n%d bits differ from the genuine logo (+ should be light, - should be dark):\n", len(diffs))
+	for _, d := range diffs {
+		fmt.Printf("  %v\n", d)
+	}
+	fmt.Println("\nBy data line:")
+	for _, l := range cartridge.LogoDataLines(diffs) {
+		fmt.Printf("  %v\n", l)
+	}
+	return 1
+}
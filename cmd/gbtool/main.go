@@ -0,0 +1,99 @@
+// Command gbtool groups the Game Boy tools of this repository under a single binary.
+//
+// Usage:
+//
+//	gbtool <command> [flags] [arguments]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/conmap"
+	"github.com/Guillem96/gameboy-tools/gbproxy"
+)
+
+type command struct {
+	summary string
+	run     func(args []string) int
+}
+
+var commands = map[string]command{
+	"audio":      {"run a ROM headless and save its audio as WAV", runAudio},
+	"catalog":    {"track dumps and saves of a cartridge collection", runCatalog},
+	"debug":      {"debug a ROM with breakpoints, watchpoints and disassembly", runDebug},
+	"disasm":     {"disassemble a ROM into RGBDS assembly", runDisasm},
+	"gfx":        {"extract tile graphics to PNG or import them back", runGfx},
+	"info":       {"print the decoded cartridge header", runInfo},
+	"logo":       {"draw the header logo and show the bits that differ from the genuine one", runLogo},
+	"manifest":   {"create or check the sidecar manifest of a dump", runManifest},
+	"run":        {"run a ROM headless and check its frame hash or serial output", runRun},
+	"save":       {"convert saves between emulator formats and cartridges", runSave},
+	"screenshot": {"run a ROM headless and save the screen as PNG", runScreenshot},
+	"validate":   {"run every validation check on a ROM file", runValidate},
+	"vault":      {"keep the history of cartridge saves", runVault},
+	"verify":     {"check ROM files against a No-Intro DAT", runVerify},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gbtool <command> [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "\nCommands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "gbtool: unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+	os.Exit(cmd.run(os.Args[2:]))
+}
+
+// newFlagSet creates the flag set of a subcommand with a usage message listing its arguments
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet("gbtool "+name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: gbtool %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// readCartridge reads a ROM file without printing the reader progress messages
+func readCartridge(fname string) (*cartridge.Cartridge, error) {
+	frr := cartridge.NewFileROMReader(fname)
+	frr.SetLogOutput(ioutil.Discard)
+	return frr.ReadCartridge()
+}
+
+// withProxy runs f with a Raspberry Pi proxy configured with the given pin mapping
+func withProxy(mapping string, f func(p gbproxy.GameBoyProxy) ([]uint8, error)) ([]uint8, error) {
+	cm := conmap.ParseRaspberryWireMapping(mapping)
+	p := gbproxy.NewRPiGameBoyProxy(cm, true)
+	defer p.End()
+	return f(p)
+}
+
+func fail(format string, args ...interface{}) int {
+	fmt.Fprintf(os.Stderr, "gbtool: "+format+"\n", args...)
+	return 1
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+func runManifest(args []string) int {
+	fs := newFlagSet("manifest", "rom.gb")
+	check := fs.Bool("check", false, "compare the ROM against its existing manifest instead of creating it")
+	save := fs.String("save", "", "save file (.sav) dumped from the cartridge")
+	backend := fs.String("backend", "file", "backend used to dump the cartridge")
+	timing := fs.String("timing", "", "timing used by the backend (ie. 50us)")
+	mapping := fs.String("mapping", "", "pin mapping file used by the backend")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	romFile := fs.Arg(0)
+	c, err := readCartridge(romFile)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if *save != "" {
+		if err := c.LoadSaveFile(*save); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	if *check {
+		m, err := cartridge.ReadManifest(cartridge.ManifestPath(romFile))
+		if err != nil {
+			return fail("%v", err)
+		}
+		problems := m.Check(c)
+		for _, p := range problems {
+			fmt.Printf("%s: %s\n", romFile, p)
+		}
+		if len(problems) > 0 {
+			return 1
+		}
+		fmt.Printf("%s: OK\n", romFile)
+		return 0
+	}
+
+	m := c.Manifest(cartridge.DumpInfo{Backend: *backend, Timing: *timing, MappingFile: *mapping})
+	if err := m.WriteFile(cartridge.ManifestPath(romFile)); err != nil {
+		return fail("%v", err)
+	}
+	fmt.Printf("%s: manifest written to %s\n", romFile, cartridge.ManifestPath(romFile))
+	return 0
+}
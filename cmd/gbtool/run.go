@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func runRun(args []string) int {
+	fs := newFlagSet("run", "rom.gb")
+	frames := fs.Int("frames", 600, "maximum number of frames to run")
+	input := fs.String("input", "", "input script with the joypad events of each frame")
+	expectHash := fs.String("expect-frame-hash", "", "SHA-1 of the last frame")
+	expectSerial := fs.String("expect-serial", "", "text the ROM has to print on the serial port")
+	loadState := fs.String("load-state", "", "save state to start from")
+	saveState := fs.String("save-state", "", "write a save state after running")
+	record := fs.String("record", "", "record the joypad state of every frame to a movie file")
+	movie := fs.String("movie", "", "replay a movie file")
+	fs.Parse(args)
+	rom, rest := fs.Arg(0), fs.Args()
+	if len(rest) > 1 {
+		// Flags can also follow the ROM file name
+		fs.Parse(rest[1:])
+		rest = append([]string{rom}, fs.Args()...)
+	}
+	if len(rest) != 1 || *frames <= 0 || *movie != "" && (*loadState != "" || *record != "") {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := readCartridge(rom)
+	if err != nil {
+		return fail("%v", err)
+	}
+	gb, err := emu.New(c)
+	if err != nil {
+		return fail("%v", err)
+	}
+	if *input != "" {
+		err := readFile(*input, func(r io.Reader) (err error) {
+			gb.Input, err = emu.ParseInputScript(r)
+			return err
+		})
+		if err != nil {
+			return fail("%v", err)
+		}
+	}
+	if *loadState != "" {
+		if err := readFile(*loadState, gb.LoadState); err != nil {
+			return fail("%v", err)
+		}
+	}
+	var recording *emu.Movie
+	if *record != "" {
+		if recording, err = gb.RecordMovie(*loadState != ""); err != nil {
+			return fail("%v", err)
+		}
+	}
+	if *movie != "" {
+		err := readFile(*movie, func(r io.Reader) error {
+			m, err := emu.ReadMovie(r)
+			if err != nil {
+				return err
+			}
+			return gb.PlayMovie(m)
+		})
+		if err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	m := emu.NewTestMonitor(gb)
+	for n := 0; n < *frames; n++ {
+		gb.RunFrame()
+		if *expectHash != "" {
+			continue // the hash is checked on the last frame
+		}
+		if m.Result != emu.TestRunning || gb.CPU.Locked ||
+			*expectSerial != "" && strings.Contains(m.Serial.String(), *expectSerial) {
+			break
+		}
+	}
+
+	fmt.Printf("frames: %d\n", gb.Frames)
+	fmt.Printf("frame hash: %s\n", gb.FrameHash())
+	if m.Serial.Len() > 0 {
+		fmt.Printf("serial: %q\n", m.Serial.String())
+	}
+	if m.Breakpoints > 0 {
+		fmt.Printf("breakpoint: %v\n", m.Result)
+	}
+
+	if *saveState != "" {
+		if err := writeFile(*saveState, gb.SaveState); err != nil {
+			return fail("%v", err)
+		}
+	}
+	if recording != nil {
+		if err := writeFile(*record, recording.Write); err != nil {
+			return fail("%v", err)
+		}
+	}
+
+	status := 0
+	if gb.CPU.Locked {
+		fmt.Fprintf(os.Stderr, "gbtool: CPU locked by an illegal opcode at %04x\n", gb.CPU.PC-1)
+		status = 1
+	}
+	if m.Result == emu.TestFailed {
+		fmt.Fprintln(os.Stderr, "gbtool: test ROM failed")
+		status = 1
+	}
+	if *expectHash != "" && !strings.EqualFold(*expectHash, gb.FrameHash()) {
+		fmt.Fprintf(os.Stderr, "gbtool: frame hash mismatch, expected %s\n", *expectHash)
+		status = 1
+	}
+	if *expectSerial != "" && !strings.Contains(m.Serial.String(), *expectSerial) {
+		fmt.Fprintf(os.Stderr, "gbtool: serial output does not contain %q\n", *expectSerial)
+		status = 1
+	}
+	return status
+}
+
+// readFile opens the file and decodes it with the given function
+func readFile(fname string, decode func(r io.Reader) error) error {
+	f, err := os.Open(fname)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return decode(bufio.NewReader(f))
+}
+
+// writeFile creates the file and encodes it with the given function
+func writeFile(fname string, encode func(w io.Writer) error) error {
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := encode(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
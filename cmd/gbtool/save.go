@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/gbproxy"
+)
+
+func saveUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: gbtool save <convert|read|write> --rom rom.gb [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "  convert --to FORMAT in.sav out.sav")
+	fmt.Fprintln(os.Stderr, "  read    --mapping pins.yaml [--to FORMAT] out.sav")
+	fmt.Fprintln(os.Stderr, "  write   --mapping pins.yaml in.sav")
+	fmt.Fprintln(os.Stderr, "\nFORMAT is raw, vbam, mgba, bgb or sameboy. The format of input saves is detected.")
+	fmt.Fprintln(os.Stderr, "Clocks are advanced to the current time using the timestamp stored in the save.")
+}
+
+func runSave(args []string) int {
+	if len(args) == 0 {
+		saveUsage()
+		return 2
+	}
+
+	action := args[0]
+	fs := newFlagSet("save "+action, "")
+	fs.Usage = saveUsage
+	romFile := fs.String("rom", "", "ROM of the cartridge, needed to know the RAM size (required)")
+	to := fs.String("to", "", "format of the output save")
+	mapping := fs.String("mapping", "", "Raspberry Pi pin mapping, to access the physical cartridge")
+	fs.Parse(args[1:])
+	if *romFile == "" {
+		saveUsage()
+		return 2
+	}
+
+	c, err := readCartridge(*romFile)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	format := cartridge.RawSave
+	if *to != "" {
+		if format, err = cartridge.ParseSaveFormat(*to); err != nil {
+			return fail("%v", err)
+		}
+	} else if c.Header.HasTimer() {
+		format = cartridge.VBAMSave
+	}
+
+	switch {
+	case action == "convert" && *to != "" && fs.NArg() == 2:
+		f, err := importSave(c, fs.Arg(0))
+		if err != nil {
+			return fail("%v", err)
+		}
+		if err := c.ExportSaveFile(fs.Arg(1), format); err != nil {
+			return fail("%v", err)
+		}
+		fmt.Printf("%s: converted %v save to %v\n", fs.Arg(1), f, format)
+
+	case action == "read" && *mapping != "" && fs.NArg() == 1:
+		_, err = withProxy(*mapping, func(p gbproxy.GameBoyProxy) ([]uint8, error) {
+			ram, err := cartridge.ReadSRAM(p, c.Header)
+			if err != nil {
+				return nil, err
+			}
+			c.SetRAM(ram)
+			if c.Header.HasTimer() {
+				c.RTC, err = cartridge.ReadRTC(p, c.Header)
+			}
+			return ram, err
+		})
+		if err == nil {
+			err = c.ExportSaveFile(fs.Arg(0), format)
+		}
+		if err != nil {
+			return fail("%v", err)
+		}
+		fmt.Printf("%s: read %v save from the cartridge\n", fs.Arg(0), format)
+
+	case action == "write" && *mapping != "" && fs.NArg() == 1:
+		if _, err := importSave(c, fs.Arg(0)); err != nil {
+			return fail("%v", err)
+		}
+		_, err = withProxy(*mapping, func(p gbproxy.GameBoyProxy) ([]uint8, error) {
+			if err := cartridge.WriteSRAM(p, c.Header, c.RAM()); err != nil {
+				return nil, err
+			}
+			if c.RTC != nil {
+				// The clock was advanced when the save was imported, catch up again after the
+				// (slow) RAM write
+				c.RTC.AdvanceTo(time.Now().UTC())
+				return nil, cartridge.WriteRTC(p, c.Header, c.RTC)
+			}
+			return nil, nil
+		})
+		if err != nil {
+			return fail("%v", err)
+		}
+		fmt.Printf("%s: written to the cartridge\n", fs.Arg(0))
+
+	default:
+		saveUsage()
+		return 2
+	}
+	return 0
+}
+
+// importSave loads a save file in any format into the cartridge, returning the detected format
+func importSave(c *cartridge.Cartridge, fname string) (cartridge.SaveFormat, error) {
+	data, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return cartridge.RawSave, err
+	}
+	return c.ImportSave(data, time.Now().UTC())
+}
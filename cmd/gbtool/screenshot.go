@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func runScreenshot(args []string) int {
+	fs := newFlagSet("screenshot", "rom.gb out.png")
+	frames := fs.Int("frames", 60, "number of frames to run before taking the screenshot")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+
+	c, err := readCartridge(fs.Arg(0))
+	if err != nil {
+		return fail("%v", err)
+	}
+	gb, err := emu.New(c)
+	if err != nil {
+		return fail("%v", err)
+	}
+	for i := 0; i < *frames; i++ {
+		gb.RunFrame()
+	}
+
+	f, err := os.Create(fs.Arg(1))
+	if err != nil {
+		return fail("%v", err)
+	}
+	defer f.Close()
+	if err := gb.WritePNG(f); err != nil {
+		return fail("%v", err)
+	}
+	return 0
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/gbproxy"
+	"github.com/Guillem96/gameboy-tools/vault"
+)
+
+const defaultVault = "saves"
+
+func vaultUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: gbtool vault <store|log|diff|restore> --rom rom.gb [flags] [arguments]")
+	fmt.Fprintln(os.Stderr, "  store   [--label TEXT] [--mapping pins.yaml] [game.sav]")
+	fmt.Fprintln(os.Stderr, "  log")
+	fmt.Fprintln(os.Stderr, "  diff    [--bytes N] OLD NEW")
+	fmt.Fprintln(os.Stderr, "  restore [--mapping pins.yaml] REF [game.sav]")
+	fmt.Fprintln(os.Stderr, "\nREF is a snapshot hash prefix, latest or ~N (N snapshots before the latest).")
+	fmt.Fprintln(os.Stderr, "With --mapping the save is read from or written to the cartridge on the Raspberry Pi.")
+}
+
+func runVault(args []string) int {
+	if len(args) == 0 {
+		vaultUsage()
+		return 2
+	}
+
+	action := args[0]
+	fs := newFlagSet("vault "+action, "")
+	fs.Usage = vaultUsage
+	dir := fs.String("vault", defaultVault, "vault directory")
+	romFile := fs.String("rom", "", "ROM of the cartridge, used to identify the saves (required)")
+	label := fs.String("label", "", "label of the snapshot")
+	mapping := fs.String("mapping", "", "Raspberry Pi pin mapping, to access the physical cartridge")
+	maxBytes := fs.Int("bytes", 32, "maximum number of byte changes shown (-1 shows all)")
+	fs.Parse(args[1:])
+	if *romFile == "" {
+		vaultUsage()
+		return 2
+	}
+
+	v, err := vault.Open(*dir)
+	if err != nil {
+		return fail("%v", err)
+	}
+	c, err := readCartridge(*romFile)
+	if err != nil {
+		return fail("%v", err)
+	}
+	id := vault.CartID(c.Header)
+
+	switch {
+	case action == "store" && (fs.NArg() == 1 || *mapping != ""):
+		var save []uint8
+		if *mapping != "" {
+			save, err = withProxy(*mapping, func(p gbproxy.GameBoyProxy) ([]uint8, error) {
+				return cartridge.ReadSRAM(p, c.Header)
+			})
+		} else {
+			save, err = ioutil.ReadFile(fs.Arg(0))
+		}
+		if err != nil {
+			return fail("%v", err)
+		}
+		snap, err := v.Store(id, save, *label)
+		if err != nil {
+			return fail("%v", err)
+		}
+		fmt.Printf("%s: stored snapshot %s\n", id, snap.Hash)
+
+	case action == "log" && fs.NArg() == 0:
+		snaps, err := v.History(id)
+		if err != nil {
+			return fail("%v", err)
+		}
+		for i, s := range snaps {
+			fmt.Printf("~%-3d %s %s %6d %s\n", len(snaps)-1-i, s.Hash[:12], s.Time.Local().Format(time.RFC3339), s.Size, s.Label)
+		}
+
+	case action == "diff" && fs.NArg() == 2:
+		var saves [2][]uint8
+		for i := range saves {
+			snap, err := v.Find(id, fs.Arg(i))
+			if err != nil {
+				return fail("%v", err)
+			}
+			if saves[i], err = v.Load(snap); err != nil {
+				return fail("%v", err)
+			}
+		}
+		d := vault.Compare(saves[0], saves[1])
+		if d.Empty() {
+			fmt.Println("no changes")
+			return 0
+		}
+		if err := d.Write(os.Stdout, *maxBytes); err != nil {
+			return fail("%v", err)
+		}
+
+	case action == "restore" && (fs.NArg() == 2 || fs.NArg() == 1 && *mapping != ""):
+		snap, err := v.Find(id, fs.Arg(0))
+		if err != nil {
+			return fail("%v", err)
+		}
+		if *mapping != "" {
+			_, err = withProxy(*mapping, func(p gbproxy.GameBoyProxy) ([]uint8, error) {
+				return nil, v.RestoreCartridge(snap, p, c.Header)
+			})
+		} else {
+			err = v.RestoreFile(snap, fs.Arg(1))
+		}
+		if err != nil {
+			return fail("%v", err)
+		}
+		fmt.Printf("%s: restored snapshot %s\n", id, snap.Hash)
+
+	default:
+		vaultUsage()
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/dat"
+)
+
+func runVerify(args []string) int {
+	fs := newFlagSet("verify", "rom.gb [rom.gb...]")
+	datFile := fs.String("dat", "", "No-Intro Logiqx XML DAT file (required)")
+	rename := fs.Bool("rename", false, "rename matching files to their No-Intro name")
+	fs.Parse(args)
+	if *datFile == "" || fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	d, err := dat.LoadFile(*datFile)
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	status := 0
+	for _, fname := range fs.Args() {
+		rom, err := ioutil.ReadFile(fname)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "gbtool: %v\n", err)
+			status = 1
+			continue
+		}
+
+		res := d.VerifyBytes(rom)
+		if !res.Matched() {
+			fmt.Printf("%s: %s (crc32 %s, sha1 %s)\n", fname, res.Level, res.Hashes.CRC32, res.Hashes.SHA1)
+			status = 1
+			continue
+		}
+
+		tags := []string{}
+		for _, t := range []string{res.Region, res.Revision} {
+			if t != "" {
+				tags = append(tags, t)
+			}
+		}
+		fmt.Printf("%s: %s %q [%s]\n", fname, res.Level, res.Game, strings.Join(tags, ", "))
+
+		if *rename && res.ROMName != "" {
+			if err := renameToDATName(fname, res.ROMName); err != nil {
+				fmt.Fprintf(os.Stderr, "gbtool: %v\n", err)
+				status = 1
+			}
+		}
+	}
+	return status
+}
+
+// renameToDATName renames the file keeping it in the same directory. Existing files are not
+// overwritten
+func renameToDATName(fname, romName string) error {
+	target := filepath.Join(filepath.Dir(fname), filepath.Base(romName))
+	if target == fname {
+		return nil
+	}
+	if _, err := os.Stat(target); err == nil {
+		return fmt.Errorf("not renaming %v: %v already exists", fname, target)
+	}
+	if err := os.Rename(fname, target); err != nil {
+		return err
+	}
+	fmt.Printf("%s: renamed to %s\n", fname, target)
+	return nil
+}
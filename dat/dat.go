@@ -0,0 +1,224 @@
+// Package dat loads No-Intro / Redump DAT files (Logiqx XML format) and checks ROM dumps
+// against the known good dumps listed in them.
+package dat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// ROM is a single file of a game entry
+type ROM struct {
+	Name   string `xml:"name,attr"`
+	Size   int64  `xml:"size,attr"`
+	CRC32  string `xml:"crc,attr"`
+	MD5    string `xml:"md5,attr"`
+	SHA1   string `xml:"sha1,attr"`
+	SHA256 string `xml:"sha256,attr"`
+	Status string `xml:"status,attr"`
+}
+
+// Game is a DAT entry. No-Intro DATs list one ROM per Game Boy game
+type Game struct {
+	Name        string `xml:"name,attr"`
+	Description string `xml:"description"`
+	ROMs        []ROM  `xml:"rom"`
+}
+
+// Header contains the DAT file metadata
+type Header struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Version     string `xml:"version"`
+}
+
+// DAT is a parsed Logiqx XML DAT file
+type DAT struct {
+	Header Header `xml:"header"`
+	Games  []Game `xml:"game"`
+	// Newer DATs use machine instead of game
+	Machines []Game `xml:"machine"`
+
+	bySHA1 map[string]*entry
+	byCRC  map[string][]*entry
+}
+
+type entry struct {
+	game *Game
+	rom  *ROM
+}
+
+// Parse reads a Logiqx XML DAT
+func Parse(r io.Reader) (*DAT, error) {
+	d := &DAT{}
+	if err := xml.NewDecoder(r).Decode(d); err != nil {
+		return nil, fmt.Errorf("parsing DAT file: %v", err)
+	}
+	d.Games = append(d.Games, d.Machines...)
+	d.Machines = nil
+
+	d.bySHA1 = map[string]*entry{}
+	d.byCRC = map[string][]*entry{}
+	for i := range d.Games {
+		g := &d.Games[i]
+		for j := range g.ROMs {
+			e := &entry{game: g, rom: &g.ROMs[j]}
+			if e.rom.SHA1 != "" {
+				d.bySHA1[strings.ToLower(e.rom.SHA1)] = e
+			}
+			crc := strings.ToLower(e.rom.CRC32)
+			d.byCRC[crc] = append(d.byCRC[crc], e)
+		}
+	}
+	return d, nil
+}
+
+// LoadFile reads a Logiqx XML DAT from disk
+func LoadFile(fname string) (*DAT, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, fmt.Errorf("opening DAT file %v: %v", fname, err)
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// MatchLevel tells how strong a match is
+type MatchLevel int
+
+const (
+	NoMatch      MatchLevel = iota
+	HashMismatch            // an entry was found but one of its hashes differs, ie. a CRC32 collision
+	CRC32Match              // the DAT entry only has a CRC32
+	FullMatch               // every hash present in the DAT matches, at least one of them is not CRC32
+)
+
+func (m MatchLevel) String() string {
+	switch m {
+	case HashMismatch:
+		return "hash mismatch"
+	case CRC32Match:
+		return "CRC32 only"
+	case FullMatch:
+		return "verified"
+	}
+	return "no match"
+}
+
+// Result is the outcome of looking up a dump in the DAT
+type Result struct {
+	Level    MatchLevel
+	Hashes   cartridge.Hashes
+	Game     string // Canonical No-Intro name
+	ROMName  string // File name of the dump in the DAT
+	Region   string
+	Revision string
+	Status   string // DAT status (ie. verified, baddump)
+}
+
+// Matched returns true if the dump is a known good dump
+func (r *Result) Matched() bool {
+	return (r.Level == CRC32Match || r.Level == FullMatch) && r.Status != "baddump"
+}
+
+// Lookup searches the DAT for a ROM with the given hashes and size
+func (d *DAT) Lookup(h cartridge.Hashes, size int64) *Result {
+	res := &Result{Hashes: h}
+
+	e := d.bySHA1[h.SHA1]
+	if e == nil {
+		for _, c := range d.byCRC[h.CRC32] {
+			if c.rom.Size == 0 || c.rom.Size == size {
+				e = c
+				break
+			}
+		}
+	}
+	if e == nil {
+		return res
+	}
+
+	switch conflict, strong := compareHashes(e.rom, h); {
+	case conflict:
+		res.Level = HashMismatch
+	case strong > 0:
+		res.Level = FullMatch
+	default:
+		res.Level = CRC32Match
+	}
+	res.Game = e.game.Name
+	res.ROMName = e.rom.Name
+	res.Status = e.rom.Status
+	res.Region, res.Revision = ParseName(e.game.Name)
+	return res
+}
+
+// compareHashes compares the hashes present in the DAT entry, returning whether any of them
+// differs and how many of the MD5, SHA-1 and SHA-256 hashes match
+func compareHashes(r *ROM, h cartridge.Hashes) (conflict bool, strong int) {
+	pairs := [][2]string{{r.CRC32, h.CRC32}, {r.MD5, h.MD5}, {r.SHA1, h.SHA1}, {r.SHA256, h.SHA256}}
+	for i, p := range pairs {
+		if p[0] == "" {
+			continue
+		}
+		if !strings.EqualFold(p[0], p[1]) {
+			return true, 0
+		}
+		if i > 0 {
+			strong++
+		}
+	}
+	return false, strong
+}
+
+// Verify hashes the whole cartridge ROM and looks it up in the DAT
+func (d *DAT) Verify(c *cartridge.Cartridge) *Result {
+	rom := c.Bytes()
+	return d.Lookup(cartridge.HashBytes(rom), int64(len(rom)))
+}
+
+// VerifyBytes hashes a ROM image (as read from a file) and looks it up in the DAT
+func (d *DAT) VerifyBytes(rom []byte) *Result {
+	return d.Lookup(cartridge.HashBytes(rom), int64(len(rom)))
+}
+
+var (
+	tagsRegexp     = regexp.MustCompile(`\(([^)]*)\)`)
+	revisionRegexp = regexp.MustCompile(`^(Rev [0-9A-Z.]+|v[0-9.]+[a-z]?)$`)
+)
+
+var regions = map[string]bool{
+	"World": true, "USA": true, "Europe": true, "Japan": true, "Asia": true, "Australia": true,
+	"Brazil": true, "Canada": true, "China": true, "France": true, "Germany": true, "Hong Kong": true,
+	"Italy": true, "Korea": true, "Netherlands": true, "Spain": true, "Sweden": true, "Taiwan": true,
+	"Unknown": true, "UK": true,
+}
+
+// ParseName extracts the region and revision from a No-Intro name such as
+// "Tetris (World) (Rev 1)". Revision is empty for the first release
+func ParseName(name string) (region, revision string) {
+	for _, m := range tagsRegexp.FindAllStringSubmatch(name, -1) {
+		tag := m[1]
+		if region == "" && isRegionTag(tag) {
+			region = tag
+		} else if revision == "" && revisionRegexp.MatchString(tag) {
+			revision = tag
+		}
+	}
+	return region, revision
+}
+
+func isRegionTag(tag string) bool {
+	for _, r := range strings.Split(tag, ",") {
+		if !regions[strings.TrimSpace(r)] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,309 @@
+// Package debug is an interactive debugger for the emulator, with breakpoints, watchpoints,
+// conditions and a bank aware disassembly view
+package debug
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Guillem96/gameboy-tools/disasm"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+// AnyBank matches an address in every bank
+const AnyBank = -1
+
+// Location is an address in a bank
+type Location struct {
+	Bank int
+	Addr uint16
+}
+
+func (l Location) String() string {
+	if l.Bank == AnyBank {
+		return fmt.Sprintf("%04X", l.Addr)
+	}
+	return fmt.Sprintf("%02X:%04X", l.Bank, l.Addr)
+}
+
+// Breakpoint stops the execution before the instruction at its location, or before any
+// instruction if it only has a condition, when the condition is true
+type Breakpoint struct {
+	ID       int
+	Location Location
+	HasAddr  bool
+	Cond     *Expr // nil always stops
+}
+
+// Watch kinds
+const (
+	WatchRead  = 1
+	WatchWrite = 2
+	WatchRW    = WatchRead | WatchWrite
+)
+
+// Watchpoint stops the execution after an instruction reads or writes its location
+type Watchpoint struct {
+	ID       int
+	Location Location
+	Kind     int
+	Cond     *Expr
+}
+
+// StopReason is why the execution stopped
+type StopReason int
+
+const (
+	StopStep StopReason = iota
+	StopBreakpoint
+	StopWatchpoint
+	StopLocked
+	StopInterrupted
+)
+
+// Stop describes where and why the execution stopped
+type Stop struct {
+	Reason StopReason
+	ID     int // of the breakpoint or watchpoint
+
+	// Memory access of a watchpoint
+	Addr  uint16
+	Value uint8
+	Write bool
+}
+
+func (s Stop) String() string {
+	switch s.Reason {
+	case StopBreakpoint:
+		return fmt.Sprintf("breakpoint %d", s.ID)
+	case StopWatchpoint:
+		action := "read"
+		if s.Write {
+			action = "write"
+		}
+		return fmt.Sprintf("watchpoint %d: %s $%02X at $%04X", s.ID, action, s.Value, s.Addr)
+	case StopLocked:
+		return "CPU locked by an illegal opcode"
+	case StopInterrupted:
+		return "interrupted"
+	}
+	return "step"
+}
+
+// Debugger controls the execution of a Game Boy
+type Debugger struct {
+	GB      *emu.GameBoy
+	Symbols *disasm.Symbols
+
+	breakpoints []*Breakpoint
+	watchpoints []*Watchpoint
+	nextID      int
+	hit         *Stop // watchpoint hit by the current instruction
+	interrupted int32
+	last        string // last command, repeated by an empty line
+}
+
+// New attaches a debugger to the Game Boy. Labels are shown and resolved with the symbols,
+// which can be nil
+func New(gb *emu.GameBoy, syms *disasm.Symbols) *Debugger {
+	d := &Debugger{GB: gb, Symbols: syms, nextID: 1}
+	gb.Bus.OnAccess = d.access
+	return d
+}
+
+// ParseLocation parses [bank:]address. The address is hexadecimal, a label or an expression
+// evaluated now. Labels keep their bank, other addresses match every bank unless one is given
+func (d *Debugger) ParseLocation(s string) (Location, error) {
+	loc := Location{Bank: AnyBank}
+	if i := strings.Index(s, ":"); i >= 0 {
+		bank, err := strconv.ParseUint(s[:i], 16, 16)
+		if err != nil {
+			return loc, fmt.Errorf("invalid bank %q", s[:i])
+		}
+		loc.Bank, s = int(bank), s[i+1:]
+	}
+
+	if v, err := strconv.ParseUint(s, 16, 16); err == nil {
+		loc.Addr = uint16(v)
+		return loc, nil
+	}
+	if sym, ok := d.Symbols.Lookup(s); ok {
+		if loc.Bank == AnyBank {
+			loc.Bank = sym.Bank
+		}
+		loc.Addr = sym.Addr
+		return loc, nil
+	}
+	e, err := ParseExpr(s, d.Symbols)
+	if err != nil {
+		return loc, err
+	}
+	loc.Addr = uint16(e.Eval(d.GB))
+	return loc, nil
+}
+
+// matches returns true if the location is the address in the bank mapped now
+func (d *Debugger) matches(l Location, addr uint16) bool {
+	return l.Addr == addr && (l.Bank == AnyBank || l.Bank == d.GB.Bus.Bank(addr))
+}
+
+// AddBreakpoint adds a breakpoint at the location
+func (d *Debugger) AddBreakpoint(loc Location, cond *Expr) *Breakpoint {
+	b := &Breakpoint{ID: d.nextID, Location: loc, HasAddr: true, Cond: cond}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	return b
+}
+
+// AddCondition adds a breakpoint that stops before any instruction when the condition is true
+func (d *Debugger) AddCondition(cond *Expr) *Breakpoint {
+	b := &Breakpoint{ID: d.nextID, Location: Location{Bank: AnyBank}, Cond: cond}
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	return b
+}
+
+// AddWatchpoint adds a watchpoint on the reads, writes or both of the location
+func (d *Debugger) AddWatchpoint(loc Location, kind int, cond *Expr) *Watchpoint {
+	w := &Watchpoint{ID: d.nextID, Location: loc, Kind: kind, Cond: cond}
+	d.nextID++
+	d.watchpoints = append(d.watchpoints, w)
+	return w
+}
+
+// Delete removes the breakpoint or watchpoint with the given ID
+func (d *Debugger) Delete(id int) bool {
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return true
+		}
+	}
+	for i, w := range d.watchpoints {
+		if w.ID == id {
+			d.watchpoints = append(d.watchpoints[:i], d.watchpoints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Breakpoints returns the breakpoints, in creation order
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	return d.breakpoints
+}
+
+// Watchpoints returns the watchpoints, in creation order
+func (d *Debugger) Watchpoints() []*Watchpoint {
+	return d.watchpoints
+}
+
+// Interrupt stops a running Continue or Next, or the next one if none is running. It can be
+// called from another goroutine
+func (d *Debugger) Interrupt() {
+	atomic.StoreInt32(&d.interrupted, 1)
+}
+
+func (d *Debugger) access(addr uint16, v uint8, write bool) {
+	if d.hit != nil {
+		return
+	}
+	kind := WatchRead
+	if write {
+		kind = WatchWrite
+	}
+	for _, w := range d.watchpoints {
+		if w.Kind&kind != 0 && d.matches(w.Location, addr) && (w.Cond == nil || w.Cond.Eval(d.GB) != 0) {
+			d.hit = &Stop{Reason: StopWatchpoint, ID: w.ID, Addr: addr, Value: v, Write: write}
+			return
+		}
+	}
+}
+
+// breakpoint returns the breakpoint that stops before the current instruction
+func (d *Debugger) breakpoint() (Stop, bool) {
+	pc := d.GB.CPU.PC
+	for _, b := range d.breakpoints {
+		if b.HasAddr && !d.matches(b.Location, pc) {
+			continue
+		}
+		if b.Cond == nil || b.Cond.Eval(d.GB) != 0 {
+			return Stop{Reason: StopBreakpoint, ID: b.ID}, true
+		}
+	}
+	return Stop{}, false
+}
+
+// step executes an instruction, returning the watchpoint it hit
+func (d *Debugger) step() (Stop, bool) {
+	d.hit = nil
+	d.GB.Step()
+	if d.hit != nil {
+		return *d.hit, true
+	}
+	if d.GB.CPU.Locked {
+		return Stop{Reason: StopLocked}, true
+	}
+	return Stop{}, false
+}
+
+// Step executes n instructions, stopping early on a watchpoint
+func (d *Debugger) Step(n int) Stop {
+	for i := 0; i < n; i++ {
+		if s, ok := d.step(); ok {
+			return s
+		}
+	}
+	return Stop{Reason: StopStep}
+}
+
+// Continue runs until a breakpoint or a watchpoint stops the execution. The breakpoints at the
+// current instruction are ignored
+func (d *Debugger) Continue() Stop {
+	return d.runUntil(func() bool { return false })
+}
+
+// Next executes the current instruction. Calls are stepped over, running until they return
+// unless a breakpoint or a watchpoint stops the execution before
+func (d *Debugger) Next() Stop {
+	in := disasm.Decode(d.GB.Bus.Peek, d.GB.CPU.PC)
+	if in.Flow != disasm.FlowCall && in.Flow != disasm.FlowCondCall {
+		return d.Step(1)
+	}
+	ret, sp := in.Next(), d.GB.CPU.SP
+	return d.runUntil(func() bool { return d.GB.CPU.PC == ret && d.GB.CPU.SP >= sp })
+}
+
+// runUntil steps until done returns true or the execution is stopped
+func (d *Debugger) runUntil(done func() bool) Stop {
+	for first := true; ; first = false {
+		if !first {
+			if done() {
+				return Stop{Reason: StopStep}
+			}
+			if s, ok := d.breakpoint(); ok {
+				return s
+			}
+			if atomic.CompareAndSwapInt32(&d.interrupted, 1, 0) {
+				return Stop{Reason: StopInterrupted}
+			}
+		}
+		if s, ok := d.step(); ok {
+			return s
+		}
+	}
+}
+
+// where returns the label and offset of an address, ie. "Main+3"
+func (d *Debugger) where(bank int, addr uint16) string {
+	sym, ok := d.Symbols.Nearest(bank, addr)
+	switch {
+	case !ok:
+		return ""
+	case sym.Addr == addr:
+		return sym.Name
+	}
+	return fmt.Sprintf("%s+%d", sym.Name, addr-sym.Addr)
+}
@@ -0,0 +1,139 @@
+package debug
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/disasm"
+	"github.com/Guillem96/gameboy-tools/emu"
+	"github.com/Guillem96/gameboy-tools/exprparse"
+)
+
+// Expr is a compiled expression, used as break condition. Expressions use C operators with
+// their usual precedence on registers (a, f, b, c, d, e, h, l, af, bc, de, hl, sp, pc), flags
+// (zf, nf, hf, cf), ime, the ROM bank (bank), the frame number (frame), labels, numbers ($FF,
+// 0xFF, %1010 or decimal) and memory bytes ([hl], [$C000]). A condition is true if it is not 0
+type Expr struct {
+	src  string
+	eval func(gb *emu.GameBoy) int
+}
+
+func (e *Expr) String() string {
+	return e.src
+}
+
+// Eval returns the value of the expression
+func (e *Expr) Eval(gb *emu.GameBoy) int {
+	return e.eval(gb)
+}
+
+// ParseExpr compiles an expression. Labels are resolved with the symbols
+func ParseExpr(src string, syms *disasm.Symbols) (*Expr, error) {
+	tp, err := exprparse.NewParser(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tp, syms}
+	eval, err := p.binary()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.Done(); err != nil {
+		return nil, err
+	}
+	return &Expr{src: src, eval: eval}, nil
+}
+
+type evalFunc func(gb *emu.GameBoy) int
+
+type parser struct {
+	*exprparse.Parser
+	syms *disasm.Symbols
+}
+
+func (p *parser) binary() (evalFunc, error) {
+	return exprparse.Binary(p.Parser, p.unary, binaryEval)
+}
+
+// binaryEval applies a binary operator. Conditions can not fail, division by zero is 0
+func binaryEval(op string, l, r evalFunc) evalFunc {
+	return func(gb *emu.GameBoy) int {
+		v, _ := exprparse.Apply(op, l(gb), r(gb))
+		return v
+	}
+}
+
+func (p *parser) unary() (evalFunc, error) {
+	switch op := p.Peek(); op {
+	case "!", "~", "-":
+		p.Pos++
+		operand, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case "!":
+			return func(gb *emu.GameBoy) int { return exprparse.BoolInt(operand(gb) == 0) }, nil
+		case "~":
+			return func(gb *emu.GameBoy) int { return ^operand(gb) }, nil
+		}
+		return func(gb *emu.GameBoy) int { return -operand(gb) }, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (evalFunc, error) {
+	t := p.Next()
+	switch {
+	case t == "":
+		return nil, fmt.Errorf("unexpected end of expression")
+	case t == "(" || t == "[":
+		inner, err := p.binary()
+		if err != nil {
+			return nil, err
+		}
+		if t == "(" {
+			return inner, p.Expect(")")
+		}
+		return func(gb *emu.GameBoy) int { return int(gb.Bus.Peek(uint16(inner(gb)))) }, p.Expect("]")
+	}
+
+	if v, ok := exprparse.ParseNumber(t); ok {
+		return func(*emu.GameBoy) int { return v }, nil
+	}
+	if f, ok := variables[strings.ToLower(t)]; ok {
+		return f, nil
+	}
+	if sym, ok := p.syms.Lookup(t); ok {
+		return func(*emu.GameBoy) int { return int(sym.Addr) }, nil
+	}
+	return nil, fmt.Errorf("unknown name %q", t)
+}
+
+func flag(f uint8) evalFunc {
+	return func(gb *emu.GameBoy) int { return exprparse.BoolInt(gb.CPU.Flag(f)) }
+}
+
+var variables = map[string]evalFunc{
+	"a":     func(gb *emu.GameBoy) int { return int(gb.CPU.A) },
+	"f":     func(gb *emu.GameBoy) int { return int(gb.CPU.F) },
+	"b":     func(gb *emu.GameBoy) int { return int(gb.CPU.B) },
+	"c":     func(gb *emu.GameBoy) int { return int(gb.CPU.C) },
+	"d":     func(gb *emu.GameBoy) int { return int(gb.CPU.D) },
+	"e":     func(gb *emu.GameBoy) int { return int(gb.CPU.E) },
+	"h":     func(gb *emu.GameBoy) int { return int(gb.CPU.H) },
+	"l":     func(gb *emu.GameBoy) int { return int(gb.CPU.L) },
+	"af":    func(gb *emu.GameBoy) int { return int(gb.CPU.AF()) },
+	"bc":    func(gb *emu.GameBoy) int { return int(gb.CPU.BC()) },
+	"de":    func(gb *emu.GameBoy) int { return int(gb.CPU.DE()) },
+	"hl":    func(gb *emu.GameBoy) int { return int(gb.CPU.HL()) },
+	"sp":    func(gb *emu.GameBoy) int { return int(gb.CPU.SP) },
+	"pc":    func(gb *emu.GameBoy) int { return int(gb.CPU.PC) },
+	"zf":    flag(emu.FlagZ),
+	"nf":    flag(emu.FlagN),
+	"hf":    flag(emu.FlagH),
+	"cf":    flag(emu.FlagC),
+	"ime":   func(gb *emu.GameBoy) int { return exprparse.BoolInt(gb.CPU.IME) },
+	"bank":  func(gb *emu.GameBoy) int { return gb.Bus.MBC.ROMBank() },
+	"frame": func(gb *emu.GameBoy) int { return int(gb.Frames) },
+}
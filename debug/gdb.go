@@ -0,0 +1,463 @@
+package debug
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// Reference: https://sourceware.org/gdb/current/onlinedocs/gdb.html/Remote-Protocol.html
+
+// GDB registers, 16 bits little endian each, in the order of the g packet
+const gdbRegisters = 6 // AF, BC, DE, HL, SP, PC
+
+const gdbTargetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target version="1.0">
+  <feature name="org.gnu.gdb.sm83.cpu">
+    <reg name="af" bitsize="16" type="int"/>
+    <reg name="bc" bitsize="16" type="int"/>
+    <reg name="de" bitsize="16" type="int"/>
+    <reg name="hl" bitsize="16" type="int"/>
+    <reg name="sp" bitsize="16" type="data_ptr"/>
+    <reg name="pc" bitsize="16" type="code_ptr"/>
+  </feature>
+</target>`
+
+// Stop signals
+const (
+	sigInt  = 2
+	sigIll  = 4
+	sigTrap = 5
+)
+
+// gdbPoint is a breakpoint or watchpoint inserted by a Z packet
+type gdbPoint struct {
+	kind uint8 // 0 and 1 breakpoints, 2 write, 3 read and 4 access watchpoints
+	addr uint32
+}
+
+// gdbSession is the state of a connection
+type gdbSession struct {
+	d      *Debugger
+	w      *bufio.Writer
+	noAck  bool
+	points map[gdbPoint][]int // IDs of the breakpoints and watchpoints of each Z packet
+	addrs  map[int]uint32     // address of each watchpoint, as sent by GDB
+}
+
+// ServeGDB serves the GDB remote serial protocol on the listener, one connection at a time,
+// until a client kills the target. Addresses above FFFF select a bank: bank<<16 | address.
+// Memory writes to the ROM patch the cartridge instead of writing to the MBC registers
+func (d *Debugger) ServeGDB(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		killed, err := d.serveGDB(conn)
+		conn.Close()
+		if killed || err != nil {
+			return err
+		}
+	}
+}
+
+// ServeGDBConn serves the GDB remote serial protocol on a connection until the client detaches
+// or kills the target
+func (d *Debugger) ServeGDBConn(conn io.ReadWriter) error {
+	_, err := d.serveGDB(conn)
+	return err
+}
+
+func (d *Debugger) serveGDB(conn io.ReadWriter) (bool, error) {
+	s := &gdbSession{d: d, w: bufio.NewWriter(conn), points: map[gdbPoint][]int{}, addrs: map[int]uint32{}}
+	packets := make(chan string)
+	errs := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	defer s.removePoints()
+	go func() {
+		errs <- readPackets(bufio.NewReader(conn), packets, d.Interrupt, done)
+	}()
+
+	for {
+		select {
+		case err := <-errs:
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		case p := <-packets:
+			if p == "" {
+				// Bad checksum, ask for a retransmission
+				s.w.WriteString("-")
+				if err := s.w.Flush(); err != nil {
+					return false, err
+				}
+				continue
+			}
+			if !s.noAck {
+				s.w.WriteString("+")
+			}
+			reply, quit := s.handle(p)
+			if reply != nil {
+				if err := s.send(*reply); err != nil {
+					return false, err
+				}
+			} else if err := s.w.Flush(); err != nil {
+				return false, err
+			}
+			if quit {
+				return reply == nil, nil
+			}
+		}
+	}
+}
+
+// readPackets sends the payload of each packet to the channel, or an empty string if the
+// checksum is wrong. A 0x03 byte interrupts the execution. Acknowledgements are ignored
+func readPackets(r *bufio.Reader, packets chan<- string, interrupt func(), done <-chan struct{}) error {
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch c {
+		case 0x03:
+			interrupt()
+			continue
+		case '$':
+		default:
+			continue
+		}
+
+		data, err := r.ReadString('#')
+		if err != nil {
+			return err
+		}
+		data = data[:len(data)-1]
+		var sum [2]uint8
+		if _, err := io.ReadFull(r, sum[:]); err != nil {
+			return err
+		}
+		if cs, err := strconv.ParseUint(string(sum[:]), 16, 8); err != nil || uint8(cs) != checksum(data) {
+			data = ""
+		}
+		select {
+		case packets <- data:
+		case <-done:
+			return nil
+		}
+	}
+}
+
+func checksum(data string) uint8 {
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// send writes a packet, escaping the characters with a special meaning
+func (s *gdbSession) send(data string) error {
+	var b strings.Builder
+	for i := 0; i < len(data); i++ {
+		if c := data[i]; c == '$' || c == '#' || c == '}' || c == '*' {
+			b.WriteByte('}')
+			b.WriteByte(c ^ 0x20)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	fmt.Fprintf(s.w, "$%s#%02x", b.String(), checksum(b.String()))
+	return s.w.Flush()
+}
+
+func reply(format string, args ...interface{}) *string {
+	r := fmt.Sprintf(format, args...)
+	return &r
+}
+
+var (
+	replyOK          = reply("OK")
+	replyUnsupported = reply("")
+	replyError       = reply("E01")
+)
+
+// handle executes a packet and returns the reply, if any, and whether the session ends. Kill
+// requests end it without a reply
+func (s *gdbSession) handle(p string) (*string, bool) {
+	d := s.d
+	cmd, args := p[0], p[1:]
+	switch cmd {
+	case '?':
+		return reply("S%02x", sigTrap), false
+	case 'g':
+		var regs []uint8
+		for i := 0; i < gdbRegisters; i++ {
+			v := s.register(i)
+			regs = append(regs, uint8(v), uint8(v>>8))
+		}
+		return reply("%s", hex.EncodeToString(regs)), false
+	case 'G':
+		regs, err := hex.DecodeString(args)
+		if err != nil || len(regs) != 2*gdbRegisters {
+			return replyError, false
+		}
+		for i := 0; i < gdbRegisters; i++ {
+			s.setRegister(i, uint16(regs[2*i+1])<<8|uint16(regs[2*i]))
+		}
+		return replyOK, false
+	case 'p':
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= gdbRegisters {
+			return replyError, false
+		}
+		v := s.register(int(n))
+		return reply("%02x%02x", uint8(v), uint8(v>>8)), false
+	case 'P':
+		parts := strings.SplitN(args, "=", 2)
+		n, err := strconv.ParseUint(parts[0], 16, 8)
+		if err != nil || n >= gdbRegisters || len(parts) != 2 {
+			return replyError, false
+		}
+		v, err := hex.DecodeString(parts[1])
+		if err != nil || len(v) != 2 {
+			return replyError, false
+		}
+		s.setRegister(int(n), uint16(v[1])<<8|uint16(v[0]))
+		return replyOK, false
+	case 'm':
+		addr, n, err := parseAddrLen(args)
+		if err != nil {
+			return replyError, false
+		}
+		data := make([]uint8, n)
+		for i := range data {
+			data[i] = s.read(addr + uint32(i))
+		}
+		return reply("%s", hex.EncodeToString(data)), false
+	case 'M':
+		parts := strings.SplitN(args, ":", 2)
+		addr, n, err := parseAddrLen(parts[0])
+		if err != nil || len(parts) != 2 {
+			return replyError, false
+		}
+		data, err := hex.DecodeString(parts[1])
+		if err != nil || len(data) != n {
+			return replyError, false
+		}
+		for i, v := range data {
+			s.write(addr+uint32(i), v)
+		}
+		return replyOK, false
+	case 's', 'c':
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 16)
+			if err != nil {
+				return replyError, false
+			}
+			d.GB.CPU.PC = uint16(addr)
+		}
+		if cmd == 's' {
+			return s.stopReply(d.Step(1)), false
+		}
+		return s.stopReply(d.Continue()), false
+	case 'Z', 'z':
+		return s.handlePoint(cmd == 'Z', args), false
+	case 'H':
+		return replyOK, false
+	case 'k':
+		return nil, true
+	case 'D':
+		return replyOK, true
+	case 'q', 'Q':
+		return s.handleQuery(p), false
+	}
+	return replyUnsupported, false
+}
+
+func (s *gdbSession) handleQuery(p string) *string {
+	switch {
+	case strings.HasPrefix(p, "qSupported"):
+		return reply("PacketSize=1000;QStartNoAckMode+;qXfer:features:read+;swbreak+")
+	case p == "QStartNoAckMode":
+		s.noAck = true
+		return replyOK
+	case p == "qAttached":
+		return reply("1")
+	case p == "qC":
+		return reply("QC1")
+	case p == "qfThreadInfo":
+		return reply("m1")
+	case p == "qsThreadInfo":
+		return reply("l")
+	case strings.HasPrefix(p, "qXfer:features:read:target.xml:"):
+		off, n, err := parseAddrLen(strings.TrimPrefix(p, "qXfer:features:read:target.xml:"))
+		if err != nil {
+			return replyError
+		}
+		if int(off) >= len(gdbTargetXML) {
+			return reply("l")
+		}
+		if end := int(off) + n; end < len(gdbTargetXML) {
+			return reply("m%s", gdbTargetXML[off:end])
+		}
+		return reply("l%s", gdbTargetXML[off:])
+	}
+	return replyUnsupported
+}
+
+// handlePoint inserts or removes a breakpoint or a watchpoint. Watchpoints cover every byte
+func (s *gdbSession) handlePoint(insert bool, args string) *string {
+	parts := strings.SplitN(args, ",", 3)
+	if len(parts) != 3 || len(parts[0]) != 1 || parts[0][0] < '0' || parts[0][0] > '4' {
+		return replyUnsupported
+	}
+	addr, err := strconv.ParseUint(parts[1], 16, 32)
+	if err != nil {
+		return replyError
+	}
+	n, err := strconv.ParseUint(parts[2], 16, 16)
+	if err != nil {
+		return replyError
+	}
+	point := gdbPoint{kind: parts[0][0] - '0', addr: uint32(addr)}
+
+	if !insert {
+		for _, id := range s.points[point] {
+			s.d.Delete(id)
+			delete(s.addrs, id)
+		}
+		delete(s.points, point)
+		return replyOK
+	}
+	if _, ok := s.points[point]; ok {
+		return replyOK
+	}
+	loc := gdbLocation(point.addr)
+	if point.kind < 2 {
+		s.points[point] = []int{s.d.AddBreakpoint(loc, nil).ID}
+		return replyOK
+	}
+	kind := map[uint8]int{2: WatchWrite, 3: WatchRead, 4: WatchRW}[point.kind]
+	if n == 0 {
+		n = 1
+	}
+	for i := uint64(0); i < n; i++ {
+		wp := s.d.AddWatchpoint(Location{Bank: loc.Bank, Addr: loc.Addr + uint16(i)}, kind, nil)
+		s.points[point] = append(s.points[point], wp.ID)
+		s.addrs[wp.ID] = point.addr
+	}
+	return replyOK
+}
+
+// removePoints removes the breakpoints and watchpoints of the session
+func (s *gdbSession) removePoints() {
+	for _, ids := range s.points {
+		for _, id := range ids {
+			s.d.Delete(id)
+		}
+	}
+}
+
+var gdbWatchKinds = map[int]string{WatchWrite: "watch", WatchRead: "rwatch", WatchRW: "awatch"}
+
+// stopReply describes why the execution stopped
+func (s *gdbSession) stopReply(stop Stop) *string {
+	switch stop.Reason {
+	case StopWatchpoint:
+		kind := "watch"
+		for _, wp := range s.d.watchpoints {
+			if wp.ID == stop.ID {
+				kind = gdbWatchKinds[wp.Kind]
+			}
+		}
+		return reply("T%02x%s:%x;", sigTrap, kind, s.addrs[stop.ID])
+	case StopBreakpoint:
+		return reply("T%02xswbreak:;", sigTrap)
+	case StopInterrupted:
+		return reply("S%02x", sigInt)
+	case StopLocked:
+		return reply("S%02x", sigIll)
+	}
+	return reply("S%02x", sigTrap)
+}
+
+func parseAddrLen(s string) (uint32, int, error) {
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected address,length")
+	}
+	addr, err := strconv.ParseUint(parts[0], 16, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	n, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return 0, 0, err
+	}
+	return uint32(addr), int(n), nil
+}
+
+// gdbLocation converts a GDB address, with the bank in the upper 16 bits
+func gdbLocation(addr uint32) Location {
+	if addr > 0xFFFF {
+		return Location{Bank: int(addr >> 16), Addr: uint16(addr)}
+	}
+	return Location{Bank: AnyBank, Addr: uint16(addr)}
+}
+
+func (s *gdbSession) read(addr uint32) uint8 {
+	loc := gdbLocation(addr)
+	return s.d.reader(loc.Bank)(loc.Addr)
+}
+
+func (s *gdbSession) write(addr uint32, v uint8) {
+	loc := gdbLocation(addr)
+	if loc.Addr >= 0x8000 {
+		s.d.GB.Bus.Poke(loc.Addr, v)
+		return
+	}
+	bank := loc.Bank
+	switch {
+	case loc.Addr < 0x4000:
+		bank = 0
+	case bank == AnyBank:
+		bank = s.d.GB.Bus.Bank(loc.Addr)
+	}
+	if banks := s.d.GB.Cartridge.ROMBanks; bank < len(banks) {
+		banks[bank][loc.Addr&(cartridge.ROMBankSize-1)] = v
+	}
+}
+
+func (s *gdbSession) register(i int) uint16 {
+	c := s.d.GB.CPU
+	return [gdbRegisters]uint16{c.AF(), c.BC(), c.DE(), c.HL(), c.SP, c.PC}[i]
+}
+
+func (s *gdbSession) setRegister(i int, v uint16) {
+	c := s.d.GB.CPU
+	switch i {
+	case 0:
+		c.A, c.F = uint8(v>>8), uint8(v)&0xF0
+	case 1:
+		c.SetBC(v)
+	case 2:
+		c.SetDE(v)
+	case 3:
+		c.SetHL(v)
+	case 4:
+		c.SP = v
+	case 5:
+		c.PC = v
+	}
+}
@@ -0,0 +1,378 @@
+package debug
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/disasm"
+)
+
+const prompt = "(gbdb) "
+
+const help = `Commands:
+  step|s [n]                   execute n instructions (1 by default)
+  next|n                       execute an instruction, stepping over calls
+  continue|c                   run until a breakpoint or a watchpoint
+  break|b <loc> [if <expr>]    stop before the instruction at loc
+  break|b if <expr>            stop before any instruction where expr is true
+  watch|w [r|w|rw] <loc> [if <expr>]
+                               stop after reading or writing loc (writes by default)
+  delete|d <id>                remove a breakpoint or a watchpoint
+  info|i                       list the breakpoints and watchpoints
+  regs|r                       show the registers
+  x <loc> [n]                  dump n bytes of memory (16 by default)
+  set <reg> <expr>             set a register
+  set [<expr>] <expr>          write a byte of memory
+  dis|l [loc] [n]              disassemble n instructions (10 by default)
+  print|p <expr>               evaluate an expression
+  help|h                       show this help
+  quit|q                       exit
+
+Locations are [bank:]address in hexadecimal, labels or expressions. Expressions use C
+operators on registers, flags (zf, nf, hf, cf), ime, bank, frame, labels, numbers ($FF,
+0xFF, %1010 or decimal) and memory ([hl]).
+`
+
+// Run reads commands from r until it is closed or the quit command, writing the output to w
+func (d *Debugger) Run(r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	fmt.Fprint(w, prompt)
+	for scanner.Scan() {
+		err := d.Exec(scanner.Text(), w)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintf(w, "error: %v\n", err)
+		}
+		fmt.Fprint(w, prompt)
+	}
+	return scanner.Err()
+}
+
+// Exec executes a command, writing its output to w. An empty line repeats the last command.
+// It returns io.EOF on quit
+func (d *Debugger) Exec(line string, w io.Writer) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		line = d.last
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil
+	}
+	d.last = line
+	cmd, args := fields[0], fields[1:]
+
+	switch cmd {
+	case "step", "s":
+		n := 1
+		if len(args) > 0 {
+			var err error
+			if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+				return fmt.Errorf("invalid count %q", args[0])
+			}
+		}
+		d.report(w, d.Step(n))
+	case "next", "n":
+		d.report(w, d.Next())
+	case "continue", "c":
+		d.report(w, d.Continue())
+	case "break", "b":
+		return d.execBreak(args, w)
+	case "watch", "w":
+		return d.execWatch(args, w)
+	case "delete", "d":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: delete <id>")
+		}
+		id, err := strconv.Atoi(args[0])
+		if err != nil || !d.Delete(id) {
+			return fmt.Errorf("no breakpoint or watchpoint %s", args[0])
+		}
+	case "info", "i":
+		d.printPoints(w)
+	case "regs", "r":
+		d.printRegisters(w)
+	case "x":
+		return d.execDump(args, w)
+	case "set":
+		return d.execSet(args)
+	case "dis", "l":
+		return d.execDisassemble(args, w)
+	case "print", "p":
+		e, err := ParseExpr(strings.Join(args, " "), d.Symbols)
+		if err != nil {
+			return err
+		}
+		v := e.Eval(d.GB)
+		fmt.Fprintf(w, "%d ($%X)\n", v, uint32(v))
+	case "help", "h":
+		fmt.Fprint(w, help)
+	case "quit", "q":
+		return io.EOF
+	default:
+		return fmt.Errorf("unknown command %q, try help", cmd)
+	}
+	return nil
+}
+
+// report prints why the execution stopped and the next instruction
+func (d *Debugger) report(w io.Writer, s Stop) {
+	if s.Reason != StopStep {
+		fmt.Fprintf(w, "stopped: %s\n", s)
+	}
+	d.disassemble(w, AnyBank, d.GB.CPU.PC, 1)
+}
+
+// splitCondition splits the "if <expr>" suffix of the arguments
+func (d *Debugger) splitCondition(args []string) ([]string, *Expr, error) {
+	for i, a := range args {
+		if a == "if" {
+			cond, err := ParseExpr(strings.Join(args[i+1:], " "), d.Symbols)
+			return args[:i], cond, err
+		}
+	}
+	return args, nil, nil
+}
+
+func (d *Debugger) execBreak(args []string, w io.Writer) error {
+	args, cond, err := d.splitCondition(args)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(args) == 0 && cond != nil:
+		b := d.AddCondition(cond)
+		fmt.Fprintf(w, "breakpoint %d if %s\n", b.ID, cond)
+		return nil
+	case len(args) != 1:
+		return fmt.Errorf("usage: break <loc> [if <expr>]")
+	}
+	loc, err := d.ParseLocation(args[0])
+	if err != nil {
+		return err
+	}
+	b := d.AddBreakpoint(loc, cond)
+	fmt.Fprintf(w, "breakpoint %d at %s\n", b.ID, loc)
+	return nil
+}
+
+func (d *Debugger) execWatch(args []string, w io.Writer) error {
+	args, cond, err := d.splitCondition(args)
+	if err != nil {
+		return err
+	}
+	kind := WatchWrite
+	if len(args) == 2 {
+		switch args[0] {
+		case "r":
+			kind = WatchRead
+		case "w":
+			kind = WatchWrite
+		case "rw":
+			kind = WatchRW
+		default:
+			return fmt.Errorf("invalid watch kind %q, expected r, w or rw", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: watch [r|w|rw] <loc> [if <expr>]")
+	}
+	loc, err := d.ParseLocation(args[0])
+	if err != nil {
+		return err
+	}
+	wp := d.AddWatchpoint(loc, kind, cond)
+	fmt.Fprintf(w, "watchpoint %d at %s\n", wp.ID, loc)
+	return nil
+}
+
+var watchKinds = map[int]string{WatchRead: "r", WatchWrite: "w", WatchRW: "rw"}
+
+func (d *Debugger) printPoints(w io.Writer) {
+	for _, b := range d.breakpoints {
+		fmt.Fprintf(w, "%d break", b.ID)
+		if b.HasAddr {
+			fmt.Fprintf(w, " %s", b.Location)
+			if name := d.where(b.Location.Bank, b.Location.Addr); name != "" {
+				fmt.Fprintf(w, " <%s>", name)
+			}
+		}
+		if b.Cond != nil {
+			fmt.Fprintf(w, " if %s", b.Cond)
+		}
+		fmt.Fprintln(w)
+	}
+	for _, wp := range d.watchpoints {
+		fmt.Fprintf(w, "%d watch %s %s", wp.ID, watchKinds[wp.Kind], wp.Location)
+		if wp.Cond != nil {
+			fmt.Fprintf(w, " if %s", wp.Cond)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func (d *Debugger) printRegisters(w io.Writer) {
+	c := d.GB.CPU
+	flags := []byte("----")
+	for i, f := range []uint8{0x80, 0x40, 0x20, 0x10} {
+		if c.F&f != 0 {
+			flags[i] = "ZNHC"[i]
+		}
+	}
+	fmt.Fprintf(w, "AF=%04X BC=%04X DE=%04X HL=%04X SP=%04X PC=%04X\n", c.AF(), c.BC(), c.DE(), c.HL(), c.SP, c.PC)
+	fmt.Fprintf(w, "flags=%s IME=%v bank=%d frame=%d cycles=%d\n", flags, c.IME, d.GB.Bus.MBC.ROMBank(), d.GB.Frames, c.Cycles)
+}
+
+// count parses an optional count argument
+func count(args []string, i, def int) (int, error) {
+	if len(args) <= i {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[i])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid count %q", args[i])
+	}
+	return n, nil
+}
+
+func (d *Debugger) execDump(args []string, w io.Writer) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf("usage: x <loc> [n]")
+	}
+	loc, err := d.ParseLocation(args[0])
+	if err != nil {
+		return err
+	}
+	n, err := count(args, 1, 16)
+	if err != nil {
+		return err
+	}
+	read := d.reader(loc.Bank)
+	for i := 0; i < n; i += 16 {
+		addr := loc.Addr + uint16(i)
+		fmt.Fprintf(w, "%04X:", addr)
+		for j := i; j < i+16 && j < n; j++ {
+			fmt.Fprintf(w, " %02X", read(loc.Addr+uint16(j)))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func (d *Debugger) execSet(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: set <reg> <expr> or set [<expr>] <expr>")
+	}
+	// The destination ends at the first argument after the closing bracket
+	dst, src := args[0], args[1:]
+	if strings.HasPrefix(dst, "[") {
+		for len(src) > 0 && !strings.HasSuffix(dst, "]") {
+			dst, src = dst+" "+src[0], src[1:]
+		}
+	}
+	value, err := ParseExpr(strings.Join(src, " "), d.Symbols)
+	if err != nil {
+		return err
+	}
+	v := value.Eval(d.GB)
+
+	if strings.HasPrefix(dst, "[") && strings.HasSuffix(dst, "]") {
+		addr, err := ParseExpr(dst[1:len(dst)-1], d.Symbols)
+		if err != nil {
+			return err
+		}
+		d.GB.Bus.Poke(uint16(addr.Eval(d.GB)), uint8(v))
+		return nil
+	}
+
+	c := d.GB.CPU
+	r8 := map[string]*uint8{"a": &c.A, "f": &c.F, "b": &c.B, "c": &c.C, "d": &c.D, "e": &c.E, "h": &c.H, "l": &c.L}
+	switch reg := strings.ToLower(dst); reg {
+	case "af":
+		c.A, c.F = uint8(v>>8), uint8(v)&0xF0
+	case "bc":
+		c.SetBC(uint16(v))
+	case "de":
+		c.SetDE(uint16(v))
+	case "hl":
+		c.SetHL(uint16(v))
+	case "sp":
+		c.SP = uint16(v)
+	case "pc":
+		c.PC = uint16(v)
+	default:
+		r, ok := r8[reg]
+		if !ok {
+			return fmt.Errorf("unknown register %q", dst)
+		}
+		*r = uint8(v)
+	}
+	return nil
+}
+
+func (d *Debugger) execDisassemble(args []string, w io.Writer) error {
+	loc := Location{Bank: AnyBank, Addr: d.GB.CPU.PC}
+	if len(args) > 0 {
+		var err error
+		if loc, err = d.ParseLocation(args[0]); err != nil {
+			return err
+		}
+	}
+	n, err := count(args, 1, 10)
+	if err != nil {
+		return err
+	}
+	d.disassemble(w, loc.Bank, loc.Addr, n)
+	return nil
+}
+
+// reader returns a function reading the memory as mapped now, or the ROM bank at 4000-7FFF
+func (d *Debugger) reader(bank int) func(addr uint16) uint8 {
+	banks := d.GB.Cartridge.ROMBanks
+	if bank == AnyBank || bank >= len(banks) {
+		return d.GB.Bus.Peek
+	}
+	return func(addr uint16) uint8 {
+		if addr >= 0x4000 && addr < 0x8000 {
+			return banks[bank][addr-0x4000]
+		}
+		return d.GB.Bus.Peek(addr)
+	}
+}
+
+// disassemble prints n instructions from the address, one per line with its bank, label and
+// bytes. The current instruction is marked with an arrow
+func (d *Debugger) disassemble(w io.Writer, bank int, addr uint16, n int) {
+	read := d.reader(bank)
+	bankOf := func(addr uint16) int {
+		if bank != AnyBank && addr >= 0x4000 && addr < 0x8000 {
+			return bank
+		}
+		return d.GB.Bus.Bank(addr)
+	}
+	label := func(addr uint16) string { return d.Symbols.Name(bankOf(addr), addr) }
+
+	for i := 0; i < n; i++ {
+		in := disasm.Decode(read, addr)
+		b := bankOf(addr)
+		if name := d.Symbols.Name(b, addr); name != "" {
+			fmt.Fprintf(w, "%s:\n", name)
+		}
+		mark := "  "
+		if bank == AnyBank && addr == d.GB.CPU.PC {
+			mark = "=>"
+		}
+		hex := ""
+		for _, v := range in.Bytes {
+			hex += fmt.Sprintf("%02X", v)
+		}
+		fmt.Fprintf(w, "%s %02X:%04X  %-6s  %s\n", mark, b, addr, hex, in.Format(label))
+		addr = in.Next()
+	}
+}
@@ -0,0 +1,315 @@
+package disasm
+
+import (
+	"fmt"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// Entry points of every ROM, traced with their labels
+var entryPoints = []Symbol{
+	{0, 0x0000, "RST_00"},
+	{0, 0x0008, "RST_08"},
+	{0, 0x0010, "RST_10"},
+	{0, 0x0018, "RST_18"},
+	{0, 0x0020, "RST_20"},
+	{0, 0x0028, "RST_28"},
+	{0, 0x0030, "RST_30"},
+	{0, 0x0038, "RST_38"},
+	{0, 0x0040, "VBlankInterrupt"},
+	{0, 0x0048, "LCDCInterrupt"},
+	{0, 0x0050, "TimerOverflowInterrupt"},
+	{0, 0x0058, "SerialTransferCompleteInterrupt"},
+	{0, 0x0060, "JoypadTransitionInterrupt"},
+	{0, 0x0100, "Boot"},
+}
+
+// unknown is the value of a register or a ROM bank that cannot be resolved
+const unknown = -1
+
+// Branch is a jump or a call to the switchable ROM bank whose bank could not be resolved
+type Branch struct {
+	Bank   int    // bank of the instruction
+	Addr   uint16 // address of the instruction
+	Target uint16
+}
+
+// Disassembly separates the code from the data of a ROM, following the control flow from the
+// entry points
+type Disassembly struct {
+	Cartridge *cartridge.Cartridge
+	// Labels are the given symbols and the generated labels of the traced jumps and calls
+	Labels *Symbols
+	// Unresolved are the branches to the switchable bank that were not traced
+	Unresolved []Branch
+
+	code    [][]bool       // instruction starts of each bank
+	targets map[uint32]int // bank of the 4000-7FFF operand of the instructions in bank 0
+	visited map[visit]bool
+	pending []trace
+}
+
+// state is what the traversal knows about the registers
+type state struct {
+	a, hl   int
+	romBank int // bank mapped at 4000-7FFF
+}
+
+type visit struct {
+	bank    int
+	addr    uint16
+	romBank int
+}
+
+type trace struct {
+	bank int
+	addr uint16
+	s    state
+}
+
+func key(bank int, addr uint16) uint32 {
+	return uint32(bank)<<16 | uint32(addr)
+}
+
+// Analyze traces the code of the cartridge from the entry point at 0100 and the RST and interrupt
+// vectors. Bank switches are followed when the bank written to the MBC is a constant. Labels of
+// the symbols, which can be nil, are used instead of the generated ones
+func Analyze(c *cartridge.Cartridge, syms *Symbols) *Disassembly {
+	d := &Disassembly{
+		Cartridge: c,
+		Labels:    NewSymbols(),
+		code:      make([][]bool, len(c.ROMBanks)),
+		targets:   map[uint32]int{},
+		visited:   map[visit]bool{},
+	}
+	for i := range d.code {
+		d.code[i] = make([]bool, len(c.ROMBanks[i]))
+	}
+	for _, sym := range syms.All() {
+		d.Labels.Add(sym.Bank, sym.Addr, sym.Name)
+	}
+
+	for _, e := range entryPoints {
+		// The boot ROM leaves bank 1 mapped, interrupts can happen with any bank
+		s := state{a: unknown, hl: unknown, romBank: unknown}
+		if e.Addr == 0x100 {
+			s.romBank = 1
+		}
+		d.Labels.Add(e.Bank, e.Addr, e.Name)
+		d.push(trace{0, e.Addr, s})
+	}
+	for len(d.pending) > 0 {
+		t := d.pending[len(d.pending)-1]
+		d.pending = d.pending[:len(d.pending)-1]
+		d.run(t)
+	}
+	return d
+}
+
+// IsCode returns true if an instruction starts at the address of the bank
+func (d *Disassembly) IsCode(bank int, addr uint16) bool {
+	return bank < len(d.code) && d.code[bank][addr&(cartridge.ROMBankSize-1)]
+}
+
+// read returns the memory of the bank, mapped at 4000-7FFF, or 0 past the end of the bank
+func (d *Disassembly) read(bank int) func(addr uint16) uint8 {
+	return func(addr uint16) uint8 {
+		b := d.Cartridge.ROMBanks[bank]
+		if addr >= 0x4000 {
+			addr -= 0x4000
+		}
+		if int(addr) < len(b) {
+			return b[addr]
+		}
+		return 0
+	}
+}
+
+func (d *Disassembly) push(t trace) {
+	if len(d.Cartridge.ROMBanks) <= 2 && t.s.romBank == unknown {
+		t.s.romBank = 1
+	}
+	if t.bank < len(d.code) {
+		d.pending = append(d.pending, t)
+	}
+}
+
+// bankOf returns the bank of a branch target, or unknown
+func (t trace) bankOf(target uint16) int {
+	switch {
+	case target < 0x4000:
+		return 0
+	case target < 0x8000:
+		return t.s.romBank
+	}
+	return unknown
+}
+
+// run traces the instructions from the given address until the control flow leaves
+func (d *Disassembly) run(t trace) {
+	end := uint16(0x4000)
+	if t.bank > 0 {
+		end = 0x8000
+	}
+	for {
+		v := visit{t.bank, t.addr, t.s.romBank}
+		if d.visited[v] {
+			return
+		}
+		d.visited[v] = true
+
+		in := Decode(d.read(t.bank), t.addr)
+		if int(in.Next()) > int(end) || in.Next() < in.Addr {
+			return
+		}
+		d.code[t.bank][t.addr&(cartridge.ROMBankSize-1)] = true
+		if t.bank == 0 && in.HasRef && in.Ref >= 0x4000 && in.Ref < 0x8000 && t.s.romBank != unknown {
+			d.targets[key(t.bank, t.addr)] = t.s.romBank
+		}
+
+		if in.Flow == FlowJump || in.Flow == FlowCondJump || in.Flow == FlowCall || in.Flow == FlowCondCall {
+			d.branch(t, in)
+		}
+		switch in.Flow {
+		case FlowJump, FlowReturn, FlowIndirect, FlowInvalid:
+			return
+		}
+		if in.Flow == FlowCall || in.Flow == FlowCondCall {
+			// The callee can change any register, the bank is expected to be restored
+			t.s.a, t.s.hl = unknown, unknown
+		} else {
+			t.s.update(in, d.Cartridge.Header, len(d.Cartridge.ROMBanks))
+		}
+		t.addr = in.Next()
+	}
+}
+
+// branch traces the target of a jump or a call
+func (d *Disassembly) branch(t trace, in Instruction) {
+	bank := t.bankOf(in.Target)
+	switch {
+	case in.Target >= 0x8000:
+		return
+	case bank == unknown || bank >= len(d.code):
+		d.Unresolved = append(d.Unresolved, Branch{t.bank, in.Addr, in.Target})
+		return
+	}
+
+	prefix := "Jump"
+	s := t.s
+	if in.Flow == FlowCall || in.Flow == FlowCondCall {
+		prefix = "Call"
+		s.a, s.hl = unknown, unknown
+	}
+	if in.Bytes[0]&0xC7 != 0xC7 { // RST vectors are already named
+		d.Labels.Add(bank, in.Target, fmt.Sprintf("%s_%03X_%04X", prefix, bank, in.Target))
+	}
+	d.push(trace{bank, in.Target, s})
+}
+
+// update tracks the constants loaded in A and HL and the bank switches written with them
+func (s *state) update(in Instruction, h *cartridge.CartridgeHeader, banks int) {
+	op := in.Bytes[0]
+	a, hl := s.a, s.hl
+
+	// Writes to the MBC registers
+	switch {
+	case op == 0xEA: // ld [n16], a
+		s.write(h, banks, in.Ref, a)
+	case op == 0x77 && hl != unknown: // ld [hl], a
+		s.write(h, banks, uint16(hl), a)
+	case op == 0x36 && hl != unknown: // ld [hl], n8
+		s.write(h, banks, uint16(hl), int(in.Bytes[1]))
+	case op >= 0x70 && op <= 0x75 && hl != unknown: // ld [hl], r8
+		s.write(h, banks, uint16(hl), unknown)
+	}
+
+	switch {
+	case op == 0x3E: // ld a, n8
+		s.a = int(in.Bytes[1])
+	case op == 0xAF: // xor a
+		s.a = 0
+	case modifiesA(in):
+		s.a = unknown
+	}
+
+	switch {
+	case op == 0x21: // ld hl, n16
+		s.hl = int(in.Bytes[2])<<8 | int(in.Bytes[1])
+	case (op == 0x22 || op == 0x2A) && hl != unknown: // [hl+]
+		s.hl = (hl + 1) & 0xFFFF
+	case (op == 0x32 || op == 0x3A) && hl != unknown: // [hl-]
+		s.hl = (hl - 1) & 0xFFFF
+	case modifiesHL(in):
+		s.hl = unknown
+	}
+}
+
+// write updates the ROM bank after a write of a value, or unknown, to the address
+func (s *state) write(h *cartridge.CartridgeHeader, banks int, addr uint16, v int) {
+	mask := 0
+	switch {
+	case h.IsMBC2() && addr < 0x4000 && addr&0x100 != 0:
+		mask = 0x0F
+	case h.IsMBC5() && addr >= 0x2000 && addr < 0x3000:
+		mask = 0xFF // the upper bit at 3000-3FFF is 0 in games with less than 256 banks
+	case h.IsMBC1() && addr >= 0x2000 && addr < 0x4000:
+		mask = 0x1F
+	case h.IsMBC3() && addr >= 0x2000 && addr < 0x4000:
+		mask = 0x7F
+	default:
+		return
+	}
+	switch {
+	case banks <= 2:
+		s.romBank = 1
+	case v == unknown:
+		s.romBank = unknown
+	case v&mask == 0 && !h.IsMBC5():
+		s.romBank = 1
+	default:
+		s.romBank = v & mask % banks
+	}
+}
+
+// modifiesA returns true if the instruction changes the accumulator
+func modifiesA(in Instruction) bool {
+	op := in.Bytes[0]
+	switch {
+	case op&0xCF == 0x0A: // ld a, [r16]
+		return true
+	case op <= 0x3F && op&7 == 7: // rlca, rrca, rla, rra, daa, cpl
+		return op <= 0x2F
+	case op == 0x3C || op == 0x3D: // inc a, dec a
+		return true
+	case op >= 0x78 && op <= 0x7E: // ld a, r8
+		return true
+	case op >= 0x80 && op <= 0xB7: // alu a, r8 except cp
+		return true
+	case op&0xC7 == 0xC6: // alu a, n8
+		return op != 0xFE
+	case op == 0xF0 || op == 0xF2 || op == 0xFA || op == 0xF1:
+		return true
+	case op == 0xCB:
+		cb := in.Bytes[1]
+		return cb&7 == 7 && (cb < 0x40 || cb >= 0x80)
+	}
+	return false
+}
+
+// modifiesHL returns true if the instruction changes H or L
+func modifiesHL(in Instruction) bool {
+	op := in.Bytes[0]
+	switch op {
+	case 0x09, 0x19, 0x29, 0x39, 0x23, 0x2B, 0x24, 0x25, 0x26, 0x2C, 0x2D, 0x2E, 0xE1, 0xF8:
+		return true
+	}
+	switch {
+	case op >= 0x60 && op <= 0x6F:
+		return true
+	case op == 0xCB:
+		cb := in.Bytes[1]
+		return (cb&7 == 4 || cb&7 == 5) && (cb < 0x40 || cb >= 0x80)
+	}
+	return false
+}
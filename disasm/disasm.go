@@ -0,0 +1,283 @@
+// Package disasm decodes SM83 machine code into RGBDS assembly
+package disasm
+
+import "fmt"
+
+// Reference: https://gbdev.io/gb-opcodes/optables/ and https://rgbds.gbdev.io/docs/gbz80.7
+
+// Flow is the effect of an instruction on the control flow
+type Flow int
+
+const (
+	FlowNext       Flow = iota // continues with the next instruction
+	FlowJump                   // always jumps to the target
+	FlowCondJump               // jumps to the target or continues
+	FlowCall                   // calls the target, including RST
+	FlowCondCall               // calls the target or continues
+	FlowReturn                 // RET and RETI
+	FlowCondReturn             // returns or continues
+	FlowIndirect               // JP HL, the destination is not known
+	FlowInvalid                // illegal opcode, locks the CPU
+)
+
+// Instruction is a decoded instruction
+type Instruction struct {
+	Addr  uint16
+	Bytes []uint8
+	Flow  Flow
+	// Target is the destination of jumps and calls
+	Target uint16
+	// Ref is the address operand of jumps, calls and memory accesses, which can be replaced by a
+	// label. It is only valid if HasRef is true
+	Ref    uint16
+	HasRef bool
+
+	format string // text with a %s in place of the address operand
+}
+
+// Len returns the size of the instruction in bytes
+func (in Instruction) Len() int {
+	return len(in.Bytes)
+}
+
+// Next returns the address of the following instruction
+func (in Instruction) Next() uint16 {
+	return in.Addr + uint16(len(in.Bytes))
+}
+
+func (in Instruction) String() string {
+	return in.Format(nil)
+}
+
+// Format returns the instruction in RGBDS syntax. The address operand is replaced by the name
+// returned by label, unless it returns an empty string
+func (in Instruction) Format(label func(addr uint16) string) string {
+	if !in.HasRef {
+		return in.format
+	}
+	name := ""
+	if label != nil {
+		name = label(in.Ref)
+	}
+	if name == "" {
+		name = fmt.Sprintf("$%04X", in.Ref)
+	}
+	return fmt.Sprintf(in.format, name)
+}
+
+var (
+	r8Names   = [8]string{"b", "c", "d", "e", "h", "l", "[hl]", "a"}
+	r16Names  = [4]string{"bc", "de", "hl", "sp"}
+	r16Stack  = [4]string{"bc", "de", "hl", "af"}
+	r16Memory = [4]string{"[bc]", "[de]", "[hl+]", "[hl-]"}
+	condNames = [4]string{"nz", "z", "nc", "c"}
+	aluNames  = [8]string{"add a, ", "adc a, ", "sub ", "sbc a, ", "and ", "xor ", "or ", "cp "}
+	accNames  = [8]string{"rlca", "rrca", "rla", "rra", "daa", "cpl", "scf", "ccf"}
+	rotNames  = [8]string{"rlc", "rrc", "rl", "rr", "sla", "sra", "swap", "srl"}
+	bitNames  = [4]string{"", "bit", "res", "set"}
+)
+
+// decoder reads the operands of an instruction
+type decoder struct {
+	read func(addr uint16) uint8
+	in   Instruction
+}
+
+func (d *decoder) n8() uint8 {
+	v := d.read(d.in.Addr + uint16(len(d.in.Bytes)))
+	d.in.Bytes = append(d.in.Bytes, v)
+	return v
+}
+
+func (d *decoder) n16() uint16 {
+	lo := d.n8()
+	return uint16(d.n8())<<8 | uint16(lo)
+}
+
+// e8 reads a signed offset and returns the address it points to from the next instruction
+func (d *decoder) e8() uint16 {
+	e := int8(d.n8())
+	return d.in.Addr + uint16(len(d.in.Bytes)) + uint16(e)
+}
+
+func (d *decoder) text(format string, args ...interface{}) {
+	d.in.format = fmt.Sprintf(format, args...)
+}
+
+func (d *decoder) ref(format string, addr uint16) {
+	d.in.format, d.in.Ref, d.in.HasRef = format, addr, true
+}
+
+func (d *decoder) flow(f Flow, format string, target uint16) {
+	d.in.Flow, d.in.Target = f, target
+	d.ref(format, target)
+}
+
+func (d *decoder) invalid() {
+	d.in.Flow = FlowInvalid
+	d.text("db $%02X", d.in.Bytes[0])
+}
+
+// Decode decodes the instruction at the given address, reading the memory with read
+func Decode(read func(addr uint16) uint8, addr uint16) Instruction {
+	op := read(addr)
+	d := &decoder{read: read, in: Instruction{Addr: addr, Bytes: []uint8{op}}}
+
+	x, y, z := op>>6, op>>3&7, op&7
+	switch x {
+	case 0:
+		d.decodeX0(y, z)
+	case 1:
+		if op == 0x76 {
+			d.text("halt")
+		} else {
+			d.text("ld %s, %s", r8Names[y], r8Names[z])
+		}
+	case 2:
+		d.text("%s%s", aluNames[y], r8Names[z])
+	case 3:
+		d.decodeX3(y, z)
+	}
+	return d.in
+}
+
+func (d *decoder) decodeX0(y, z uint8) {
+	p, q := y>>1, y&1
+	switch z {
+	case 0:
+		switch {
+		case y == 0:
+			d.text("nop")
+		case y == 1:
+			d.ref("ld [%s], sp", d.n16())
+		case y == 2:
+			if v := d.n8(); v != 0 {
+				d.text("db $10, $%02X", v)
+			} else {
+				d.text("stop")
+			}
+		case y == 3:
+			d.flow(FlowJump, "jr %s", d.e8())
+		default:
+			d.flow(FlowCondJump, "jr "+condNames[y-4]+", %s", d.e8())
+		}
+	case 1:
+		if q == 0 {
+			d.text("ld %s, $%04X", r16Names[p], d.n16())
+		} else {
+			d.text("add hl, %s", r16Names[p])
+		}
+	case 2:
+		if q == 0 {
+			d.text("ld %s, a", r16Memory[p])
+		} else {
+			d.text("ld a, %s", r16Memory[p])
+		}
+	case 3:
+		if q == 0 {
+			d.text("inc %s", r16Names[p])
+		} else {
+			d.text("dec %s", r16Names[p])
+		}
+	case 4:
+		d.text("inc %s", r8Names[y])
+	case 5:
+		d.text("dec %s", r8Names[y])
+	case 6:
+		d.text("ld %s, $%02X", r8Names[y], d.n8())
+	case 7:
+		d.text("%s", accNames[y])
+	}
+}
+
+func (d *decoder) decodeX3(y, z uint8) {
+	p, q := y>>1, y&1
+	switch z {
+	case 0:
+		switch {
+		case y < 4:
+			d.in.Flow = FlowCondReturn
+			d.text("ret %s", condNames[y])
+		case y == 4:
+			d.ref("ldh [%s], a", 0xFF00|uint16(d.n8()))
+		case y == 5:
+			d.text("add sp, %d", int8(d.n8()))
+		case y == 6:
+			d.ref("ldh a, [%s]", 0xFF00|uint16(d.n8()))
+		default:
+			if e := int8(d.n8()); e < 0 {
+				d.text("ld hl, sp-%d", -int(e))
+			} else {
+				d.text("ld hl, sp+%d", e)
+			}
+		}
+	case 1:
+		switch {
+		case q == 0:
+			d.text("pop %s", r16Stack[p])
+		case p == 0:
+			d.in.Flow = FlowReturn
+			d.text("ret")
+		case p == 1:
+			d.in.Flow = FlowReturn
+			d.text("reti")
+		case p == 2:
+			d.in.Flow = FlowIndirect
+			d.text("jp hl")
+		default:
+			d.text("ld sp, hl")
+		}
+	case 2:
+		switch {
+		case y < 4:
+			d.flow(FlowCondJump, "jp "+condNames[y]+", %s", d.n16())
+		case y == 4:
+			d.text("ldh [c], a")
+		case y == 5:
+			d.ref("ld [%s], a", d.n16())
+		case y == 6:
+			d.text("ldh a, [c]")
+		default:
+			d.ref("ld a, [%s]", d.n16())
+		}
+	case 3:
+		switch y {
+		case 0:
+			d.flow(FlowJump, "jp %s", d.n16())
+		case 1:
+			cb := d.n8()
+			cy, cz := cb>>3&7, cb&7
+			if cb < 0x40 {
+				d.text("%s %s", rotNames[cy], r8Names[cz])
+			} else {
+				d.text("%s %d, %s", bitNames[cb>>6], cy, r8Names[cz])
+			}
+		case 6:
+			d.text("di")
+		case 7:
+			d.text("ei")
+		default:
+			d.invalid()
+		}
+	case 4:
+		if y < 4 {
+			d.flow(FlowCondCall, "call "+condNames[y]+", %s", d.n16())
+		} else {
+			d.invalid()
+		}
+	case 5:
+		switch {
+		case q == 0:
+			d.text("push %s", r16Stack[p])
+		case p == 0:
+			d.flow(FlowCall, "call %s", d.n16())
+		default:
+			d.invalid()
+		}
+	case 6:
+		d.text("%s$%02X", aluNames[y], d.n8())
+	case 7:
+		d.in.Flow, d.in.Target = FlowCall, uint16(y)*8
+		d.text("rst $%02X", y*8)
+	}
+}
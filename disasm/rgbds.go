@@ -0,0 +1,152 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// bytesPerRow is the maximum number of bytes of a db line
+const bytesPerRow = 8
+
+// line is an instruction or a row of data
+type line struct {
+	addr uint16
+	in   *Instruction // nil for data
+	data []uint8
+}
+
+// layout splits a bank in lines. Instructions overlapping others or crossing the end of the bank
+// are written as data, so the output always assembles to the same bytes
+func (d *Disassembly) layout(bank int) []line {
+	rom := d.Cartridge.ROMBanks[bank]
+	base := uint16(0)
+	if bank > 0 {
+		base = 0x4000
+	}
+	read := d.read(bank)
+
+	var lines []line
+	for off := 0; off < len(rom); {
+		addr := base + uint16(off)
+		if d.code[bank][off] {
+			in := Decode(read, addr)
+			if d.fits(bank, off, in.Len()) {
+				lines = append(lines, line{addr: addr, in: &in})
+				off += in.Len()
+				continue
+			}
+		}
+		// Data until the next label or instruction
+		n := 1
+		for n < bytesPerRow && off+n < len(rom) && !d.code[bank][off+n] && d.Labels.Name(bank, addr+uint16(n)) == "" {
+			n++
+		}
+		lines = append(lines, line{addr: addr, data: rom[off : off+n]})
+		off += n
+	}
+	return lines
+}
+
+// fits returns true if the instruction ends in the bank without overlapping other instructions
+func (d *Disassembly) fits(bank, off, n int) bool {
+	if off+n > len(d.code[bank]) {
+		return false
+	}
+	for i := off + 1; i < off+n; i++ {
+		if d.code[bank][i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteRGBDS writes the disassembly as RGBDS assembly with a section per bank. Assembled and
+// linked, ie. `rgbasm -o rom.o rom.asm && rgblink -o rom.gb rom.o`, it gives back the same ROM
+func (d *Disassembly) WriteRGBDS(w io.Writer) error {
+	layouts := make([][]line, len(d.Cartridge.ROMBanks))
+	defined := map[uint32]bool{} // labels placed at the start of a line
+	for bank := range layouts {
+		layouts[bank] = d.layout(bank)
+		for _, l := range layouts[bank] {
+			if d.Labels.Name(bank, l.addr) != "" {
+				defined[key(bank, l.addr)] = true
+			}
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	title := strings.TrimRight(string(d.Cartridge.Header.Title), "\x00")
+	fmt.Fprintf(bw, "; Disassembly of %s\n", title)
+	for bank, lines := range layouts {
+		if bank == 0 {
+			fmt.Fprintf(bw, "\nSECTION \"ROM Bank $%03X\", ROM0[$0000]\n", bank)
+		} else {
+			fmt.Fprintf(bw, "\nSECTION \"ROM Bank $%03X\", ROMX[$4000], BANK[$%X]\n", bank, bank)
+		}
+		for _, l := range lines {
+			if name := d.Labels.Name(bank, l.addr); name != "" {
+				fmt.Fprintf(bw, "\n%s:\n", name)
+			}
+			if l.in == nil {
+				fmt.Fprintf(bw, "\tdb %s\n", hexBytes(l.data))
+				continue
+			}
+			label := func(addr uint16) string {
+				if rel, ok := wrappedJR(l.in); ok {
+					return fmt.Sprintf("@ - %d", -rel)
+				}
+				b := d.refBank(bank, l.addr, addr)
+				if b == unknown || !defined[key(b, addr)] {
+					return ""
+				}
+				return d.Labels.Name(b, addr)
+			}
+			fmt.Fprintf(bw, "\t%s\n", l.in.Format(label))
+		}
+	}
+	return bw.Flush()
+}
+
+// wrappedJR returns the offset from the instruction address of a JR whose destination wraps
+// around 0000, which assemblers reject as an absolute address
+func wrappedJR(in *Instruction) (int, bool) {
+	switch in.Bytes[0] {
+	case 0x18, 0x20, 0x28, 0x30, 0x38:
+		rel := int(int8(in.Bytes[1])) + len(in.Bytes)
+		return rel, int(in.Addr)+rel < 0
+	}
+	return 0, false
+}
+
+// refBank returns the bank of the address operand of the instruction at the address
+func (d *Disassembly) refBank(bank int, addr, ref uint16) int {
+	switch {
+	case ref < 0x4000:
+		return 0
+	case ref >= 0x8000:
+		return unknown
+	case bank > 0:
+		return bank
+	}
+	if b, ok := d.targets[key(bank, addr)]; ok {
+		return b
+	}
+	return unknown
+}
+
+func hexBytes(data []uint8) string {
+	s := make([]string, len(data))
+	for i, v := range data {
+		s[i] = fmt.Sprintf("$%02X", v)
+	}
+	return strings.Join(s, ", ")
+}
+
+// Disassemble analyses the cartridge and writes it as RGBDS assembly
+func Disassemble(c *cartridge.Cartridge, syms *Symbols, w io.Writer) error {
+	return Analyze(c, syms).WriteRGBDS(w)
+}
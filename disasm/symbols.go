@@ -0,0 +1,141 @@
+package disasm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbol is a label at a banked address
+type Symbol struct {
+	Bank int
+	Addr uint16
+	Name string
+}
+
+// Symbols are the labels of a program, as listed in a RGBDS .sym file. A nil *Symbols has no
+// labels
+type Symbols struct {
+	sorted []Symbol // by bank and address
+	byName map[string]Symbol
+}
+
+// NewSymbols returns an empty symbol table
+func NewSymbols() *Symbols {
+	return &Symbols{byName: map[string]Symbol{}}
+}
+
+// ParseSymbols reads a RGBDS .sym file, with a "bank:address name" line per label. Comments
+// start with ;
+func ParseSymbols(r io.Reader) (*Symbols, error) {
+	s := NewSymbols()
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if i := strings.Index(text, ";"); i >= 0 {
+			text = text[:i]
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		sym, err := parseSymbol(fields)
+		if err != nil {
+			return nil, fmt.Errorf("sym file line %d: %v", line, err)
+		}
+		s.Add(sym.Bank, sym.Addr, sym.Name)
+	}
+	return s, scanner.Err()
+}
+
+func parseSymbol(fields []string) (Symbol, error) {
+	loc := strings.Split(fields[0], ":")
+	if len(fields) != 2 || len(loc) != 2 {
+		return Symbol{}, fmt.Errorf("expected bank:address name")
+	}
+	bank, err := strconv.ParseUint(loc[0], 16, 16)
+	if err != nil {
+		return Symbol{}, fmt.Errorf("invalid bank %q", loc[0])
+	}
+	addr, err := strconv.ParseUint(loc[1], 16, 16)
+	if err != nil {
+		return Symbol{}, fmt.Errorf("invalid address %q", loc[1])
+	}
+	return Symbol{int(bank), uint16(addr), fields[1]}, nil
+}
+
+// LoadSymbols reads a RGBDS .sym file
+func LoadSymbols(fname string) (*Symbols, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseSymbols(f)
+}
+
+// Add adds a label. The first label of an address is used to name it
+func (s *Symbols) Add(bank int, addr uint16, name string) {
+	sym := Symbol{bank, addr, name}
+	i := sort.Search(len(s.sorted), func(i int) bool { return !s.sorted[i].before(sym) })
+	s.sorted = append(s.sorted, Symbol{})
+	copy(s.sorted[i+1:], s.sorted[i:])
+	s.sorted[i] = sym
+	s.byName[name] = sym
+}
+
+// before orders the symbols by bank and address, keeping the insertion order of the labels of
+// the same address
+func (s Symbol) before(o Symbol) bool {
+	return s.Bank < o.Bank || s.Bank == o.Bank && s.Addr <= o.Addr
+}
+
+// All returns the labels sorted by bank and address
+func (s *Symbols) All() []Symbol {
+	if s == nil {
+		return nil
+	}
+	return s.sorted
+}
+
+// Name returns the label of the address, or an empty string
+func (s *Symbols) Name(bank int, addr uint16) string {
+	if sym, ok := s.Nearest(bank, addr); ok && sym.Addr == addr {
+		return sym.Name
+	}
+	return ""
+}
+
+// Nearest returns the closest label at or before the address in the same bank
+func (s *Symbols) Nearest(bank int, addr uint16) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	// First symbol after the address, the previous one is the nearest
+	i := sort.Search(len(s.sorted), func(i int) bool {
+		o := s.sorted[i]
+		return o.Bank > bank || o.Bank == bank && o.Addr > addr
+	})
+	i--
+	if i < 0 || s.sorted[i].Bank != bank {
+		return Symbol{}, false
+	}
+	// The first label of the address names it
+	for i > 0 && s.sorted[i-1].Bank == bank && s.sorted[i-1].Addr == s.sorted[i].Addr {
+		i--
+	}
+	return s.sorted[i], true
+}
+
+// Lookup returns the label with the given name
+func (s *Symbols) Lookup(name string) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	sym, ok := s.byName[name]
+	return sym, ok
+}
@@ -0,0 +1,507 @@
+package emu
+
+import "github.com/Guillem96/gameboy-tools/cartridge"
+
+// Reference: https://gbdev.io/pandocs/Audio_Registers.html
+
+// Audio registers, FF10-FF3F (the last 16 bytes are the wave RAM)
+const (
+	addrNR10    uint16 = 0xFF10
+	addrNR52    uint16 = 0xFF26
+	addrWaveRAM uint16 = 0xFF30
+	addrAPUEnd  uint16 = 0xFF3F
+)
+
+// Register offsets from NR10
+const (
+	nr10 = iota
+	nr11
+	nr12
+	nr13
+	nr14
+	_
+	nr21
+	nr22
+	nr23
+	nr24
+	nr30
+	nr31
+	nr32
+	nr33
+	nr34
+	_
+	nr41
+	nr42
+	nr43
+	nr44
+	nr50
+	nr51
+	nr52
+)
+
+// Bits that always read as 1 for each register (write only bits and unused registers)
+var apuReadMasks = [0x20]uint8{
+	0x80, 0x3F, 0x00, 0xFF, 0xBF,
+	0xFF, 0x3F, 0x00, 0xFF, 0xBF,
+	0x7F, 0xFF, 0x9F, 0xFF, 0xBF,
+	0xFF, 0xFF, 0x00, 0x00, 0xBF,
+	0x00, 0x00, 0x70,
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+}
+
+// The frame sequencer clocks the length counters at 256Hz, the sweep at 128Hz and the envelopes
+// at 64Hz
+const frameSequencerPeriod = 8192
+
+// DefaultSampleRate is the sample rate of the PCM output
+const DefaultSampleRate = 44100
+
+var dutyPatterns = [4][8]uint8{
+	{0, 0, 0, 0, 0, 0, 0, 1}, // 12.5%
+	{1, 0, 0, 0, 0, 0, 0, 1}, // 25%
+	{1, 0, 0, 0, 0, 1, 1, 1}, // 50%
+	{0, 1, 1, 1, 1, 1, 1, 0}, // 75%
+}
+
+var noiseDivisors = [8]int{8, 16, 32, 48, 64, 80, 96, 112}
+
+// channel holds the state shared by the four sound channels
+type channel struct {
+	enabled       bool
+	dac           bool
+	length        int
+	lengthEnabled bool
+	timer         int
+
+	// Envelope (pulse and noise channels)
+	volume      uint8
+	envPeriod   uint8
+	envTimer    uint8
+	envIncrease bool
+}
+
+func (ch *channel) clockLength() {
+	if ch.lengthEnabled && ch.length > 0 {
+		ch.length--
+		if ch.length == 0 {
+			ch.enabled = false
+		}
+	}
+}
+
+func (ch *channel) clockEnvelope() {
+	if ch.envPeriod == 0 {
+		return
+	}
+	if ch.envTimer > 0 {
+		ch.envTimer--
+	}
+	if ch.envTimer == 0 {
+		ch.envTimer = ch.envPeriod
+		if ch.envIncrease && ch.volume < 15 {
+			ch.volume++
+		} else if !ch.envIncrease && ch.volume > 0 {
+			ch.volume--
+		}
+	}
+}
+
+// setEnvelope decodes a NRx2 register. The DAC is off when the upper 5 bits are 0
+func (ch *channel) setEnvelope(v uint8) {
+	ch.dac = v&0xF8 != 0
+	if !ch.dac {
+		ch.enabled = false
+	}
+}
+
+func (ch *channel) triggerEnvelope(nrx2 uint8) {
+	ch.volume = nrx2 >> 4
+	ch.envIncrease = nrx2&0x08 != 0
+	ch.envPeriod = nrx2 & 0x07
+	ch.envTimer = ch.envPeriod
+}
+
+// APU is the audio processing unit. It mixes the two pulse channels, the wave channel and the
+// noise channel into stereo PCM samples
+type APU struct {
+	// SampleRate of the generated samples
+	SampleRate int
+
+	regs    [0x20]uint8
+	WaveRAM [16]uint8
+
+	pulse1, pulse2, wave, noise channel
+
+	// Pulse channels
+	duty1, duty2 uint8 // position in the duty pattern
+
+	// Sweep (channel 1)
+	sweepEnabled bool
+	sweepTimer   uint8
+	shadowFreq   int
+
+	// Wave channel
+	wavePos uint8
+
+	// Noise channel
+	lfsr uint16
+
+	seqTimer int
+	seqStep  int
+
+	// Resampling: every output sample is the average of the cycles it spans
+	sampleClock int
+	sumL, sumR  float64
+	sumCount    int
+	capL, capR  float64 // high pass filter state, removes the DC offset of the DACs
+	samples     []int16
+}
+
+// NewAPU returns a powered on APU generating samples at the given rate
+func NewAPU(sampleRate int) *APU {
+	a := &APU{SampleRate: sampleRate, seqTimer: frameSequencerPeriod}
+	// State left by the boot ROM
+	a.regs = [0x20]uint8{nr10: 0x80, nr11: 0xBF, nr12: 0xF3, nr14: 0xBF, nr21: 0x3F, nr24: 0xBF,
+		nr30: 0x7F, nr31: 0xFF, nr32: 0x9F, nr34: 0xBF, nr41: 0xFF, nr44: 0xBF, nr50: 0x77, nr51: 0xF3,
+		nr52: 0x80}
+	a.pulse1.enabled, a.pulse1.dac = true, true
+	return a
+}
+
+func (a *APU) powered() bool {
+	return a.regs[nr52]&0x80 != 0
+}
+
+// IsRegister returns true if the address is handled by the APU
+func (a *APU) IsRegister(addr uint16) bool {
+	return addr >= addrNR10 && addr <= addrAPUEnd
+}
+
+// ReadRegister returns the value of an audio register or of the wave RAM
+func (a *APU) ReadRegister(addr uint16) uint8 {
+	if addr >= addrWaveRAM {
+		return a.WaveRAM[addr-addrWaveRAM]
+	}
+	off := addr - addrNR10
+	if off == nr52 {
+		v := a.regs[nr52]&0x80 | 0x70
+		for i, ch := range []*channel{&a.pulse1, &a.pulse2, &a.wave, &a.noise} {
+			if ch.enabled {
+				v |= 1 << uint(i)
+			}
+		}
+		return v
+	}
+	return a.regs[off] | apuReadMasks[off]
+}
+
+// WriteRegister sets the value of an audio register or of the wave RAM. While the APU is
+// powered off only NR52 and the wave RAM can be written
+func (a *APU) WriteRegister(addr uint16, v uint8) {
+	if addr >= addrWaveRAM {
+		a.WaveRAM[addr-addrWaveRAM] = v
+		return
+	}
+	off := int(addr - addrNR10)
+	if off == nr52 {
+		a.setPower(v&0x80 != 0)
+		return
+	}
+	if !a.powered() {
+		return
+	}
+	a.regs[off] = v
+
+	switch off {
+	case nr11:
+		a.pulse1.length = 64 - int(v&0x3F)
+	case nr12:
+		a.pulse1.setEnvelope(v)
+	case nr14:
+		a.pulse1.lengthEnabled = v&0x40 != 0
+		if v&0x80 != 0 {
+			a.triggerPulse1()
+		}
+	case nr21:
+		a.pulse2.length = 64 - int(v&0x3F)
+	case nr22:
+		a.pulse2.setEnvelope(v)
+	case nr24:
+		a.pulse2.lengthEnabled = v&0x40 != 0
+		if v&0x80 != 0 {
+			a.triggerPulse(&a.pulse2, a.regs[nr22], nr23)
+		}
+	case nr30:
+		a.wave.dac = v&0x80 != 0
+		if !a.wave.dac {
+			a.wave.enabled = false
+		}
+	case nr31:
+		a.wave.length = 256 - int(v)
+	case nr34:
+		a.wave.lengthEnabled = v&0x40 != 0
+		if v&0x80 != 0 {
+			a.triggerWave()
+		}
+	case nr41:
+		a.noise.length = 64 - int(v&0x3F)
+	case nr42:
+		a.noise.setEnvelope(v)
+	case nr44:
+		a.noise.lengthEnabled = v&0x40 != 0
+		if v&0x80 != 0 {
+			a.triggerNoise()
+		}
+	}
+}
+
+// setPower turns the APU on or off. Turning it off clears every register except the wave RAM
+func (a *APU) setPower(on bool) {
+	if on == a.powered() {
+		return
+	}
+	if !on {
+		a.regs = [0x20]uint8{}
+		a.pulse1, a.pulse2, a.wave, a.noise = channel{}, channel{}, channel{}, channel{}
+		a.sweepEnabled = false
+		return
+	}
+	a.regs[nr52] = 0x80
+	a.seqStep = 0
+	a.seqTimer = frameSequencerPeriod
+	a.duty1, a.duty2, a.wavePos = 0, 0, 0
+}
+
+func (a *APU) frequency(lowReg int) int {
+	return int(a.regs[lowReg+1]&0x07)<<8 | int(a.regs[lowReg])
+}
+
+func (a *APU) setFrequency(lowReg int, f int) {
+	a.regs[lowReg] = uint8(f)
+	a.regs[lowReg+1] = a.regs[lowReg+1]&^0x07 | uint8(f>>8)&0x07
+}
+
+func (a *APU) triggerPulse(ch *channel, nrx2 uint8, lowReg int) {
+	ch.enabled = ch.dac
+	if ch.length == 0 {
+		ch.length = 64
+	}
+	ch.timer = (2048 - a.frequency(lowReg)) * 4
+	ch.triggerEnvelope(nrx2)
+}
+
+func (a *APU) triggerPulse1() {
+	a.triggerPulse(&a.pulse1, a.regs[nr12], nr13)
+
+	period, shift := a.regs[nr10]>>4&0x07, a.regs[nr10]&0x07
+	a.shadowFreq = a.frequency(nr13)
+	a.sweepTimer = period
+	if a.sweepTimer == 0 {
+		a.sweepTimer = 8
+	}
+	a.sweepEnabled = period != 0 || shift != 0
+	if shift != 0 {
+		a.sweepFrequency()
+	}
+}
+
+// sweepFrequency returns the next frequency of the sweep, disabling the channel if it overflows
+func (a *APU) sweepFrequency() int {
+	delta := a.shadowFreq >> (a.regs[nr10] & 0x07)
+	f := a.shadowFreq + delta
+	if a.regs[nr10]&0x08 != 0 {
+		f = a.shadowFreq - delta
+	}
+	if f > 2047 {
+		a.pulse1.enabled = false
+	}
+	return f
+}
+
+func (a *APU) clockSweep() {
+	if a.sweepTimer > 0 {
+		a.sweepTimer--
+	}
+	if a.sweepTimer != 0 {
+		return
+	}
+
+	period, shift := a.regs[nr10]>>4&0x07, a.regs[nr10]&0x07
+	a.sweepTimer = period
+	if a.sweepTimer == 0 {
+		a.sweepTimer = 8
+	}
+	if !a.sweepEnabled || period == 0 {
+		return
+	}
+	if f := a.sweepFrequency(); f <= 2047 && shift != 0 {
+		a.shadowFreq = f
+		a.setFrequency(nr13, f)
+		a.sweepFrequency()
+	}
+}
+
+func (a *APU) triggerWave() {
+	a.wave.enabled = a.wave.dac
+	if a.wave.length == 0 {
+		a.wave.length = 256
+	}
+	a.wave.timer = (2048 - a.frequency(nr33)) * 2
+	a.wavePos = 0
+}
+
+func (a *APU) noisePeriod() int {
+	nr43v := a.regs[nr43]
+	return noiseDivisors[nr43v&0x07] << (nr43v >> 4)
+}
+
+func (a *APU) triggerNoise() {
+	a.noise.enabled = a.noise.dac
+	if a.noise.length == 0 {
+		a.noise.length = 64
+	}
+	a.noise.timer = a.noisePeriod()
+	a.noise.triggerEnvelope(a.regs[nr42])
+	a.lfsr = 0x7FFF
+}
+
+// Tick advances the APU by the given number of clock cycles
+func (a *APU) Tick(cycles int) {
+	for i := 0; i < cycles; i++ {
+		if a.powered() {
+			a.step()
+		}
+		a.mix()
+	}
+}
+
+// step advances the channel timers and the frame sequencer by one clock cycle
+func (a *APU) step() {
+	if a.pulse1.timer--; a.pulse1.timer <= 0 {
+		a.pulse1.timer = (2048 - a.frequency(nr13)) * 4
+		a.duty1 = (a.duty1 + 1) & 7
+	}
+	if a.pulse2.timer--; a.pulse2.timer <= 0 {
+		a.pulse2.timer = (2048 - a.frequency(nr23)) * 4
+		a.duty2 = (a.duty2 + 1) & 7
+	}
+	if a.wave.timer--; a.wave.timer <= 0 {
+		a.wave.timer = (2048 - a.frequency(nr33)) * 2
+		a.wavePos = (a.wavePos + 1) & 31
+	}
+	if a.noise.timer--; a.noise.timer <= 0 {
+		a.noise.timer = a.noisePeriod()
+		bit := (a.lfsr ^ a.lfsr>>1) & 1
+		a.lfsr = a.lfsr>>1 | bit<<14
+		if a.regs[nr43]&0x08 != 0 {
+			a.lfsr = a.lfsr&^(1<<6) | bit<<6
+		}
+	}
+
+	if a.seqTimer--; a.seqTimer > 0 {
+		return
+	}
+	a.seqTimer = frameSequencerPeriod
+	if a.seqStep%2 == 0 {
+		for _, ch := range []*channel{&a.pulse1, &a.pulse2, &a.wave, &a.noise} {
+			ch.clockLength()
+		}
+	}
+	if a.seqStep == 2 || a.seqStep == 6 {
+		a.clockSweep()
+	}
+	if a.seqStep == 7 {
+		a.pulse1.clockEnvelope()
+		a.pulse2.clockEnvelope()
+		a.noise.clockEnvelope()
+	}
+	a.seqStep = (a.seqStep + 1) & 7
+}
+
+// outputs returns the digital output (0-15) of each channel
+func (a *APU) outputs() [4]uint8 {
+	var out [4]uint8
+	if a.pulse1.enabled {
+		out[0] = dutyPatterns[a.regs[nr11]>>6][a.duty1] * a.pulse1.volume
+	}
+	if a.pulse2.enabled {
+		out[1] = dutyPatterns[a.regs[nr21]>>6][a.duty2] * a.pulse2.volume
+	}
+	if a.wave.enabled {
+		sample := a.WaveRAM[a.wavePos/2]
+		if a.wavePos%2 == 0 {
+			sample >>= 4
+		}
+		if level := a.regs[nr32] >> 5 & 0x03; level != 0 {
+			out[2] = (sample & 0x0F) >> (level - 1)
+		}
+	}
+	if a.noise.enabled && a.lfsr&1 == 0 {
+		out[3] = a.noise.volume
+	}
+	return out
+}
+
+// mix converts the channel outputs to analog, pans them and accumulates them for the current
+// output sample
+func (a *APU) mix() {
+	var left, right float64
+	if a.powered() {
+		out := a.outputs()
+		dacs := [4]bool{a.pulse1.dac, a.pulse2.dac, a.wave.dac, a.noise.dac}
+		panning := a.regs[nr51]
+		for i, v := range out {
+			if !dacs[i] {
+				continue
+			}
+			analog := 1 - float64(v)/7.5
+			if panning&(0x10<<uint(i)) != 0 {
+				left += analog
+			}
+			if panning&(0x01<<uint(i)) != 0 {
+				right += analog
+			}
+		}
+		left *= float64(a.regs[nr50]>>4&0x07+1) / 8
+		right *= float64(a.regs[nr50]&0x07+1) / 8
+	}
+	a.sumL += left
+	a.sumR += right
+	a.sumCount++
+
+	a.sampleClock += a.SampleRate
+	if a.sampleClock < cartridge.CyclesPerSecond {
+		return
+	}
+	a.sampleClock -= cartridge.CyclesPerSecond
+	a.emit(a.sumL/float64(a.sumCount), a.sumR/float64(a.sumCount))
+	a.sumL, a.sumR, a.sumCount = 0, 0, 0
+}
+
+func (a *APU) emit(left, right float64) {
+	const charge = 0.996 // high pass filter charge factor, per sample at 44100Hz
+	outL, outR := left-a.capL, right-a.capR
+	// Explicit conversions prevent fused multiply-adds, keeping the output identical on every
+	// architecture
+	a.capL = left - float64(outL*charge)
+	a.capR = right - float64(outR*charge)
+
+	// 4 channels at full volume give an amplitude of 4
+	a.samples = append(a.samples, pcm(outL/4), pcm(outR/4))
+}
+
+func pcm(v float64) int16 {
+	if v > 1 {
+		v = 1
+	} else if v < -1 {
+		v = -1
+	}
+	return int16(v * 32767)
+}
+
+// Samples returns the stereo samples (left and right interleaved) generated since the last call
+func (a *APU) Samples() []int16 {
+	s := a.samples
+	a.samples = nil
+	return s
+}
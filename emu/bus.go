@@ -0,0 +1,227 @@
+package emu
+
+import "github.com/Guillem96/gameboy-tools/cartridge"
+
+// Reference: https://gbdev.io/pandocs/Memory_Map.html
+
+// Memory map regions
+const (
+	addrVRAM     uint16 = 0x8000
+	addrExtRAM   uint16 = 0xA000
+	addrWRAM     uint16 = 0xC000
+	addrEcho     uint16 = 0xE000
+	addrOAM      uint16 = 0xFE00
+	addrUnusable uint16 = 0xFEA0
+	addrIO       uint16 = 0xFF00
+	addrHRAM     uint16 = 0xFF80
+)
+
+// Bus connects the CPU with the cartridge, the internal memories and the I/O registers
+type Bus struct {
+	MBC    cartridge.MBC
+	PPU    *PPU
+	APU    *APU
+	Timer  *Timer
+	Joypad *Joypad
+	Serial *Serial
+	DMA    *DMA
+	WRAM   [8][0x1000]uint8 // banks 1-7 are mapped at D000-DFFF in CGB mode
+	HRAM   [0x7F]uint8
+	IO     [0x80]uint8 // FF00-FF7F, registers without a component behind them are plain memory
+	IE     uint8
+
+	// CGB mode
+	CGB         bool
+	DoubleSpeed bool
+	key1        uint8
+	svbk        uint8
+	hdma        hdma
+	stall       int // clock cycles the CPU is stopped by a DMA transfer
+
+	// OnAccess is called after every data read and write of the instructions, used by debuggers
+	// to watch memory. Opcode fetches and interrupt checks are not reported
+	OnAccess func(addr uint16, v uint8, write bool)
+}
+
+// NewBus returns a bus with the cartridge inserted
+func NewBus(c *cartridge.Cartridge) (*Bus, error) {
+	mbc, err := cartridge.NewMBC(c)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bus{MBC: mbc}
+	b.PPU = NewPPU(b.RequestInterrupt)
+	b.APU = NewAPU(DefaultSampleRate)
+	b.Timer = NewTimer(b.RequestInterrupt)
+	b.Joypad = NewJoypad(b.RequestInterrupt)
+	b.Serial = NewSerial(b.RequestInterrupt)
+	b.DMA = NewDMA(b.read, &b.PPU.OAM)
+	return b, nil
+}
+
+// Read returns the value seen by the CPU at the given address
+func (b *Bus) Read(addr uint16) uint8 {
+	v := b.Fetch(addr)
+	if b.OnAccess != nil {
+		b.OnAccess(addr, v, false)
+	}
+	return v
+}
+
+// Fetch returns the instruction byte seen by the CPU at the given address. It is the same as
+// Read, but opcode fetches are not data accesses so OnAccess is not called
+func (b *Bus) Fetch(addr uint16) uint8 {
+	if b.DMA.Conflicts(addr) {
+		return b.DMA.ConflictRead(addr)
+	}
+	return b.read(addr)
+}
+
+// Peek returns the value at the given address, ignoring DMA conflicts and without calling
+// OnAccess
+func (b *Bus) Peek(addr uint16) uint8 {
+	return b.read(addr)
+}
+
+func (b *Bus) read(addr uint16) uint8 {
+	switch {
+	case addr < addrVRAM:
+		return b.MBC.Read(addr)
+	case addr < addrExtRAM:
+		return b.PPU.VRAM[b.PPU.VBK][addr-addrVRAM]
+	case addr < addrWRAM:
+		return b.MBC.Read(addr)
+	case addr < addrOAM:
+		return *b.wram(addr)
+	case addr < addrUnusable:
+		return b.PPU.OAM[addr-addrOAM]
+	case addr < addrIO:
+		return 0xFF
+	case addr < addrHRAM:
+		return b.readIO(addr)
+	case addr < AddrIE:
+		return b.HRAM[addr-addrHRAM]
+	}
+	return b.IE
+}
+
+// Write stores the value at the given address. Writes blocked by an OAM DMA transfer are lost
+func (b *Bus) Write(addr uint16, v uint8) {
+	if b.OnAccess != nil {
+		b.OnAccess(addr, v, true)
+	}
+	if !b.DMA.Conflicts(addr) {
+		b.Poke(addr, v)
+	}
+}
+
+// Poke stores the value at the given address, ignoring DMA conflicts and without calling
+// OnAccess
+func (b *Bus) Poke(addr uint16, v uint8) {
+	switch {
+	case addr < addrVRAM:
+		b.MBC.Write(addr, v)
+	case addr < addrExtRAM:
+		b.PPU.VRAM[b.PPU.VBK][addr-addrVRAM] = v
+	case addr < addrWRAM:
+		b.MBC.Write(addr, v)
+	case addr < addrOAM:
+		*b.wram(addr) = v
+	case addr < addrUnusable:
+		b.PPU.OAM[addr-addrOAM] = v
+	case addr < addrIO:
+	case addr < addrHRAM:
+		b.writeIO(addr, v)
+	case addr < AddrIE:
+		b.HRAM[addr-addrHRAM] = v
+	default:
+		b.IE = v
+	}
+}
+
+// Bank returns the bank mapped at the given address: the ROM bank at 4000-7FFF, the VRAM bank,
+// the external RAM bank or the WRAM bank at D000-DFFF. Other areas are not banked and return 0
+func (b *Bus) Bank(addr uint16) int {
+	switch {
+	case addr < 0x4000:
+		return 0
+	case addr < addrVRAM:
+		return b.MBC.ROMBank()
+	case addr < addrExtRAM:
+		return int(b.PPU.VBK)
+	case addr < addrWRAM:
+		if bank := b.MBC.RAMBank(); bank > 0 {
+			return bank
+		}
+		return 0
+	case addr >= 0xD000 && addr < addrEcho && b.svbk&0x07 > 1:
+		return int(b.svbk & 0x07)
+	case addr >= 0xD000 && addr < addrEcho:
+		return 1
+	}
+	return 0
+}
+
+// wram returns the work RAM byte at the given address (C000-FDFF, including the echo RAM)
+func (b *Bus) wram(addr uint16) *uint8 {
+	if addr >= addrEcho {
+		addr -= addrEcho - addrWRAM
+	}
+	off := addr - addrWRAM
+	if off < 0x1000 {
+		return &b.WRAM[0][off]
+	}
+	bank := b.svbk & 0x07
+	if bank == 0 {
+		bank = 1
+	}
+	return &b.WRAM[bank][off-0x1000]
+}
+
+func (b *Bus) readIO(addr uint16) uint8 {
+	switch {
+	case addr == AddrIF:
+		return b.IO[addr-addrIO] | 0xE0
+	case addr == addrP1:
+		return b.Joypad.ReadRegister()
+	case addr == addrDMA:
+		return b.DMA.ReadRegister()
+	case b.Serial.IsRegister(addr):
+		return b.Serial.ReadRegister(addr)
+	case b.Timer.IsRegister(addr):
+		return b.Timer.ReadRegister(addr)
+	case b.PPU.IsRegister(addr):
+		return b.PPU.ReadRegister(addr)
+	case b.APU.IsRegister(addr):
+		return b.APU.ReadRegister(addr)
+	case b.isCGBRegister(addr):
+		return b.readCGBRegister(addr)
+	}
+	return b.IO[addr-addrIO]
+}
+
+func (b *Bus) writeIO(addr uint16, v uint8) {
+	switch {
+	case addr == addrP1:
+		b.Joypad.WriteRegister(v)
+	case addr == addrDMA:
+		b.DMA.WriteRegister(v)
+	case b.Serial.IsRegister(addr):
+		b.Serial.WriteRegister(addr, v)
+	case b.Timer.IsRegister(addr):
+		b.Timer.WriteRegister(addr, v)
+	case b.PPU.IsRegister(addr):
+		b.PPU.WriteRegister(addr, v)
+	case b.APU.IsRegister(addr):
+		b.APU.WriteRegister(addr, v)
+	case b.isCGBRegister(addr):
+		b.writeCGBRegister(addr, v)
+	default:
+		b.IO[addr-addrIO] = v
+	}
+}
+
+// RequestInterrupt sets the given interrupt bits in the IF register
+func (b *Bus) RequestInterrupt(i uint8) {
+	b.IO[AddrIF-addrIO] |= i
+}
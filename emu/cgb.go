@@ -0,0 +1,146 @@
+package emu
+
+// Reference: https://gbdev.io/pandocs/CGB_Registers.html
+
+// CGB registers handled by the bus
+const (
+	addrKEY1  uint16 = 0xFF4D
+	addrHDMA1 uint16 = 0xFF51
+	addrHDMA5 uint16 = 0xFF55
+	addrSVBK  uint16 = 0xFF70
+)
+
+// KEY1 bits
+const (
+	key1Prepare uint8 = 0x01
+	key1Speed   uint8 = 0x80
+)
+
+// Each HDMA block copies 16 bytes and stops the CPU for 8 M-cycles: 32 clock cycles at normal
+// speed and 64 in double speed mode, where the CPU clock is twice as fast
+const (
+	hdmaBlockSize   = 16
+	hdmaBlockCycles = 32
+	hdmaMaxBlocks   = 0x80
+)
+
+// hdma is the VRAM DMA. A general purpose transfer copies everything at once, a HBlank transfer
+// copies a block at the start of each HBlank
+type hdma struct {
+	src, dst uint16
+	blocks   int // remaining blocks
+	hblank   bool
+	active   bool
+}
+
+func (b *Bus) isCGBRegister(addr uint16) bool {
+	return addr == addrKEY1 || addr >= addrHDMA1 && addr <= addrHDMA5 || addr == addrSVBK
+}
+
+func (b *Bus) readCGBRegister(addr uint16) uint8 {
+	if !b.CGB {
+		return 0xFF
+	}
+	switch addr {
+	case addrKEY1:
+		v := b.key1&key1Prepare | 0x7E
+		if b.DoubleSpeed {
+			v |= key1Speed
+		}
+		return v
+	case addrHDMA5:
+		if !b.hdma.active {
+			return 0xFF
+		}
+		return uint8(b.hdma.blocks - 1)
+	case addrSVBK:
+		return b.svbk | 0xF8
+	}
+	return 0xFF
+}
+
+func (b *Bus) writeCGBRegister(addr uint16, v uint8) {
+	if !b.CGB {
+		return
+	}
+	switch addr {
+	case addrKEY1:
+		b.key1 = v & key1Prepare
+	case addrHDMA1:
+		b.hdma.src = b.hdma.src&0x00FF | uint16(v)<<8
+	case addrHDMA1 + 1:
+		b.hdma.src = b.hdma.src&0xFF00 | uint16(v&0xF0)
+	case addrHDMA1 + 2:
+		b.hdma.dst = b.hdma.dst&0x00FF | uint16(v&0x1F)<<8
+	case addrHDMA1 + 3:
+		b.hdma.dst = b.hdma.dst&0xFF00 | uint16(v&0xF0)
+	case addrHDMA5:
+		b.startHDMA(v)
+	case addrSVBK:
+		b.svbk = v & 0x07
+	}
+}
+
+func (b *Bus) startHDMA(v uint8) {
+	if b.hdma.active && b.hdma.hblank && v&0x80 == 0 {
+		// Writing bit 7 clear stops a HBlank transfer
+		b.hdma.active = false
+		return
+	}
+
+	b.hdma.blocks = int(v&0x7F) + 1
+	b.hdma.hblank = v&0x80 != 0
+	b.hdma.active = true
+	if !b.hdma.hblank {
+		for b.hdma.active {
+			b.copyHDMABlock()
+		}
+	} else if b.PPU.Mode() == ModeHBlank && b.PPU.enabled() {
+		b.copyHDMABlock()
+	}
+}
+
+// copyHDMABlock copies 16 bytes to VRAM
+func (b *Bus) copyHDMABlock() {
+	for i := uint16(0); i < hdmaBlockSize; i++ {
+		v := b.read(b.hdma.src + i)
+		b.PPU.VRAM[b.PPU.VBK][(b.hdma.dst+i)&0x1FFF] = v
+	}
+	b.hdma.src += hdmaBlockSize
+	b.hdma.dst += hdmaBlockSize
+	b.hdma.blocks--
+	if b.DoubleSpeed {
+		b.stall += 2 * hdmaBlockCycles
+	} else {
+		b.stall += hdmaBlockCycles
+	}
+	if b.hdma.blocks == 0 || b.hdma.dst >= 0x2000 {
+		b.hdma.active = false
+	}
+}
+
+// hblank continues an active HBlank DMA transfer
+func (b *Bus) hblank() {
+	if b.hdma.active && b.hdma.hblank {
+		b.copyHDMABlock()
+	}
+}
+
+// switchSpeed toggles the double speed mode if it was prepared writing KEY1. It is called when
+// the CPU executes STOP, which also resets DIV
+func (b *Bus) switchSpeed() bool {
+	b.Timer.WriteRegister(addrDIV, 0)
+	if !b.CGB || b.key1&key1Prepare == 0 {
+		return false
+	}
+	b.DoubleSpeed = !b.DoubleSpeed
+	b.key1 &^= key1Prepare
+	return true
+}
+
+// takeStall returns and clears the clock cycles the CPU has to wait for a DMA transfer
+func (b *Bus) takeStall() int {
+	s := b.stall
+	b.stall = 0
+	return s
+}
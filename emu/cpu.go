@@ -0,0 +1,243 @@
+// Package emu is a headless Game Boy emulator. It runs the cartridges read by the cartridge
+// package, using the same memory bank controllers.
+package emu
+
+// Reference: https://gbdev.io/pandocs/CPU_Registers_and_Flags.html
+
+// Memory is the 16 bits address space seen by the CPU. Read and Write are the data accesses of
+// the instructions, Fetch reads the instructions themselves and Peek and Poke are used for the
+// interrupt registers, which the CPU checks without a memory access
+type Memory interface {
+	Read(addr uint16) uint8
+	Write(addr uint16, v uint8)
+	Fetch(addr uint16) uint8
+	Peek(addr uint16) uint8
+	Poke(addr uint16, v uint8)
+}
+
+// Flags of the F register
+const (
+	FlagZ uint8 = 0x80 // zero
+	FlagN uint8 = 0x40 // subtraction
+	FlagH uint8 = 0x20 // half carry
+	FlagC uint8 = 0x10 // carry
+)
+
+// Interrupt bits of the IE and IF registers, from the highest to the lowest priority
+const (
+	IntVBlank uint8 = 0x01
+	IntLCD    uint8 = 0x02
+	IntTimer  uint8 = 0x04
+	IntSerial uint8 = 0x08
+	IntJoypad uint8 = 0x10
+)
+
+// Interrupt registers
+const (
+	AddrIF uint16 = 0xFF0F
+	AddrIE uint16 = 0xFFFF
+)
+
+// Registers of the SM83 CPU
+type Registers struct {
+	A, F, B, C, D, E, H, L uint8
+	SP, PC                 uint16
+}
+
+// AF returns the AF register pair
+func (r *Registers) AF() uint16 { return uint16(r.A)<<8 | uint16(r.F) }
+
+// BC returns the BC register pair
+func (r *Registers) BC() uint16 { return uint16(r.B)<<8 | uint16(r.C) }
+
+// DE returns the DE register pair
+func (r *Registers) DE() uint16 { return uint16(r.D)<<8 | uint16(r.E) }
+
+// HL returns the HL register pair
+func (r *Registers) HL() uint16 { return uint16(r.H)<<8 | uint16(r.L) }
+
+// SetAF sets the AF register pair. The lower 4 bits of F are always 0
+func (r *Registers) SetAF(v uint16) { r.A, r.F = uint8(v>>8), uint8(v)&0xF0 }
+
+// SetBC sets the BC register pair
+func (r *Registers) SetBC(v uint16) { r.B, r.C = uint8(v>>8), uint8(v) }
+
+// SetDE sets the DE register pair
+func (r *Registers) SetDE(v uint16) { r.D, r.E = uint8(v>>8), uint8(v) }
+
+// SetHL sets the HL register pair
+func (r *Registers) SetHL(v uint16) { r.H, r.L = uint8(v>>8), uint8(v) }
+
+// Flag returns true if the given flag is set
+func (r *Registers) Flag(f uint8) bool { return r.F&f != 0 }
+
+func (r *Registers) setFlag(f uint8, on bool) {
+	if on {
+		r.F |= f
+	} else {
+		r.F &^= f
+	}
+}
+
+func (r *Registers) setFlags(z, n, h, c bool) {
+	r.F = 0
+	r.setFlag(FlagZ, z)
+	r.setFlag(FlagN, n)
+	r.setFlag(FlagH, h)
+	r.setFlag(FlagC, c)
+}
+
+// CPU is a Sharp SM83 (LR35902) interpreter. Every step executes a whole instruction (or
+// dispatches an interrupt) and returns the number of clock cycles it took
+type CPU struct {
+	Registers
+	IME     bool // interrupt master enable
+	Halted  bool
+	Stopped bool
+	Locked  bool   // an illegal opcode was executed, only a reset recovers the CPU
+	Cycles  uint64 // clock cycles since the reset
+
+	// OnStop is called when a STOP instruction is executed. If it returns true the CPU keeps
+	// running (ie. a CGB speed switch), otherwise it stops until a joypad interrupt is requested
+	OnStop func() bool
+	// OnBreakpoint is called when a LD B,B instruction is executed
+	OnBreakpoint func()
+
+	mem       Memory
+	eiPending bool // EI enables the interrupts after the next instruction
+	haltBug   bool // the byte after HALT is read twice
+}
+
+// NewCPU returns a CPU in the state left by the DMG boot ROM
+func NewCPU(mem Memory) *CPU {
+	c := &CPU{mem: mem}
+	c.Reset()
+	return c
+}
+
+// Reset sets the registers to the values left by the DMG boot ROM, with PC at the cartridge
+// entry point
+func (c *CPU) Reset() {
+	c.Registers = Registers{A: 0x01, F: 0xB0, B: 0x00, C: 0x13, D: 0x00, E: 0xD8, H: 0x01, L: 0x4D, SP: 0xFFFE, PC: 0x0100}
+	c.IME, c.Halted, c.Stopped, c.Locked = false, false, false, false
+	c.eiPending, c.haltBug = false, false
+	c.Cycles = 0
+}
+
+// ResetCGB sets the registers to the values left by the CGB boot ROM for a CGB cartridge
+func (c *CPU) ResetCGB() {
+	c.Reset()
+	c.Registers = Registers{A: 0x11, F: 0x80, B: 0x00, C: 0x00, D: 0xFF, E: 0x56, H: 0x00, L: 0x0D, SP: 0xFFFE, PC: 0x0100}
+}
+
+// Step executes the next instruction, or dispatches a pending interrupt, and returns the clock
+// cycles it took
+func (c *CPU) Step() int {
+	cycles := c.step()
+	c.Cycles += uint64(cycles)
+	return cycles
+}
+
+func (c *CPU) step() int {
+	if c.Locked {
+		return 4
+	}
+
+	pending := c.pendingInterrupts()
+	if c.Stopped {
+		if c.mem.Peek(AddrIF)&IntJoypad == 0 {
+			return 4
+		}
+		c.Stopped = false
+	}
+	if c.Halted {
+		if pending == 0 {
+			return 4
+		}
+		c.Halted = false
+	}
+	if c.IME && pending != 0 {
+		return c.interrupt(pending)
+	}
+
+	ei := c.eiPending
+	c.eiPending = false
+	cycles := c.execute(c.fetch())
+	if ei {
+		c.IME = true
+	}
+	return cycles
+}
+
+// interrupt jumps to the handler of the highest priority pending interrupt
+func (c *CPU) interrupt(pending uint8) int {
+	for bit := uint(0); bit < 5; bit++ {
+		mask := uint8(1) << bit
+		if pending&mask != 0 {
+			c.IME = false
+			c.mem.Poke(AddrIF, c.mem.Peek(AddrIF)&^mask)
+			c.push(c.PC)
+			c.PC = 0x40 + uint16(bit)*8
+			break
+		}
+	}
+	return 20
+}
+
+// pendingInterrupts returns the interrupts both requested and enabled
+func (c *CPU) pendingInterrupts() uint8 {
+	return c.mem.Peek(AddrIE) & c.mem.Peek(AddrIF) & 0x1F
+}
+
+func (c *CPU) fetch() uint8 {
+	v := c.mem.Fetch(c.PC)
+	if c.haltBug {
+		c.haltBug = false
+	} else {
+		c.PC++
+	}
+	return v
+}
+
+func (c *CPU) fetch16() uint16 {
+	lo := c.fetch()
+	return uint16(c.fetch())<<8 | uint16(lo)
+}
+
+func (c *CPU) read16(addr uint16) uint16 {
+	return uint16(c.mem.Read(addr+1))<<8 | uint16(c.mem.Read(addr))
+}
+
+func (c *CPU) write16(addr uint16, v uint16) {
+	c.mem.Write(addr, uint8(v))
+	c.mem.Write(addr+1, uint8(v>>8))
+}
+
+func (c *CPU) push(v uint16) {
+	c.SP -= 2
+	c.write16(c.SP, v)
+}
+
+func (c *CPU) pop() uint16 {
+	v := c.read16(c.SP)
+	c.SP += 2
+	return v
+}
+
+// halt stops the CPU until an interrupt is pending. If the interrupts are disabled and one is
+// already pending the CPU does not halt and fails to increment PC (HALT bug)
+func (c *CPU) halt() {
+	if !c.IME && c.pendingInterrupts() != 0 {
+		c.haltBug = true
+		return
+	}
+	c.Halted = true
+}
+
+func (c *CPU) stop() {
+	c.fetch() // STOP is followed by a padding byte
+	if c.OnStop != nil && c.OnStop() {
+		return
+	}
+	c.Stopped = true
+}
@@ -0,0 +1,108 @@
+package emu
+
+// Reference: https://gbdev.io/pandocs/OAM_DMA_Transfer.html
+
+// An OAM DMA transfer copies 160 bytes, one per M-cycle, after a startup M-cycle
+const (
+	dmaLength     = 0xA0
+	dmaByteCycles = 4
+	dmaStartDelay = 4
+)
+
+// DMA is the OAM DMA. While a transfer runs the CPU can not access OAM, and reading the memory
+// bus used by the source (external or video) returns the byte being transferred
+type DMA struct {
+	reg    uint8 // last value written to FF46
+	src    uint16
+	pos    int
+	delay  int
+	cycles int
+	active bool
+
+	read func(addr uint16) uint8
+	oam  *[0xA0]uint8
+}
+
+// NewDMA returns an idle OAM DMA reading the source with the given function
+func NewDMA(read func(addr uint16) uint8, oam *[0xA0]uint8) *DMA {
+	return &DMA{reg: 0xFF, read: read, oam: oam}
+}
+
+// Active returns true while a transfer is running, including its startup
+func (d *DMA) Active() bool {
+	return d.active
+}
+
+// ReadRegister returns the last value written to the DMA register
+func (d *DMA) ReadRegister() uint8 {
+	return d.reg
+}
+
+// WriteRegister starts a transfer from XX00 to OAM, XX being the value written. Sources above
+// DFFF read the work RAM echo
+func (d *DMA) WriteRegister(v uint8) {
+	d.reg = v
+	d.src = uint16(v) << 8
+	if d.src >= addrOAM {
+		d.src -= addrEcho - addrWRAM
+	}
+	d.pos, d.cycles = 0, 0
+	d.delay = dmaStartDelay
+	d.active = true
+}
+
+// Tick advances the transfer by the given number of CPU clock cycles
+func (d *DMA) Tick(cycles int) {
+	for i := 0; i < cycles && d.active; i++ {
+		if d.delay > 0 {
+			d.delay--
+			continue
+		}
+		if d.cycles++; d.cycles < dmaByteCycles {
+			continue
+		}
+		d.cycles = 0
+		d.oam[d.pos] = d.read(d.src + uint16(d.pos))
+		if d.pos++; d.pos == dmaLength {
+			d.active = false
+		}
+	}
+}
+
+// Conflicts returns true if the CPU can not access the address because of the running transfer
+func (d *DMA) Conflicts(addr uint16) bool {
+	if !d.active || d.delay > 0 {
+		return false
+	}
+	if addr >= addrOAM && addr < addrUnusable {
+		return true
+	}
+	return memoryBus(addr) != busNone && memoryBus(addr) == memoryBus(d.src)
+}
+
+// ConflictRead returns the value read by the CPU at an address blocked by the transfer
+func (d *DMA) ConflictRead(addr uint16) uint8 {
+	if addr >= addrOAM && addr < addrUnusable {
+		return 0xFF
+	}
+	return d.read(d.src + uint16(d.pos))
+}
+
+// Memory buses of the DMG
+const (
+	busNone = iota // OAM, I/O registers and HRAM are internal to the SoC
+	busExternal
+	busVideo
+)
+
+func memoryBus(addr uint16) int {
+	switch {
+	case addr < addrVRAM:
+		return busExternal
+	case addr < addrExtRAM:
+		return busVideo
+	case addr < addrOAM:
+		return busExternal
+	}
+	return busNone
+}
@@ -0,0 +1,141 @@
+package emu
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// Model is the Game Boy hardware being emulated
+type Model int
+
+const (
+	// ModelAuto picks CGB for cartridges with CGB support (CGBFlag 0x80 or 0xC0) and DMG for the
+	// others
+	ModelAuto Model = iota
+	ModelDMG
+	ModelCGB
+)
+
+// GameBoy is a whole console with a cartridge inserted
+type GameBoy struct {
+	Cartridge *cartridge.Cartridge
+	CPU       *CPU
+	Bus       *Bus
+	Model     Model
+
+	// Input is applied to the joypad at the start of every frame run by RunFrame
+	Input InputScript
+	// Frames run by RunFrame
+	Frames uint64
+
+	movie *movie
+}
+
+// New powers on a Game Boy with the given cartridge, skipping the boot ROM. The model is chosen
+// from the cartridge header
+func New(c *cartridge.Cartridge) (*GameBoy, error) {
+	return NewWithModel(c, ModelAuto)
+}
+
+// NewWithModel powers on the given Game Boy model. CGB mode is only enabled for cartridges with
+// CGB support, other cartridges run in DMG mode
+func NewWithModel(c *cartridge.Cartridge, m Model) (*GameBoy, error) {
+	if m == ModelAuto {
+		m = ModelDMG
+		if c.Header.SupportsGBC() {
+			m = ModelCGB
+		}
+	} else if m == ModelDMG && c.Header.IsGBCOnly() {
+		return nil, fmt.Errorf("%v only runs on a Game Boy Color", c.Header.TitleText())
+	}
+
+	bus, err := NewBus(c)
+	if err != nil {
+		return nil, err
+	}
+	gb := &GameBoy{Cartridge: c, CPU: NewCPU(bus), Bus: bus, Model: m}
+	if m == ModelCGB && c.Header.SupportsGBC() {
+		bus.CGB = true
+		bus.PPU.CGB = true
+		bus.PPU.OnHBlank = bus.hblank
+		bus.Serial.CGB = true
+		gb.CPU.ResetCGB()
+	}
+	gb.CPU.OnStop = bus.switchSpeed
+	return gb, nil
+}
+
+// Step executes a CPU instruction and advances the rest of the hardware by the same time. It
+// returns the elapsed time in clock cycles of the normal speed (4194304 per second), so an
+// instruction takes half the cycles in CGB double speed mode
+func (gb *GameBoy) Step() int {
+	speed := 1
+	if gb.Bus.DoubleSpeed {
+		speed = 2
+	}
+	cycles := gb.CPU.Step() + gb.Bus.takeStall()
+
+	// The timer, the serial port and the OAM DMA run at the CPU speed
+	gb.Bus.Timer.Tick(cycles)
+	gb.Bus.Serial.Tick(cycles)
+	gb.Bus.DMA.Tick(cycles)
+
+	cycles /= speed
+	gb.Bus.PPU.Tick(cycles)
+	gb.Bus.APU.Tick(cycles)
+	if t, ok := gb.Bus.MBC.(cartridge.Ticker); ok {
+		t.Tick(cycles)
+	}
+	return cycles
+}
+
+// RunFrame runs until the PPU completes a frame. If the LCD is off it runs for the duration of
+// a frame instead
+func (gb *GameBoy) RunFrame() {
+	gb.Input.Apply(gb.Bus.Joypad, gb.Frames)
+	gb.updateMovie()
+	gb.Frames++
+
+	frames := gb.Bus.PPU.Frames
+	for cycles := 0; gb.Bus.PPU.Frames == frames && cycles < 2*CyclesPerFrame; {
+		cycles += gb.Step()
+		if !gb.Bus.PPU.enabled() && cycles >= CyclesPerFrame {
+			return
+		}
+	}
+}
+
+// RunFor runs for at least the given number of clock cycles
+func (gb *GameBoy) RunFor(cycles int) {
+	for elapsed := 0; elapsed < cycles; {
+		elapsed += gb.Step()
+	}
+}
+
+// Samples returns the stereo audio samples (left and right interleaved) generated since the last
+// call
+func (gb *GameBoy) Samples() []int16 {
+	return gb.Bus.APU.Samples()
+}
+
+// Frame returns the last frame rendered by the PPU
+func (gb *GameBoy) Frame() image.Image {
+	return gb.Bus.PPU.Frame()
+}
+
+// FrameHash returns the hex encoded SHA-1 of the RGBA pixels of the last frame
+func (gb *GameBoy) FrameHash() string {
+	h := sha1.Sum(gb.Bus.PPU.Frame().Pix)
+	return hex.EncodeToString(h[:])
+}
+
+// WritePNG encodes the last frame as a PNG image
+func (gb *GameBoy) WritePNG(w io.Writer) error {
+	return png.Encode(w, gb.Frame())
+}
@@ -0,0 +1,105 @@
+package emu
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// InputEvent presses or releases buttons at the start of a frame
+type InputEvent struct {
+	Frame   uint64
+	Buttons Button
+	Pressed bool
+}
+
+// InputScript is a list of joypad events that drives a game deterministically
+type InputScript []InputEvent
+
+// Press holds the buttons from the given frame
+func (s *InputScript) Press(frame uint64, b Button) {
+	*s = append(*s, InputEvent{Frame: frame, Buttons: b, Pressed: true})
+}
+
+// Release lets go of the buttons at the given frame
+func (s *InputScript) Release(frame uint64, b Button) {
+	*s = append(*s, InputEvent{Frame: frame, Buttons: b})
+}
+
+// Tap holds the buttons for the given number of frames
+func (s *InputScript) Tap(frame uint64, b Button, frames uint64) {
+	s.Press(frame, b)
+	s.Release(frame+frames, b)
+}
+
+// Apply updates the joypad with the events of the given frame, in script order
+func (s InputScript) Apply(j *Joypad, frame uint64) {
+	for _, e := range s {
+		if e.Frame != frame {
+			continue
+		}
+		if e.Pressed {
+			j.Press(e.Buttons)
+		} else {
+			j.Release(e.Buttons)
+		}
+	}
+}
+
+// ParseInputScript reads a script with an event per line, blank lines and lines starting with #
+// are ignored:
+//
+//	120 press A
+//	130 release A
+//	200 tap START 5
+//	300 press LEFT+B
+//
+// A tap holds the buttons for the given number of frames, 1 if omitted
+func ParseInputScript(r io.Reader) (InputScript, error) {
+	var s InputScript
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if err := s.parseEvent(strings.Fields(text)); err != nil {
+			return nil, fmt.Errorf("input script line %d: %v", line, err)
+		}
+	}
+	return s, scanner.Err()
+}
+
+func (s *InputScript) parseEvent(fields []string) error {
+	if len(fields) < 3 {
+		return fmt.Errorf("expected <frame> press|release|tap <buttons>")
+	}
+	frame, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid frame %q", fields[0])
+	}
+	b, err := ParseButton(fields[2])
+	if err != nil {
+		return err
+	}
+
+	switch action := strings.ToLower(fields[1]); {
+	case action == "press" && len(fields) == 3:
+		s.Press(frame, b)
+	case action == "release" && len(fields) == 3:
+		s.Release(frame, b)
+	case action == "tap" && len(fields) == 3:
+		s.Tap(frame, b, 1)
+	case action == "tap" && len(fields) == 4:
+		n, err := strconv.ParseUint(fields[3], 10, 64)
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid tap length %q", fields[3])
+		}
+		s.Tap(frame, b, n)
+	default:
+		return fmt.Errorf("invalid event %q", strings.Join(fields, " "))
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package emu
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Reference: https://gbdev.io/pandocs/Joypad_Input.html
+
+const addrP1 uint16 = 0xFF00
+
+// P1 bits selecting the button group read in the lower nibble (active low)
+const (
+	p1SelectDirections uint8 = 0x10
+	p1SelectActions    uint8 = 0x20
+)
+
+// Button is a set of Game Boy buttons
+type Button uint8
+
+// Buttons, in the P1 bit order of their group (directions in the lower nibble, actions in the
+// upper one)
+const (
+	ButtonRight Button = 1 << iota
+	ButtonLeft
+	ButtonUp
+	ButtonDown
+	ButtonA
+	ButtonB
+	ButtonSelect
+	ButtonStart
+)
+
+var buttonNames = [8]string{"RIGHT", "LEFT", "UP", "DOWN", "A", "B", "SELECT", "START"}
+
+// ParseButton returns the buttons of a name such as "A" or "start", or of several names joined
+// with "+" (ie. "A+B+SELECT+START")
+func ParseButton(s string) (Button, error) {
+	var b Button
+	for _, name := range strings.Split(s, "+") {
+		found := false
+		for i, n := range buttonNames {
+			if strings.EqualFold(strings.TrimSpace(name), n) {
+				b |= 1 << uint(i)
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown button %q", name)
+		}
+	}
+	return b, nil
+}
+
+func (b Button) String() string {
+	var names []string
+	for i, n := range buttonNames {
+		if b&(1<<uint(i)) != 0 {
+			names = append(names, n)
+		}
+	}
+	return strings.Join(names, "+")
+}
+
+// Joypad is the P1 register. A joypad interrupt is requested when a selected button line goes
+// from high to low
+type Joypad struct {
+	pressed Button
+	sel     uint8 // P1 bits 4 and 5
+	irq     func(uint8)
+}
+
+// NewJoypad returns a joypad with no buttons pressed
+func NewJoypad(irq func(uint8)) *Joypad {
+	return &Joypad{sel: p1SelectDirections | p1SelectActions, irq: irq}
+}
+
+// Pressed returns the buttons being held
+func (j *Joypad) Pressed() Button {
+	return j.pressed
+}
+
+// Press holds the given buttons
+func (j *Joypad) Press(b Button) {
+	j.Set(j.pressed | b)
+}
+
+// Release lets go of the given buttons
+func (j *Joypad) Release(b Button) {
+	j.Set(j.pressed &^ b)
+}
+
+// Set replaces the buttons being held
+func (j *Joypad) Set(b Button) {
+	old := j.lines()
+	j.pressed = b
+	j.update(old)
+}
+
+// lines returns the lower nibble of P1, a bit is 0 if its button is pressed in a selected group
+func (j *Joypad) lines() uint8 {
+	var low uint8
+	if j.sel&p1SelectDirections == 0 {
+		low |= uint8(j.pressed) & 0x0F
+	}
+	if j.sel&p1SelectActions == 0 {
+		low |= uint8(j.pressed) >> 4
+	}
+	return ^low & 0x0F
+}
+
+func (j *Joypad) update(old uint8) {
+	if old&^j.lines() != 0 {
+		j.irq(IntJoypad)
+	}
+}
+
+// ReadRegister returns the value of P1
+func (j *Joypad) ReadRegister() uint8 {
+	return 0xC0 | j.sel | j.lines()
+}
+
+// WriteRegister selects the button groups. Only bits 4 and 5 are writable
+func (j *Joypad) WriteRegister(v uint8) {
+	old := j.lines()
+	j.sel = v & (p1SelectDirections | p1SelectActions)
+	j.update(old)
+}
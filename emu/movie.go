@@ -0,0 +1,148 @@
+package emu
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// MovieVersion is the version of the movie format. Movies of other versions are rejected
+const MovieVersion = 1
+
+var movieMagic = [4]uint8{'G', 'B', 'M', 'V'}
+
+// Movie is a recording of the joypad state of every frame. Played from the same starting state it
+// reproduces the run bit for bit
+type Movie struct {
+	State  []uint8  // save state the recording starts from, empty if it starts at power on
+	Inputs []Button // joypad state of each frame
+
+	header stateHeader // console and cartridge of the recording
+}
+
+// Write encodes the movie: a header identifying the console and the cartridge, the starting
+// state and a byte per frame with the joypad state
+func (m *Movie) Write(w io.Writer) error {
+	e := &stateEncoder{w: w}
+	e.write(m.header, uint32(len(m.State)), m.State, uint32(len(m.Inputs)), m.Inputs)
+	return e.err
+}
+
+// ReadMovie decodes a movie written by Movie.Write
+func ReadMovie(r io.Reader) (*Movie, error) {
+	m := &Movie{}
+	d := &stateDecoder{r: r}
+	d.read(&m.header)
+	if d.err == nil && m.header.Magic != movieMagic {
+		return nil, fmt.Errorf("not a movie")
+	}
+	if d.err == nil && m.header.Version != MovieVersion {
+		return nil, fmt.Errorf("unsupported movie version %d", m.header.Version)
+	}
+
+	m.State = d.readBlock()
+	inputs := d.readBlock()
+	if d.err != nil {
+		return nil, fmt.Errorf("reading movie: %v", d.err)
+	}
+	m.Inputs = make([]Button, len(inputs))
+	for i, b := range inputs {
+		m.Inputs[i] = Button(b)
+	}
+	return m, nil
+}
+
+// readBlock reads a 32 bits length and the bytes that follow. The buffer grows as the bytes are
+// read, so a corrupt length does not allocate more than the size of the file
+func (d *stateDecoder) readBlock() []uint8 {
+	var n uint32
+	d.read(&n)
+	if d.err != nil {
+		return nil
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		d.err = err
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// movie is the movie being recorded or played by a Game Boy
+type movie struct {
+	*Movie
+	start     uint64 // frame of the first input
+	recording bool
+}
+
+// poweredOn returns true if the console did not run since it was powered on
+func (gb *GameBoy) poweredOn() bool {
+	return gb.CPU.Cycles == 0 && gb.Frames == 0
+}
+
+// RecordMovie starts recording the joypad state of every frame run by RunFrame. With fromState
+// the movie starts from the current state, otherwise the console must be just powered on. If
+// the console is rewound while recording, the inputs of the rewound frames are replaced
+func (gb *GameBoy) RecordMovie(fromState bool) (*Movie, error) {
+	m := &Movie{header: gb.stateHeader()}
+	m.header.Magic, m.header.Version = movieMagic, MovieVersion
+	if fromState {
+		var buf bytes.Buffer
+		if err := gb.SaveState(&buf); err != nil {
+			return nil, err
+		}
+		m.State = buf.Bytes()
+	} else if !gb.poweredOn() {
+		return nil, fmt.Errorf("movies without a starting state must be recorded from power on")
+	}
+	gb.movie = &movie{Movie: m, start: gb.Frames, recording: true}
+	return m, nil
+}
+
+// PlayMovie loads the starting state of the movie and replays its inputs in the next frames run
+// by RunFrame, overriding the input script. Movies without a starting state must be played on a
+// console just powered on
+func (gb *GameBoy) PlayMovie(m *Movie) error {
+	h := gb.stateHeader()
+	if m.header.Model != h.Model || m.header.HeaderChecksum != h.HeaderChecksum || m.header.GlobalChecksum != h.GlobalChecksum {
+		return fmt.Errorf("movie recorded with a different console or cartridge")
+	}
+	if len(m.State) > 0 {
+		if err := gb.LoadState(bytes.NewReader(m.State)); err != nil {
+			return err
+		}
+	} else if !gb.poweredOn() {
+		return fmt.Errorf("movies without a starting state must be played from power on")
+	}
+	gb.movie = &movie{Movie: m, start: gb.Frames}
+	return nil
+}
+
+// PlayingMovie returns true while a movie has inputs left to play
+func (gb *GameBoy) PlayingMovie() bool {
+	m := gb.movie
+	return m != nil && !m.recording && gb.Frames >= m.start && gb.Frames-m.start < uint64(len(m.Inputs))
+}
+
+// StopMovie stops recording or playing a movie
+func (gb *GameBoy) StopMovie() {
+	gb.movie = nil
+}
+
+// updateMovie plays or records the joypad state of the frame about to run
+func (gb *GameBoy) updateMovie() {
+	m := gb.movie
+	if m == nil || gb.Frames < m.start {
+		return
+	}
+	i := gb.Frames - m.start
+	switch {
+	case m.recording:
+		if i < uint64(len(m.Inputs)) {
+			m.Inputs = m.Inputs[:i]
+		}
+		m.Inputs = append(m.Inputs, gb.Bus.Joypad.Pressed())
+	case i < uint64(len(m.Inputs)):
+		gb.Bus.Joypad.Set(m.Inputs[i])
+	}
+}
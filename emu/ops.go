@@ -0,0 +1,485 @@
+package emu
+
+// Reference: https://gbdev.io/gb-opcodes/optables/
+//
+// Opcodes are decoded splitting them in xx yyy zzz bits. y and z select 8 bits registers in the
+// order B, C, D, E, H, L, (HL), A; register pairs are BC, DE, HL and SP (AF for PUSH and POP)
+// and conditions NZ, Z, NC, C.
+
+const regHL = 6 // (HL) operand of the 8 bits register encoding
+
+func (c *CPU) r8(i uint8) uint8 {
+	switch i {
+	case 0:
+		return c.B
+	case 1:
+		return c.C
+	case 2:
+		return c.D
+	case 3:
+		return c.E
+	case 4:
+		return c.H
+	case 5:
+		return c.L
+	case regHL:
+		return c.mem.Read(c.HL())
+	}
+	return c.A
+}
+
+func (c *CPU) setR8(i uint8, v uint8) {
+	switch i {
+	case 0:
+		c.B = v
+	case 1:
+		c.C = v
+	case 2:
+		c.D = v
+	case 3:
+		c.E = v
+	case 4:
+		c.H = v
+	case 5:
+		c.L = v
+	case regHL:
+		c.mem.Write(c.HL(), v)
+	default:
+		c.A = v
+	}
+}
+
+func (c *CPU) rp(i uint8) uint16 {
+	switch i {
+	case 0:
+		return c.BC()
+	case 1:
+		return c.DE()
+	case 2:
+		return c.HL()
+	}
+	return c.SP
+}
+
+func (c *CPU) setRP(i uint8, v uint16) {
+	switch i {
+	case 0:
+		c.SetBC(v)
+	case 1:
+		c.SetDE(v)
+	case 2:
+		c.SetHL(v)
+	default:
+		c.SP = v
+	}
+}
+
+func (c *CPU) cond(i uint8) bool {
+	switch i {
+	case 0:
+		return !c.Flag(FlagZ)
+	case 1:
+		return c.Flag(FlagZ)
+	case 2:
+		return !c.Flag(FlagC)
+	}
+	return c.Flag(FlagC)
+}
+
+// execute runs the given opcode and returns its cycles
+func (c *CPU) execute(op uint8) int {
+	y, z := op>>3&7, op&7
+
+	switch {
+	case op == 0x76: // HALT
+		c.halt()
+		return 4
+	case op == 0x40: // LD B,B, the software breakpoint of debuggers and test ROMs
+		if c.OnBreakpoint != nil {
+			c.OnBreakpoint()
+		}
+		return 4
+	case op >= 0x40 && op < 0x80: // LD r,r'
+		c.setR8(y, c.r8(z))
+		if y == regHL || z == regHL {
+			return 8
+		}
+		return 4
+	case op >= 0x80 && op < 0xC0: // ALU A,r
+		c.alu(y, c.r8(z))
+		if z == regHL {
+			return 8
+		}
+		return 4
+	case op < 0x40 && z == 4: // INC r
+		v := c.r8(y) + 1
+		c.setR8(y, v)
+		c.setFlags(v == 0, false, v&0x0F == 0, c.Flag(FlagC))
+		return regCycles(y, 4, 12)
+	case op < 0x40 && z == 5: // DEC r
+		v := c.r8(y) - 1
+		c.setR8(y, v)
+		c.setFlags(v == 0, true, v&0x0F == 0x0F, c.Flag(FlagC))
+		return regCycles(y, 4, 12)
+	case op < 0x40 && z == 6: // LD r,d8
+		c.setR8(y, c.fetch())
+		return regCycles(y, 8, 12)
+	}
+
+	switch op {
+	case 0x00: // NOP
+		return 4
+	case 0x10: // STOP
+		c.stop()
+		return 4
+
+	// 16 bits loads and arithmetic
+	case 0x01, 0x11, 0x21, 0x31: // LD rr,d16
+		c.setRP(y>>1, c.fetch16())
+		return 12
+	case 0x03, 0x13, 0x23, 0x33: // INC rr
+		c.setRP(y>>1, c.rp(y>>1)+1)
+		return 8
+	case 0x0B, 0x1B, 0x2B, 0x3B: // DEC rr
+		c.setRP(y>>1, c.rp(y>>1)-1)
+		return 8
+	case 0x09, 0x19, 0x29, 0x39: // ADD HL,rr
+		hl, v := c.HL(), c.rp(y>>1)
+		r := uint32(hl) + uint32(v)
+		c.setFlags(c.Flag(FlagZ), false, hl&0x0FFF+v&0x0FFF > 0x0FFF, r > 0xFFFF)
+		c.SetHL(uint16(r))
+		return 8
+	case 0x08: // LD (a16),SP
+		c.write16(c.fetch16(), c.SP)
+		return 20
+	case 0xE8: // ADD SP,e8
+		c.SP = c.addSP(c.fetch())
+		return 16
+	case 0xF8: // LD HL,SP+e8
+		c.SetHL(c.addSP(c.fetch()))
+		return 12
+	case 0xF9: // LD SP,HL
+		c.SP = c.HL()
+		return 8
+
+	// Indirect loads
+	case 0x02: // LD (BC),A
+		c.mem.Write(c.BC(), c.A)
+		return 8
+	case 0x12: // LD (DE),A
+		c.mem.Write(c.DE(), c.A)
+		return 8
+	case 0x22: // LD (HL+),A
+		c.mem.Write(c.HL(), c.A)
+		c.SetHL(c.HL() + 1)
+		return 8
+	case 0x32: // LD (HL-),A
+		c.mem.Write(c.HL(), c.A)
+		c.SetHL(c.HL() - 1)
+		return 8
+	case 0x0A: // LD A,(BC)
+		c.A = c.mem.Read(c.BC())
+		return 8
+	case 0x1A: // LD A,(DE)
+		c.A = c.mem.Read(c.DE())
+		return 8
+	case 0x2A: // LD A,(HL+)
+		c.A = c.mem.Read(c.HL())
+		c.SetHL(c.HL() + 1)
+		return 8
+	case 0x3A: // LD A,(HL-)
+		c.A = c.mem.Read(c.HL())
+		c.SetHL(c.HL() - 1)
+		return 8
+	case 0xE0: // LDH (a8),A
+		c.mem.Write(0xFF00|uint16(c.fetch()), c.A)
+		return 12
+	case 0xF0: // LDH A,(a8)
+		c.A = c.mem.Read(0xFF00 | uint16(c.fetch()))
+		return 12
+	case 0xE2: // LD (C),A
+		c.mem.Write(0xFF00|uint16(c.C), c.A)
+		return 8
+	case 0xF2: // LD A,(C)
+		c.A = c.mem.Read(0xFF00 | uint16(c.C))
+		return 8
+	case 0xEA: // LD (a16),A
+		c.mem.Write(c.fetch16(), c.A)
+		return 16
+	case 0xFA: // LD A,(a16)
+		c.A = c.mem.Read(c.fetch16())
+		return 16
+
+	// Accumulator rotations and flag operations
+	case 0x07: // RLCA
+		c.A = c.rlc(c.A)
+		c.setFlag(FlagZ, false)
+		return 4
+	case 0x0F: // RRCA
+		c.A = c.rrc(c.A)
+		c.setFlag(FlagZ, false)
+		return 4
+	case 0x17: // RLA
+		c.A = c.rl(c.A)
+		c.setFlag(FlagZ, false)
+		return 4
+	case 0x1F: // RRA
+		c.A = c.rr(c.A)
+		c.setFlag(FlagZ, false)
+		return 4
+	case 0x27: // DAA
+		c.daa()
+		return 4
+	case 0x2F: // CPL
+		c.A = ^c.A
+		c.setFlag(FlagN, true)
+		c.setFlag(FlagH, true)
+		return 4
+	case 0x37: // SCF
+		c.setFlags(c.Flag(FlagZ), false, false, true)
+		return 4
+	case 0x3F: // CCF
+		c.setFlags(c.Flag(FlagZ), false, false, !c.Flag(FlagC))
+		return 4
+
+	// Jumps, calls and returns
+	case 0x18: // JR e8
+		c.jr(int8(c.fetch()))
+		return 12
+	case 0x20, 0x28, 0x30, 0x38: // JR cc,e8
+		e := int8(c.fetch())
+		if c.cond(y - 4) {
+			c.jr(e)
+			return 12
+		}
+		return 8
+	case 0xC3: // JP a16
+		c.PC = c.fetch16()
+		return 16
+	case 0xC2, 0xCA, 0xD2, 0xDA: // JP cc,a16
+		addr := c.fetch16()
+		if c.cond(y) {
+			c.PC = addr
+			return 16
+		}
+		return 12
+	case 0xE9: // JP HL
+		c.PC = c.HL()
+		return 4
+	case 0xCD: // CALL a16
+		addr := c.fetch16()
+		c.push(c.PC)
+		c.PC = addr
+		return 24
+	case 0xC4, 0xCC, 0xD4, 0xDC: // CALL cc,a16
+		addr := c.fetch16()
+		if c.cond(y) {
+			c.push(c.PC)
+			c.PC = addr
+			return 24
+		}
+		return 12
+	case 0xC9: // RET
+		c.PC = c.pop()
+		return 16
+	case 0xD9: // RETI
+		c.PC = c.pop()
+		c.IME = true
+		return 16
+	case 0xC0, 0xC8, 0xD0, 0xD8: // RET cc
+		if c.cond(y) {
+			c.PC = c.pop()
+			return 20
+		}
+		return 8
+	case 0xC7, 0xCF, 0xD7, 0xDF, 0xE7, 0xEF, 0xF7, 0xFF: // RST n
+		c.push(c.PC)
+		c.PC = uint16(y) * 8
+		return 16
+
+	// Stack
+	case 0xC1, 0xD1, 0xE1: // POP rr
+		c.setRP(y>>1, c.pop())
+		return 12
+	case 0xF1: // POP AF
+		c.SetAF(c.pop())
+		return 12
+	case 0xC5, 0xD5, 0xE5: // PUSH rr
+		c.push(c.rp(y >> 1))
+		return 16
+	case 0xF5: // PUSH AF
+		c.push(c.AF())
+		return 16
+
+	// ALU with immediate operand
+	case 0xC6, 0xCE, 0xD6, 0xDE, 0xE6, 0xEE, 0xF6, 0xFE:
+		c.alu(y, c.fetch())
+		return 8
+
+	// Interrupts
+	case 0xF3: // DI
+		c.IME = false
+		c.eiPending = false
+		return 4
+	case 0xFB: // EI
+		c.eiPending = true
+		return 4
+
+	case 0xCB:
+		return c.executeCB(c.fetch())
+	}
+
+	// D3, DB, DD, E3, E4, EB, EC, ED, F4, FC and FD hang the CPU
+	c.Locked = true
+	return 4
+}
+
+// regCycles returns the cycles of an instruction whose operand is a register or (HL)
+func regCycles(r uint8, reg, mem int) int {
+	if r == regHL {
+		return mem
+	}
+	return reg
+}
+
+func (c *CPU) jr(e int8) {
+	c.PC = uint16(int32(c.PC) + int32(e))
+}
+
+// addSP returns SP plus a signed offset. The flags are computed as an unsigned addition of the
+// lower byte
+func (c *CPU) addSP(e uint8) uint16 {
+	sp := c.SP
+	c.setFlags(false, false, sp&0x0F+uint16(e&0x0F) > 0x0F, sp&0xFF+uint16(e) > 0xFF)
+	return uint16(int32(sp) + int32(int8(e)))
+}
+
+// alu runs the y-th arithmetic operation (ADD, ADC, SUB, SBC, AND, XOR, OR, CP) on A
+func (c *CPU) alu(y uint8, v uint8) {
+	a := c.A
+	switch y {
+	case 0, 1: // ADD, ADC
+		var carry uint8
+		if y == 1 && c.Flag(FlagC) {
+			carry = 1
+		}
+		r := uint16(a) + uint16(v) + uint16(carry)
+		c.A = uint8(r)
+		c.setFlags(c.A == 0, false, a&0x0F+v&0x0F+carry > 0x0F, r > 0xFF)
+	case 2, 3, 7: // SUB, SBC, CP
+		var carry uint8
+		if y == 3 && c.Flag(FlagC) {
+			carry = 1
+		}
+		r := int(a) - int(v) - int(carry)
+		c.setFlags(uint8(r) == 0, true, int(a&0x0F)-int(v&0x0F)-int(carry) < 0, r < 0)
+		if y != 7 {
+			c.A = uint8(r)
+		}
+	case 4: // AND
+		c.A &= v
+		c.setFlags(c.A == 0, false, true, false)
+	case 5: // XOR
+		c.A ^= v
+		c.setFlags(c.A == 0, false, false, false)
+	case 6: // OR
+		c.A |= v
+		c.setFlags(c.A == 0, false, false, false)
+	}
+}
+
+// daa adjusts A to a valid BCD number after an addition or subtraction
+func (c *CPU) daa() {
+	a := c.A
+	carry := c.Flag(FlagC)
+	if !c.Flag(FlagN) {
+		if carry || a > 0x99 {
+			a += 0x60
+			carry = true
+		}
+		if c.Flag(FlagH) || a&0x0F > 0x09 {
+			a += 0x06
+		}
+	} else {
+		if carry {
+			a -= 0x60
+		}
+		if c.Flag(FlagH) {
+			a -= 0x06
+		}
+	}
+	c.A = a
+	c.setFlags(a == 0, c.Flag(FlagN), false, carry)
+}
+
+func (c *CPU) rlc(v uint8) uint8 {
+	r := v<<1 | v>>7
+	c.setFlags(r == 0, false, false, v&0x80 != 0)
+	return r
+}
+
+func (c *CPU) rrc(v uint8) uint8 {
+	r := v>>1 | v<<7
+	c.setFlags(r == 0, false, false, v&0x01 != 0)
+	return r
+}
+
+func (c *CPU) rl(v uint8) uint8 {
+	r := v << 1
+	if c.Flag(FlagC) {
+		r |= 0x01
+	}
+	c.setFlags(r == 0, false, false, v&0x80 != 0)
+	return r
+}
+
+func (c *CPU) rr(v uint8) uint8 {
+	r := v >> 1
+	if c.Flag(FlagC) {
+		r |= 0x80
+	}
+	c.setFlags(r == 0, false, false, v&0x01 != 0)
+	return r
+}
+
+// executeCB runs the CB prefixed opcodes: rotations and shifts, BIT, RES and SET
+func (c *CPU) executeCB(op uint8) int {
+	x, y, z := op>>6, op>>3&7, op&7
+	v := c.r8(z)
+
+	switch x {
+	case 0:
+		switch y {
+		case 0: // RLC
+			v = c.rlc(v)
+		case 1: // RRC
+			v = c.rrc(v)
+		case 2: // RL
+			v = c.rl(v)
+		case 3: // RR
+			v = c.rr(v)
+		case 4: // SLA
+			c.setFlags(v<<1 == 0, false, false, v&0x80 != 0)
+			v <<= 1
+		case 5: // SRA
+			c.setFlags(v>>1|v&0x80 == 0, false, false, v&0x01 != 0)
+			v = v>>1 | v&0x80
+		case 6: // SWAP
+			v = v<<4 | v>>4
+			c.setFlags(v == 0, false, false, false)
+		case 7: // SRL
+			c.setFlags(v>>1 == 0, false, false, v&0x01 != 0)
+			v >>= 1
+		}
+	case 1: // BIT
+		c.setFlags(v&(1<<y) == 0, false, true, c.Flag(FlagC))
+		return regCycles(z, 8, 12)
+	case 2: // RES
+		v &^= 1 << y
+	case 3: // SET
+		v |= 1 << y
+	}
+
+	c.setR8(z, v)
+	return regCycles(z, 8, 16)
+}
@@ -0,0 +1,571 @@
+package emu
+
+import (
+	"image"
+	"image/color"
+)
+
+// Reference: https://gbdev.io/pandocs/Rendering.html
+
+// Screen size in pixels
+const (
+	ScreenWidth  = 160
+	ScreenHeight = 144
+)
+
+// PPU timing in dots (clock cycles)
+const (
+	dotsPerLine   = 456
+	linesPerFrame = 154
+	oamScanDots   = 80
+	drawDots      = 172
+
+	// CyclesPerFrame is the duration of a frame, around 59.7 frames per second
+	CyclesPerFrame = dotsPerLine * linesPerFrame
+)
+
+// PPU modes, as reported in the lower bits of STAT
+const (
+	ModeHBlank uint8 = 0
+	ModeVBlank uint8 = 1
+	ModeOAM    uint8 = 2
+	ModeDraw   uint8 = 3
+)
+
+// LCD registers
+const (
+	addrLCDC uint16 = 0xFF40
+	addrSTAT uint16 = 0xFF41
+	addrSCY  uint16 = 0xFF42
+	addrSCX  uint16 = 0xFF43
+	addrLY   uint16 = 0xFF44
+	addrLYC  uint16 = 0xFF45
+	addrDMA  uint16 = 0xFF46
+	addrBGP  uint16 = 0xFF47
+	addrOBP0 uint16 = 0xFF48
+	addrOBP1 uint16 = 0xFF49
+	addrWY   uint16 = 0xFF4A
+	addrWX   uint16 = 0xFF4B
+
+	// CGB only
+	addrVBK  uint16 = 0xFF4F
+	addrBCPS uint16 = 0xFF68
+	addrBCPD uint16 = 0xFF69
+	addrOCPS uint16 = 0xFF6A
+	addrOCPD uint16 = 0xFF6B
+)
+
+// Palette specification registers auto increment the index after each data write if bit 7 is set
+const (
+	paletteIndexMask     uint8 = 0x3F
+	paletteAutoIncrement uint8 = 0x80
+)
+
+// LCDC bits
+const (
+	lcdcBGEnable     uint8 = 0x01
+	lcdcOBJEnable    uint8 = 0x02
+	lcdcOBJSize      uint8 = 0x04
+	lcdcBGMap        uint8 = 0x08
+	lcdcTileData     uint8 = 0x10
+	lcdcWindowEnable uint8 = 0x20
+	lcdcWindowMap    uint8 = 0x40
+	lcdcEnable       uint8 = 0x80
+)
+
+// STAT bits
+const (
+	statLYCFlag uint8 = 0x04
+	statHBlank  uint8 = 0x08
+	statVBlank  uint8 = 0x10
+	statOAM     uint8 = 0x20
+	statLYC     uint8 = 0x40
+)
+
+// OAM attribute bits
+const (
+	objPalette  uint8 = 0x10
+	objXFlip    uint8 = 0x20
+	objYFlip    uint8 = 0x40
+	objPriority uint8 = 0x80
+
+	objCGBPaletteMask uint8 = 0x07
+	objBank           uint8 = 0x08
+
+	maxSpritesPerLine = 10
+)
+
+// CGB background map attribute bits, stored in VRAM bank 1
+const (
+	bgPaletteMask uint8 = 0x07
+	bgBank        uint8 = 0x08
+	bgXFlip       uint8 = 0x20
+	bgYFlip       uint8 = 0x40
+	bgPriority    uint8 = 0x80
+)
+
+// DMGPalette are the colors used for the four DMG shades, from white to black
+var DMGPalette = [4]color.RGBA{
+	{0xFF, 0xFF, 0xFF, 0xFF},
+	{0xAA, 0xAA, 0xAA, 0xFF},
+	{0x55, 0x55, 0x55, 0xFF},
+	{0x00, 0x00, 0x00, 0xFF},
+}
+
+// PPU is the picture processing unit. It renders a scanline when the drawing mode ends, and
+// publishes the frame when VBlank starts
+type PPU struct {
+	VRAM [2][0x2000]uint8 // bank 1 is only used in CGB mode
+	OAM  [0xA0]uint8
+
+	LCDC, STAT, SCY, SCX, LY, LYC, BGP, OBP0, OBP1, WY, WX uint8
+
+	// CGB mode registers
+	CGB                     bool
+	VBK                     uint8
+	BCPS, OCPS              uint8
+	BGPalettes, OBJPalettes [64]uint8 // 8 palettes of 4 RGB555 colors
+
+	// OnHBlank is called when the PPU enters HBlank in a visible line, used by the HBlank DMA
+	OnHBlank func()
+
+	// Frames counts the completed frames
+	Frames uint64
+
+	irq        func(uint8)
+	dot        int
+	drawLen    int
+	windowLine int  // line of the window being drawn, only advances when the window is visible
+	statLine   bool // STAT interrupt line, the interrupt is requested on the rising edge
+	sprites    []sprite
+	bgIndex    [ScreenWidth]uint8 // background color indexes of the current line
+	bgPriority [ScreenWidth]bool
+	bgColor    [ScreenWidth]color.RGBA
+	back       *image.RGBA
+	front      *image.RGBA
+}
+
+type sprite struct {
+	y, x, tile, attr uint8
+	index            int
+}
+
+// NewPPU returns a PPU that requests interrupts through irq
+func NewPPU(irq func(uint8)) *PPU {
+	p := &PPU{
+		irq:   irq,
+		back:  image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight)),
+		front: image.NewRGBA(image.Rect(0, 0, ScreenWidth, ScreenHeight)),
+	}
+	// State left by the boot ROM
+	p.LCDC, p.STAT, p.BGP = 0x91, 0x85, 0xFC
+	for i := range p.BGPalettes {
+		p.BGPalettes[i], p.OBJPalettes[i] = 0xFF, 0xFF
+	}
+	p.setMode(ModeOAM)
+	p.clear(p.front)
+	return p
+}
+
+// Frame returns the last completed frame. The image is reused by the next frames
+func (p *PPU) Frame() *image.RGBA {
+	return p.front
+}
+
+// Mode returns the current PPU mode
+func (p *PPU) Mode() uint8 {
+	return p.STAT & 0x03
+}
+
+func (p *PPU) enabled() bool {
+	return p.LCDC&lcdcEnable != 0
+}
+
+// ReadRegister returns the value of a LCD register
+func (p *PPU) ReadRegister(addr uint16) uint8 {
+	switch addr {
+	case addrLCDC:
+		return p.LCDC
+	case addrSTAT:
+		return p.STAT | 0x80
+	case addrSCY:
+		return p.SCY
+	case addrSCX:
+		return p.SCX
+	case addrLY:
+		return p.LY
+	case addrLYC:
+		return p.LYC
+	case addrBGP:
+		return p.BGP
+	case addrOBP0:
+		return p.OBP0
+	case addrOBP1:
+		return p.OBP1
+	case addrWY:
+		return p.WY
+	case addrWX:
+		return p.WX
+	}
+
+	if !p.CGB {
+		return 0xFF
+	}
+	switch addr {
+	case addrVBK:
+		return p.VBK | 0xFE
+	case addrBCPS:
+		return p.BCPS | 0x40
+	case addrBCPD:
+		return p.BGPalettes[p.BCPS&paletteIndexMask]
+	case addrOCPS:
+		return p.OCPS | 0x40
+	case addrOCPD:
+		return p.OBJPalettes[p.OCPS&paletteIndexMask]
+	}
+	return 0xFF
+}
+
+// WriteRegister sets the value of a LCD register. LY is read only
+func (p *PPU) WriteRegister(addr uint16, v uint8) {
+	switch addr {
+	case addrLCDC:
+		wasEnabled := p.enabled()
+		p.LCDC = v
+		if wasEnabled && !p.enabled() {
+			// Turning the LCD off resets LY and blanks the screen
+			p.LY, p.dot, p.windowLine = 0, 0, 0
+			p.STAT &^= 0x03
+			p.clear(p.front)
+		} else if !wasEnabled && p.enabled() {
+			p.setMode(ModeOAM)
+			p.compareLYC()
+		}
+	case addrSTAT:
+		p.STAT = p.STAT&0x07 | v&0x78
+		p.updateSTATLine()
+	case addrSCY:
+		p.SCY = v
+	case addrSCX:
+		p.SCX = v
+	case addrLYC:
+		p.LYC = v
+		if p.enabled() {
+			p.compareLYC()
+		}
+	case addrBGP:
+		p.BGP = v
+	case addrOBP0:
+		p.OBP0 = v
+	case addrOBP1:
+		p.OBP1 = v
+	case addrWY:
+		p.WY = v
+	case addrWX:
+		p.WX = v
+	}
+
+	if !p.CGB {
+		return
+	}
+	switch addr {
+	case addrVBK:
+		p.VBK = v & 0x01
+	case addrBCPS:
+		p.BCPS = v & (paletteIndexMask | paletteAutoIncrement)
+	case addrBCPD:
+		writePalette(&p.BGPalettes, &p.BCPS, v)
+	case addrOCPS:
+		p.OCPS = v & (paletteIndexMask | paletteAutoIncrement)
+	case addrOCPD:
+		writePalette(&p.OBJPalettes, &p.OCPS, v)
+	}
+}
+
+func writePalette(palettes *[64]uint8, spec *uint8, v uint8) {
+	palettes[*spec&paletteIndexMask] = v
+	if *spec&paletteAutoIncrement != 0 {
+		*spec = paletteAutoIncrement | (*spec+1)&paletteIndexMask
+	}
+}
+
+// cgbColor converts the RGB555 color of the given palette to RGBA
+func cgbColor(palettes []uint8, palette, index uint8) color.RGBA {
+	i := int(palette)*8 + int(index)*2
+	rgb := uint16(palettes[i+1])<<8 | uint16(palettes[i])
+	scale := func(c uint16) uint8 {
+		c &= 0x1F
+		return uint8(c<<3 | c>>2)
+	}
+	return color.RGBA{scale(rgb), scale(rgb >> 5), scale(rgb >> 10), 0xFF}
+}
+
+// IsRegister returns true if the address is a LCD register handled by the PPU
+func (p *PPU) IsRegister(addr uint16) bool {
+	return addr >= addrLCDC && addr <= addrWX && addr != addrDMA ||
+		addr == addrVBK || addr >= addrBCPS && addr <= addrOCPD
+}
+
+// Tick advances the PPU by the given number of dots
+func (p *PPU) Tick(dots int) {
+	if !p.enabled() {
+		return
+	}
+
+	p.dot += dots
+	for {
+		switch p.Mode() {
+		case ModeOAM:
+			if p.dot < oamScanDots {
+				return
+			}
+			p.scanOAM()
+			p.drawLen = drawDots + int(p.SCX&7) + 6*len(p.sprites)
+			p.setMode(ModeDraw)
+		case ModeDraw:
+			if p.dot < oamScanDots+p.drawLen {
+				return
+			}
+			p.renderLine()
+			p.setMode(ModeHBlank)
+			if p.OnHBlank != nil {
+				p.OnHBlank()
+			}
+		case ModeHBlank, ModeVBlank:
+			if p.dot < dotsPerLine {
+				return
+			}
+			p.dot -= dotsPerLine
+			p.nextLine()
+		}
+	}
+}
+
+func (p *PPU) nextLine() {
+	p.LY++
+	switch {
+	case p.LY == ScreenHeight:
+		p.back, p.front = p.front, p.back
+		p.Frames++
+		p.irq(IntVBlank)
+		p.setMode(ModeVBlank)
+	case p.LY == linesPerFrame:
+		p.LY = 0
+		p.windowLine = 0
+		p.setMode(ModeOAM)
+	case p.LY < ScreenHeight:
+		p.setMode(ModeOAM)
+	}
+	p.compareLYC()
+}
+
+func (p *PPU) setMode(mode uint8) {
+	p.STAT = p.STAT&^0x03 | mode
+	p.updateSTATLine()
+}
+
+func (p *PPU) compareLYC() {
+	if p.LY == p.LYC {
+		p.STAT |= statLYCFlag
+	} else {
+		p.STAT &^= statLYCFlag
+	}
+	p.updateSTATLine()
+}
+
+// updateSTATLine requests a STAT interrupt when any of the enabled sources becomes active while
+// the others were inactive (STAT blocking)
+func (p *PPU) updateSTATLine() {
+	line := p.STAT&statLYC != 0 && p.STAT&statLYCFlag != 0
+	switch p.Mode() {
+	case ModeHBlank:
+		line = line || p.STAT&statHBlank != 0
+	case ModeVBlank:
+		line = line || p.STAT&statVBlank != 0
+	case ModeOAM:
+		line = line || p.STAT&statOAM != 0
+	}
+	if line && !p.statLine && p.enabled() {
+		p.irq(IntLCD)
+	}
+	p.statLine = line
+}
+
+// scanOAM selects the first 10 sprites in OAM order that are visible in the current line
+func (p *PPU) scanOAM() {
+	p.sprites = p.sprites[:0]
+	height := 8
+	if p.LCDC&lcdcOBJSize != 0 {
+		height = 16
+	}
+
+	for i := 0; i < len(p.OAM) && len(p.sprites) < maxSpritesPerLine; i += 4 {
+		y := int(p.OAM[i]) - 16
+		if int(p.LY) >= y && int(p.LY) < y+height {
+			p.sprites = append(p.sprites, sprite{p.OAM[i], p.OAM[i+1], p.OAM[i+2], p.OAM[i+3], i / 4})
+		}
+	}
+}
+
+// tilePixel returns the color index of a pixel of the tile stored at the given VRAM bank and
+// offset
+func (p *PPU) tilePixel(bank uint8, tile uint16, x, y uint8) uint8 {
+	lo := p.VRAM[bank][tile+uint16(y)*2]
+	hi := p.VRAM[bank][tile+uint16(y)*2+1]
+	bit := 7 - x
+	return (hi>>bit&1)<<1 | lo>>bit&1
+}
+
+// bgTile returns the VRAM offset of a background or window tile given its map entry
+func (p *PPU) bgTile(id uint8) uint16 {
+	if p.LCDC&lcdcTileData != 0 {
+		return uint16(id) * 16
+	}
+	return uint16(0x1000 + int(int8(id))*16)
+}
+
+func shade(palette, index uint8) uint8 {
+	return palette >> (index * 2) & 0x03
+}
+
+func (p *PPU) renderLine() {
+	line := p.back.Pix[int(p.LY)*p.back.Stride:]
+	ly := p.LY
+
+	// In CGB mode LCDC bit 0 does not disable the background, it gives sprites the priority
+	bgEnabled := p.CGB || p.LCDC&lcdcBGEnable != 0
+	windowVisible := p.LCDC&lcdcWindowEnable != 0 && bgEnabled && ly >= p.WY && p.WX <= 166
+	for x := 0; x < ScreenWidth; x++ {
+		var index, attr uint8
+		if bgEnabled {
+			var mapBase uint16
+			var tx, ty uint8
+			if windowVisible && x+7 >= int(p.WX) {
+				mapBase = 0x1800
+				if p.LCDC&lcdcWindowMap != 0 {
+					mapBase = 0x1C00
+				}
+				tx, ty = uint8(x+7-int(p.WX)), uint8(p.windowLine)
+			} else {
+				mapBase = 0x1800
+				if p.LCDC&lcdcBGMap != 0 {
+					mapBase = 0x1C00
+				}
+				tx, ty = uint8(x)+p.SCX, ly+p.SCY
+			}
+			entry := mapBase + uint16(ty/8)*32 + uint16(tx/8)
+			id := p.VRAM[0][entry]
+			if p.CGB {
+				attr = p.VRAM[1][entry]
+			}
+
+			col, row := tx%8, ty%8
+			if attr&bgXFlip != 0 {
+				col = 7 - col
+			}
+			if attr&bgYFlip != 0 {
+				row = 7 - row
+			}
+			index = p.tilePixel(attr&bgBank>>3, p.bgTile(id), col, row)
+		}
+
+		var c color.RGBA
+		if p.CGB {
+			c = cgbColor(p.BGPalettes[:], attr&bgPaletteMask, index)
+		} else {
+			c = DMGPalette[shade(p.BGP, index)]
+		}
+		p.bgIndex[x], p.bgPriority[x], p.bgColor[x] = index, attr&bgPriority != 0, c
+		setPixel(line, x, c)
+	}
+	if windowVisible {
+		p.windowLine++
+	}
+
+	if p.LCDC&lcdcOBJEnable != 0 {
+		p.renderSprites(line)
+	}
+}
+
+// renderSprites draws the sprites of the line. On DMG the sprite with the lowest X has priority,
+// and the lowest OAM index if they overlap at the same X. On CGB only the OAM index is used
+func (p *PPU) renderSprites(line []uint8) {
+	height := uint8(8)
+	if p.LCDC&lcdcOBJSize != 0 {
+		height = 16
+	}
+
+	var owner [ScreenWidth]int
+	for x := range owner {
+		owner[x] = -1
+	}
+	for i, s := range p.sprites {
+		row := p.LY + 16 - s.y
+		if s.attr&objYFlip != 0 {
+			row = height - 1 - row
+		}
+		tile := s.tile
+		if height == 16 {
+			tile &= 0xFE
+		}
+		var bank uint8
+		if p.CGB {
+			bank = s.attr & objBank >> 3
+		}
+
+		for px := uint8(0); px < 8; px++ {
+			x := int(s.x) - 8 + int(px)
+			if x < 0 || x >= ScreenWidth {
+				continue
+			}
+			if o := owner[x]; o >= 0 && (p.CGB || p.sprites[o].x < s.x || p.sprites[o].x == s.x && p.sprites[o].index < s.index) {
+				continue
+			}
+
+			col := px
+			if s.attr&objXFlip != 0 {
+				col = 7 - px
+			}
+			index := p.tilePixel(bank, uint16(tile)*16, col, row)
+			if index == 0 {
+				continue
+			}
+			owner[x] = i
+			if p.hiddenByBackground(s, x) {
+				// Hidden behind the background, along with the sprites with less priority
+				setPixel(line, x, p.bgColor[x])
+				continue
+			}
+
+			if p.CGB {
+				setPixel(line, x, cgbColor(p.OBJPalettes[:], s.attr&objCGBPaletteMask, index))
+				continue
+			}
+			palette := p.OBP0
+			if s.attr&objPalette != 0 {
+				palette = p.OBP1
+			}
+			setPixel(line, x, DMGPalette[shade(palette, index)])
+		}
+	}
+}
+
+func (p *PPU) hiddenByBackground(s sprite, x int) bool {
+	if p.bgIndex[x] == 0 {
+		return false
+	}
+	if p.CGB {
+		return p.LCDC&lcdcBGEnable != 0 && (p.bgPriority[x] || s.attr&objPriority != 0)
+	}
+	return s.attr&objPriority != 0
+}
+
+func setPixel(line []uint8, x int, c color.RGBA) {
+	line[x*4], line[x*4+1], line[x*4+2], line[x*4+3] = c.R, c.G, c.B, c.A
+}
+
+func (p *PPU) clear(img *image.RGBA) {
+	for i := 0; i < len(img.Pix); i += 4 {
+		setPixel(img.Pix[i:], 0, DMGPalette[0])
+	}
+}
@@ -0,0 +1,65 @@
+package emu
+
+import "bytes"
+
+// Rewind keeps the save states of the last frames in a ring buffer
+type Rewind struct {
+	gb       *GameBoy
+	interval uint64
+	states   []bytes.Buffer
+	frames   []uint64
+	next     int
+	count    int
+}
+
+// NewRewind returns a buffer of up to size states, taken every interval frames
+func NewRewind(gb *GameBoy, size int, interval uint64) *Rewind {
+	if interval == 0 {
+		interval = 1
+	}
+	return &Rewind{gb: gb, interval: interval, states: make([]bytes.Buffer, size), frames: make([]uint64, size)}
+}
+
+// Len returns the number of states in the buffer
+func (r *Rewind) Len() int {
+	return r.count
+}
+
+// Capture saves the current state if the frame is a multiple of the interval, replacing the
+// oldest state when the buffer is full. Call it after every RunFrame
+func (r *Rewind) Capture() error {
+	if len(r.states) == 0 || r.gb.Frames%r.interval != 0 {
+		return nil
+	}
+	buf := &r.states[r.next]
+	buf.Reset()
+	if err := r.gb.SaveState(buf); err != nil {
+		return err
+	}
+	r.frames[r.next] = r.gb.Frames
+	r.next = (r.next + 1) % len(r.states)
+	if r.count < len(r.states) {
+		r.count++
+	}
+	return nil
+}
+
+// Back restores the most recent state older than the current frame and removes it from the
+// buffer, with the state of the current frame if it was just captured. It returns false if there
+// is no older state. The buffer is left untouched if the state can not be loaded
+func (r *Rewind) Back() (bool, error) {
+	next, count := r.next, r.count
+	for count > 0 {
+		next = (next - 1 + len(r.states)) % len(r.states)
+		count--
+		if r.frames[next] == r.gb.Frames {
+			continue
+		}
+		if err := r.gb.LoadState(bytes.NewReader(r.states[next].Bytes())); err != nil {
+			return true, err
+		}
+		r.next, r.count = next, count
+		return true, nil
+	}
+	return false, nil
+}
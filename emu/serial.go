@@ -0,0 +1,95 @@
+package emu
+
+// Reference: https://gbdev.io/pandocs/Serial_Data_Transfer_(Link_Cable).html
+
+// Serial registers
+const (
+	addrSB uint16 = 0xFF01
+	addrSC uint16 = 0xFF02
+)
+
+// SC bits
+const (
+	scTransfer uint8 = 0x80
+	scFast     uint8 = 0x02 // CGB only
+	scInternal uint8 = 0x01
+)
+
+// A byte is shifted in 8 bits at 8192Hz, or at 262144Hz with the CGB fast clock
+const (
+	serialBitCycles     = 512
+	serialFastBitCycles = 16
+)
+
+// Serial is the link cable port. Only the transfers clocked by this Game Boy (internal clock)
+// complete, as there is no other Game Boy to provide the external clock
+type Serial struct {
+	SB, SC uint8
+	CGB    bool
+
+	// OnTransfer is called with the byte sent when a transfer completes and returns the byte
+	// received. When it is nil no cable is connected and 0xFF is received
+	OnTransfer func(sent uint8) uint8
+
+	cycles int // clock cycles until the transfer completes
+	irq    func(uint8)
+}
+
+// NewSerial returns a serial port with no cable connected
+func NewSerial(irq func(uint8)) *Serial {
+	return &Serial{SC: 0x7E, irq: irq}
+}
+
+// IsRegister returns true if the address is a serial register
+func (s *Serial) IsRegister(addr uint16) bool {
+	return addr == addrSB || addr == addrSC
+}
+
+// ReadRegister returns the value of a serial register
+func (s *Serial) ReadRegister(addr uint16) uint8 {
+	if addr == addrSB {
+		return s.SB
+	}
+	if s.CGB {
+		return s.SC | 0x7C
+	}
+	return s.SC | 0x7E
+}
+
+// WriteRegister sets the value of a serial register. Setting the transfer bit of SC with the
+// internal clock starts a transfer
+func (s *Serial) WriteRegister(addr uint16, v uint8) {
+	if addr == addrSB {
+		s.SB = v
+		return
+	}
+	s.SC = v & (scTransfer | scFast | scInternal)
+	if !s.CGB {
+		s.SC &^= scFast
+	}
+	s.cycles = 0
+	if s.SC&scTransfer != 0 && s.SC&scInternal != 0 {
+		s.cycles = 8 * serialBitCycles
+		if s.SC&scFast != 0 {
+			s.cycles = 8 * serialFastBitCycles
+		}
+	}
+}
+
+// Tick advances the serial port by the given number of CPU clock cycles
+func (s *Serial) Tick(cycles int) {
+	if s.cycles == 0 {
+		return
+	}
+	if s.cycles -= cycles; s.cycles > 0 {
+		return
+	}
+	s.cycles = 0
+	received := uint8(0xFF)
+	if s.OnTransfer != nil {
+		received = s.OnTransfer(s.SB)
+	}
+	s.SB = received
+	s.SC &^= scTransfer
+	s.irq(IntSerial)
+}
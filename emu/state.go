@@ -0,0 +1,286 @@
+package emu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// StateVersion is the version of the save state format. States of other versions are rejected
+const StateVersion = 1
+
+var stateMagic = [4]uint8{'G', 'B', 'S', 'T'}
+
+// stateHeader identifies the console and the cartridge a state belongs to
+type stateHeader struct {
+	Magic          [4]uint8
+	Version        uint16
+	Model          uint8
+	HeaderChecksum uint8
+	GlobalChecksum [2]uint8
+}
+
+func (gb *GameBoy) stateHeader() stateHeader {
+	h := stateHeader{
+		Magic:          stateMagic,
+		Version:        StateVersion,
+		Model:          uint8(gb.Model),
+		HeaderChecksum: gb.Cartridge.Header.HeaderChecksum,
+	}
+	copy(h.GlobalChecksum[:], gb.Cartridge.Header.GlobalChecksum)
+	return h
+}
+
+// stateEncoder writes little endian values, keeping the first error
+type stateEncoder struct {
+	w   io.Writer
+	err error
+}
+
+func (e *stateEncoder) write(values ...interface{}) {
+	for _, v := range values {
+		if e.err == nil {
+			e.err = binary.Write(e.w, binary.LittleEndian, v)
+		}
+	}
+}
+
+func (e *stateEncoder) writeInts(values ...int) {
+	for _, v := range values {
+		e.write(int64(v))
+	}
+}
+
+// stateDecoder reads the values written by a stateEncoder, keeping the first error
+type stateDecoder struct {
+	r   io.Reader
+	err error
+}
+
+func (d *stateDecoder) read(values ...interface{}) {
+	for _, v := range values {
+		if d.err == nil {
+			d.err = binary.Read(d.r, binary.LittleEndian, v)
+		}
+	}
+}
+
+func (d *stateDecoder) readInts(values ...*int) {
+	for _, p := range values {
+		var v int64
+		d.read(&v)
+		*p = int(v)
+	}
+}
+
+// check fails the decoding if a value read is out of range, so the emulator never indexes its
+// memories with it
+func (d *stateDecoder) check(ok bool, format string, args ...interface{}) {
+	if d.err == nil && !ok {
+		d.err = fmt.Errorf(format, args...)
+	}
+}
+
+// SaveState writes the whole state of the console: CPU, memories, PPU, APU, timer, joypad,
+// serial port, DMAs and the cartridge controller, RAM and clock
+func (gb *GameBoy) SaveState(w io.Writer) error {
+	e := &stateEncoder{w: w}
+	e.write(gb.stateHeader(), gb.Frames)
+	gb.CPU.saveState(e)
+	gb.Bus.saveState(e)
+	gb.Bus.PPU.saveState(e)
+	gb.Bus.APU.saveState(e)
+	gb.Bus.Timer.saveState(e)
+	gb.Bus.Joypad.saveState(e)
+	gb.Bus.Serial.saveState(e)
+	gb.Bus.DMA.saveState(e)
+	if e.err != nil {
+		return fmt.Errorf("writing state: %v", e.err)
+	}
+	return gb.Bus.MBC.SaveState(w)
+}
+
+// LoadState restores a state written by SaveState with the same model and cartridge. If the
+// state is invalid the console is left untouched
+func (gb *GameBoy) LoadState(r io.Reader) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("reading state: %v", err)
+	}
+
+	var h stateHeader
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &h); err != nil {
+		return fmt.Errorf("reading state: %v", err)
+	}
+	switch want := gb.stateHeader(); {
+	case h.Magic != stateMagic:
+		return fmt.Errorf("not a save state")
+	case h.Version != StateVersion:
+		return fmt.Errorf("unsupported save state version %d", h.Version)
+	case h.Model != want.Model:
+		return fmt.Errorf("save state of a different Game Boy model")
+	case h.HeaderChecksum != want.HeaderChecksum || h.GlobalChecksum != want.GlobalChecksum:
+		return fmt.Errorf("save state of a different cartridge")
+	}
+
+	var backup bytes.Buffer
+	if err := gb.SaveState(&backup); err != nil {
+		return err
+	}
+	if err := gb.loadState(bytes.NewReader(data)); err != nil {
+		gb.loadState(&backup)
+		return err
+	}
+	return nil
+}
+
+func (gb *GameBoy) loadState(r io.Reader) error {
+	d := &stateDecoder{r: r}
+	var h stateHeader
+	d.read(&h, &gb.Frames)
+	gb.CPU.loadState(d)
+	gb.Bus.loadState(d)
+	gb.Bus.PPU.loadState(d)
+	gb.Bus.APU.loadState(d)
+	gb.Bus.Timer.loadState(d)
+	gb.Bus.Joypad.loadState(d)
+	gb.Bus.Serial.loadState(d)
+	gb.Bus.DMA.loadState(d)
+	if d.err != nil {
+		return fmt.Errorf("reading state: %v", d.err)
+	}
+	return gb.Bus.MBC.LoadState(r)
+}
+
+func (c *CPU) saveState(e *stateEncoder) {
+	e.write(c.Registers, c.IME, c.Halted, c.Stopped, c.Locked, c.Cycles, c.eiPending, c.haltBug)
+}
+
+func (c *CPU) loadState(d *stateDecoder) {
+	d.read(&c.Registers, &c.IME, &c.Halted, &c.Stopped, &c.Locked, &c.Cycles, &c.eiPending, &c.haltBug)
+}
+
+func (b *Bus) saveState(e *stateEncoder) {
+	e.write(&b.WRAM, &b.HRAM, &b.IO, b.IE, b.DoubleSpeed, b.key1, b.svbk)
+	e.write(b.hdma.src, b.hdma.dst, b.hdma.hblank, b.hdma.active)
+	e.writeInts(b.hdma.blocks, b.stall)
+}
+
+func (b *Bus) loadState(d *stateDecoder) {
+	d.read(&b.WRAM, &b.HRAM, &b.IO, &b.IE, &b.DoubleSpeed, &b.key1, &b.svbk)
+	d.read(&b.hdma.src, &b.hdma.dst, &b.hdma.hblank, &b.hdma.active)
+	d.readInts(&b.hdma.blocks, &b.stall)
+	d.check(b.hdma.blocks >= 0 && b.hdma.blocks <= hdmaMaxBlocks, "invalid HDMA length %d", b.hdma.blocks)
+	d.check(b.stall >= 0 && b.stall <= hdmaMaxBlocks*hdmaBlockCycles*2, "invalid DMA stall %d", b.stall)
+}
+
+func (p *PPU) saveState(e *stateEncoder) {
+	e.write(&p.VRAM, &p.OAM, p.LCDC, p.STAT, p.SCY, p.SCX, p.LY, p.LYC, p.BGP, p.OBP0, p.OBP1, p.WY, p.WX)
+	e.write(p.VBK, p.BCPS, p.OCPS, &p.BGPalettes, &p.OBJPalettes, p.Frames, p.statLine)
+	e.writeInts(p.dot, p.drawLen, p.windowLine, len(p.sprites))
+	for _, s := range p.sprites {
+		e.write([5]uint8{s.y, s.x, s.tile, s.attr, uint8(s.index)})
+	}
+	e.write(p.back.Pix, p.front.Pix)
+}
+
+func (p *PPU) loadState(d *stateDecoder) {
+	d.read(&p.VRAM, &p.OAM, &p.LCDC, &p.STAT, &p.SCY, &p.SCX, &p.LY, &p.LYC, &p.BGP, &p.OBP0, &p.OBP1, &p.WY, &p.WX)
+	d.read(&p.VBK, &p.BCPS, &p.OCPS, &p.BGPalettes, &p.OBJPalettes, &p.Frames, &p.statLine)
+	var sprites int
+	d.readInts(&p.dot, &p.drawLen, &p.windowLine, &sprites)
+	d.check(p.VBK <= 1, "invalid VRAM bank %d", p.VBK)
+	d.check(p.LY < linesPerFrame, "invalid LY %d", p.LY)
+	d.check(p.dot >= 0 && p.dot < dotsPerLine, "invalid PPU dot %d", p.dot)
+	d.check(p.drawLen >= 0 && p.drawLen < dotsPerLine, "invalid PPU draw length %d", p.drawLen)
+	d.check(p.windowLine >= 0 && p.windowLine <= 0xFF, "invalid window line %d", p.windowLine)
+	d.check(sprites >= 0 && sprites <= maxSpritesPerLine, "invalid sprite count %d", sprites)
+	if d.err != nil {
+		return
+	}
+	p.sprites = p.sprites[:0]
+	for i := 0; i < sprites; i++ {
+		var s [5]uint8
+		d.read(&s)
+		d.check(int(s[4]) < len(p.OAM)/4, "invalid sprite index %d", s[4])
+		p.sprites = append(p.sprites, sprite{s[0], s[1], s[2], s[3], int(s[4])})
+	}
+	d.read(p.back.Pix, p.front.Pix)
+}
+
+func (ch *channel) saveState(e *stateEncoder) {
+	e.write(ch.enabled, ch.dac, ch.lengthEnabled, ch.volume, ch.envPeriod, ch.envTimer, ch.envIncrease)
+	e.writeInts(ch.length, ch.timer)
+}
+
+func (ch *channel) loadState(d *stateDecoder) {
+	d.read(&ch.enabled, &ch.dac, &ch.lengthEnabled, &ch.volume, &ch.envPeriod, &ch.envTimer, &ch.envIncrease)
+	d.readInts(&ch.length, &ch.timer)
+}
+
+func (a *APU) saveState(e *stateEncoder) {
+	e.write(&a.regs, &a.WaveRAM)
+	for _, ch := range []*channel{&a.pulse1, &a.pulse2, &a.wave, &a.noise} {
+		ch.saveState(e)
+	}
+	e.write(a.duty1, a.duty2, a.sweepEnabled, a.sweepTimer, a.wavePos, a.lfsr)
+	e.write(a.sumL, a.sumR, a.capL, a.capR)
+	e.writeInts(a.shadowFreq, a.seqTimer, a.seqStep, a.sampleClock, a.sumCount)
+}
+
+func (a *APU) loadState(d *stateDecoder) {
+	d.read(&a.regs, &a.WaveRAM)
+	for _, ch := range []*channel{&a.pulse1, &a.pulse2, &a.wave, &a.noise} {
+		ch.loadState(d)
+	}
+	d.read(&a.duty1, &a.duty2, &a.sweepEnabled, &a.sweepTimer, &a.wavePos, &a.lfsr)
+	d.read(&a.sumL, &a.sumR, &a.capL, &a.capR)
+	d.readInts(&a.shadowFreq, &a.seqTimer, &a.seqStep, &a.sampleClock, &a.sumCount)
+	d.check(a.duty1 <= 7 && a.duty2 <= 7 && a.wavePos <= 31, "invalid APU wave positions")
+	d.check(a.seqStep >= 0 && a.seqStep <= 7, "invalid frame sequencer step %d", a.seqStep)
+	a.samples = nil
+}
+
+func (t *Timer) saveState(e *stateEncoder) {
+	e.write(t.TIMA, t.TMA, t.TAC, t.counter)
+	e.writeInts(t.reload)
+}
+
+func (t *Timer) loadState(d *stateDecoder) {
+	d.read(&t.TIMA, &t.TMA, &t.TAC, &t.counter)
+	d.readInts(&t.reload)
+	d.check(t.reload >= 0 && t.reload <= timerReloadDelay, "invalid timer reload delay %d", t.reload)
+}
+
+func (j *Joypad) saveState(e *stateEncoder) {
+	e.write(uint8(j.pressed), j.sel)
+}
+
+func (j *Joypad) loadState(d *stateDecoder) {
+	d.read((*uint8)(&j.pressed), &j.sel)
+}
+
+func (s *Serial) saveState(e *stateEncoder) {
+	e.write(s.SB, s.SC)
+	e.writeInts(s.cycles)
+}
+
+func (s *Serial) loadState(d *stateDecoder) {
+	d.read(&s.SB, &s.SC)
+	d.readInts(&s.cycles)
+	d.check(s.cycles >= 0, "invalid serial cycles %d", s.cycles)
+}
+
+func (dma *DMA) saveState(e *stateEncoder) {
+	e.write(dma.reg, dma.src, dma.active)
+	e.writeInts(dma.pos, dma.delay, dma.cycles)
+}
+
+func (dma *DMA) loadState(d *stateDecoder) {
+	d.read(&dma.reg, &dma.src, &dma.active)
+	d.readInts(&dma.pos, &dma.delay, &dma.cycles)
+	d.check(dma.pos >= 0 && dma.pos < dmaLength, "invalid OAM DMA position %d", dma.pos)
+	d.check(dma.delay >= 0 && dma.cycles >= 0, "invalid OAM DMA timing")
+}
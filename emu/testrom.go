@@ -0,0 +1,61 @@
+package emu
+
+import "bytes"
+
+// TestResult is the outcome reported by a test ROM
+type TestResult int
+
+const (
+	TestRunning TestResult = iota
+	TestPassed
+	TestFailed
+)
+
+func (r TestResult) String() string {
+	switch r {
+	case TestPassed:
+		return "passed"
+	case TestFailed:
+		return "failed"
+	}
+	return "running"
+}
+
+// Mooneye test ROMs execute LD B,B when they finish, with the Fibonacci numbers in B, C, D, E,
+// H and L if they passed or 0x42 in all of them if they failed
+var (
+	mooneyePassed = [6]uint8{3, 5, 8, 13, 21, 34}
+	mooneyeFailed = [6]uint8{0x42, 0x42, 0x42, 0x42, 0x42, 0x42}
+)
+
+// TestMonitor collects the outputs used by test ROMs: the text printed on the serial port (ie.
+// Blargg's test suites) and the registers at the LD B,B breakpoint (ie. Mooneye's)
+type TestMonitor struct {
+	Serial      bytes.Buffer
+	Result      TestResult
+	Breakpoints int
+
+	gb *GameBoy
+}
+
+// NewTestMonitor starts monitoring the Game Boy, replacing its serial and breakpoint callbacks
+func NewTestMonitor(gb *GameBoy) *TestMonitor {
+	m := &TestMonitor{gb: gb}
+	gb.Bus.Serial.OnTransfer = func(sent uint8) uint8 {
+		m.Serial.WriteByte(sent)
+		return 0xFF
+	}
+	gb.CPU.OnBreakpoint = m.breakpoint
+	return m
+}
+
+func (m *TestMonitor) breakpoint() {
+	m.Breakpoints++
+	r := m.gb.CPU.Registers
+	switch [6]uint8{r.B, r.C, r.D, r.E, r.H, r.L} {
+	case mooneyePassed:
+		m.Result = TestPassed
+	case mooneyeFailed:
+		m.Result = TestFailed
+	}
+}
@@ -0,0 +1,119 @@
+package emu
+
+// Reference: https://gbdev.io/pandocs/Timer_and_Divider_Registers.html and
+// https://gbdev.io/pandocs/Timer_Obscure_Behaviour.html
+
+// Timer registers
+const (
+	addrDIV  uint16 = 0xFF04
+	addrTIMA uint16 = 0xFF05
+	addrTMA  uint16 = 0xFF06
+	addrTAC  uint16 = 0xFF07
+)
+
+// TAC bits
+const (
+	tacEnable uint8 = 0x04
+	tacClock  uint8 = 0x03
+)
+
+// Bit of the system counter that clocks TIMA for each TAC clock select (4096Hz, 262144Hz,
+// 65536Hz and 16384Hz)
+var timerBits = [4]uint16{1 << 9, 1 << 3, 1 << 5, 1 << 7}
+
+// TIMA is reloaded with TMA one M-cycle after it overflows
+const timerReloadDelay = 4
+
+// Timer is the divider and the programmable timer. Both are driven by a 16 bits system counter
+// whose upper byte is DIV. TIMA increments on the falling edge of the counter bit selected by
+// TAC, so writing DIV or TAC can increment it too
+type Timer struct {
+	TIMA, TMA, TAC uint8
+
+	counter uint16
+	reload  int // clock cycles until TIMA is reloaded after an overflow
+	irq     func(uint8)
+}
+
+// NewTimer returns a timer in the state left by the boot ROM
+func NewTimer(irq func(uint8)) *Timer {
+	return &Timer{counter: 0xABCC, TAC: 0xF8, irq: irq}
+}
+
+// DIV returns the divider register, the upper byte of the system counter
+func (t *Timer) DIV() uint8 {
+	return uint8(t.counter >> 8)
+}
+
+// IsRegister returns true if the address is a timer register
+func (t *Timer) IsRegister(addr uint16) bool {
+	return addr >= addrDIV && addr <= addrTAC
+}
+
+// ReadRegister returns the value of a timer register
+func (t *Timer) ReadRegister(addr uint16) uint8 {
+	switch addr {
+	case addrDIV:
+		return t.DIV()
+	case addrTIMA:
+		return t.TIMA
+	case addrTMA:
+		return t.TMA
+	}
+	return t.TAC | 0xF8
+}
+
+// WriteRegister sets the value of a timer register. Any write to DIV resets the system counter
+func (t *Timer) WriteRegister(addr uint16, v uint8) {
+	switch addr {
+	case addrDIV:
+		t.setCounter(0)
+	case addrTIMA:
+		// Writing TIMA while the reload is pending cancels it
+		t.TIMA = v
+		t.reload = 0
+	case addrTMA:
+		t.TMA = v
+	case addrTAC:
+		old := t.signal()
+		t.TAC = v | 0xF8
+		if old && !t.signal() {
+			t.increment()
+		}
+	}
+}
+
+// Tick advances the timer by the given number of CPU clock cycles
+func (t *Timer) Tick(cycles int) {
+	for i := 0; i < cycles; i++ {
+		if t.reload > 0 {
+			t.reload--
+			if t.reload == 0 {
+				t.TIMA = t.TMA
+				t.irq(IntTimer)
+			}
+		}
+		t.setCounter(t.counter + 1)
+	}
+}
+
+// signal is the input of the TIMA falling edge detector
+func (t *Timer) signal() bool {
+	return t.TAC&tacEnable != 0 && t.counter&timerBits[t.TAC&tacClock] != 0
+}
+
+func (t *Timer) setCounter(v uint16) {
+	old := t.signal()
+	t.counter = v
+	if old && !t.signal() {
+		t.increment()
+	}
+}
+
+// increment increments TIMA. On overflow it reads 0 until the delayed reload
+func (t *Timer) increment() {
+	t.TIMA++
+	if t.TIMA == 0 {
+		t.reload = timerReloadDelay
+	}
+}
@@ -0,0 +1,46 @@
+package emu
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// WriteWAV encodes stereo 16 bits samples (left and right interleaved) as a PCM WAV file
+func WriteWAV(w io.Writer, samples []int16, sampleRate int) error {
+	const channels, bytesPerSample = 2, 2
+	dataSize := uint32(len(samples) * bytesPerSample)
+
+	header := struct {
+		RIFF          [4]byte
+		Size          uint32
+		WAVE          [4]byte
+		Fmt           [4]byte
+		FmtSize       uint32
+		Format        uint16
+		Channels      uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Data          [4]byte
+		DataSize      uint32
+	}{
+		RIFF:          [4]byte{'R', 'I', 'F', 'F'},
+		Size:          36 + dataSize,
+		WAVE:          [4]byte{'W', 'A', 'V', 'E'},
+		Fmt:           [4]byte{'f', 'm', 't', ' '},
+		FmtSize:       16,
+		Format:        1, // PCM
+		Channels:      channels,
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * channels * bytesPerSample),
+		BlockAlign:    channels * bytesPerSample,
+		BitsPerSample: 8 * bytesPerSample,
+		Data:          [4]byte{'d', 'a', 't', 'a'},
+		DataSize:      dataSize,
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, samples)
+}
@@ -0,0 +1,217 @@
+// Package exprparse holds the expression syntax shared by the assembler and the debugger: the
+// tokens, the C binary operators with their precedence and the number formats. Each package
+// evaluates the parsed expressions its own way
+package exprparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BinaryOps are the binary operators by precedence, from the lowest
+var BinaryOps = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<", "<=", ">", ">="},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+var binaryFuncs = map[string]func(a, b int) (int, error){
+	"||": func(a, b int) (int, error) { return BoolInt(a != 0 || b != 0), nil },
+	"&&": func(a, b int) (int, error) { return BoolInt(a != 0 && b != 0), nil },
+	"|":  func(a, b int) (int, error) { return a | b, nil },
+	"^":  func(a, b int) (int, error) { return a ^ b, nil },
+	"&":  func(a, b int) (int, error) { return a & b, nil },
+	"==": func(a, b int) (int, error) { return BoolInt(a == b), nil },
+	"!=": func(a, b int) (int, error) { return BoolInt(a != b), nil },
+	"<":  func(a, b int) (int, error) { return BoolInt(a < b), nil },
+	"<=": func(a, b int) (int, error) { return BoolInt(a <= b), nil },
+	">":  func(a, b int) (int, error) { return BoolInt(a > b), nil },
+	">=": func(a, b int) (int, error) { return BoolInt(a >= b), nil },
+	"<<": func(a, b int) (int, error) { return a << uint(b&31), nil },
+	">>": func(a, b int) (int, error) { return a >> uint(b&31), nil },
+	"+":  func(a, b int) (int, error) { return a + b, nil },
+	"-":  func(a, b int) (int, error) { return a - b, nil },
+	"*":  func(a, b int) (int, error) { return a * b, nil },
+	"/": func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return a / b, nil
+	},
+	"%": func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return a % b, nil
+	},
+}
+
+// Apply computes a binary operator of BinaryOps. Division by zero is an error
+func Apply(op string, a, b int) (int, error) {
+	return binaryFuncs[op](a, b)
+}
+
+// BoolInt returns 1 for true and 0 for false, the value of the comparisons
+func BoolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Tokenize splits an expression in numbers, names, characters ('A' or "A"), @ and operators,
+// including parentheses and brackets
+func Tokenize(src string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case (c == '\'' || c == '"') && i+2 < len(src) && src[i+2] == c:
+			tokens = append(tokens, src[i:i+3])
+			i += 3
+		case IsIdentChar(c) || c == '$' || c == '@' || c == '%' && (len(tokens) == 0 || isOperator(tokens[len(tokens)-1])):
+			// Numbers and names; % is a binary number where an operand is expected
+			j := i + 1
+			for j < len(src) && IsIdentChar(src[j]) {
+				j++
+			}
+			tokens = append(tokens, src[i:j])
+			i = j
+		case i+1 < len(src) && isOperator(src[i:i+2]):
+			tokens = append(tokens, src[i:i+2])
+			i += 2
+		case strings.IndexByte("+-*/%&|^!~<>()[]", c) >= 0:
+			tokens = append(tokens, src[i:i+1])
+			i++
+		default:
+			return nil, fmt.Errorf("unexpected character %q in %q", c, src)
+		}
+	}
+	return tokens, nil
+}
+
+// IsIdentChar returns true for the characters of names and numbers
+func IsIdentChar(c uint8) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '#'
+}
+
+func isOperator(t string) bool {
+	if t == "(" || t == "[" || t == "!" || t == "~" {
+		return true
+	}
+	for _, ops := range BinaryOps {
+		for _, op := range ops {
+			if t == op {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Parser is a cursor over the tokens of an expression
+type Parser struct {
+	Tokens []string
+	Pos    int
+}
+
+// NewParser tokenizes the expression
+func NewParser(src string) (*Parser, error) {
+	tokens, err := Tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Parser{Tokens: tokens}, nil
+}
+
+// Peek returns the current token, or "" at the end of the expression
+func (p *Parser) Peek() string {
+	if p.Pos < len(p.Tokens) {
+		return p.Tokens[p.Pos]
+	}
+	return ""
+}
+
+// Next returns the current token and advances to the next one
+func (p *Parser) Next() string {
+	t := p.Peek()
+	p.Pos++
+	return t
+}
+
+// Expect consumes the given token
+func (p *Parser) Expect(t string) error {
+	if p.Peek() != t {
+		return fmt.Errorf("expected %q", t)
+	}
+	p.Pos++
+	return nil
+}
+
+// Done returns an error if there are tokens left
+func (p *Parser) Done() error {
+	if p.Pos < len(p.Tokens) {
+		return fmt.Errorf("unexpected %q", p.Tokens[p.Pos])
+	}
+	return nil
+}
+
+// Binary parses the binary operators with their precedence. operand parses the unary operators
+// and the operands, combine joins two operands with a binary operator
+func Binary[T any](p *Parser, operand func() (T, error), combine func(op string, l, r T) T) (T, error) {
+	return binary(p, 0, operand, combine)
+}
+
+// binary parses the operators of the given precedence level and the higher ones
+func binary[T any](p *Parser, level int, operand func() (T, error), combine func(op string, l, r T) T) (T, error) {
+	if level == len(BinaryOps) {
+		return operand()
+	}
+	left, err := binary(p, level+1, operand, combine)
+	if err != nil {
+		return left, err
+	}
+	for {
+		op := p.Peek()
+		found := false
+		for _, o := range BinaryOps[level] {
+			found = found || o == op
+		}
+		if !found {
+			return left, nil
+		}
+		p.Pos++
+		right, err := binary(p, level+1, operand, combine)
+		if err != nil {
+			return right, err
+		}
+		left = combine(op, left, right)
+	}
+}
+
+// ParseNumber parses $FF, 0xFF, %1010, 0b1010 and decimal numbers
+func ParseNumber(t string) (int, bool) {
+	base, digits := 10, t
+	switch {
+	case strings.HasPrefix(t, "$"):
+		base, digits = 16, t[1:]
+	case strings.HasPrefix(t, "0x") || strings.HasPrefix(t, "0X"):
+		base, digits = 16, t[2:]
+	case strings.HasPrefix(t, "%"):
+		base, digits = 2, t[1:]
+	case strings.HasPrefix(t, "0b") || strings.HasPrefix(t, "0B"):
+		base, digits = 2, t[2:]
+	}
+	v, err := strconv.ParseUint(digits, base, 32)
+	return int(v), err == nil
+}
@@ -0,0 +1,55 @@
+package gfx
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// romOffset returns the offset in the ROM image of the bank offset, checking that count tiles
+// fit in the ROM. Tiles can continue in the following banks
+func romOffset(c *cartridge.Cartridge, bank, offset, count int, f Format) (int, error) {
+	if bank < 0 || bank >= len(c.ROMBanks) {
+		return 0, fmt.Errorf("bank %d is not in the ROM (%d banks)", bank, len(c.ROMBanks))
+	}
+	if offset < 0 || offset >= cartridge.ROMBankSize {
+		return 0, fmt.Errorf("offset $%X is not in a bank", offset)
+	}
+	if count <= 0 {
+		return 0, fmt.Errorf("invalid number of tiles %d", count)
+	}
+	start := bank*cartridge.ROMBankSize + offset
+	if end := start + count*f.TileSize(); end > len(c.ROMBanks)*cartridge.ROMBankSize {
+		return 0, fmt.Errorf("%d tiles at %02X:%04X go past the end of the ROM", count, bank, offset)
+	}
+	return start, nil
+}
+
+// ExtractTiles draws count tiles stored at the offset (0000-3FFF) of a ROM bank in a sheet
+func ExtractTiles(c *cartridge.Cartridge, bank, offset, count int, o Options) (*image.Paletted, error) {
+	start, err := romOffset(c, bank, offset, count, o.Format)
+	if err != nil {
+		return nil, err
+	}
+	rom := c.Bytes()
+	return DecodeTiles(rom[start:start+count*o.Format.TileSize()], o)
+}
+
+// PatchTiles encodes count tiles of a sheet and writes them at the offset of a ROM bank. The
+// header and global checksums are fixed afterwards
+func PatchTiles(c *cartridge.Cartridge, bank, offset, count int, img image.Image, o Options) error {
+	start, err := romOffset(c, bank, offset, count, o.Format)
+	if err != nil {
+		return err
+	}
+	data, err := EncodeTiles(img, count, o)
+	if err != nil {
+		return err
+	}
+	for i, v := range data {
+		addr := start + i
+		c.ROMBanks[addr/cartridge.ROMBankSize][addr%cartridge.ROMBankSize] = v
+	}
+	return c.FixChecksums()
+}
@@ -0,0 +1,223 @@
+// Package gfx extracts the tile graphics of a ROM into PNG tile sheets and imports edited sheets
+// back into the ROM
+package gfx
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// Reference: https://gbdev.io/pandocs/Tile_Data.html
+
+// TileWidth is the width and height of a tile in pixels
+const TileWidth = 8
+
+// Format is the encoding of the tile data
+type Format int
+
+const (
+	// Format2BPP is the format of the PPU: 2 bytes per row, low bits first (16 bytes per tile)
+	Format2BPP Format = iota
+	// Format1BPP is 1 byte per row (8 bytes per tile), often used to store fonts
+	Format1BPP
+)
+
+// TileSize returns the number of bytes of a tile
+func (f Format) TileSize() int {
+	if f == Format1BPP {
+		return TileWidth
+	}
+	return 2 * TileWidth
+}
+
+func (f Format) String() string {
+	if f == Format1BPP {
+		return "1bpp"
+	}
+	return "2bpp"
+}
+
+// ParseFormat parses "2bpp" or "1bpp"
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(s) {
+	case "2bpp":
+		return Format2BPP, nil
+	case "1bpp":
+		return Format1BPP, nil
+	}
+	return 0, fmt.Errorf("unknown tile format %q, expected 2bpp or 1bpp", s)
+}
+
+// DefaultPalette are the DMG shades, from color 0 (white) to color 3 (black)
+var DefaultPalette = [4]color.RGBA{
+	{0xE0, 0xF8, 0xD0, 0xFF},
+	{0x88, 0xC0, 0x70, 0xFF},
+	{0x34, 0x68, 0x56, 0xFF},
+	{0x08, 0x18, 0x20, 0xFF},
+}
+
+// ParsePalette parses four comma separated RGB colors in hexadecimal, from color 0 to 3. For
+// example "ffffff,aaaaaa,555555,000000"
+func ParsePalette(s string) ([4]color.RGBA, error) {
+	var p [4]color.RGBA
+	parts := strings.Split(s, ",")
+	if len(parts) != len(p) {
+		return p, fmt.Errorf("palette %q should have 4 colors", s)
+	}
+	for i, part := range parts {
+		part = strings.TrimPrefix(strings.TrimSpace(part), "#")
+		v, err := strconv.ParseUint(part, 16, 32)
+		if err != nil || len(part) != 6 {
+			return p, fmt.Errorf("invalid color %q in palette", part)
+		}
+		p[i] = color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 0xFF}
+	}
+	return p, nil
+}
+
+// Options configure the layout of a tile sheet
+type Options struct {
+	Format      Format
+	Palette     [4]color.RGBA // DefaultPalette if not set
+	TilesPerRow int           // 16 if not set
+	Tall        bool          // 8x16 mode: pairs of tiles are stacked, as the PPU draws tall objects
+}
+
+func (o Options) palette() color.Palette {
+	p := o.Palette
+	if p == [4]color.RGBA{} {
+		p = DefaultPalette
+	}
+	return color.Palette{p[0], p[1], p[2], p[3]}
+}
+
+func (o Options) tilesPerRow() int {
+	if o.TilesPerRow <= 0 {
+		return 16
+	}
+	return o.TilesPerRow
+}
+
+// cellHeight returns the height of the sheet cells in pixels
+func (o Options) cellHeight() int {
+	if o.Tall {
+		return 2 * TileWidth
+	}
+	return TileWidth
+}
+
+// tileOrigin returns the top left pixel of the tile in the sheet
+func (o Options) tileOrigin(tile int) image.Point {
+	cell := tile
+	if o.Tall {
+		cell = tile / 2
+	}
+	p := image.Pt(cell%o.tilesPerRow()*TileWidth, cell/o.tilesPerRow()*o.cellHeight())
+	if o.Tall && tile%2 == 1 {
+		p.Y += TileWidth
+	}
+	return p
+}
+
+// sheetSize returns the size of a sheet holding count tiles
+func (o Options) sheetSize(count int) image.Point {
+	cells := count
+	if o.Tall {
+		cells = (count + 1) / 2
+	}
+	cols := o.tilesPerRow()
+	if cells < cols {
+		cols = cells
+	}
+	rows := (cells + o.tilesPerRow() - 1) / o.tilesPerRow()
+	return image.Pt(cols*TileWidth, rows*o.cellHeight())
+}
+
+// DecodeTile returns the color numbers (0-3) of the pixels of a tile, by rows
+func DecodeTile(data []uint8, f Format) [TileWidth][TileWidth]uint8 {
+	var px [TileWidth][TileWidth]uint8
+	for y := range px {
+		for x := range px[y] {
+			bit := uint(7 - x)
+			if f == Format1BPP {
+				px[y][x] = (data[y] >> bit & 1) * 3
+				continue
+			}
+			px[y][x] = data[2*y]>>bit&1 | (data[2*y+1]>>bit&1)<<1
+		}
+	}
+	return px
+}
+
+// EncodeTile returns the tile data of the pixels. In 1bpp colors 2 and 3 are set bits
+func EncodeTile(px [TileWidth][TileWidth]uint8, f Format) []uint8 {
+	data := make([]uint8, f.TileSize())
+	for y := range px {
+		for x, c := range px[y] {
+			bit := uint(7 - x)
+			if f == Format1BPP {
+				data[y] |= (c >> 1 & 1) << bit
+				continue
+			}
+			data[2*y] |= (c & 1) << bit
+			data[2*y+1] |= (c >> 1 & 1) << bit
+		}
+	}
+	return data
+}
+
+// DecodeTiles draws the tiles of the data in a sheet. Trailing bytes that do not fill a tile
+// are ignored
+func DecodeTiles(data []uint8, o Options) (*image.Paletted, error) {
+	count := len(data) / o.Format.TileSize()
+	if count == 0 {
+		return nil, fmt.Errorf("%d bytes do not hold a %v tile", len(data), o.Format)
+	}
+	img := image.NewPaletted(image.Rectangle{Max: o.sheetSize(count)}, o.palette())
+	for t := 0; t < count; t++ {
+		px := DecodeTile(data[t*o.Format.TileSize():], o.Format)
+		origin := o.tileOrigin(t)
+		for y := range px {
+			for x, c := range px[y] {
+				img.SetColorIndex(origin.X+x, origin.Y+y, c)
+			}
+		}
+	}
+	return img, nil
+}
+
+// EncodeTiles encodes the first count tiles of a sheet with the layout of the options. The
+// pixels are mapped to the nearest color of the palette
+func EncodeTiles(img image.Image, count int, o Options) ([]uint8, error) {
+	size := o.sheetSize(count)
+	b := img.Bounds()
+	if b.Dx() < size.X || b.Dy() < size.Y {
+		return nil, fmt.Errorf("%dx%d sheet cannot hold %d tiles of %d per row, %dx%d expected",
+			b.Dx(), b.Dy(), count, o.tilesPerRow(), size.X, size.Y)
+	}
+
+	palette := o.palette()
+	if o.Format == Format1BPP {
+		// Only colors 0 and 3 can be stored
+		palette = color.Palette{palette[0], palette[3]}
+	}
+	data := make([]uint8, 0, count*o.Format.TileSize())
+	for t := 0; t < count; t++ {
+		var px [TileWidth][TileWidth]uint8
+		origin := o.tileOrigin(t).Add(b.Min)
+		for y := range px {
+			for x := range px[y] {
+				c := uint8(palette.Index(img.At(origin.X+x, origin.Y+y)))
+				if o.Format == Format1BPP {
+					c *= 3
+				}
+				px[y][x] = c
+			}
+		}
+		data = append(data, EncodeTile(px, o.Format)...)
+	}
+	return data, nil
+}
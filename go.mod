@@ -1,8 +1,8 @@
 module github.com/Guillem96/gameboy-tools
 
-go 1.17
+go 1.18
 
 require (
-	github.com/stianeikeland/go-rpio/v4 v4.5.1 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
+	github.com/stianeikeland/go-rpio/v4 v4.5.1
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,155 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+)
+
+// Reference: https://github.com/blakesmith/rombp/blob/master/docs/bps_spec.md
+
+const bpsMagic = "BPS1"
+
+const maxPreallocSize = 8 * 1024 * 1024
+
+// BPS actions
+const (
+	bpsSourceRead = iota
+	bpsTargetRead
+	bpsSourceCopy
+	bpsTargetCopy
+)
+
+// ApplyBPS applies a BPS patch. The source, target and patch CRC32 are verified
+func ApplyBPS(rom []byte, p []byte) ([]byte, error) {
+	if !bytes.HasPrefix(p, []byte(bpsMagic)) {
+		return nil, fmt.Errorf("not a BPS patch")
+	}
+	crcs, body, err := readFooter(p)
+	if err != nil {
+		return nil, err
+	}
+	if crc := crc32.ChecksumIEEE(rom); crc != crcs.source {
+		return nil, fmt.Errorf("source CRC32 mismatch. Expected 0x%08x found 0x%08x", crcs.source, crc)
+	}
+
+	r := &reader{buf: body, pos: len(bpsMagic)}
+	sourceSize, err := r.varint()
+	if err != nil {
+		return nil, fmt.Errorf("reading BPS source size: %v", err)
+	}
+	targetSize, err := r.varint()
+	if err != nil {
+		return nil, fmt.Errorf("reading BPS target size: %v", err)
+	}
+	if sourceSize != len(rom) {
+		return nil, fmt.Errorf("source is %d bytes but patch expects %d", len(rom), sourceSize)
+	}
+	metadataSize, err := r.varint()
+	if err != nil {
+		return nil, fmt.Errorf("reading BPS metadata size: %v", err)
+	}
+	if _, err := r.bytes(metadataSize); err != nil {
+		return nil, fmt.Errorf("reading BPS metadata: %v", err)
+	}
+
+	// Do not trust the declared size blindly when allocating, the biggest cartridges are 8MB
+	capacity := targetSize
+	if capacity > maxPreallocSize {
+		capacity = maxPreallocSize
+	}
+	out := make([]byte, 0, capacity)
+	sourceRel, targetRel := 0, 0
+	for r.remaining() > 0 {
+		data, err := r.varint()
+		if err != nil {
+			return nil, fmt.Errorf("reading BPS action: %v", err)
+		}
+		command, length := data&3, (data>>2)+1
+		if len(out)+length > targetSize {
+			return nil, fmt.Errorf("BPS action at 0x%x writes past the target size", r.pos)
+		}
+
+		switch command {
+		case bpsSourceRead:
+			if len(out)+length > len(rom) {
+				return nil, fmt.Errorf("BPS source read at 0x%x reads past the source", r.pos)
+			}
+			out = append(out, rom[len(out):len(out)+length]...)
+		case bpsTargetRead:
+			b, err := r.bytes(length)
+			if err != nil {
+				return nil, fmt.Errorf("reading BPS target data: %v", err)
+			}
+			out = append(out, b...)
+		case bpsSourceCopy, bpsTargetCopy:
+			offset, err := r.varint()
+			if err != nil {
+				return nil, fmt.Errorf("reading BPS copy offset: %v", err)
+			}
+			delta := offset >> 1
+			if offset&1 != 0 {
+				delta = -delta
+			}
+
+			if command == bpsSourceCopy {
+				sourceRel += delta
+				if sourceRel < 0 || sourceRel+length > len(rom) {
+					return nil, fmt.Errorf("BPS source copy at 0x%x reads out of the source", r.pos)
+				}
+				out = append(out, rom[sourceRel:sourceRel+length]...)
+				sourceRel += length
+			} else {
+				targetRel += delta
+				if targetRel < 0 || targetRel >= len(out) {
+					return nil, fmt.Errorf("BPS target copy at 0x%x reads out of the target", r.pos)
+				}
+				// Byte by byte because the ranges may overlap (RLE-like copies)
+				for i := 0; i < length; i++ {
+					out = append(out, out[targetRel])
+					targetRel++
+				}
+			}
+		}
+	}
+
+	if len(out) != targetSize {
+		return nil, fmt.Errorf("BPS patch produced %d bytes but %d were expected", len(out), targetSize)
+	}
+	if crc := crc32.ChecksumIEEE(out); crc != crcs.target {
+		return nil, fmt.Errorf("target CRC32 mismatch. Expected 0x%08x found 0x%08x", crcs.target, crc)
+	}
+	return out, nil
+}
+
+// CreateBPS generates a linear BPS patch: bytes equal to the source at the same offset are
+// source reads and the rest are stored as target reads
+func CreateBPS(source, target []byte) []byte {
+	var out bytes.Buffer
+	out.WriteString(bpsMagic)
+	writeVarint(&out, len(source))
+	writeVarint(&out, len(target))
+	writeVarint(&out, 0) // no metadata
+
+	same := func(i int) bool {
+		return i < len(source) && source[i] == target[i]
+	}
+
+	for i := 0; i < len(target); {
+		start, isSame := i, same(i)
+		for i < len(target) && same(i) == isSame {
+			i++
+		}
+
+		length := i - start
+		if isSame {
+			writeVarint(&out, (length-1)<<2|bpsSourceRead)
+		} else {
+			writeVarint(&out, (length-1)<<2|bpsTargetRead)
+			out.Write(target[start:i])
+		}
+	}
+
+	writeFooter(&out, source, target)
+	return out.Bytes()
+}
@@ -0,0 +1,159 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Reference: https://zerosoft.zophar.net/ips.php
+
+const (
+	ipsMagic = "PATCH"
+	ipsEOF   = "EOF"
+
+	// Offsets are stored with 3 bytes and sizes with 2
+	ipsMaxOffset = 0xFFFFFF
+	ipsMaxSize   = 0xFFFF
+	// A record starting at this offset would be read as the EOF marker
+	ipsEOFOffset = 0x454F46
+	// Runs of equal bytes longer than this are stored as RLE records
+	ipsMinRLE = 8
+)
+
+// ApplyIPS applies an IPS patch, including RLE records and the truncation extension (3 bytes
+// after the EOF marker with the final size of the file)
+func ApplyIPS(rom []byte, p []byte) ([]byte, error) {
+	if !bytes.HasPrefix(p, []byte(ipsMagic)) {
+		return nil, fmt.Errorf("not an IPS patch")
+	}
+
+	out := append([]byte(nil), rom...)
+	r := &reader{buf: p, pos: len(ipsMagic)}
+	for {
+		if r.remaining() >= len(ipsEOF) && string(p[r.pos:r.pos+len(ipsEOF)]) == ipsEOF {
+			r.pos += len(ipsEOF)
+			break
+		}
+
+		offset, err := r.uintBE(3)
+		if err != nil {
+			return nil, fmt.Errorf("reading IPS record offset: %v", err)
+		}
+		size, err := r.uintBE(2)
+		if err != nil {
+			return nil, fmt.Errorf("reading IPS record size at 0x%06x: %v", offset, err)
+		}
+
+		var data []byte
+		if size == 0 {
+			runLen, err := r.uintBE(2)
+			if err != nil {
+				return nil, fmt.Errorf("reading IPS RLE size at 0x%06x: %v", offset, err)
+			}
+			value, err := r.bytes(1)
+			if err != nil {
+				return nil, fmt.Errorf("reading IPS RLE value at 0x%06x: %v", offset, err)
+			}
+			data = bytes.Repeat(value, runLen)
+		} else if data, err = r.bytes(size); err != nil {
+			return nil, fmt.Errorf("reading IPS record data at 0x%06x: %v", offset, err)
+		}
+
+		if end := offset + len(data); end > len(out) {
+			out = append(out, make([]byte, end-len(out))...)
+		}
+		copy(out[offset:], data)
+	}
+
+	switch r.remaining() {
+	case 0:
+	case 3:
+		size, _ := r.uintBE(3)
+		if size < len(out) {
+			out = out[:size]
+		}
+	default:
+		return nil, fmt.Errorf("unexpected %d bytes after IPS EOF marker", r.remaining())
+	}
+	return out, nil
+}
+
+// CreateIPS generates an IPS patch. Runs of repeated bytes are encoded as RLE records and the
+// truncation extension is used if target is smaller than source
+func CreateIPS(source, target []byte) ([]byte, error) {
+	if len(target) > ipsMaxOffset {
+		return nil, fmt.Errorf("IPS patches can not address %d bytes", len(target))
+	}
+
+	var out bytes.Buffer
+	out.WriteString(ipsMagic)
+
+	differs := func(i int) bool {
+		// The last byte of a larger target is always written so the file grows to its size
+		return i >= len(source) || source[i] != target[i] || i == len(target)-1 && len(target) > len(source)
+	}
+
+	for i := 0; i < len(target); {
+		if !differs(i) {
+			i++
+			continue
+		}
+
+		end := i
+		for end < len(target) && differs(end) {
+			end++
+		}
+		writeIPSRecords(&out, target, i, end)
+		i = end
+	}
+
+	out.WriteString(ipsEOF)
+	if len(target) < len(source) {
+		writeUintBE(&out, len(target), 3)
+	}
+	return out.Bytes(), nil
+}
+
+// writeIPSRecords encodes target[start:end] as a sequence of literal and RLE records
+func writeIPSRecords(out *bytes.Buffer, target []byte, start, end int) {
+	for pos := start; pos < end; {
+		if run := runLength(target, pos, end, ipsMaxSize); run >= ipsMinRLE && pos != ipsEOFOffset {
+			writeUintBE(out, pos, 3)
+			writeUintBE(out, 0, 2)
+			writeUintBE(out, run, 2)
+			out.WriteByte(target[pos])
+			pos += run
+			continue
+		}
+
+		// Literal record until the next long run. One byte is reserved in case the record has
+		// to start one byte earlier to avoid the EOF offset
+		lit := pos + 1
+		for lit < end && lit-pos < ipsMaxSize-1 && runLength(target, lit, end, ipsMinRLE) < ipsMinRLE {
+			lit++
+		}
+		recStart := pos
+		if recStart == ipsEOFOffset {
+			recStart--
+		}
+		writeUintBE(out, recStart, 3)
+		writeUintBE(out, lit-recStart, 2)
+		out.Write(target[recStart:lit])
+		pos = lit
+	}
+}
+
+// runLength counts how many times target[pos] is repeated starting at pos, up to max
+func runLength(target []byte, pos, end, max int) int {
+	run := 1
+	for pos+run < end && run < max && target[pos+run] == target[pos] {
+		run++
+	}
+	return run
+}
+
+func writeUintBE(b *bytes.Buffer, v int, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.WriteByte(byte(v >> (8 * i)))
+	}
+}
@@ -0,0 +1,112 @@
+// Package patch applies and creates IPS, BPS and UPS patches for Game Boy ROMs.
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// Format identifies a patch file format
+type Format string
+
+const (
+	IPS Format = "ips"
+	BPS Format = "bps"
+	UPS Format = "ups"
+)
+
+// ParseFormat converts a file extension or a user provided name into a Format
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.TrimPrefix(strings.ToLower(s), ".")); f {
+	case IPS, BPS, UPS:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown patch format %q (expected ips, bps or ups)", s)
+}
+
+// Detect returns the format of the patch looking at its magic number
+func Detect(p []byte) (Format, error) {
+	switch {
+	case bytes.HasPrefix(p, []byte(ipsMagic)):
+		return IPS, nil
+	case bytes.HasPrefix(p, []byte(bpsMagic)):
+		return BPS, nil
+	case bytes.HasPrefix(p, []byte(upsMagic)):
+		return UPS, nil
+	}
+	return "", fmt.Errorf("unknown patch format")
+}
+
+// ApplyBytes applies the patch to the given ROM image and returns the patched image. The
+// input slice is never modified
+func ApplyBytes(rom []byte, p []byte) ([]byte, error) {
+	f, err := Detect(p)
+	if err != nil {
+		return nil, err
+	}
+
+	switch f {
+	case IPS:
+		return ApplyIPS(rom, p)
+	case BPS:
+		return ApplyBPS(rom, p)
+	}
+	return ApplyUPS(rom, p)
+}
+
+// Apply applies the patch to the cartridge ROM and returns a new cartridge. The header and
+// global checksums of the result are fixed, so patches that forget to update them still
+// produce a consistent ROM. The RAM banks of the original cartridge are kept
+func Apply(c *cartridge.Cartridge, p []byte) (*cartridge.Cartridge, error) {
+	rom, err := ApplyBytes(c.Bytes(), p)
+	if err != nil {
+		return nil, err
+	}
+
+	patched, err := cartridge.CartridgeFromBytes(rom)
+	if err != nil {
+		return nil, fmt.Errorf("patched ROM is not valid: %v", err)
+	}
+	patched.RAMBanks = c.RAMBanks
+
+	if err := patched.FixChecksums(); err != nil {
+		return nil, err
+	}
+	return patched, nil
+}
+
+// ApplyFile reads the patch stored in fname and applies it to the cartridge
+func ApplyFile(c *cartridge.Cartridge, fname string) (*cartridge.Cartridge, error) {
+	p, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, fmt.Errorf("reading patch %v: %v", fname, err)
+	}
+
+	patched, err := Apply(c, p)
+	if err != nil {
+		return nil, fmt.Errorf("applying patch %v: %v", fname, err)
+	}
+	return patched, nil
+}
+
+// CreateBytes generates a patch that transforms source into target
+func CreateBytes(f Format, source, target []byte) ([]byte, error) {
+	switch f {
+	case IPS:
+		return CreateIPS(source, target)
+	case BPS:
+		return CreateBPS(source, target), nil
+	case UPS:
+		return CreateUPS(source, target), nil
+	}
+	return nil, fmt.Errorf("unknown patch format %q", f)
+}
+
+// Create generates a patch that transforms the source cartridge ROM into the target one
+func Create(f Format, source, target *cartridge.Cartridge) ([]byte, error) {
+	return CreateBytes(f, source.Bytes(), target.Bytes())
+}
@@ -0,0 +1,117 @@
+package patch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+)
+
+// reader walks through the patch bytes returning errors instead of panicking on truncated patches
+type reader struct {
+	buf []byte
+	pos int
+}
+
+func (r *reader) remaining() int {
+	return len(r.buf) - r.pos
+}
+
+func (r *reader) bytes(n int) ([]byte, error) {
+	if n < 0 || r.remaining() < n {
+		return nil, fmt.Errorf("unexpected end of patch at 0x%x", r.pos)
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *reader) byte() (byte, error) {
+	b, err := r.bytes(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *reader) uintBE(n int) (int, error) {
+	b, err := r.bytes(n)
+	if err != nil {
+		return 0, err
+	}
+	v := 0
+	for _, x := range b {
+		v = v<<8 | int(x)
+	}
+	return v, nil
+}
+
+// varint decodes the variable length integers used by BPS and UPS
+func (r *reader) varint() (int, error) {
+	data, shift := 0, 1
+	for {
+		x, err := r.byte()
+		if err != nil {
+			return 0, err
+		}
+		data += int(x&0x7F) * shift
+		if x&0x80 != 0 {
+			break
+		}
+		shift <<= 7
+		data += shift
+		if shift > 1<<42 {
+			return 0, fmt.Errorf("variable length integer too large at 0x%x", r.pos)
+		}
+	}
+	return data, nil
+}
+
+func writeVarint(b *bytes.Buffer, data int) {
+	for {
+		x := byte(data & 0x7F)
+		data >>= 7
+		if data == 0 {
+			b.WriteByte(0x80 | x)
+			return
+		}
+		b.WriteByte(x)
+		data--
+	}
+}
+
+// footer holds the CRC32 values stored at the end of BPS and UPS patches
+type footer struct {
+	source, target, patch uint32
+}
+
+const footerSize = 12
+
+// readFooter reads and verifies the patch CRC32. The returned slice contains the patch
+// without the footer
+func readFooter(p []byte) (footer, []byte, error) {
+	if len(p) < footerSize {
+		return footer{}, nil, fmt.Errorf("patch is too short")
+	}
+
+	body := p[:len(p)-footerSize]
+	f := footer{
+		source: binary.LittleEndian.Uint32(p[len(p)-12:]),
+		target: binary.LittleEndian.Uint32(p[len(p)-8:]),
+		patch:  binary.LittleEndian.Uint32(p[len(p)-4:]),
+	}
+	if crc := crc32.ChecksumIEEE(p[:len(p)-4]); crc != f.patch {
+		return footer{}, nil, fmt.Errorf("patch CRC32 mismatch. Expected 0x%08x found 0x%08x", f.patch, crc)
+	}
+	return f, body, nil
+}
+
+func writeFooter(b *bytes.Buffer, source, target []byte) {
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(source))
+	b.Write(crc[:])
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(target))
+	b.Write(crc[:])
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(b.Bytes()))
+	b.Write(crc[:])
+}
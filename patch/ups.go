@@ -0,0 +1,127 @@
+package patch
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+)
+
+// Reference: http://individual.utoronto.ca/dmeunier/ups-spec.pdf
+
+const upsMagic = "UPS1"
+
+// ApplyUPS applies an UPS patch. UPS patches are XOR based, so they can be applied to the
+// target file to get the source back. The CRC32 of the input selects the direction
+func ApplyUPS(rom []byte, p []byte) ([]byte, error) {
+	if !bytes.HasPrefix(p, []byte(upsMagic)) {
+		return nil, fmt.Errorf("not an UPS patch")
+	}
+	crcs, body, err := readFooter(p)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reader{buf: body, pos: len(upsMagic)}
+	sourceSize, err := r.varint()
+	if err != nil {
+		return nil, fmt.Errorf("reading UPS source size: %v", err)
+	}
+	targetSize, err := r.varint()
+	if err != nil {
+		return nil, fmt.Errorf("reading UPS target size: %v", err)
+	}
+
+	outSize, expectedCRC := targetSize, crcs.target
+	switch crc := crc32.ChecksumIEEE(rom); {
+	case crc == crcs.source && len(rom) == sourceSize:
+	case crc == crcs.target && len(rom) == targetSize:
+		outSize, expectedCRC = sourceSize, crcs.source
+	default:
+		return nil, fmt.Errorf("input CRC32 0x%08x matches neither the source nor the target of the patch", crc)
+	}
+
+	// The output is allocated with the declared size, so do not trust it blindly: the biggest
+	// cartridges are 8MB
+	if outSize > maxPreallocSize && outSize > len(rom) {
+		return nil, fmt.Errorf("UPS output of %d bytes is larger than any cartridge", outSize)
+	}
+
+	size := outSize
+	if len(rom) > size {
+		size = len(rom)
+	}
+	out := make([]byte, size)
+	copy(out, rom)
+
+	pos := 0
+	for r.remaining() > 0 {
+		skip, err := r.varint()
+		if err != nil {
+			return nil, fmt.Errorf("reading UPS hunk offset: %v", err)
+		}
+		pos += skip
+		for {
+			x, err := r.byte()
+			if err != nil {
+				return nil, fmt.Errorf("reading UPS hunk data: %v", err)
+			}
+			if x == 0 {
+				break
+			}
+			if pos >= len(out) {
+				return nil, fmt.Errorf("UPS hunk writes past the end of the file (0x%x)", pos)
+			}
+			out[pos] ^= x
+			pos++
+		}
+		// The terminating zero stands for an unchanged byte
+		pos++
+	}
+
+	out = out[:outSize]
+	if crc := crc32.ChecksumIEEE(out); crc != expectedCRC {
+		return nil, fmt.Errorf("output CRC32 mismatch. Expected 0x%08x found 0x%08x", expectedCRC, crc)
+	}
+	return out, nil
+}
+
+// CreateUPS generates an UPS patch that transforms source into target
+func CreateUPS(source, target []byte) []byte {
+	var out bytes.Buffer
+	out.WriteString(upsMagic)
+	writeVarint(&out, len(source))
+	writeVarint(&out, len(target))
+
+	size := len(source)
+	if len(target) > size {
+		size = len(target)
+	}
+	at := func(b []byte, i int) byte {
+		if i < len(b) {
+			return b[i]
+		}
+		return 0
+	}
+
+	last := 0
+	for i := 0; i < size; i++ {
+		x := at(source, i) ^ at(target, i)
+		if x == 0 {
+			continue
+		}
+
+		writeVarint(&out, i-last)
+		for ; i < size; i++ {
+			x = at(source, i) ^ at(target, i)
+			if x == 0 {
+				break
+			}
+			out.WriteByte(x)
+		}
+		out.WriteByte(0x00)
+		last = i + 1
+	}
+
+	writeFooter(&out, source, target)
+	return out.Bytes()
+}
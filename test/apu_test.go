@@ -0,0 +1,120 @@
+package test
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func TestAPURegisters(t *testing.T) {
+	bus := newTestGameBoy(t).Bus
+	if v := bus.Read(0xFF26); v != 0xF1 {
+		t.Errorf("NR52 after boot should be F1, read %02x", v)
+	}
+	if v := bus.Read(0xFF13); v != 0xFF {
+		t.Errorf("NR13 is write only, read %02x", v)
+	}
+
+	bus.Write(0xFF26, 0x00)
+	bus.Write(0xFF12, 0xF0)
+	bus.Write(0xFF30, 0x12)
+	if bus.Read(0xFF26) != 0x70 || bus.Read(0xFF12) != 0x00 || bus.Read(0xFF24) != 0x00 {
+		t.Error("powering off should clear the registers and ignore writes")
+	}
+	if bus.Read(0xFF30) != 0x12 {
+		t.Error("wave RAM should be writable while the APU is off")
+	}
+}
+
+func TestAPUChannels(t *testing.T) {
+	bus := newTestGameBoy(t).Bus
+	apu := bus.APU
+
+	// Pulse 2 with a length of 1: disabled by the first length clock
+	bus.Write(0xFF16, 0x3F)
+	bus.Write(0xFF17, 0xF0)
+	bus.Write(0xFF19, 0xC0)
+	if bus.Read(0xFF26)&0x02 == 0 {
+		t.Fatal("trigger should enable pulse 2")
+	}
+	apu.Tick(8192)
+	if bus.Read(0xFF26)&0x02 != 0 {
+		t.Error("length counter should disable pulse 2")
+	}
+
+	// Sweep overflow on trigger: 0x700 + 0x700>>1 > 0x7FF
+	bus.Write(0xFF10, 0x11)
+	bus.Write(0xFF12, 0xF0)
+	bus.Write(0xFF13, 0x00)
+	bus.Write(0xFF14, 0x87)
+	if bus.Read(0xFF26)&0x01 != 0 {
+		t.Error("sweep overflow should disable pulse 1")
+	}
+
+	// The DAC of the wave channel is off, triggering it does nothing
+	bus.Write(0xFF1A, 0x00)
+	bus.Write(0xFF1E, 0x80)
+	if bus.Read(0xFF26)&0x04 != 0 {
+		t.Error("wave channel with the DAC off should stay disabled")
+	}
+}
+
+// playTune writes the registers of a short sound effect using the four channels
+func playTune(bus *emu.Bus) {
+	for i := uint16(0); i < 16; i++ {
+		bus.Write(0xFF30+i, uint8(i*0x11))
+	}
+	for _, w := range [][2]uint16{
+		{0xFF24, 0x77}, {0xFF25, 0xB6}, // master volume, channels panned differently
+		{0xFF10, 0x24}, {0xFF11, 0x80}, {0xFF12, 0xF3}, {0xFF13, 0x83}, {0xFF14, 0x86},
+		{0xFF16, 0x40}, {0xFF17, 0xA1}, {0xFF18, 0x06}, {0xFF19, 0x87},
+		{0xFF1A, 0x80}, {0xFF1B, 0x00}, {0xFF1C, 0x40}, {0xFF1D, 0x00}, {0xFF1E, 0xC6},
+		{0xFF20, 0x00}, {0xFF21, 0xC2}, {0xFF22, 0x53}, {0xFF23, 0x80},
+	} {
+		bus.Write(w[0], uint8(w[1]))
+	}
+}
+
+func TestAPUOutput(t *testing.T) {
+	gb := newTestGameBoy(t)
+	playTune(gb.Bus)
+	gb.RunFor(cartridge.CyclesPerSecond / 2)
+	samples := gb.Samples()
+
+	if n := len(samples); n < emu.DefaultSampleRate-2 || n > emu.DefaultSampleRate+2 {
+		t.Errorf("half a second should have %d stereo samples, got %d values", emu.DefaultSampleRate/2, n)
+	}
+	silent := true
+	for _, s := range samples {
+		if s > 1000 || s < -1000 {
+			silent = false
+			break
+		}
+	}
+	if silent {
+		t.Fatal("the tune should not be silent")
+	}
+
+	h := sha1.New()
+	binary.Write(h, binary.LittleEndian, samples)
+	if got := hex.EncodeToString(h.Sum(nil)); got != "01ff143cdaabea5c381fa7cd9994fd6a3239e36a" {
+		t.Errorf("audio output changed, SHA-1 %v", got)
+	}
+
+	var wav bytes.Buffer
+	if err := emu.WriteWAV(&wav, samples, emu.DefaultSampleRate); err != nil {
+		t.Fatal(err)
+	}
+	header := wav.Bytes()
+	if string(header[:4]) != "RIFF" || string(header[8:16]) != "WAVEfmt " || wav.Len() != 44+len(samples)*2 {
+		t.Error("invalid WAV header")
+	}
+	if rate := binary.LittleEndian.Uint32(header[24:]); rate != emu.DefaultSampleRate {
+		t.Errorf("WAV sample rate is %d", rate)
+	}
+}
@@ -0,0 +1,232 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/asm"
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/disasm"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+const asmProgram = `
+DEF SERIAL_DATA EQU $FF01
+SERIAL_CONTROL EQU $FF02
+
+; Sends the byte in A on the serial port
+MACRO send
+	ld a, \1
+	call Send
+ENDM
+
+SECTION "Entry", ROM0[$0100]
+	nop
+	jp Main
+	ds $150 - @, 0 ; header, written by the builder
+
+SECTION "Main", ROM0
+Main:
+	ld hl, Message
+.loop
+	ld a, [hl+]
+	or a
+	jr z, .done
+	call Send
+	jr .loop
+.done:
+	send "!"
+	ld a, BANK(Far)
+	ld [$2000], a
+	call Far
+	ld b, b
+.halt:
+	jr .halt
+
+Send:
+	ldh [LOW(SERIAL_DATA)], a
+	ld a, $81
+	ldh [SERIAL_CONTROL], a
+.wait
+	ldh a, [SERIAL_CONTROL]
+	bit 7, a
+	jr nz, .wait
+	ret
+
+Message:
+	db "Hi", 0
+Table:
+	dw Main, HIGH(Table) * 256 + LOW(Table)
+
+SECTION "Far", ROMX, BANK[2]
+Far:
+	ld a, 3 + 4 * 2 ; 11
+	ld [wResult], a
+	ret
+
+SECTION "Variables", WRAM0[$C000]
+wResult: ds 1
+`
+
+func TestAssembler(t *testing.T) {
+	p, err := asm.AssembleString(asmProgram)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Banks) != 3 {
+		t.Fatalf("program should use 3 banks, got %d", len(p.Banks))
+	}
+	main, ok := p.Symbols.Lookup("Main")
+	if !ok || main.Addr != 0x150 {
+		t.Fatalf("Main should follow the header section, got %v", main)
+	}
+	if loop, ok := p.Symbols.Lookup("Main.loop"); !ok || loop.Addr != 0x153 {
+		t.Errorf("local labels should be scoped, got %v", loop)
+	}
+	if far, _ := p.Symbols.Lookup("Far"); far.Bank != 2 || far.Addr != 0x4000 {
+		t.Errorf("Far should be at 02:4000, got %v", far)
+	}
+	if w, _ := p.Symbols.Lookup("wResult"); w.Addr != 0xC000 {
+		t.Errorf("wResult should be at C000, got %v", w)
+	}
+	expected := []uint8{0x3E, 0x0B, 0xEA, 0x00, 0xC0, 0xC9}
+	if !bytes.Equal(p.Banks[2][:len(expected)], expected) {
+		t.Errorf("bank 2 should be % X, got % X", expected, p.Banks[2][:len(expected)])
+	}
+
+	c, err := p.Build(asm.Header{Title: "ASM", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.ROMBanks) != 4 || c.Validate() != nil || c.Header.ComputeHeaderChecksum() != c.Header.HeaderChecksum {
+		t.Fatalf("built ROM should have 4 banks and valid checksums: %v", c.Validate())
+	}
+	if c.ROMBanks[3][0] != cartridge.ROMPadding || !bytes.Equal(c.Header.NintendoLogo, cartridge.NintendoLogo[:]) {
+		t.Error("unused banks should be padded and the logo should be genuine")
+	}
+
+	gb, err := emu.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := emu.NewTestMonitor(gb)
+	for i := 0; i < 10 && m.Breakpoints == 0; i++ {
+		gb.RunFrame()
+	}
+	if m.Serial.String() != "Hi!" || gb.Bus.Read(0xC000) != 11 {
+		t.Errorf("program should print Hi! and store 11, got %q and %d", m.Serial.String(), gb.Bus.Read(0xC000))
+	}
+}
+
+func TestAssemblerErrors(t *testing.T) {
+	cases := map[string]string{
+		"SECTION \"a\", ROM0\n\tld a, Missing": "<input>:2: undefined symbol Missing",
+		"SECTION \"a\", ROM0\n\tjr @ + 200":    "out of range",
+		"SECTION \"a\", ROM0\n\tfoo a":         "invalid instruction",
+		"\tnop":                                "outside of a section",
+		"SECTION \"a\", ROM0[0]\n\tnop\nSECTION \"b\", ROM0[0]\n\tnop": "overlaps",
+		"SECTION \"a\", WRAM0\n\tnop":                                  "only ds",
+		"MACRO m\n\tnop":                                               "without ENDM",
+		"SECTION \"a\", ROM0\nA:\nA:":                                  "already defined",
+		"SECTION \"a\", ROM0[-5]\n\tnop":                               "negative section address",
+		"SECTION \"a\", ROMX, BANK\n\tnop":                             "unexpected section option",
+	}
+	for src, msg := range cases {
+		if _, err := asm.AssembleString(src); err == nil || !strings.Contains(err.Error(), msg) {
+			t.Errorf("%q should fail with %q, got %v", src, msg, err)
+		}
+	}
+}
+
+// TestAssembleOpcodes assembles the disassembly of every opcode
+func TestAssembleOpcodes(t *testing.T) {
+	var src strings.Builder
+	var code []uint8
+	src.WriteString("SECTION \"code\", ROM0[$1000]\n")
+	for op := 0; op < 0x200; op++ {
+		b := []uint8{uint8(op), 0x34, 0x12}
+		if op >= 0x100 {
+			b = []uint8{0xCB, uint8(op)}
+		}
+		in := disasm.Decode(func(addr uint16) uint8 { return b[addr-uint16(0x1000+len(code))] }, uint16(0x1000+len(code)))
+		if in.Flow == disasm.FlowInvalid || op == 0x10 {
+			continue
+		}
+		fmt.Fprintf(&src, "\t%s\n", in)
+		code = append(code, in.Bytes...)
+	}
+	p, err := asm.AssembleString(src.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Banks[0][0x1000 : 0x1000+len(code)]; !bytes.Equal(got, code) {
+		for i := range code {
+			if got[i] != code[i] {
+				t.Fatalf("byte %04X should be %02X, got %02X", 0x1000+i, code[i], got[i])
+			}
+		}
+	}
+}
+
+// assembleDisassembly checks that the RGBDS output of the disassembler assembles back to every
+// bank of the cartridge
+func assembleDisassembly(t *testing.T, c *cartridge.Cartridge, syms *disasm.Symbols) string {
+	t.Helper()
+	var out bytes.Buffer
+	if err := disasm.Disassemble(c, syms, &out); err != nil {
+		t.Fatal(err)
+	}
+	p, err := asm.AssembleString(out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Banks) != len(c.ROMBanks) {
+		t.Fatalf("expected %d banks, got %d", len(c.ROMBanks), len(p.Banks))
+	}
+	for i := range p.Banks {
+		if !bytes.Equal(p.Banks[i], c.ROMBanks[i]) {
+			t.Errorf("bank %d should assemble to the same bytes", i)
+		}
+	}
+	return out.String()
+}
+
+// TestDisassemblyRoundTrip assembles the RGBDS output of the disassembler
+func TestDisassemblyRoundTrip(t *testing.T) {
+	c := newDisasmCartridge(t)
+	assembleDisassembly(t, c, nil)
+
+	syms := disasm.NewSymbols()
+	syms.Add(0, 0x150, "Main")
+	syms.Add(2, 0x4000, "FarFunction")
+	syms.Add(0, 0xC000, "wValue")
+	assembleDisassembly(t, c, syms)
+
+	// A JR before 0000 is written relative to the instruction
+	c.ROMBanks[0][0], c.ROMBanks[0][1] = 0x18, 0xFC
+	if out := assembleDisassembly(t, c, nil); !strings.Contains(out, "\tjr @ - 2\n") {
+		t.Error("JR wrapping around 0000 should be relative to @")
+	}
+
+	// Random bytes mix code, data and instructions overlapping labels
+	r := rand.New(rand.NewSource(46))
+	for _, cartType := range []uint8{cartridge.RomOnly, cartridge.MBC1, cartridge.MBC3, cartridge.MBC5} {
+		for i := 0; i < 5; i++ {
+			c, err := testrom.New(testrom.Options{CartridgeType: cartType, ROMSize: cartridge.ROM128KB})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, bank := range c.ROMBanks {
+				r.Read(bank)
+			}
+			if err := c.EditHeader().SetCartridgeType(cartType).SetROMSize(cartridge.ROM128KB).FixLogo().Apply(); err != nil {
+				t.Fatal(err)
+			}
+			assembleDisassembly(t, c, nil)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/catalog"
+)
+
+func TestCatalogQueries(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "catalog.jsonl")
+	cat, err := catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crystal := generatedCartridge(t, testrom.Options{Title: "PM_CRYSTAL", CartridgeType: cartridge.MBC3TimerRAMBattery, ROMSize: cartridge.ROM128KB, RAMSize: cartridge.RAM32KB})
+	red := generatedCartridge(t, testrom.Options{Title: "POKEMON RED", CartridgeType: cartridge.MBC3RAMBattery, ROMSize: cartridge.ROM128KB, RAMSize: cartridge.RAM32KB})
+	tetris := generatedCartridge(t, testrom.Options{Title: "TETRIS", CartridgeType: cartridge.RomOnly, ROMSize: cartridge.ROM32KB, RAMSize: cartridge.None})
+
+	save := make([]uint8, 32*1024)
+	crystal.SetRAM(save)
+	red.SetRAM(save)
+
+	if err := cat.AddDump("CRYSTAL-01", crystal, catalog.DumpOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.AddDump(catalog.CartID(red), red, catalog.DumpOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.AddDump("TETRIS-01", tetris, catalog.DumpOptions{UnstableReads: 3, Notes: "dirty pins"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Crystal save changes, red is backed up again without changes
+	save[0] = 0x01
+	if err := cat.AddSave("CRYSTAL-01", save, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.AddSave(catalog.CartID(red), make([]uint8, 32*1024), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.AddNote("TETRIS-01", "label damaged"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen to make sure everything is read back from the JSON lines file
+	cat, err = catalog.Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(cat.Carts()); n != 3 {
+		t.Fatalf("Expected 3 carts got %d", n)
+	}
+
+	changed := cat.Query(catalog.MBC("MBC3"), catalog.SaveChanged())
+	if len(changed) != 1 || changed[0].ID != "CRYSTAL-01" {
+		t.Errorf("Unexpected MBC3 carts with changed saves %v", changed)
+	}
+	unstable := cat.Query(catalog.UnstableReads())
+	if len(unstable) != 1 || unstable[0].ID != "TETRIS-01" || len(unstable[0].Notes) != 1 {
+		t.Errorf("Unexpected unstable carts %v", unstable)
+	}
+	if mbc3 := cat.Query(catalog.MBC("mbc3")); len(mbc3) != 2 {
+		t.Errorf("Expected 2 MBC3 carts got %d", len(mbc3))
+	}
+	if red := cat.Query(catalog.TitleContains("red")); len(red) != 1 {
+		t.Errorf("Expected 1 cart with RED in the title got %d", len(red))
+	}
+}
+
+// TestCatalogInvalidRecords opens hand edited catalogs with records missing the fields of their
+// type, which the queries would dereference
+func TestCatalogInvalidRecords(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "catalog.jsonl")
+	for line, want := range map[string]string{
+		`{"type":"save","cart_id":"X"}`: "save record without save hashes",
+		`{"type":"dump","cart_id":"X"}`: "dump record without rom hashes",
+		`{"type":"note","notes":"?"}`:   "record without cartridge id",
+	} {
+		if err := os.WriteFile(db, []byte(`{"type":"note","cart_id":"X"}`+"\n"+line+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := catalog.Open(db); err == nil || !strings.Contains(err.Error(), "catalog.jsonl:2: "+want) {
+			t.Errorf("%s: expected %q, got %v", line, want, err)
+		}
+	}
+
+	cat, err := catalog.Open(filepath.Join(t.TempDir(), "catalog.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cat.Append(catalog.Record{Type: catalog.SaveRecord, CartID: "X"}); err == nil {
+		t.Error("a save record without save hashes should not be appended")
+	}
+}
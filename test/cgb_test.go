@@ -0,0 +1,181 @@
+package test
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func newCGBCartridge(t *testing.T, mode cartridge.CGBMode) *cartridge.Cartridge {
+	t.Helper()
+	c, _ := assembleProgram(t, cartridge.MBC5RAMBattery, cartridge.RAM8KB, "\tjr @\n")
+	if err := c.EditHeader().SetCGBMode(mode).Apply(); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func newTestCGB(t *testing.T) *emu.GameBoy {
+	t.Helper()
+	gb, err := emu.New(newCGBCartridge(t, cartridge.CGBEnhanced))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gb
+}
+
+func TestCGBBootPath(t *testing.T) {
+	gb := newTestCGB(t)
+	if gb.Model != emu.ModelCGB || !gb.Bus.CGB || gb.CPU.A != 0x11 {
+		t.Errorf("CGB cartridge should boot in CGB mode, A=%02x", gb.CPU.A)
+	}
+
+	dmg, err := emu.NewWithModel(newCGBCartridge(t, cartridge.CGBEnhanced), emu.ModelDMG)
+	if err != nil || dmg.Bus.CGB || dmg.CPU.A != 0x01 {
+		t.Errorf("CGB enhanced cartridge should run on DMG (err %v)", err)
+	}
+	if _, err := emu.NewWithModel(newCGBCartridge(t, cartridge.CGBOnly), emu.ModelDMG); err == nil {
+		t.Error("CGB only cartridge should not run on DMG")
+	}
+	if gb := newTestGameBoy(t); gb.Bus.CGB || gb.Bus.Read(0xFF70) != 0xFF {
+		t.Error("DMG cartridge should not have CGB registers")
+	}
+}
+
+func TestCGBMemoryBanks(t *testing.T) {
+	bus := newTestCGB(t).Bus
+
+	for bank := uint8(0); bank < 8; bank++ {
+		bus.Write(0xFF70, bank)
+		bus.Write(0xD000, 0x10+bank)
+	}
+	bus.Write(0xFF70, 0x00) // bank 0 maps bank 1
+	if v := bus.Read(0xD000); v != 0x11 {
+		t.Errorf("SVBK 0 should map WRAM bank 1, read %02x", v)
+	}
+	bus.Write(0xFF70, 0x07)
+	if v := bus.Read(0xD000); v != 0x17 || bus.Read(0xF000) != 0x17 || bus.Read(0xFF70) != 0xFF {
+		t.Errorf("SVBK 7 should map WRAM bank 7, read %02x", v)
+	}
+
+	bus.Write(0xFF4F, 0x01)
+	bus.Write(0x8000, 0xAA)
+	bus.Write(0xFF4F, 0x00)
+	if bus.Read(0x8000) != 0x00 || bus.PPU.VRAM[1][0] != 0xAA {
+		t.Error("VBK 1 should map VRAM bank 1")
+	}
+}
+
+func TestCGBPalettes(t *testing.T) {
+	bus := newTestCGB(t).Bus
+
+	// Palette 2, color 1: pure red (RGB555 0x001F), auto increment
+	bus.Write(0xFF68, 0x80|(2*8+2))
+	bus.Write(0xFF69, 0x1F)
+	bus.Write(0xFF69, 0x00)
+	if bus.Read(0xFF68) != 0xC0|(2*8+4) {
+		t.Errorf("BCPS should auto increment, read %02x", bus.Read(0xFF68))
+	}
+	bus.Write(0xFF68, 2*8+2)
+	if bus.Read(0xFF69) != 0x1F {
+		t.Error("BCPD should read the palette byte")
+	}
+
+	// Tile 1 in VRAM bank 1, color 1 on the left column only, drawn flipped with palette 2
+	bus.Write(0xFF4F, 0x01)
+	for row := uint16(0); row < 8; row++ {
+		bus.Write(0x8010+row*2, 0x80)
+	}
+	bus.Write(0x9800, 0x08|0x20|0x02) // attributes: bank 1, X flip, palette 2
+	bus.Write(0xFF4F, 0x00)
+	bus.Write(0x9800, 0x01)
+
+	bus.PPU.Tick(emu.CyclesPerFrame)
+	frame := bus.PPU.Frame()
+	if got := frame.At(7, 0); got != (color.RGBA{0xFF, 0x00, 0x00, 0xFF}) {
+		t.Errorf("flipped pixel should be red, got %v", got)
+	}
+	if got := frame.At(0, 0); got != (color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}) {
+		t.Errorf("pixel should use color 0 (white), got %v", got)
+	}
+}
+
+func TestCGBHDMA(t *testing.T) {
+	gb := newTestCGB(t)
+	bus := gb.Bus
+	for i := uint16(0); i < 0x40; i++ {
+		bus.Write(0xC000+i, uint8(i+1))
+	}
+
+	// General purpose: 2 blocks from C000 to 8100
+	bus.Write(0xFF51, 0xC0)
+	bus.Write(0xFF52, 0x00)
+	bus.Write(0xFF53, 0x81)
+	bus.Write(0xFF54, 0x00)
+	bus.Write(0xFF55, 0x01)
+	if bus.PPU.VRAM[0][0x100] != 0x01 || bus.PPU.VRAM[0][0x11F] != 0x20 || bus.Read(0xFF55) != 0xFF {
+		t.Error("general purpose HDMA should copy 32 bytes at once")
+	}
+
+	// HBlank: 2 blocks from C020 to 9000, one per line
+	bus.Write(0xFF51, 0xC0)
+	bus.Write(0xFF52, 0x20)
+	bus.Write(0xFF53, 0x90)
+	bus.Write(0xFF54, 0x00)
+	bus.Write(0xFF55, 0x81)
+	if bus.Read(0xFF55) != 0x01 {
+		t.Fatalf("HBlank HDMA should be active, HDMA5 %02x", bus.Read(0xFF55))
+	}
+	bus.PPU.Tick(80 + 172)
+	if bus.PPU.VRAM[0][0x1000] != 0x21 || bus.PPU.VRAM[0][0x1010] != 0x00 || bus.Read(0xFF55) != 0x00 {
+		t.Error("HBlank HDMA should copy one block per HBlank")
+	}
+	bus.PPU.Tick(456)
+	if bus.PPU.VRAM[0][0x101F] != 0x40 || bus.Read(0xFF55) != 0xFF {
+		t.Error("HBlank HDMA should finish after two lines")
+	}
+}
+
+func TestCGBHDMAStall(t *testing.T) {
+	for _, double := range []bool{false, true} {
+		gb := newTestCGB(t)
+		bus := gb.Bus
+		bus.DoubleSpeed = double
+		bus.Write(0xFF51, 0xC0)
+		bus.Write(0xFF52, 0x00)
+		bus.Write(0xFF53, 0x81)
+		bus.Write(0xFF54, 0x00)
+		bus.Write(0xC100, 0xE0) // LDH (FF55),A: general purpose transfer of 2 blocks
+		bus.Write(0xC101, 0x55)
+		gb.CPU.A, gb.CPU.PC = 0x01, 0xC100
+
+		// 12 clock cycles of the instruction and 8 M-cycles per block
+		expected := 12 + 2*32
+		if double {
+			expected = (12 + 2*64) / 2
+		}
+		if cycles := gb.Step(); cycles != expected {
+			t.Errorf("double speed %v: HDMA of 2 blocks should take %d cycles, got %d", double, expected, cycles)
+		}
+	}
+}
+
+func TestCGBDoubleSpeed(t *testing.T) {
+	gb := newTestCGB(t)
+	bus := gb.Bus
+	bus.Write(0xC000, 0x10) // STOP
+	bus.Write(0xC001, 0x00)
+	bus.Write(0xC002, 0x00) // NOP
+	gb.CPU.PC = 0xC000
+
+	bus.Write(0xFF4D, 0x01)
+	gb.Step()
+	if !bus.DoubleSpeed || gb.CPU.Stopped || bus.Read(0xFF4D) != 0xFE {
+		t.Fatalf("STOP should switch to double speed, KEY1 %02x", bus.Read(0xFF4D))
+	}
+	if cycles := gb.Step(); cycles != 2 {
+		t.Errorf("NOP should take 2 cycles in double speed, took %d", cycles)
+	}
+}
@@ -0,0 +1,397 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+// flatMemory is a 64KB RAM, enough to run instruction sequences without a cartridge
+type flatMemory [0x10000]uint8
+
+func (m *flatMemory) Read(addr uint16) uint8     { return m[addr] }
+func (m *flatMemory) Write(addr uint16, v uint8) { m[addr] = v }
+func (m *flatMemory) Fetch(addr uint16) uint8    { return m[addr] }
+func (m *flatMemory) Peek(addr uint16) uint8     { return m[addr] }
+func (m *flatMemory) Poke(addr uint16, v uint8)  { m[addr] = v }
+
+// newTestCPU loads the program at 0x0100 and returns a CPU ready to run it
+func newTestCPU(program ...uint8) (*emu.CPU, *flatMemory) {
+	mem := &flatMemory{}
+	copy(mem[0x100:], program)
+	cpu := emu.NewCPU(mem)
+	cpu.F = 0
+	return cpu, mem
+}
+
+// run executes n instructions and returns the cycles they took
+func run(cpu *emu.CPU, n int) int {
+	cycles := 0
+	for i := 0; i < n; i++ {
+		cycles += cpu.Step()
+	}
+	return cycles
+}
+
+func flags(z, n, h, c bool) uint8 {
+	var f uint8
+	for i, on := range []bool{z, n, h, c} {
+		if on {
+			f |= 0x80 >> uint(i)
+		}
+	}
+	return f
+}
+
+func TestCPUInstructions(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []uint8
+		steps   int
+		setup   func(c *emu.CPU, m *flatMemory)
+		check   func(c *emu.CPU, m *flatMemory) bool
+		flags   uint8
+		cycles  int
+	}{
+		{
+			name:    "LD B,d8; LD C,B",
+			program: []uint8{0x06, 0x42, 0x48},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.B == 0x42 && c.C == 0x42 },
+			cycles:  12,
+		},
+		{
+			name:    "LD HL,d16; LD (HL),d8; LD A,(HL+)",
+			program: []uint8{0x21, 0x00, 0xC0, 0x36, 0x99, 0x2A},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x99 && c.HL() == 0xC001 },
+			cycles:  12 + 12 + 8,
+		},
+		{
+			name:    "ADD A,d8 with half carry and carry",
+			program: []uint8{0x3E, 0xF8, 0xC6, 0x08},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x00 },
+			flags:   flags(true, false, true, true),
+			cycles:  16,
+		},
+		{
+			name:    "ADC A,B uses the carry",
+			program: []uint8{0x37, 0x3E, 0x0E, 0x06, 0x01, 0x88},
+			steps:   4,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x10 },
+			flags:   flags(false, false, true, false),
+		},
+		{
+			name:    "SUB d8 borrows",
+			program: []uint8{0x3E, 0x10, 0xD6, 0x20},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0xF0 },
+			flags:   flags(false, true, false, true),
+		},
+		{
+			name:    "SBC A,A with carry",
+			program: []uint8{0x37, 0x9F},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0xFF },
+			flags:   flags(false, true, true, true),
+		},
+		{
+			name:    "CP d8 keeps A",
+			program: []uint8{0x3E, 0x3C, 0xFE, 0x3C},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x3C },
+			flags:   flags(true, true, false, false),
+		},
+		{
+			name:    "AND, XOR, OR",
+			program: []uint8{0x3E, 0xF0, 0xE6, 0x3C, 0xEE, 0xFF, 0xF6, 0x01},
+			steps:   4,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0xCF },
+		},
+		{
+			name:    "INC (HL) half carry, carry untouched",
+			program: []uint8{0x37, 0x21, 0x00, 0xC0, 0x36, 0x0F, 0x34},
+			steps:   4,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return m[0xC000] == 0x10 },
+			flags:   flags(false, false, true, true),
+		},
+		{
+			name:    "DEC B to zero",
+			program: []uint8{0x06, 0x01, 0x05},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.B == 0 },
+			flags:   flags(true, true, false, false),
+		},
+		{
+			name:    "ADD HL,BC keeps Z",
+			program: []uint8{0x21, 0xFF, 0x0F, 0x01, 0x01, 0xF0, 0x09},
+			steps:   3,
+			setup:   func(c *emu.CPU, m *flatMemory) { c.F = emu.FlagZ },
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.HL() == 0x0000 },
+			flags:   flags(true, false, true, true),
+		},
+		{
+			name:    "ADD SP,e8 negative",
+			program: []uint8{0x31, 0xF8, 0xFF, 0xE8, 0xFE},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.SP == 0xFFF6 },
+			flags:   flags(false, false, true, true),
+			cycles:  12 + 16,
+		},
+		{
+			name:    "LD HL,SP+e8",
+			program: []uint8{0x31, 0x00, 0xD0, 0xF8, 0x05},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.HL() == 0xD005 && c.SP == 0xD000 },
+		},
+		{
+			name:    "LD (a16),SP",
+			program: []uint8{0x31, 0x34, 0x12, 0x08, 0x00, 0xC0},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return m[0xC000] == 0x34 && m[0xC001] == 0x12 },
+			cycles:  12 + 20,
+		},
+		{
+			name:    "DAA after BCD addition",
+			program: []uint8{0x3E, 0x45, 0xC6, 0x38, 0x27},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x83 },
+		},
+		{
+			name:    "DAA after BCD subtraction",
+			program: []uint8{0x3E, 0x10, 0xD6, 0x01, 0x27},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x09 },
+			flags:   flags(false, true, false, false),
+		},
+		{
+			name:    "CPL, SCF, CCF",
+			program: []uint8{0x3E, 0x0F, 0x2F, 0x37, 0x3F},
+			steps:   4,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0xF0 },
+		},
+		{
+			name:    "RLCA clears Z",
+			program: []uint8{0x3E, 0x80, 0x07},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x01 },
+			flags:   flags(false, false, false, true),
+		},
+		{
+			name:    "RRA through carry",
+			program: []uint8{0x37, 0x3E, 0x01, 0x1F},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x80 },
+			flags:   flags(false, false, false, true),
+		},
+		{
+			name:    "JR Z backwards",
+			program: []uint8{0xAF, 0x28, 0xFD},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.PC == 0x0101 },
+			flags:   flags(true, false, false, false),
+			cycles:  4 + 12 + 4,
+		},
+		{
+			name:    "JR NZ not taken",
+			program: []uint8{0xAF, 0x20, 0x10},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.PC == 0x0103 },
+			flags:   flags(true, false, false, false),
+			cycles:  4 + 8,
+		},
+		{
+			name:    "JP cc and JP HL",
+			program: []uint8{0x37, 0xDA, 0x10, 0x01},
+			steps:   3,
+			setup: func(c *emu.CPU, m *flatMemory) {
+				m[0x0110] = 0x21 // LD HL,0x0200
+				m[0x0111] = 0x00
+				m[0x0112] = 0x02
+			},
+			check: func(c *emu.CPU, m *flatMemory) bool { return c.PC == 0x0113 && c.HL() == 0x0200 },
+			flags: flags(false, false, false, true),
+		},
+		{
+			name:    "CALL and RET",
+			program: []uint8{0xCD, 0x00, 0x02, 0x00},
+			steps:   3,
+			setup:   func(c *emu.CPU, m *flatMemory) { m[0x0200] = 0x3C; m[0x0201] = 0xC9 },
+			check: func(c *emu.CPU, m *flatMemory) bool {
+				return c.PC == 0x0103 && c.SP == 0xFFFE && c.A == 0x02 && m[0xFFFC] == 0x03 && m[0xFFFD] == 0x01
+			},
+			cycles: 24 + 4 + 16,
+		},
+		{
+			name:    "CALL NC not taken, RET Z taken",
+			program: []uint8{0x37, 0xD4, 0x00, 0x02, 0xAF, 0xC8},
+			steps:   4,
+			setup:   func(c *emu.CPU, m *flatMemory) { c.SP = 0xD000; m[0xD000] = 0x34; m[0xD001] = 0x12 },
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.PC == 0x1234 },
+			flags:   flags(true, false, false, false),
+			cycles:  4 + 12 + 4 + 20,
+		},
+		{
+			name:    "RST 38h",
+			program: []uint8{0xFF},
+			steps:   1,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.PC == 0x0038 && c.SP == 0xFFFC },
+			cycles:  16,
+		},
+		{
+			name:    "PUSH BC, POP AF masks F",
+			program: []uint8{0x01, 0xFF, 0x12, 0xC5, 0xF1},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x12 },
+			flags:   0xF0,
+			cycles:  12 + 16 + 12,
+		},
+		{
+			name:    "LDH and LD (C)",
+			program: []uint8{0x3E, 0x77, 0xE0, 0x80, 0x0E, 0x80, 0xF2},
+			steps:   4,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return m[0xFF80] == 0x77 && c.A == 0x77 },
+			cycles:  8 + 12 + 8 + 8,
+		},
+		{
+			name:    "CB SWAP A",
+			program: []uint8{0x3E, 0xA5, 0xCB, 0x37},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.A == 0x5A },
+			cycles:  16,
+		},
+		{
+			name:    "CB SRA keeps the sign",
+			program: []uint8{0x06, 0x81, 0xCB, 0x28},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.B == 0xC0 },
+			flags:   flags(false, false, false, true),
+		},
+		{
+			name:    "CB SLA to zero",
+			program: []uint8{0x0E, 0x80, 0xCB, 0x21},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.C == 0 },
+			flags:   flags(true, false, false, true),
+		},
+		{
+			name:    "CB BIT 7,(HL)",
+			program: []uint8{0x21, 0x00, 0xC0, 0xCB, 0x7E},
+			steps:   2,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return true },
+			flags:   flags(true, false, true, false),
+			cycles:  12 + 12,
+		},
+		{
+			name:    "CB SET 3,(HL) and RES 0,(HL)",
+			program: []uint8{0x21, 0x00, 0xC0, 0x36, 0x01, 0xCB, 0xDE, 0xCB, 0x86},
+			steps:   4,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return m[0xC000] == 0x08 },
+			cycles:  12 + 12 + 16 + 16,
+		},
+		{
+			name:    "illegal opcode locks the CPU",
+			program: []uint8{0xD3, 0x3C},
+			steps:   3,
+			check:   func(c *emu.CPU, m *flatMemory) bool { return c.Locked && c.PC == 0x0101 && c.A == 0x01 },
+		},
+	}
+
+	for _, tc := range tests {
+		cpu, mem := newTestCPU(tc.program...)
+		if tc.setup != nil {
+			tc.setup(cpu, mem)
+		}
+		cycles := run(cpu, tc.steps)
+		if !tc.check(cpu, mem) {
+			t.Errorf("%s: unexpected state %+v", tc.name, cpu.Registers)
+		}
+		if cpu.F != tc.flags {
+			t.Errorf("%s: flags %08b, want %08b", tc.name, cpu.F, tc.flags)
+		}
+		if tc.cycles != 0 && cycles != tc.cycles {
+			t.Errorf("%s: took %d cycles, want %d", tc.name, cycles, tc.cycles)
+		}
+	}
+}
+
+func TestCPUInterrupts(t *testing.T) {
+	// EI; NOP; NOP with a pending timer interrupt: dispatched after the instruction following EI
+	cpu, mem := newTestCPU(0xFB, 0x00, 0x00)
+	mem[emu.AddrIE] = emu.IntTimer | emu.IntVBlank
+	mem[emu.AddrIF] = emu.IntTimer
+	run(cpu, 2)
+	if cpu.PC != 0x0102 || !cpu.IME {
+		t.Fatalf("interrupt dispatched too early, PC %04x", cpu.PC)
+	}
+	if cycles := cpu.Step(); cycles != 20 || cpu.PC != 0x0050 || cpu.IME || mem[emu.AddrIF] != 0 {
+		t.Errorf("timer interrupt: PC %04x, IME %v, IF %02x, %d cycles", cpu.PC, cpu.IME, mem[emu.AddrIF], cycles)
+	}
+
+	// VBlank has priority over the timer, RETI enables the interrupts again
+	cpu, mem = newTestCPU(0x00)
+	cpu.IME = true
+	mem[0x0040] = 0xD9
+	mem[emu.AddrIE] = 0x1F
+	mem[emu.AddrIF] = emu.IntTimer | emu.IntVBlank
+	run(cpu, 2)
+	if cpu.PC != 0x0100 || !cpu.IME || mem[emu.AddrIF] != emu.IntTimer {
+		t.Errorf("vblank interrupt: PC %04x, IME %v, IF %02x", cpu.PC, cpu.IME, mem[emu.AddrIF])
+	}
+}
+
+func TestCPUHalt(t *testing.T) {
+	// HALT waits for an interrupt even with IME disabled, then continues after HALT
+	cpu, mem := newTestCPU(0x76, 0x3C)
+	mem[emu.AddrIE] = emu.IntSerial
+	run(cpu, 10)
+	if !cpu.Halted || cpu.A != 0x01 {
+		t.Fatal("CPU should be halted")
+	}
+	mem[emu.AddrIF] = emu.IntSerial
+	run(cpu, 1)
+	if cpu.Halted || cpu.A != 0x02 {
+		t.Errorf("CPU should resume after HALT, A %02x", cpu.A)
+	}
+
+	// HALT bug: with IME disabled and an interrupt pending the next byte is read twice
+	cpu, mem = newTestCPU(0x76, 0x3C)
+	mem[emu.AddrIE] = emu.IntSerial
+	mem[emu.AddrIF] = emu.IntSerial
+	run(cpu, 3)
+	if cpu.A != 0x03 || cpu.PC != 0x0102 {
+		t.Errorf("HALT bug: A %02x, PC %04x", cpu.A, cpu.PC)
+	}
+
+	// STOP waits for a joypad interrupt
+	cpu, mem = newTestCPU(0x10, 0x00, 0x3C)
+	run(cpu, 5)
+	if !cpu.Stopped || cpu.PC != 0x0102 {
+		t.Fatal("CPU should be stopped")
+	}
+	mem[emu.AddrIF] = emu.IntJoypad
+	run(cpu, 1)
+	if cpu.Stopped || cpu.A != 0x02 {
+		t.Error("CPU should resume after a joypad interrupt")
+	}
+}
+
+func TestCPUAllOpcodes(t *testing.T) {
+	illegal := map[uint8]bool{0xD3: true, 0xDB: true, 0xDD: true, 0xE3: true, 0xE4: true, 0xEB: true, 0xEC: true, 0xED: true, 0xF4: true, 0xFC: true, 0xFD: true}
+	for op := 0; op < 0x200; op++ {
+		var cpu *emu.CPU
+		if op < 0x100 {
+			cpu, _ = newTestCPU(uint8(op), 0x00, 0x00)
+		} else {
+			cpu, _ = newTestCPU(0xCB, uint8(op))
+		}
+		cycles := cpu.Step()
+		if cycles < 4 || cycles > 24 || cycles%4 != 0 {
+			t.Errorf("opcode %03x took %d cycles", op, cycles)
+		}
+		if op < 0x100 && cpu.Locked != illegal[uint8(op)] {
+			t.Errorf("opcode %02x: locked %v", op, cpu.Locked)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/dat"
+)
+
+func testDAT(rom []byte) string {
+	h := cartridge.HashBytes(rom)
+	return fmt.Sprintf(`<?xml version="1.0"?>
+<datafile>
+	<header><name>Nintendo - Game Boy</name><version>20240101</version></header>
+	<game name="Homebrew (USA, Europe) (Rev 1)">
+		<description>Homebrew (USA, Europe) (Rev 1)</description>
+		<rom name="Homebrew (USA, Europe) (Rev 1).gb" size="%d" crc="%s" md5="%s" sha1="%s" status="verified"/>
+	</game>
+	<game name="Other (Japan)">
+		<rom name="Other (Japan).gb" size="32768" crc="00000000" sha1="0000000000000000000000000000000000000000"/>
+	</game>
+</datafile>`, len(rom), strings.ToUpper(h.CRC32), strings.ToUpper(h.MD5), strings.ToUpper(h.SHA1))
+}
+
+func TestDATVerify(t *testing.T) {
+	rom := generatedROM(t, testrom.Options{Title: "HOMEBREW", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+	d, err := dat.Parse(strings.NewReader(testDAT(rom)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Header.Name != "Nintendo - Game Boy" || len(d.Games) != 2 {
+		t.Errorf("Unexpected DAT %+v", d.Header)
+	}
+
+	c, err := cartridge.CartridgeFromBytes(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := d.Verify(c)
+	if !res.Matched() || res.Level != dat.FullMatch {
+		t.Fatalf("Expected a full match, got %v", res.Level)
+	}
+	if res.Game != "Homebrew (USA, Europe) (Rev 1)" || res.Region != "USA, Europe" || res.Revision != "Rev 1" {
+		t.Errorf("Unexpected result %+v", res)
+	}
+
+	rom[0x7000] ^= 0xFF // a bad dump
+	if res := d.VerifyBytes(rom); res.Matched() {
+		t.Error("A modified ROM must not match")
+	}
+}
+
+func TestDATMatchLevels(t *testing.T) {
+	rom := generatedROM(t, testrom.Options{Title: "HOMEBREW", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+	h := cartridge.HashBytes(rom)
+	entry := func(attrs string) *dat.DAT {
+		d, err := dat.Parse(strings.NewReader(`<datafile><game name="Homebrew (USA)">` +
+			`<rom name="Homebrew (USA).gb" size="65536" ` + attrs + `/></game></datafile>`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	cases := []struct {
+		attrs   string
+		level   dat.MatchLevel
+		matched bool
+	}{
+		{fmt.Sprintf(`crc="%s"`, h.CRC32), dat.CRC32Match, true},
+		{fmt.Sprintf(`sha1="%s"`, h.SHA1), dat.FullMatch, true},
+		{fmt.Sprintf(`crc="%s" sha1="%s"`, h.CRC32, h.SHA1), dat.FullMatch, true},
+		// Same CRC32 but a different dump, as a forged or colliding ROM would have
+		{fmt.Sprintf(`crc="%s" md5="00000000000000000000000000000000"`, h.CRC32), dat.HashMismatch, false},
+		{fmt.Sprintf(`crc="%s" sha1="%s" md5="00000000000000000000000000000000"`, h.CRC32, h.SHA1), dat.HashMismatch, false},
+	}
+	for _, c := range cases {
+		res := entry(c.attrs).VerifyBytes(rom)
+		if res.Level != c.level || res.Matched() != c.matched {
+			t.Errorf("%s: expected %v (matched %v), got %v (matched %v)", c.attrs, c.level, c.matched, res.Level, res.Matched())
+		}
+	}
+}
+
+func TestParseNoIntroName(t *testing.T) {
+	cases := []struct{ name, region, revision string }{
+		{"Tetris (World) (Rev 1)", "World", "Rev 1"},
+		{"Pokemon - Red Version (USA, Europe) (SGB Enhanced)", "USA, Europe", ""},
+		{"Dr. Mario (World) (Rev A)", "World", "Rev A"},
+		{"Some Game (Japan) (v1.1) (Proto)", "Japan", "v1.1"},
+	}
+	for _, c := range cases {
+		region, revision := dat.ParseName(c.name)
+		if region != c.region || revision != c.revision {
+			t.Errorf("%q: got region %q revision %q", c.name, region, revision)
+		}
+	}
+}
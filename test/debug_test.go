@@ -0,0 +1,144 @@
+package test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/debug"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func newTestDebugger(t *testing.T) *debug.Debugger {
+	c, p := assembleProgram(t, cartridge.RomOnly, cartridge.None, `
+	ld a, 3
+	call Double
+.store
+	ld [wValue], a
+	inc a
+	jr .store
+
+SECTION "Double", ROM0[$0160]
+Double:
+	add a, a
+	ret
+
+SECTION "Variables", WRAM0[$C000]
+wValue: ds 1
+`)
+	gb, err := emu.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return debug.New(gb, p.Symbols)
+}
+
+// exec runs the debugger commands, returning the output of the last one
+func exec(t *testing.T, d *debug.Debugger, lines ...string) string {
+	t.Helper()
+	var out bytes.Buffer
+	for _, line := range lines {
+		out.Reset()
+		if err := d.Exec(line, &out); err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+	}
+	return out.String()
+}
+
+func TestDebugger(t *testing.T) {
+	d := newTestDebugger(t)
+	cpu := d.GB.CPU
+
+	out := exec(t, d, "break Main", "continue")
+	if cpu.PC != 0x150 || !strings.Contains(out, "stopped: breakpoint 1") || !strings.Contains(out, "Main:") {
+		t.Fatalf("should stop at Main, PC %04X:\n%s", cpu.PC, out)
+	}
+
+	out = exec(t, d, "next", "")
+	if cpu.PC != 0x155 || cpu.A != 6 {
+		t.Errorf("next should step over the call, PC %04X A %02X", cpu.PC, cpu.A)
+	}
+	if !strings.Contains(out, "ld [wValue], a") {
+		t.Errorf("operands should use labels:\n%s", out)
+	}
+
+	out = exec(t, d, "watch wValue", "continue")
+	if cpu.PC != 0x158 || !strings.Contains(out, "watchpoint 2: write $06 at $C000") {
+		t.Errorf("should stop after writing wValue, PC %04X:\n%s", cpu.PC, out)
+	}
+
+	exec(t, d, "delete 2", "break if a == 9 && [wValue] == 8", "continue")
+	if cpu.PC != 0x159 || cpu.A != 9 {
+		t.Errorf("should stop when the condition is true, PC %04X A %02X", cpu.PC, cpu.A)
+	}
+
+	out = exec(t, d, "set a $10", "set [wValue] 2 * $55", "print a + 1")
+	if out != "17 ($11)\n" || d.GB.Bus.Peek(0xC000) != 0xAA {
+		t.Errorf("set should change registers and memory: %q", out)
+	}
+	if out = exec(t, d, "x wValue 2"); out != "C000: AA 00\n" {
+		t.Errorf("unexpected memory dump %q", out)
+	}
+	if out = exec(t, d, "dis Double 2"); !strings.Contains(out, "Double:\n   00:0160  87      add a, a\n") {
+		t.Errorf("unexpected disassembly:\n%s", out)
+	}
+	if out = exec(t, d, "info"); out != "1 break 00:0150 <Main>\n3 break if a == 9 && [wValue] == 8\n" {
+		t.Errorf("unexpected breakpoints %q", out)
+	}
+
+	if err := d.Exec("quit", io.Discard); err != io.EOF {
+		t.Errorf("quit should return io.EOF, got %v", err)
+	}
+	if err := d.Exec("break nowhere", io.Discard); err == nil {
+		t.Error("unknown labels should be rejected")
+	}
+}
+
+// TestReadWatchpoints checks that only the data reads of the instructions stop, not the opcode
+// fetches nor the interrupt checks of every step
+func TestReadWatchpoints(t *testing.T) {
+	d := newTestDebugger(t)
+	cpu := d.GB.CPU
+
+	out := exec(t, d, "watch r FF0F", "watch r Double", "watch r FFFD", "continue")
+	if cpu.PC != 0x155 || !strings.Contains(out, "watchpoint 3: read $01 at $FFFD") {
+		t.Errorf("should stop when RET reads the return address, PC %04X:\n%s", cpu.PC, out)
+	}
+}
+
+func TestExpr(t *testing.T) {
+	gb := newProgramGameBoy(t, "")
+	gb.CPU.A, gb.CPU.F = 3, emu.FlagZ
+	gb.CPU.SetHL(0xC000)
+	gb.Bus.Write(0xC000, 0x42)
+
+	cases := map[string]int{
+		"(a + 1) * 2":        8,
+		"a + 1 * 2":          5,
+		"$10 | %0011 ^ 0x1":  0x12,
+		"[hl] == $42 && zf":  1,
+		"!cf || 1 / 0":       1,
+		"hl >> 8":            0xC0,
+		"~0 & $FF":           0xFF,
+		"pc == $100 && !ime": 1,
+	}
+	for src, expected := range cases {
+		e, err := debug.ParseExpr(src, nil)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if v := e.Eval(gb); v != expected {
+			t.Errorf("%s = %d, expected %d", src, v, expected)
+		}
+	}
+
+	for _, src := range []string{"a +", "(a", "[hl", "a ? 1", "unknown"} {
+		if _, err := debug.ParseExpr(src, nil); err == nil {
+			t.Errorf("%s should be rejected", src)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/asm"
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/disasm"
+)
+
+func decode(addr uint16, code ...uint8) disasm.Instruction {
+	return disasm.Decode(func(a uint16) uint8 {
+		if i := int(a - addr); i < len(code) {
+			return code[i]
+		}
+		return 0
+	}, addr)
+}
+
+func TestDisassemble(t *testing.T) {
+	cases := []struct {
+		code []uint8
+		text string
+		flow disasm.Flow
+	}{
+		{[]uint8{0x00}, "nop", disasm.FlowNext},
+		{[]uint8{0x3E, 0x10}, "ld a, $10", disasm.FlowNext},
+		{[]uint8{0x01, 0x34, 0x12}, "ld bc, $1234", disasm.FlowNext},
+		{[]uint8{0xEA, 0x00, 0xC0}, "ld [$C000], a", disasm.FlowNext},
+		{[]uint8{0xE0, 0x44}, "ldh [$FF44], a", disasm.FlowNext},
+		{[]uint8{0xF2}, "ldh a, [c]", disasm.FlowNext},
+		{[]uint8{0x22}, "ld [hl+], a", disasm.FlowNext},
+		{[]uint8{0x86}, "add a, [hl]", disasm.FlowNext},
+		{[]uint8{0xFE, 0x90}, "cp $90", disasm.FlowNext},
+		{[]uint8{0xCB, 0x7C}, "bit 7, h", disasm.FlowNext},
+		{[]uint8{0xCB, 0x37}, "swap a", disasm.FlowNext},
+		{[]uint8{0xF8, 0xFD}, "ld hl, sp-3", disasm.FlowNext},
+		{[]uint8{0xE8, 0x05}, "add sp, 5", disasm.FlowNext},
+		{[]uint8{0x10, 0x00}, "stop", disasm.FlowNext},
+		{[]uint8{0x18, 0xFE}, "jr $0200", disasm.FlowJump},
+		{[]uint8{0x20, 0x02}, "jr nz, $0204", disasm.FlowCondJump},
+		{[]uint8{0xC4, 0x34, 0x12}, "call nz, $1234", disasm.FlowCondCall},
+		{[]uint8{0xFF}, "rst $38", disasm.FlowCall},
+		{[]uint8{0xD8}, "ret c", disasm.FlowCondReturn},
+		{[]uint8{0xD9}, "reti", disasm.FlowReturn},
+		{[]uint8{0xE9}, "jp hl", disasm.FlowIndirect},
+		{[]uint8{0xD3}, "db $D3", disasm.FlowInvalid},
+	}
+	for _, c := range cases {
+		in := decode(0x200, c.code...)
+		if in.String() != c.text || in.Flow != c.flow || in.Len() != len(c.code) {
+			t.Errorf("% X: got %q (flow %d, %d bytes), expected %q (flow %d)", c.code, in, in.Flow, in.Len(), c.text, c.flow)
+		}
+	}
+
+	in := decode(0x150, 0xCD, 0x00, 0x40)
+	label := func(addr uint16) string {
+		if addr == 0x4000 {
+			return "Func"
+		}
+		return ""
+	}
+	if in.Format(label) != "call Func" || in.Target != 0x4000 || in.Next() != 0x153 {
+		t.Errorf("call should use the label: %q, target %04X", in.Format(label), in.Target)
+	}
+}
+
+func TestSymbols(t *testing.T) {
+	syms, err := disasm.ParseSymbols(strings.NewReader(`; File generated by rgblink
+00:0150 Main
+00:0150 Main.alias
+01:4000 Bank1Func
+00:c000 wValue
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if syms.Name(0, 0x150) != "Main" || syms.Name(1, 0x150) != "" || syms.Name(0, 0xC000) != "wValue" {
+		t.Error("names should match the bank and the first label of the address")
+	}
+	if sym, ok := syms.Nearest(1, 0x4005); !ok || sym.Name != "Bank1Func" {
+		t.Errorf("nearest label of 01:4005 should be Bank1Func, got %v", sym)
+	}
+	if _, ok := syms.Nearest(2, 0x4005); ok {
+		t.Error("labels of other banks should not be the nearest")
+	}
+	if sym, ok := syms.Lookup("Main.alias"); !ok || sym.Addr != 0x150 {
+		t.Errorf("lookup should find local labels, got %v", sym)
+	}
+
+	if _, err := disasm.ParseSymbols(strings.NewReader("0150 Main\n")); err == nil {
+		t.Error("labels without a bank should be rejected")
+	}
+	var none *disasm.Symbols
+	if none.Name(0, 0x150) != "" {
+		t.Error("nil symbols should have no labels")
+	}
+}
+
+// newDisasmCartridge returns a MBC1 cartridge calling a routine in bank 2 and another in bank 3
+func newDisasmCartridge(t *testing.T) *cartridge.Cartridge {
+	t.Helper()
+	c, err := asm.BuildROM(`
+SECTION "VBlank", ROM0[$0040]
+VBlankInterrupt:
+	reti
+
+SECTION "LCDC", ROM0[$0048]
+LCDCInterrupt:
+	call $4000 ; bank unknown
+	reti
+
+SECTION "Entry", ROM0[$0100]
+	nop
+	jp Main
+	ds $150 - @, 0
+
+SECTION "Main", ROM0[$0150]
+Main:
+	ld a, 2
+	ld [$2000], a
+	call FarLoad
+	ld hl, $2000
+	ld [hl], 3
+	call FarTest
+	jr Main
+	db $C3 ; data
+
+SECTION "Bank 2", ROMX[$4000], BANK[2]
+FarLoad:
+	ld a, $11
+	ret
+
+SECTION "Bank 3", ROMX[$4000], BANK[3]
+FarTest:
+	jr z, .done
+	ret
+.done
+	ret
+`, asm.Header{Title: "DISASM", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestAnalyze(t *testing.T) {
+	d := disasm.Analyze(newDisasmCartridge(t), nil)
+
+	code := []struct {
+		bank int
+		addr uint16
+		code bool
+	}{
+		{0, 0x100, true}, {0, 0x101, true}, {0, 0x104, false}, {0, 0x150, true}, {0, 0x164, false},
+		{1, 0x4000, false}, {2, 0x4000, true}, {2, 0x4002, true}, {2, 0x4003, false},
+		{3, 0x4000, true}, {3, 0x4002, true}, {3, 0x4003, true},
+	}
+	for _, c := range code {
+		if d.IsCode(c.bank, c.addr) != c.code {
+			t.Errorf("%02X:%04X should be code: %v", c.bank, c.addr, c.code)
+		}
+	}
+	if len(d.Unresolved) != 1 || d.Unresolved[0] != (disasm.Branch{Bank: 0, Addr: 0x48, Target: 0x4000}) {
+		t.Errorf("the call of the interrupt should be unresolved, got %v", d.Unresolved)
+	}
+
+	var out bytes.Buffer
+	if err := d.WriteRGBDS(&out); err != nil {
+		t.Fatal(err)
+	}
+	src := out.String()
+	for _, s := range []string{
+		"SECTION \"ROM Bank $000\", ROM0[$0000]\n",
+		"\nBoot:\n\tnop\n\tjp Jump_000_0150\n",
+		"\tld [$2000], a\n\tcall Call_002_4000\n",
+		"\tld [hl], $03\n\tcall Call_003_4000\n\tjr Jump_000_0150\n\tdb $C3, $FF",
+		"\tcall $4000\n\treti\n",
+		"SECTION \"ROM Bank $001\", ROMX[$4000], BANK[$1]\n\tdb $FF, $FF, $FF, $FF, $FF, $FF, $FF, $FF\n",
+		"\nCall_002_4000:\n\tld a, $11\n\tret\n\tdb $FF",
+		"\nCall_003_4000:\n\tjr z, Jump_003_4003\n\tret\n\nJump_003_4003:\n\tret\n",
+	} {
+		if !strings.Contains(src, s) {
+			t.Errorf("disassembly should contain %q", s)
+		}
+	}
+}
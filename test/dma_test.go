@@ -0,0 +1,39 @@
+package test
+
+import "testing"
+
+func TestOAMDMA(t *testing.T) {
+	bus := newTestGameBoy(t).Bus
+	for i := uint16(0); i < 0xA0; i++ {
+		bus.Write(0xC100+i, uint8(i))
+	}
+	bus.Write(0xFF80, 0x42)
+
+	bus.Write(0xFF46, 0xC1)
+	if !bus.DMA.Active() || bus.Read(0xFF46) != 0xC1 {
+		t.Fatal("writing FF46 should start a transfer")
+	}
+	bus.DMA.Tick(4 + 4*0x10)
+	if bus.PPU.OAM[0x0F] != 0x0F || bus.PPU.OAM[0x10] != 0x00 {
+		t.Error("DMA should copy a byte per M-cycle after the startup")
+	}
+
+	// Bus conflicts
+	if v := bus.Read(0xFE00); v != 0xFF {
+		t.Errorf("OAM should read FF during the transfer, read %02x", v)
+	}
+	if v := bus.Read(0x0000); v != 0x10 {
+		t.Errorf("external bus should read the byte being transferred, read %02x", v)
+	}
+	if v := bus.Read(0xFF80); v != 0x42 {
+		t.Errorf("HRAM should be accessible, read %02x", v)
+	}
+	if bus.Read(0x8000) != 0x00 {
+		t.Error("video bus should be accessible when copying from WRAM")
+	}
+
+	bus.DMA.Tick(4 * 0x90)
+	if bus.DMA.Active() || bus.PPU.OAM[0x9F] != 0x9F || bus.Read(0xFE9F) != 0x9F {
+		t.Error("DMA should copy 160 bytes")
+	}
+}
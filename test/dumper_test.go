@@ -0,0 +1,113 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+func TestGeneratedROMs(t *testing.T) {
+	cases := []testrom.Options{
+		{CartridgeType: cartridge.None, ROMSize: cartridge.ROM32KB},
+		{CartridgeType: cartridge.MBC1RAMBattery, ROMSize: cartridge.ROM2MB, RAMSize: cartridge.RAM32KB},
+		{CartridgeType: cartridge.MBC2Battery, ROMSize: cartridge.ROM256KB},
+		{CartridgeType: cartridge.MBC3TimerRAMBattery, ROMSize: cartridge.ROM2MB, RAMSize: cartridge.RAM32KB},
+		{CartridgeType: cartridge.MBC5RAMBattery, ROMSize: cartridge.ROM8MB, RAMSize: cartridge.RAM128KB, CGBFlag: 0xC0},
+	}
+	for _, o := range cases {
+		c, err := testrom.New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := c.Header.CartridgeTypeText()
+		if len(c.ROMBanks) != c.Header.GetNumROMBanks() {
+			t.Errorf("%s: expected %d banks, got %d", name, c.Header.GetNumROMBanks(), len(c.ROMBanks))
+		}
+		if r := c.ValidationReport(); !r.OK() {
+			var buf bytes.Buffer
+			r.Write(&buf)
+			t.Errorf("%s: generated ROM should be valid:\n%s", name, buf.String())
+		}
+		if err := testrom.Check(c); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if last := len(c.ROMBanks) - 1; testrom.BankID(c.ROMBanks[last]) != last {
+			t.Errorf("%s: last bank should be identified as %d", name, last)
+		}
+	}
+
+	if _, err := testrom.New(testrom.Options{ROMSize: 0x42}); err == nil {
+		t.Error("unknown ROM sizes should fail")
+	}
+}
+
+func TestDumper(t *testing.T) {
+	cases := []testrom.Options{
+		{CartridgeType: cartridge.None, ROMSize: cartridge.ROM32KB},
+		{CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM2MB}, // banks 20, 40 and 60
+		{CartridgeType: cartridge.MBC2, ROMSize: cartridge.ROM256KB},
+		{CartridgeType: cartridge.MBC3RAMBattery, ROMSize: cartridge.ROM2MB, RAMSize: cartridge.RAM32KB},
+		{CartridgeType: cartridge.MBC5, ROMSize: cartridge.ROM8MB}, // 9th bank bit
+	}
+	for _, o := range cases {
+		c, err := testrom.New(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := testrom.NewProxy(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := cartridge.NewDumper(p)
+		d.SetLogOutput(ioutil.Discard)
+		dump, err := d.ReadCartridge()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		name := c.Header.CartridgeTypeText()
+		if len(dump.ROMBanks) != len(c.ROMBanks) {
+			t.Fatalf("%s: expected %d banks, got %d", name, len(c.ROMBanks), len(dump.ROMBanks))
+		}
+		for b, bank := range dump.ROMBanks {
+			if err := testrom.CheckBank(b, bank); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if err := dump.Validate(); err != nil || !bytes.Equal(dump.Bytes(), c.Bytes()) {
+			t.Errorf("%s: dump should match the ROM: %v", name, err)
+		}
+	}
+}
+
+func TestProxySRAM(t *testing.T) {
+	c, err := testrom.New(testrom.Options{CartridgeType: cartridge.MBC1RAMBattery, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.RAM32KB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := testrom.NewProxy(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := make([]uint8, 32*1024)
+	for i := range save {
+		save[i] = uint8(i / cartridge.RAMBankSize * 0x11)
+	}
+	if err := cartridge.WriteSRAM(p, c.Header, save); err != nil {
+		t.Fatal(err)
+	}
+	if c.RAMBanks[3][0] != 0x33 {
+		t.Errorf("bank 3 should be written to the cartridge RAM, got %02X", c.RAMBanks[3][0])
+	}
+	read, err := cartridge.ReadSRAM(p, c.Header)
+	if err != nil || !bytes.Equal(read, save) {
+		t.Errorf("read save should match the written one: %v", err)
+	}
+	if p.MBC.ROMBank() != 1 {
+		t.Errorf("MBC should map bank 1 after the RAM access, got %d", p.MBC.ROMBank())
+	}
+}
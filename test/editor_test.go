@@ -0,0 +1,80 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+func TestHeaderEditorFixesChecksums(t *testing.T) {
+	c := generatedCartridge(t, testrom.Options{Title: "HOMEBREW", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+
+	c.ROMBanks[2][0x10] = 0xAB // a patch that breaks the global checksum
+	err := c.EditHeader().
+		SetCGBMode(cartridge.CGBEnhanced).
+		SetTitle("MY GAME").
+		SetSGB(true).
+		SetLicensee("01").
+		SetCartridgeType(cartridge.MBC5RAMBattery).
+		SetROMSize(cartridge.ROM128KB).
+		SetRAMSize(cartridge.RAM32KB).
+		SetVersion(1).
+		Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.ROMBanks) != 8 || c.ROMBanks[7][0] != cartridge.ROMPadding {
+		t.Errorf("ROM was not padded to 8 banks (%d)", len(c.ROMBanks))
+	}
+	if c.Header.TitleText() != "MY GAME" || c.Header.CGBMode() != cartridge.CGBEnhanced || !c.Header.SupportsSGB() {
+		t.Errorf("Unexpected header %+v", c.Header.Info())
+	}
+	if c.Header.Licensee().Code != "01" || !c.Header.IsMBC5() || c.Header.RAMSizeBytes() != 32*1024 {
+		t.Errorf("Unexpected header %+v", c.Header.Info())
+	}
+
+	fname := filepath.Join(t.TempDir(), "fixed.gb")
+	if err := c.Save(fname); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := cartridge.NewFileROMReader(fname).ReadCartridge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := saved.Header.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := saved.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHeaderEditorErrors(t *testing.T) {
+	c := generatedCartridge(t, testrom.Options{Title: "HOMEBREW", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+
+	if err := c.EditHeader().SetTitle("THIS TITLE IS TOO LONG").Apply(); err == nil {
+		t.Error("Expected an error for a long title")
+	}
+	if err := c.EditHeader().SetROMSize(0x42).Apply(); err == nil {
+		t.Error("Expected an error for an unknown ROM size")
+	}
+	if err := c.EditHeader().SetTitle("SIXTEEN CHARS OK").SetCGBFlag(cartridge.CGBEnhancedFlag).Apply(); err == nil {
+		t.Error("Expected an error for a CGB flag over the last title character")
+	}
+	if err := c.EditHeader().SetCGBMode(cartridge.CGBOnly).SetTitle("SIXTEEN CHARS OK").Apply(); err == nil {
+		t.Error("Expected an error for a 16 character title with the CGB flag set")
+	}
+	if c.Header.TitleText() != "HOMEBREW" {
+		t.Error("A failed edit must not modify the cartridge")
+	}
+
+	if err := c.EditHeader().SetROMSize(cartridge.ROM32KB).Apply(); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.ROMBanks) != 2 || c.Validate() != nil {
+		t.Errorf("ROM was not truncated to 2 banks (%d)", len(c.ROMBanks))
+	}
+}
@@ -0,0 +1,87 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+// Run with: go test ./test -run '^$' -fuzz FuzzROMHeaderFromBytes
+
+func fuzzSeeds(f *testing.F) {
+	f.Add([]byte{})
+	f.Add(make([]byte, 0x14F))
+	f.Add(generatedHeader(f, testrom.Options{Title: "SEED", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM32KB, RAMSize: cartridge.None}))
+
+	rom := make([]byte, 2*cartridge.ROMBankSize)
+	copy(rom, generatedHeader(f, testrom.Options{Title: "SEED", CartridgeType: cartridge.RomOnly, ROMSize: cartridge.ROM32KB, RAMSize: cartridge.None}))
+	f.Add(rom)
+}
+
+func FuzzROMHeaderFromBytes(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		h, err := cartridge.ROMHeaderFromBytes(data)
+		if err != nil {
+			return
+		}
+		h.Validate()
+		h.Info()
+		h.CartridgeTypeText()
+	})
+}
+
+func FuzzCartridgeFromBytes(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c, err := cartridge.CartridgeFromBytes(data)
+		if err != nil {
+			return
+		}
+		if len(c.ROMBanks) != c.Header.GetNumROMBanks() {
+			t.Errorf("Expected %d banks got %d", c.Header.GetNumROMBanks(), len(c.ROMBanks))
+		}
+		c.Validate()
+	})
+}
+
+func FuzzFileROMReader(f *testing.F) {
+	fuzzSeeds(f)
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fname := filepath.Join(dir, "fuzz.gb")
+		if err := os.WriteFile(fname, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		frr := cartridge.NewFileROMReader(fname)
+		if _, err := frr.ReadCartridge(); err != nil {
+			return
+		}
+	})
+}
+
+func TestTruncatedROMReturnsError(t *testing.T) {
+	rom := make([]byte, 40*1024)
+	copy(rom, generatedHeader(t, testrom.Options{Title: "SHORT", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None}))
+
+	_, err := cartridge.CartridgeFromBytes(rom)
+	if err == nil || !strings.Contains(err.Error(), "file is 40KB but header declares 64KB") {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if _, err := cartridge.ROMHeaderFromBytes(rom[:0x100]); err == nil {
+		t.Error("Expected an error parsing a header with only 0x100 bytes")
+	}
+
+	fname := filepath.Join(t.TempDir(), "short.gb")
+	if err := os.WriteFile(fname, rom[:0x120], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cartridge.NewFileROMReader(fname).ReadHeader(); err == nil {
+		t.Error("Expected an error reading a truncated file")
+	}
+}
@@ -0,0 +1,129 @@
+package test
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+)
+
+// rspClient is a scripted GDB remote serial protocol client
+type rspClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// call sends a packet and returns the payload of the reply
+func (c *rspClient) call(data string) string {
+	c.t.Helper()
+	var sum uint8
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	if _, err := fmt.Fprintf(c.conn, "$%s#%02x", data, sum); err != nil {
+		c.t.Fatal(err)
+	}
+	if ack, err := c.r.ReadByte(); err != nil || ack != '+' {
+		c.t.Fatalf("%s: expected an ack, got %q (%v)", data, ack, err)
+	}
+	return c.reply()
+}
+
+func (c *rspClient) reply() string {
+	c.t.Helper()
+	if start, err := c.r.ReadByte(); err != nil || start != '$' {
+		c.t.Fatalf("expected a packet, got %q (%v)", start, err)
+	}
+	payload, err := c.r.ReadString('#')
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	var sum [2]uint8
+	if _, err := c.r.Read(sum[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	c.conn.Write([]uint8{'+'})
+	return payload[:len(payload)-1]
+}
+
+func TestGDBServer(t *testing.T) {
+	d := newTestDebugger(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	served := make(chan error, 1)
+	go func() { served <- d.ServeGDB(l) }()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := &rspClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+
+	script := []struct{ send, expect string }{
+		{"?", "S05"},
+		{"g", "b0011300d8004d01feff0001"}, // DMG boot values, PC 0100
+		{"Z0,150,1", "OK"},
+		{"c", "T05swbreak:;"},
+		{"p5", "5001"},
+		{"z0,150,1", "OK"},
+		{"s", "S05"},
+		{"p0", "b003"}, // A = 3, flags from the boot ROM
+		{"Z2,c000,1", "OK"},
+		{"c", "T05watch:c000;"},
+		{"mc000,2", "0600"},
+		{"z2,c000,1", "OK"},
+		{"P3=00c0", "OK"},
+		{"Mc000,2:aa55", "OK"},
+		{"mc000,2", "aa55"},
+		{"p3", "00c0"},
+		{"Z3,c000,1", "OK"},
+		{"Z3,ff0f,1", "OK"}, // checked for interrupts every step, but never read by the program
+		{"Z4,158,1", "OK"},  // INC A, fetched but not accessed
+		{"s", "S05"},        // INC A
+		{"s", "S05"},        // JR
+		{"s", "S05"},        // LD (C000),A writes, the read watchpoint does not stop
+		{"z3,c000,1", "OK"},
+		{"z3,ff0f,1", "OK"},
+		{"z4,158,1", "OK"},
+		{"M14000,2:1234", "OK"}, // bank 1 of the ROM
+		{"m4000,2", "1234"},
+		{"M160,1:3c", "OK"}, // patch Double with INC A
+		{"m160,1", "3c"},
+		{"Z9,0,1", ""},
+		{"qSupported:swbreak+", "PacketSize=1000;QStartNoAckMode+;qXfer:features:read+;swbreak+"},
+		{"D", "OK"},
+	}
+	for _, s := range script {
+		if got := c.call(s.send); got != s.expect {
+			t.Fatalf("%s: got %q, expected %q", s.send, got, s.expect)
+		}
+	}
+	if len(d.Breakpoints()) != 0 || len(d.Watchpoints()) != 0 {
+		t.Error("detaching should remove the breakpoints and watchpoints")
+	}
+
+	// A second client interrupts a running target and kills it
+	conn, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c = &rspClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	if got := c.call("QStartNoAckMode"); got != "OK" {
+		t.Fatalf("QStartNoAckMode: got %q", got)
+	}
+	fmt.Fprintf(conn, "$c#63")
+	conn.Write([]uint8{0x03})
+	if got := c.reply(); got != "S02" {
+		t.Fatalf("interrupt: got %q, expected S02", got)
+	}
+	fmt.Fprintf(conn, "$k#6b")
+	if err := <-served; err != nil {
+		t.Errorf("kill should end the server, got %v", err)
+	}
+}
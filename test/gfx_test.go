@@ -0,0 +1,132 @@
+package test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/gfx"
+)
+
+// Tile of the Pan Docs tile data example
+var exampleTile = []uint8{0x3C, 0x7E, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42, 0x7E, 0x5E, 0x7E, 0x0A, 0x7C, 0x56, 0x38, 0x7C}
+
+func TestDecodeTile(t *testing.T) {
+	px := gfx.DecodeTile(exampleTile, gfx.Format2BPP)
+	rows := [][8]uint8{
+		{0, 2, 3, 3, 3, 3, 2, 0},
+		{0, 3, 0, 0, 0, 0, 3, 0},
+		{0, 3, 0, 0, 0, 0, 3, 0},
+		{0, 3, 0, 0, 0, 0, 3, 0},
+		{0, 3, 1, 3, 3, 3, 3, 0},
+		{0, 1, 1, 1, 3, 1, 3, 0},
+		{0, 3, 1, 3, 1, 3, 2, 0},
+		{0, 2, 3, 3, 3, 2, 0, 0},
+	}
+	for y, row := range rows {
+		if px[y] != row {
+			t.Errorf("row %d should be %v, got %v", y, row, px[y])
+		}
+	}
+	if !bytes.Equal(gfx.EncodeTile(px, gfx.Format2BPP), exampleTile) {
+		t.Error("encoded tile should match the original data")
+	}
+
+	font := gfx.DecodeTile([]uint8{0x81, 0, 0, 0, 0, 0, 0, 0xFF}, gfx.Format1BPP)
+	if font[0] != [8]uint8{3, 0, 0, 0, 0, 0, 0, 3} || font[7][4] != 3 || font[1][0] != 0 {
+		t.Errorf("1bpp set bits should be color 3, got %v", font)
+	}
+}
+
+func TestExtractTiles(t *testing.T) {
+	c, err := testrom.New(testrom.Options{CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		copy(c.ROMBanks[2][0x100+i*16:], exampleTile)
+	}
+
+	img, err := gfx.ExtractTiles(c, 2, 0x100, 5, gfx.Options{TilesPerRow: 2, Tall: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tiles 0 and 1 are stacked in the first column, tile 4 starts the second row of cells
+	if img.Bounds().Dx() != 16 || img.Bounds().Dy() != 32 {
+		t.Fatalf("sheet should be 16x32, got %v", img.Bounds())
+	}
+	if img.ColorIndexAt(1, 8) != 2 || img.ColorIndexAt(9, 8) != 2 || img.ColorIndexAt(1, 16) != 2 || img.ColorIndexAt(9, 16) != 0 {
+		t.Error("tiles should be laid out in 8x16 cells")
+	}
+	if img.At(1, 1) != gfx.DefaultPalette[3] {
+		t.Errorf("color 3 should use the default palette, got %v", img.At(1, 1))
+	}
+
+	if _, err := gfx.ExtractTiles(c, 3, 0x3FF0, 2, gfx.Options{}); err == nil {
+		t.Error("tiles past the end of the ROM should fail")
+	}
+	if _, err := gfx.ExtractTiles(c, 1, 0x3FF0, 2, gfx.Options{}); err != nil {
+		t.Errorf("tiles should continue in the next bank: %v", err)
+	}
+}
+
+func TestPatchTiles(t *testing.T) {
+	c, err := testrom.New(testrom.Options{CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	palette, err := gfx.ParsePalette("ffffff,#aaaaaa,555555,000000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []gfx.Format{gfx.Format2BPP, gfx.Format1BPP} {
+		o := gfx.Options{Format: f, Palette: palette, TilesPerRow: 3}
+		original := append([]uint8(nil), c.ROMBanks[1][:4*f.TileSize()]...)
+		img, err := gfx.ExtractTiles(c, 1, 0, 4, o)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Edit the PNG as an RGBA image: the colors are mapped back to the palette
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		edited := image.NewRGBA(decoded.Bounds())
+		draw.Draw(edited, edited.Bounds(), decoded, image.Point{}, draw.Src)
+		edited.Set(0, 0, color.RGBA{0x10, 0x08, 0x00, 0xFF}) // nearly black
+		if err := gfx.PatchTiles(c, 3, 0x200, 4, edited, o); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := append([]uint8(nil), original...)
+		expected[0] |= 0x80
+		if f == gfx.Format2BPP {
+			expected[1] |= 0x80
+		}
+		patched := c.ROMBanks[3][0x200 : 0x200+len(original)]
+		if !bytes.Equal(patched, expected) {
+			t.Errorf("%v: patched tiles should match the edited sheet, got % X", f, patched)
+		}
+		if err := c.Validate(); err != nil {
+			t.Errorf("%v: checksums should be fixed: %v", f, err)
+		}
+	}
+
+	small := image.NewPaletted(image.Rect(0, 0, 8, 8), nil)
+	if err := gfx.PatchTiles(c, 1, 0, 2, small, gfx.Options{}); err == nil {
+		t.Error("sheets smaller than the tiles should fail")
+	}
+	if _, err := gfx.ParsePalette("ffffff,000000"); err == nil {
+		t.Error("palettes should have 4 colors")
+	}
+}
@@ -0,0 +1,140 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"gopkg.in/yaml.v2"
+)
+
+// generatedCartridge returns a cartridge generated by testrom
+func generatedCartridge(t testing.TB, o testrom.Options) *cartridge.Cartridge {
+	t.Helper()
+	c, err := testrom.New(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// generatedROM returns the image of a ROM generated by testrom
+func generatedROM(t testing.TB, o testrom.Options) []uint8 {
+	t.Helper()
+	return generatedCartridge(t, o).Bytes()
+}
+
+// generatedHeader returns the first 0x150 bytes of a ROM generated by testrom
+func generatedHeader(t testing.TB, o testrom.Options) []uint8 {
+	t.Helper()
+	return generatedROM(t, o)[:0x150]
+}
+
+func TestHeaderInfoJSON(t *testing.T) {
+	h, err := cartridge.ROMHeaderFromBytes(generatedHeader(t, testrom.Options{Title: "TETRIS", CartridgeType: cartridge.MBC1RAMBattery, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.RAM8KB}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := h.WriteInfo(&buf, cartridge.FormatJSON); err != nil {
+		t.Fatal(err)
+	}
+
+	var info cartridge.HeaderInfo
+	if err := json.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Title != "TETRIS" {
+		t.Errorf("Title not trimmed: %q", info.Title)
+	}
+	if info.ROMSize != 64*1024 || info.RAMSize != 8*1024 {
+		t.Errorf("Unexpected sizes ROM=%d RAM=%d", info.ROMSize, info.RAMSize)
+	}
+	if info.HeaderChecksum.Valid == nil || !*info.HeaderChecksum.Valid {
+		t.Error("Header checksum should be valid")
+	}
+	if info.GlobalChecksum.Valid != nil {
+		t.Error("Global checksum validity can not be known from the header only")
+	}
+}
+
+func TestHeaderInfoYAMLAndText(t *testing.T) {
+	h, err := cartridge.ROMHeaderFromBytes(generatedHeader(t, testrom.Options{Title: "POKEMON RED", CartridgeType: cartridge.MBC3RAMBattery, ROMSize: cartridge.ROM1MB, RAMSize: cartridge.RAM32KB}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := h.WriteInfo(&buf, cartridge.FormatYAML); err != nil {
+		t.Fatal(err)
+	}
+	var info cartridge.HeaderInfo
+	if err := yaml.Unmarshal(buf.Bytes(), &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Title != "POKEMON RED" || info.ROMBanks != 64 {
+		t.Errorf("Unexpected decoded yaml %+v", info)
+	}
+
+	buf.Reset()
+	if err := h.WriteInfo(&buf, cartridge.FormatText); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Title: POKEMON RED") {
+		t.Errorf("Text output does not contain the title:\n%s", buf.String())
+	}
+
+	if _, err := cartridge.ParseInfoFormat("xml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestHeaderDecoding(t *testing.T) {
+	raw := generatedHeader(t, testrom.Options{Title: "ZELDA", CartridgeType: cartridge.MBC5RAMBattery, ROMSize: cartridge.ROM1_5MB, RAMSize: cartridge.RAM2KB})
+	raw[0x143] = cartridge.CGBEnhancedFlag
+	raw[0x144], raw[0x145] = 'A', '4'
+	raw[0x14B] = cartridge.UseNewLicensee
+	raw[0x14A] = 0x00
+	raw[0x14C] = 0x02
+	h, err := cartridge.ROMHeaderFromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if h.CGBMode() != cartridge.CGBEnhanced || h.IsGBCOnly() || !h.SupportsGBC() {
+		t.Errorf("Unexpected CGB mode %v", h.CGBMode())
+	}
+	if h.GetNumROMBanks() != 96 || h.ROMSizeBytes() != 96*cartridge.ROMBankSize {
+		t.Errorf("Unexpected number of ROM banks %d", h.GetNumROMBanks())
+	}
+	if h.RAMSizeBytes() != 2048 || h.GetNumRAMBanks() != 1 {
+		t.Errorf("Unexpected RAM size %d (%d banks)", h.RAMSizeBytes(), h.GetNumRAMBanks())
+	}
+	if l := h.Licensee(); l.Code != "A4" || l.Name != "Konami (Yu-Gi-Oh!)" {
+		t.Errorf("Unexpected licensee %+v", l)
+	}
+	if h.Destination() != cartridge.Japanese {
+		t.Errorf("Unexpected destination %v", h.Destination())
+	}
+	if h.Version() != 2 {
+		t.Errorf("Unexpected version %d", h.Version())
+	}
+
+	raw[0x143] = cartridge.CGBOnlyFlag
+	raw[0x14B] = 0xA4
+	h, err = cartridge.ROMHeaderFromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.CGBMode() != cartridge.CGBOnly {
+		t.Errorf("Unexpected CGB mode %v", h.CGBMode())
+	}
+	if l := h.Licensee(); l.Code != "A4" || l.Name != "Konami" {
+		t.Errorf("Unexpected old licensee %+v", l)
+	}
+}
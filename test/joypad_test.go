@@ -0,0 +1,67 @@
+package test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func TestJoypad(t *testing.T) {
+	var requested uint8
+	j := emu.NewJoypad(func(i uint8) { requested |= i })
+
+	j.WriteRegister(0x20) // directions
+	j.Press(emu.ButtonA)
+	if v := j.ReadRegister(); v != 0xEF || requested != 0 {
+		t.Errorf("action buttons should not be visible, P1 %02x", v)
+	}
+	j.Press(emu.ButtonDown)
+	if v := j.ReadRegister(); v != 0xE7 || requested != emu.IntJoypad {
+		t.Errorf("down should be read and interrupt, P1 %02x", v)
+	}
+
+	requested = 0
+	j.WriteRegister(0x10) // actions, A goes low
+	if v := j.ReadRegister(); v != 0xDE || requested != emu.IntJoypad {
+		t.Errorf("A should be read and interrupt, P1 %02x", v)
+	}
+}
+
+func TestParseButton(t *testing.T) {
+	b, err := emu.ParseButton("a+B+start")
+	if err != nil || b != emu.ButtonA|emu.ButtonB|emu.ButtonStart || b.String() != "A+B+START" {
+		t.Errorf("ParseButton: %v (%v)", b, err)
+	}
+	if _, err := emu.ParseButton("X"); err == nil {
+		t.Error("X is not a Game Boy button")
+	}
+}
+
+func TestInputScript(t *testing.T) {
+	script, err := emu.ParseInputScript(strings.NewReader(`
+# start the game
+2 press A
+4 release A
+5 tap START 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gb := newTestGameBoy(t)
+	gb.Input = script
+
+	want := []emu.Button{0, 0, emu.ButtonA, emu.ButtonA, 0, emu.ButtonStart, emu.ButtonStart, 0}
+	for frame, w := range want {
+		gb.RunFrame()
+		if got := gb.Bus.Joypad.Pressed(); got != w {
+			t.Errorf("frame %d: pressed %v, want %v", frame, got, w)
+		}
+	}
+
+	for _, bad := range []string{"1 press", "x press A", "1 hold A", "1 tap A 0"} {
+		if _, err := emu.ParseInputScript(strings.NewReader(bad)); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+func TestDecodeLogo(t *testing.T) {
+	b := cartridge.DecodeLogo(expectedNintendoLogo[:])
+	// Top left of the N and the first pixels of the second row
+	if !b[0][0] || !b[0][1] || b[0][2] || !b[1][2] {
+		t.Error("logo should start with the N")
+	}
+	if !bytes.Equal(b.Encode(), expectedNintendoLogo[:]) {
+		t.Error("encoded bitmap should match the logo bytes")
+	}
+
+	ascii := cartridge.LogoASCII(expectedNintendoLogo[:])
+	rows := strings.Split(strings.TrimSuffix(ascii, "\n"), "\n")
+	if len(rows) != cartridge.LogoHeight || len(rows[0]) != cartridge.LogoWidth {
+		t.Fatalf("ASCII logo should be 48x8:\n%s", ascii)
+	}
+	if rows[7] != "##...##.##.##..##.##..#####.##..##..#####..####." || strings.ContainsAny(ascii, "+-") {
+		t.Errorf("genuine logo should not have wrong pixels:\n%s", ascii)
+	}
+	if diffs := cartridge.CompareLogo(expectedNintendoLogo[:]); len(diffs) != 0 {
+		t.Errorf("genuine logo should not differ, got %v", diffs)
+	}
+}
+
+func TestCompareLogo(t *testing.T) {
+	logo := append([]uint8(nil), expectedNintendoLogo[:]...)
+	logo[0] ^= 0x80 // top left pixel missing
+	logo[47] |= 0x01
+	diffs := cartridge.CompareLogo(logo)
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 wrong bits, got %v", diffs)
+	}
+	if d := diffs[0]; d.Offset != 0 || d.Bit != 7 || d.X != 0 || d.Y != 0 || d.Set {
+		t.Errorf("first wrong bit should be the top left pixel, got %+v", d)
+	}
+	if d := diffs[1]; d.X != 47 || d.Y != 7 || !d.Set || d.String() != "$0133 bit 0 (47,7) reads 1" {
+		t.Errorf("second wrong bit should be the bottom right pixel, got %v", d)
+	}
+	ascii := cartridge.LogoASCII(logo)
+	if ascii[0] != '-' || ascii[len(ascii)-2] != '+' {
+		t.Errorf("wrong pixels should be marked:\n%s", ascii)
+	}
+
+	// A disconnected D3 line reads always 1
+	for i := range logo {
+		logo[i] = expectedNintendoLogo[i] | 0x08
+	}
+	lines := cartridge.LogoDataLines(cartridge.CompareLogo(logo))
+	if len(lines) != 1 || lines[0].Line != 3 || !lines[0].Stuck() || lines[0].Cleared != 0 {
+		t.Errorf("D3 should be stuck at 1, got %v", lines)
+	}
+	if !strings.HasSuffix(lines[0].String(), "(stuck at 1)") {
+		t.Errorf("unexpected data line summary %q", lines[0])
+	}
+	logo[2] = expectedNintendoLogo[2]
+	if lines := cartridge.LogoDataLines(cartridge.CompareLogo(logo)); lines[0].Stuck() {
+		t.Error("a line with some right bits should not be stuck")
+	}
+
+	h, err := cartridge.ROMHeaderFromBytes(generatedHeader(t, testrom.Options{Title: "BOOTLEG", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.NintendoLogo[1] ^= 0x03
+	if len(h.LogoDiff()) != 2 {
+		t.Errorf("header logo should have 2 wrong bits, got %v", h.LogoDiff())
+	}
+}
+
+func TestLogoPNG(t *testing.T) {
+	logo := append([]uint8(nil), expectedNintendoLogo[:]...)
+	logo[0] ^= 0x80
+	var buf bytes.Buffer
+	if err := cartridge.WriteLogoPNG(&buf, logo, 4); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 48*4 || b.Dy() != 8*4 {
+		t.Fatalf("image should be scaled to 192x32, got %v", b)
+	}
+	r, g, b, _ := img.At(3, 3).RGBA()
+	if r == g || b <= r {
+		t.Error("missing pixels should be blue")
+	}
+	if r, g, b, _ := img.At(4, 0).RGBA(); r != 0 || g != 0 || b != 0 {
+		t.Error("dark pixels should be black")
+	}
+}
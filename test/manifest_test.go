@@ -0,0 +1,47 @@
+package test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+func TestManifestDetectsBitRot(t *testing.T) {
+	c := generatedCartridge(t, testrom.Options{Title: "POKEMON", CartridgeType: cartridge.MBC3TimerRAMBattery, ROMSize: cartridge.ROM128KB, RAMSize: cartridge.RAM32KB})
+	save := make([]uint8, 32*1024)
+	save[0x10] = 0x99
+	c.SetRAM(save)
+	c.RTC = &cartridge.RTC{Hours: 12, Days: 300, DayCarry: true}
+
+	m := c.Manifest(cartridge.DumpInfo{Backend: "rpi", Timing: "50us", MappingFile: "pins.yaml"})
+	if len(m.Banks) != 8 || m.Save == nil || m.Save.Size != 32*1024 || m.Header.Title != "POKEMON" {
+		t.Fatalf("Unexpected manifest %+v", m)
+	}
+	if m.Header.GlobalChecksum.Valid == nil || !*m.Header.GlobalChecksum.Valid {
+		t.Error("Manifest should record a valid global checksum")
+	}
+
+	fname := cartridge.ManifestPath(filepath.Join(t.TempDir(), "pokemon.gb"))
+	if err := m.WriteFile(fname); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := cartridge.ReadManifest(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.RTC == nil || loaded.RTC.Days != 300 || loaded.RTC.DH() != 0x81 || loaded.Dump.Backend != "rpi" {
+		t.Errorf("Unexpected loaded manifest %+v", loaded)
+	}
+	if problems := loaded.Check(c); len(problems) != 0 {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+
+	c.ROMBanks[5][0x100] ^= 0x01
+	c.RAMBanks[1][0] = 0x01
+	problems := loaded.Check(c)
+	if len(problems) != 3 {
+		t.Errorf("Expected ROM, bank 5 and save problems, got %v", problems)
+	}
+}
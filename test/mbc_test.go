@@ -0,0 +1,141 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func newTestBus(t *testing.T, rom []uint8) (*emu.Bus, *cartridge.Cartridge) {
+	t.Helper()
+	c, err := cartridge.CartridgeFromBytes(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus, err := emu.NewBus(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bus, c
+}
+
+func TestMBC1Banking(t *testing.T) {
+	bus, c := newTestBus(t, generatedROM(t, testrom.Options{Title: "MBC1", CartridgeType: cartridge.MBC1RAMBattery, ROMSize: cartridge.ROM1MB, RAMSize: cartridge.RAM32KB}))
+
+	if v := bus.Read(0x4000); v != 1 {
+		t.Errorf("bank 1 should be mapped after reset, read %d", v)
+	}
+	bus.Write(0x2000, 0x00) // bank 0 selects bank 1
+	if v := bus.Read(0x4000); v != 1 {
+		t.Errorf("bank 0 should map bank 1, read %d", v)
+	}
+	bus.Write(0x2000, 0x05)
+	bus.Write(0x4000, 0x01) // upper bits
+	if v := bus.Read(0x7FFF); v != testrom.Pattern(0x25, 0x3FFF) || bus.MBC.ROMBank() != 0x25 {
+		t.Errorf("bank 0x25 should be mapped, read %d", v)
+	}
+
+	// RAM is disabled until 0x0A is written
+	bus.Write(0xA000, 0x42)
+	if v := bus.Read(0xA000); v != 0xFF || bus.MBC.RAMBank() != -1 {
+		t.Errorf("disabled RAM read %02x", v)
+	}
+	bus.Write(0x0000, 0x0A)
+	bus.Write(0x6000, 0x01) // RAM banking mode, bank 1
+	bus.Write(0xA000, 0x42)
+	if c.RAMBanks[1][0] != 0x42 || bus.Read(0xA000) != 0x42 {
+		t.Error("RAM write should go to RAM bank 1")
+	}
+}
+
+// TestMBC1EnableRAMFirst enables the RAM before selecting any bank, which must keep bank 1
+// mapped at 4000
+func TestMBC1EnableRAMFirst(t *testing.T) {
+	bus, _ := newTestBus(t, generatedROM(t, testrom.Options{Title: "MBC1", CartridgeType: cartridge.MBC1RAMBattery, ROMSize: cartridge.ROM1MB, RAMSize: cartridge.RAM32KB}))
+
+	bus.Write(0x0000, 0x0A)
+	if v := bus.Read(0x4000); v != 1 || bus.MBC.ROMBank() != 1 {
+		t.Errorf("enabling the RAM should keep bank 1 mapped, read %d", v)
+	}
+	bus.Write(0x6000, 0x01)
+	if v := bus.Read(0x4000); v != 1 {
+		t.Errorf("changing the banking mode should keep bank 1 mapped, read %d", v)
+	}
+}
+
+func TestMBC2RAM(t *testing.T) {
+	bus, c := newTestBus(t, generatedROM(t, testrom.Options{Title: "MBC2", CartridgeType: cartridge.MBC2Battery, ROMSize: cartridge.ROM256KB, RAMSize: cartridge.None}))
+
+	bus.Write(0x0100, 0x0F) // bit 8 set: ROM bank
+	if v := bus.Read(0x4000); v != 0x0F {
+		t.Errorf("bank 15 should be mapped, read %d", v)
+	}
+	bus.Write(0x0000, 0x0A)
+	bus.Write(0xA201, 0x5C) // mirrored every 512 bytes
+	if c.RAMBanks[0][1] != 0x0C || bus.Read(0xA001) != 0xFC {
+		t.Errorf("MBC2 RAM should store half bytes, stored %02x", c.RAMBanks[0][1])
+	}
+}
+
+func TestMBC3Clock(t *testing.T) {
+	bus, c := newTestBus(t, generatedROM(t, testrom.Options{Title: "MBC3", CartridgeType: cartridge.MBC3TimerRAMBattery, ROMSize: cartridge.ROM2MB, RAMSize: cartridge.RAM32KB}))
+	gb := &emu.GameBoy{Cartridge: c, CPU: emu.NewCPU(bus), Bus: bus}
+
+	bus.Write(0x2000, 0x7F)
+	if v := bus.Read(0x4000); v != 0x7F {
+		t.Errorf("bank 127 should be mapped, read %d", v)
+	}
+
+	// Set 59 seconds, run two emulated seconds of NOPs and latch the clock
+	bus.Write(0x0000, 0x0A)
+	bus.Write(0x4000, 0x08)
+	bus.Write(0xA000, 59)
+	for cycles := 0; cycles < 2*cartridge.CyclesPerSecond; {
+		gb.CPU.PC = 0x0150 // even bytes of bank 0 are 0, a NOP
+		cycles += gb.Step()
+	}
+	bus.Write(0x6000, 0x00)
+	bus.Write(0x6000, 0x01)
+	if s := bus.Read(0xA000); s != 1 {
+		t.Errorf("latched seconds %d, want 1", s)
+	}
+	bus.Write(0x4000, 0x09)
+	if m := bus.Read(0xA000); m != 1 || c.RTC.Minutes != 1 {
+		t.Errorf("latched minutes %d, want 1", m)
+	}
+	if bus.MBC.RAMBank() != -1 {
+		t.Error("RTC registers are not a RAM bank")
+	}
+}
+
+func TestMBC5Banking(t *testing.T) {
+	rom := generatedROM(t, testrom.Options{Title: "MBC5", CartridgeType: cartridge.MBC5RAMBattery, ROMSize: cartridge.ROM8MB, RAMSize: cartridge.RAM128KB})
+	rom[0x101*cartridge.ROMBankSize] = 0xAB
+	bus, c := newTestBus(t, rom)
+
+	bus.Write(0x2000, 0x00)
+	if v := bus.Read(0x4000); v != 0x00 || bus.MBC.ROMBank() != 0 {
+		t.Errorf("MBC5 can map bank 0, read %d", v)
+	}
+	bus.Write(0x2000, 0x01)
+	bus.Write(0x3000, 0x01)
+	if v := bus.Read(0x4000); v != 0xAB || bus.MBC.ROMBank() != 0x101 {
+		t.Errorf("bank 0x101 should be mapped, read %02x", v)
+	}
+
+	bus.Write(0x0000, 0x0A)
+	bus.Write(0x4000, 0x0F)
+	bus.Write(0xBFFF, 0x77)
+	if c.RAMBanks[15][0x1FFF] != 0x77 || bus.MBC.RAMBank() != 15 {
+		t.Error("RAM write should go to RAM bank 15")
+	}
+}
+
+func TestUnsupportedMBC(t *testing.T) {
+	c := generatedCartridge(t, testrom.Options{Title: "CAMERA", CartridgeType: cartridge.PocketCamera, ROMSize: cartridge.ROM1MB, RAMSize: cartridge.RAM128KB})
+	if _, err := emu.New(c); err == nil {
+		t.Error("pocket camera cartridges are not supported")
+	}
+}
@@ -0,0 +1,240 @@
+package test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/patch"
+)
+
+// translatedROM returns a copy of rom with some typical patch modifications: changed text,
+// a long run of equal bytes and an enlarged ROM
+func translatedROM(rom []byte, banks int) []byte {
+	out := make([]byte, banks*cartridge.ROMBankSize)
+	copy(out, rom)
+	copy(out[0x2000:], "HELLO WORLD, THIS IS A TRANSLATION")
+	for i := 0x5000; i < 0x5400; i++ {
+		out[i] = 0x7E
+	}
+	for i := len(rom); i < len(out); i++ {
+		out[i] = uint8(i * 7)
+	}
+	return out
+}
+
+func TestPatchRoundTrip(t *testing.T) {
+	source := generatedROM(t, testrom.Options{Title: "ORIGINAL", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+	target := translatedROM(source, 8)
+
+	for _, f := range []patch.Format{patch.IPS, patch.BPS, patch.UPS} {
+		p, err := patch.CreateBytes(f, source, target)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if detected, err := patch.Detect(p); err != nil || detected != f {
+			t.Errorf("%v: detected %v (%v)", f, detected, err)
+		}
+
+		out, err := patch.ApplyBytes(source, p)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if !bytes.Equal(out, target) {
+			t.Errorf("%v: patched ROM does not match the target", f)
+		}
+
+		// Shrinking patches (IPS uses the truncation extension)
+		p, err = patch.CreateBytes(f, target, source)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		out, err = patch.ApplyBytes(target, p)
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if !bytes.Equal(out, source) {
+			t.Errorf("%v: shrinking patch does not restore the source", f)
+		}
+	}
+}
+
+func TestApplyPatchToCartridgeFixesChecksums(t *testing.T) {
+	source := generatedROM(t, testrom.Options{Title: "ORIGINAL", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+	target := append([]byte(nil), source...)
+	copy(target[0x134:], "PATCHED\x00") // title changes but checksums are left untouched
+	target[0x4010] = 0x42
+
+	p, err := patch.CreateIPS(source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := cartridge.CartridgeFromBytes(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patched, err := patch.Apply(c, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if patched.Header.TitleText() != "PATCHED" || patched.ROMBanks[1][0x10] != 0x42 {
+		t.Error("Patch was not applied")
+	}
+	if err := patched.Header.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := patched.Validate(); err != nil {
+		t.Error(err)
+	}
+	if c.Header.TitleText() != "ORIGINAL" {
+		t.Error("Original cartridge must not be modified")
+	}
+
+	bps := patch.CreateBPS(patched.Bytes(), source)
+	restored, err := patch.Apply(patched, bps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.Bytes(), source) {
+		t.Error("BPS patch did not restore the original cartridge")
+	}
+}
+
+func TestIPSRLEAndTruncation(t *testing.T) {
+	rom := make([]byte, 16)
+	p := []byte("PATCH")
+	p = append(p, 0x00, 0x00, 0x02, 0x00, 0x02, 0xAA, 0xBB)       // literal record at 0x02
+	p = append(p, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x04, 0xCC) // RLE record at 0x08
+	p = append(p, []byte("EOF")...)
+	p = append(p, 0x00, 0x00, 0x0A) // truncate to 10 bytes
+
+	out, err := patch.ApplyIPS(rom, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0, 0, 0xAA, 0xBB, 0, 0, 0, 0, 0xCC, 0xCC}
+	if !bytes.Equal(out, expected) {
+		t.Errorf("Expected %x got %x", expected, out)
+	}
+
+	if _, err := patch.ApplyIPS(rom, p[:12]); err == nil {
+		t.Error("Expected an error for a truncated IPS patch")
+	}
+}
+
+func bpsVarint(data int) []byte {
+	var out []byte
+	for {
+		x := byte(data & 0x7F)
+		data >>= 7
+		if data == 0 {
+			return append(out, 0x80|x)
+		}
+		out = append(out, x)
+		data--
+	}
+}
+
+func TestBPSCopyActionsAndCRC(t *testing.T) {
+	source := []byte("ABCDEFGH")
+	target := []byte("EFGHxxxxxABCD")
+
+	p := []byte("BPS1")
+	p = append(p, bpsVarint(len(source))...)
+	p = append(p, bpsVarint(len(target))...)
+	p = append(p, bpsVarint(0)...)
+	p = append(p, bpsVarint((4-1)<<2|2)...) // SourceCopy 4 bytes from +4
+	p = append(p, bpsVarint(4<<1)...)
+	p = append(p, bpsVarint((1-1)<<2|1)...) // TargetRead "x"
+	p = append(p, 'x')
+	p = append(p, bpsVarint((4-1)<<2|3)...) // TargetCopy 4 bytes from +4 (overlapping)
+	p = append(p, bpsVarint(4<<1)...)
+	p = append(p, bpsVarint((4-1)<<2|2)...) // SourceCopy 4 bytes from 0 (-8)
+	p = append(p, bpsVarint(8<<1|1)...)
+
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(source))
+	p = append(p, crc[:]...)
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(target))
+	p = append(p, crc[:]...)
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(p))
+	p = append(p, crc[:]...)
+
+	out, err := patch.ApplyBPS(source, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, target) {
+		t.Errorf("Expected %q got %q", target, out)
+	}
+
+	if _, err := patch.ApplyBPS([]byte("ABCDEFGX"), p); err == nil {
+		t.Error("Expected a source CRC32 error")
+	}
+	p[len(p)-13] ^= 0xFF
+	if _, err := patch.ApplyBPS(source, p); err == nil {
+		t.Error("Expected a patch CRC32 error")
+	}
+}
+
+func TestUPSIsReversible(t *testing.T) {
+	source := generatedROM(t, testrom.Options{Title: "ORIGINAL", CartridgeType: cartridge.RomOnly, ROMSize: cartridge.ROM32KB, RAMSize: cartridge.None})
+	target := translatedROM(source, 4)
+
+	p := patch.CreateUPS(source, target)
+	out, err := patch.ApplyUPS(target, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, source) {
+		t.Error("Applying an UPS patch to the target must return the source")
+	}
+
+	if _, err := patch.ApplyUPS(source[:len(source)-1], p); err == nil {
+		t.Error("Expected an error applying the patch to an unrelated file")
+	}
+}
+
+func TestIPSRecordAtEOFOffset(t *testing.T) {
+	source := make([]byte, 0x500000)
+	target := append([]byte(nil), source...)
+	target[0x454F46] = 0x01 // a record starting here would read as the "EOF" marker
+	for i := 0x454F47; i < 0x454F60; i++ {
+		target[i] = 0x02
+	}
+
+	p, err := patch.CreateIPS(source, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := patch.ApplyIPS(source, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out, target) {
+		t.Error("IPS patch with a record at the EOF offset was not applied correctly")
+	}
+}
+
+func TestUPSHugeTargetSize(t *testing.T) {
+	source := []byte("ABCDEFGH")
+	p := []byte("UPS1")
+	p = append(p, bpsVarint(len(source))...)
+	p = append(p, bpsVarint(1<<40)...)
+
+	var crc [4]byte
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(source))
+	p = append(p, crc[:]...)
+	p = append(p, crc[:]...)
+	binary.LittleEndian.PutUint32(crc[:], crc32.ChecksumIEEE(p))
+	p = append(p, crc[:]...)
+
+	if _, err := patch.ApplyUPS(source, p); err == nil || !strings.Contains(err.Error(), "larger than any cartridge") {
+		t.Errorf("Expected an error for a huge target size, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package test
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+// newTestGameBoy returns a Game Boy looping at 0150
+func newTestGameBoy(t *testing.T) *emu.GameBoy {
+	t.Helper()
+	return newProgramGameBoy(t, "\tjr @\n")
+}
+
+// solidTile writes a tile whose pixels all have the given color index
+func solidTile(bus *emu.Bus, addr uint16, index uint8) {
+	for row := uint16(0); row < 8; row++ {
+		bus.Write(addr+row*2, 0xFF*(index&1))
+		bus.Write(addr+row*2+1, 0xFF*(index>>1))
+	}
+}
+
+func TestPPUModeTiming(t *testing.T) {
+	bus := newTestGameBoy(t).Bus
+	ppu := bus.PPU
+	bus.Write(emu.AddrIF, 0)
+
+	steps := []struct {
+		dots int
+		mode uint8
+		ly   uint8
+	}{
+		{0, emu.ModeOAM, 0},
+		{80, emu.ModeDraw, 0},
+		{172, emu.ModeHBlank, 0},
+		{204, emu.ModeOAM, 1},
+		{456 * 143, emu.ModeVBlank, 144},
+		{456 * 10, emu.ModeOAM, 0},
+	}
+	for _, s := range steps {
+		ppu.Tick(s.dots)
+		if ppu.Mode() != s.mode || ppu.LY != s.ly {
+			t.Fatalf("after %d dots: mode %d LY %d, want mode %d LY %d", s.dots, ppu.Mode(), ppu.LY, s.mode, s.ly)
+		}
+	}
+	if bus.Read(emu.AddrIF)&emu.IntVBlank == 0 || ppu.Frames != 1 {
+		t.Error("VBlank interrupt not requested")
+	}
+}
+
+func TestPPUSTATInterrupts(t *testing.T) {
+	bus := newTestGameBoy(t).Bus
+	bus.Write(0xFF45, 10)   // LYC
+	bus.Write(0xFF41, 0x40) // LYC interrupt
+	bus.Write(emu.AddrIF, 0)
+
+	bus.PPU.Tick(456*10 - 1)
+	if bus.Read(emu.AddrIF)&emu.IntLCD != 0 {
+		t.Fatal("STAT interrupt requested before LY=LYC")
+	}
+	bus.PPU.Tick(1)
+	if bus.Read(emu.AddrIF)&emu.IntLCD == 0 || bus.Read(0xFF41)&0x04 == 0 {
+		t.Error("STAT interrupt not requested when LY=LYC")
+	}
+
+	// HBlank interrupt, blocked while the LYC line is still high
+	bus.Write(emu.AddrIF, 0)
+	bus.Write(0xFF41, 0x48)
+	bus.PPU.Tick(300)
+	if bus.Read(emu.AddrIF)&emu.IntLCD != 0 {
+		t.Error("HBlank interrupt should be blocked by the LYC source")
+	}
+	bus.PPU.Tick(456)
+	if bus.Read(emu.AddrIF)&emu.IntLCD == 0 {
+		t.Error("HBlank interrupt not requested on the next line")
+	}
+}
+
+func TestPPURendering(t *testing.T) {
+	gb := newTestGameBoy(t)
+	bus := gb.Bus
+
+	solidTile(bus, 0x8010, 1) // tile 1: light
+	solidTile(bus, 0x8020, 3) // tile 2: black
+	solidTile(bus, 0x8030, 2) // tile 3: dark
+	bus.Write(0x9800, 0x01)   // background tile (0,0)
+	bus.Write(0x9C00, 0x02)   // window tile (0,0)
+	bus.Write(0xFF47, 0xE4)   // BGP identity
+	bus.Write(0xFF48, 0xE4)   // OBP0 identity
+	bus.Write(0xFF4A, 64)     // WY
+	bus.Write(0xFF4B, 7+80)   // WX
+
+	// 11 sprites on line 32, the 11th is not drawn
+	for i := 0; i < 11; i++ {
+		bus.Write(0xFE00+uint16(i)*4, 16+32)
+		bus.Write(0xFE01+uint16(i)*4, uint8(8+i*12))
+		bus.Write(0xFE02+uint16(i)*4, 0x03)
+	}
+	// Overlapping sprites on line 100: the one with the lowest X wins, even if it has a
+	// higher OAM index
+	bus.Write(0xFE30, 16+100)
+	bus.Write(0xFE31, 8+20)
+	bus.Write(0xFE32, 0x02)
+	bus.Write(0xFE34, 16+100)
+	bus.Write(0xFE35, 8+16)
+	bus.Write(0xFE36, 0x01)
+
+	bus.Write(0xFF40, 0x80|0x40|0x20|0x10|0x02|0x01)
+	bus.PPU.Tick(emu.CyclesPerFrame)
+	frame := gb.Frame()
+
+	for _, tc := range []struct {
+		name string
+		x, y int
+		want color.RGBA
+	}{
+		{"background tile", 3, 3, emu.DMGPalette[1]},
+		{"background scrolled out", 20, 3, emu.DMGPalette[0]},
+		{"window", 80, 64, emu.DMGPalette[3]},
+		{"window right of WX only", 79, 64, emu.DMGPalette[0]},
+		{"10th sprite", 9*12 + 1, 32, emu.DMGPalette[2]},
+		{"11th sprite dropped", 10*12 + 1, 32, emu.DMGPalette[0]},
+		{"lowest X sprite priority", 21, 100, emu.DMGPalette[1]},
+		{"overlapped sprite visible", 25, 100, emu.DMGPalette[3]},
+	} {
+		if got := frame.At(tc.x, tc.y); got != tc.want {
+			t.Errorf("%s: pixel (%d,%d) is %v, want %v", tc.name, tc.x, tc.y, got, tc.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gb.WritePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil || img.Bounds().Dx() != emu.ScreenWidth || img.Bounds().Dy() != emu.ScreenHeight {
+		t.Errorf("invalid PNG: %v", err)
+	}
+}
+
+func TestPPUSpriteBehindBackground(t *testing.T) {
+	gb := newTestGameBoy(t)
+	bus := gb.Bus
+	solidTile(bus, 0x8010, 1)
+	solidTile(bus, 0x8020, 3)
+	bus.Write(0x9800, 0x01)
+	bus.Write(0xFF47, 0xE4)
+	bus.Write(0xFF48, 0xE4)
+	bus.Write(0xFE00, 16)
+	bus.Write(0xFE01, 8+4)
+	bus.Write(0xFE02, 0x02)
+	bus.Write(0xFE03, 0x80) // behind background colors 1-3
+
+	bus.Write(0xFF40, 0x80|0x10|0x02|0x01)
+	bus.PPU.Tick(emu.CyclesPerFrame)
+	if got := gb.Frame().At(5, 0); got != emu.DMGPalette[1] {
+		t.Errorf("sprite should be hidden by the background, pixel is %v", got)
+	}
+	if got := gb.Frame().At(9, 0); got != emu.DMGPalette[3] {
+		t.Errorf("sprite should be drawn over background color 0, pixel is %v", got)
+	}
+}
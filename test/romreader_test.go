@@ -1,13 +1,44 @@
 package test
 
 import (
-	"fmt"
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
 	"testing"
 
+	"github.com/Guillem96/gameboy-tools/asm"
 	"github.com/Guillem96/gameboy-tools/cartridge"
 )
 
-const romFile = "../roms/tetris.gb"
+// romFile assembles a MBC1 ROM with different contents in every bank and writes it to a
+// temporary file
+func romFile(t *testing.T) (string, *cartridge.Cartridge) {
+	t.Helper()
+	c, err := asm.BuildROM(programEntry+`
+	ld a, 1
+.select
+	ld [$2000], a
+	inc a
+	cp 4
+	jr nz, .select
+	jr @
+
+SECTION "Bank 1", ROMX[$4000], BANK[1]
+	db "BANK 1"
+SECTION "Bank 2", ROMX[$4000], BANK[2]
+	db "BANK 2"
+SECTION "Bank 3", ROMX[$4000], BANK[3]
+	db "BANK 3"
+`, asm.Header{Title: "TETRIS", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM64KB})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fname := filepath.Join(t.TempDir(), "tetris.gb")
+	if err := ioutil.WriteFile(fname, c.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fname, c
+}
 
 var expectedNintendoLogo = [...]uint8{
 	0xCE, 0xED, 0x66, 0x66, 0xCC, 0x0D, 0x00, 0x0B, 0x03, 0x73, 0x00, 0x83, 0x00,
@@ -17,7 +48,8 @@ var expectedNintendoLogo = [...]uint8{
 }
 
 func TestReadHeaderFromFile(t *testing.T) {
-	frr := cartridge.NewFileROMReader(romFile)
+	fname, _ := romFile(t)
+	frr := cartridge.NewFileROMReader(fname)
 	header, err := frr.ReadHeader()
 	if err != nil {
 		t.Error(err)
@@ -30,7 +62,8 @@ func TestReadHeaderFromFile(t *testing.T) {
 }
 
 func TestReadWholeCartridge(t *testing.T) {
-	frr := cartridge.NewFileROMReader(romFile)
+	fname, built := romFile(t)
+	frr := cartridge.NewFileROMReader(fname)
 	cart, err := frr.ReadCartridge()
 	if err != nil {
 		t.Error(err)
@@ -38,17 +71,21 @@ func TestReadWholeCartridge(t *testing.T) {
 
 	err = cart.Validate()
 	if err != nil {
-		fmt.Println("Warning:", err)
+		t.Error(err)
+	}
+	if !bytes.Equal(cart.Bytes(), built.Bytes()) {
+		t.Error("the cartridge read should be the assembled ROM")
 	}
 
-	err = cart.Save("../roms/test.gb")
+	err = cart.Save(filepath.Join(t.TempDir(), "test.gb"))
 	if err != nil {
 		t.Error(err)
 	}
 }
 
 func TestReadHeaderAndCheckNintendoLogo(t *testing.T) {
-	frr := cartridge.NewFileROMReader(romFile)
+	fname, _ := romFile(t)
+	frr := cartridge.NewFileROMReader(fname)
 	header, err := frr.ReadHeader()
 	if err != nil {
 		t.Error(err)
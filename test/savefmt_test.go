@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+func TestRTCAdvance(t *testing.T) {
+	rtc := cartridge.RTC{Seconds: 59, Minutes: 59, Hours: 23, Days: 511}
+	rtc.Advance(2 * time.Second)
+	if rtc.Seconds != 1 || rtc.Minutes != 0 || rtc.Hours != 0 || rtc.Days != 0 || !rtc.DayCarry {
+		t.Errorf("Advance() = %+v", rtc)
+	}
+
+	rtc = cartridge.RTC{Hours: 10, Halt: true}
+	rtc.Advance(time.Hour)
+	if rtc.Hours != 10 {
+		t.Errorf("halted clock advanced to %d hours", rtc.Hours)
+	}
+}
+
+func TestSaveFormatsRoundTrip(t *testing.T) {
+	ram := make([]uint8, 32*1024)
+	ram[0x1234] = 0x56
+	written := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rtc := &cartridge.RTC{Seconds: 30, Minutes: 15, Hours: 20, Days: 300, Timestamp: written}
+
+	for _, tc := range []struct {
+		format   cartridge.SaveFormat
+		detected cartridge.SaveFormat
+		size     int
+	}{
+		{cartridge.RawSave, cartridge.RawSave, 0},
+		{cartridge.VBAMSave, cartridge.VBAMSave, 48},
+		{cartridge.BGBSave, cartridge.BGBSave, 44},
+		{cartridge.SameBoySave, cartridge.VBAMSave, 48},
+	} {
+		data, err := cartridge.EncodeSave(tc.format, ram, rtc)
+		if err != nil {
+			t.Fatalf("%v: %v", tc.format, err)
+		}
+		if len(data) != len(ram)+tc.size {
+			t.Errorf("%v: save is %d bytes, want %d", tc.format, len(data), len(ram)+tc.size)
+		}
+
+		gotRAM, gotRTC, f, err := cartridge.DecodeSave(data, len(ram))
+		if err != nil || f != tc.detected || !bytes.Equal(gotRAM, ram) {
+			t.Errorf("%v: DecodeSave() detected %v, err %v", tc.format, f, err)
+			continue
+		}
+		if tc.size > 0 && (gotRTC == nil || *gotRTC != *rtc) {
+			t.Errorf("%v: clock %+v, want %+v", tc.format, gotRTC, rtc)
+		}
+	}
+
+	if _, _, _, err := cartridge.DecodeSave(make([]uint8, len(ram)+10), len(ram)); err == nil {
+		t.Error("DecodeSave() should reject unknown footers")
+	}
+}
+
+func TestImportSaveAdvancesClock(t *testing.T) {
+	c := generatedCartridge(t, testrom.Options{Title: "PM_CRYSTAL", CartridgeType: cartridge.MBC3TimerRAMBattery, ROMSize: cartridge.ROM128KB, RAMSize: cartridge.RAM32KB})
+
+	written := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	data, _ := cartridge.EncodeSave(cartridge.BGBSave, make([]uint8, 32*1024), &cartridge.RTC{Hours: 1, Timestamp: written})
+	if f, err := c.ImportSave(data, written.Add(49*time.Hour+30*time.Minute)); err != nil || f != cartridge.BGBSave {
+		t.Fatalf("ImportSave() = %v, %v", f, err)
+	}
+	if c.RTC.Days != 2 || c.RTC.Hours != 2 || c.RTC.Minutes != 30 {
+		t.Errorf("imported clock is %+v", c.RTC)
+	}
+
+	exported, err := c.ExportSave(cartridge.VBAMSave, c.RTC.Timestamp.Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rtc, _, _ := cartridge.DecodeSave(exported, 32*1024)
+	if rtc.Minutes != 31 {
+		t.Errorf("exported clock is %+v", rtc)
+	}
+
+	p := &fakeSRAMProxy{ram: make([]uint8, 32*1024)}
+	if err := cartridge.WriteRTC(p, c.Header, rtc); err != nil {
+		t.Fatal(err)
+	}
+	read, err := cartridge.ReadRTC(p, c.Header)
+	if err != nil || read.Days != rtc.Days || read.Hours != rtc.Hours || read.Minutes != rtc.Minutes || read.Halt {
+		t.Errorf("ReadRTC() = %+v, %v; want %+v", read, err, rtc)
+	}
+}
@@ -0,0 +1,35 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func TestSerialTransfer(t *testing.T) {
+	var requested, sent uint8
+	s := emu.NewSerial(func(i uint8) { requested |= i })
+	s.OnTransfer = func(b uint8) uint8 {
+		sent = b
+		return 0x24
+	}
+
+	s.WriteRegister(0xFF01, 0x42)
+	s.WriteRegister(0xFF02, 0x81)
+	s.Tick(8*512 - 1)
+	if requested != 0 || s.ReadRegister(0xFF02) != 0xFF {
+		t.Fatal("transfer should take 8 bits at 8192Hz")
+	}
+	s.Tick(1)
+	if requested != emu.IntSerial || sent != 0x42 || s.SB != 0x24 || s.ReadRegister(0xFF02) != 0x7F {
+		t.Errorf("transfer should complete, sent %02x SB %02x", sent, s.SB)
+	}
+
+	// Without a cable the external clock never arrives
+	requested = 0
+	s.WriteRegister(0xFF02, 0x80)
+	s.Tick(1 << 16)
+	if requested != 0 {
+		t.Error("transfer with the external clock should not complete")
+	}
+}
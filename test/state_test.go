@@ -0,0 +1,263 @@
+package test
+
+import (
+	"bytes"
+	"runtime"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+// newStateGameBoy runs a program that keeps changing the cartridge RAM, the scroll and the
+// audio, so every component has some state
+func newStateGameBoy(t *testing.T) *emu.GameBoy {
+	t.Helper()
+	gb := newProgramCartridgeGameBoy(t, cartridge.MBC3TimerRAMBattery, cartridge.RAM8KB, `
+	ld a, $0A
+	ld [$0000], a
+	ld hl, $A000
+.loop
+	inc [hl]
+	ldh a, [$FF44]
+	ldh [$FF43], a
+	jr .loop
+`)
+	solidTile(gb.Bus, 0x8010, 2)
+	gb.Bus.Write(0x9800, 0x01)
+	gb.Bus.Write(0xFF07, 0x05)
+	playTune(gb.Bus)
+	return gb
+}
+
+func saveState(t *testing.T, gb *emu.GameBoy) []uint8 {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := gb.SaveState(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func runFrames(gb *emu.GameBoy, n int) {
+	for i := 0; i < n; i++ {
+		gb.RunFrame()
+	}
+}
+
+func TestSaveStateReplay(t *testing.T) {
+	a := newStateGameBoy(t)
+	runFrames(a, 10)
+	state := saveState(t, a)
+	counter := a.Cartridge.RAM()[0]
+	a.Samples()
+	runFrames(a, 20)
+
+	b := newStateGameBoy(t)
+	if err := b.LoadState(bytes.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	if b.Frames != 10 || counter == 0 || b.Cartridge.RAM()[0] != counter {
+		t.Errorf("state should restore the frame counter and the RAM, frame %d", b.Frames)
+	}
+	runFrames(b, 20)
+
+	if !bytes.Equal(saveState(t, a), saveState(t, b)) {
+		t.Error("replaying from a state should be bit exact")
+	}
+	if a.FrameHash() != b.FrameHash() || !equalSamples(a.Samples(), b.Samples()) {
+		t.Error("replay should render the same frames and audio")
+	}
+}
+
+func equalSamples(a, b []int16) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	gb := newStateGameBoy(t)
+	runFrames(gb, 2)
+	state := saveState(t, gb)
+	runFrames(gb, 1)
+	before := saveState(t, gb)
+
+	other := newTestGameBoy(t)
+	corrupt := append([]uint8{}, state...)
+	corrupt[0] = 'X'
+	for name, err := range map[string]error{
+		"other cartridge": other.LoadState(bytes.NewReader(state)),
+		"bad magic":       gb.LoadState(bytes.NewReader(corrupt)),
+		"truncated":       gb.LoadState(bytes.NewReader(state[:len(state)-100])),
+	} {
+		if err == nil {
+			t.Errorf("%s: state should be rejected", name)
+		}
+	}
+	if !bytes.Equal(saveState(t, gb), before) {
+		t.Error("a failed load should not modify the console")
+	}
+}
+
+// TestLoadCorruptState loads states with out of range values, which would make the emulator
+// index its memories out of bounds
+func TestLoadCorruptState(t *testing.T) {
+	gb := newStateGameBoy(t)
+	runFrames(gb, 2)
+	state := saveState(t, gb)
+	before := saveState(t, gb)
+
+	// The MBC3 state is last: banks and flags (21 bytes), the 8KB RAM and the clock (12 bytes).
+	// The OAM DMA position is the first of its 3 ints, written just before
+	mbc := len(state) - 12 - 8*1024 - 21
+	dmaPos := mbc - 3*8
+	for name, corrupt := range map[string]func(s []uint8){
+		"negative ROM bank": func(s []uint8) { copy(s[mbc:], []uint8{0xFF, 0xFF, 0xFF, 0xFF}) },
+		"huge RAM bank":     func(s []uint8) { copy(s[mbc+4:], []uint8{0x00, 0x01, 0x00, 0x00}) },
+		"DMA position":      func(s []uint8) { copy(s[dmaPos:], []uint8{0x00, 0x10}) },
+	} {
+		s := append([]uint8{}, state...)
+		corrupt(s)
+		if err := gb.LoadState(bytes.NewReader(s)); err == nil {
+			t.Errorf("%s: state should be rejected", name)
+		}
+		if !bytes.Equal(saveState(t, gb), before) {
+			t.Errorf("%s: a failed load should not modify the console", name)
+		}
+	}
+	gb.Bus.Read(0x4000)
+	runFrames(gb, 1)
+}
+
+func TestMovie(t *testing.T) {
+	a := newStateGameBoy(t)
+	a.Input.Tap(3, emu.ButtonA, 2)
+	a.Input.Press(6, emu.ButtonLeft)
+	movie, err := a.RecordMovie(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(a, 12)
+
+	var buf bytes.Buffer
+	if err := movie.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	played, err := emu.ReadMovie(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []emu.Button{0, 0, 0, emu.ButtonA, emu.ButtonA, 0, emu.ButtonLeft}
+	if len(played.Inputs) != 12 || !bytes.Equal(buttonBytes(played.Inputs[:7]), buttonBytes(want)) {
+		t.Fatalf("recorded inputs %v", played.Inputs)
+	}
+
+	b := newStateGameBoy(t)
+	if err := b.PlayMovie(played); err != nil {
+		t.Fatal(err)
+	}
+	for b.PlayingMovie() {
+		b.RunFrame()
+	}
+	if !bytes.Equal(saveState(t, a), saveState(t, b)) {
+		t.Error("playing the movie should reproduce the run")
+	}
+	if err := b.PlayMovie(played); err == nil {
+		t.Error("movies without a state should only play from power on")
+	}
+}
+
+func TestReadCorruptMovie(t *testing.T) {
+	gb := newStateGameBoy(t)
+	movie, err := gb.RecordMovie(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runFrames(gb, 2)
+	var buf bytes.Buffer
+	if err := movie.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The state length follows the 10 bytes header. A huge length must not be allocated before
+	// the read fails
+	data := buf.Bytes()
+	copy(data[10:], []uint8{0xFF, 0xFF, 0xFF, 0xFF})
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	if _, err := emu.ReadMovie(bytes.NewReader(data)); err == nil {
+		t.Error("a movie with a corrupt state length should be rejected")
+	}
+	runtime.ReadMemStats(&after)
+	if alloc := after.TotalAlloc - before.TotalAlloc; alloc > 16*uint64(len(data)) {
+		t.Errorf("reading a corrupt movie allocated %d bytes", alloc)
+	}
+}
+
+func buttonBytes(buttons []emu.Button) []uint8 {
+	b := make([]uint8, len(buttons))
+	for i, v := range buttons {
+		b[i] = uint8(v)
+	}
+	return b
+}
+
+func TestRewind(t *testing.T) {
+	gb := newStateGameBoy(t)
+	movie, err := gb.RecordMovie(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rewind := emu.NewRewind(gb, 4, 1)
+	var states [][]uint8
+	for i := 0; i < 10; i++ {
+		gb.RunFrame()
+		if err := rewind.Capture(); err != nil {
+			t.Fatal(err)
+		}
+		states = append(states, saveState(t, gb))
+	}
+	if rewind.Len() != 4 {
+		t.Fatalf("rewind should keep 4 states, has %d", rewind.Len())
+	}
+
+	// The state of the current frame is skipped, going back goes to the previous frame
+	for _, want := range []int{8, 7} {
+		if ok, err := rewind.Back(); !ok || err != nil {
+			t.Fatalf("rewind failed: %v", err)
+		}
+		if gb.Frames != uint64(want+1) || !bytes.Equal(saveState(t, gb), states[want]) {
+			t.Errorf("rewind should restore frame %d, at frame %d", want+1, gb.Frames)
+		}
+	}
+	if rewind.Len() != 1 {
+		t.Errorf("rewind should have 1 state left, has %d", rewind.Len())
+	}
+
+	// A state that can not be loaded stays in the buffer
+	gb.Cartridge.Header.HeaderChecksum++
+	if _, err := rewind.Back(); err == nil || rewind.Len() != 1 {
+		t.Errorf("a failed rewind should keep the state, err %v and %d states", err, rewind.Len())
+	}
+	gb.Cartridge.Header.HeaderChecksum--
+	if ok, err := rewind.Back(); !ok || err != nil || gb.Frames != 7 {
+		t.Fatalf("rewind should restore frame 7 after a failed load, at frame %d: %v", gb.Frames, err)
+	}
+	if ok, _ := rewind.Back(); ok {
+		t.Error("rewind should be empty")
+	}
+
+	// Recording continues from the rewound frame
+	gb.Bus.Joypad.Press(emu.ButtonB)
+	gb.RunFrame()
+	if len(movie.Inputs) != 8 || movie.Inputs[7] != emu.ButtonB {
+		t.Errorf("rewound inputs should be replaced, movie has %d frames", len(movie.Inputs))
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/asm"
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+// programEntry is the entry point of the program fixtures, jumping to Main after the header
+const programEntry = `
+SECTION "Entry", ROM0[$0100]
+	nop
+	jp Main
+	ds $150 - @, 0
+
+SECTION "Main", ROM0[$0150]
+Main:
+`
+
+// assembleProgram assembles a 32KB ROM with the program at Main, stored at 0150
+func assembleProgram(t *testing.T, cartType, ramSize uint8, src string) (*cartridge.Cartridge, *asm.Program) {
+	t.Helper()
+	p, err := asm.AssembleString(programEntry + src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Build(asm.Header{Title: "PROGRAM", CartridgeType: cartType, ROMSize: cartridge.ROM32KB, RAMSize: ramSize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, p
+}
+
+// newProgramGameBoy returns a Game Boy running a ROM whose entry point jumps to the program,
+// stored at 0150
+func newProgramGameBoy(t *testing.T, src string) *emu.GameBoy {
+	t.Helper()
+	return newProgramCartridgeGameBoy(t, cartridge.RomOnly, cartridge.None, src)
+}
+
+func newProgramCartridgeGameBoy(t *testing.T, cartType, ramSize uint8, src string) *emu.GameBoy {
+	t.Helper()
+	c, _ := assembleProgram(t, cartType, ramSize, src)
+	gb, err := emu.New(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gb
+}
+
+// testROM prints the message on the serial port and executes LD B,B with the given registers
+func testROM(t *testing.T, b, c, d, e, h, l uint8) *emu.GameBoy {
+	return newProgramGameBoy(t, fmt.Sprintf(`
+	ld hl, Message
+.print
+	ld a, [hl+]
+	or a
+	jr z, .done
+	ldh [$FF01], a
+	ld a, $81
+	ldh [$FF02], a
+.wait
+	ldh a, [$FF02]
+	bit 7, a
+	jr nz, .wait
+	jr .print
+.done
+	ld b, %d
+	ld c, %d
+	ld d, %d
+	ld e, %d
+	ld h, %d
+	ld l, %d
+	ld b, b
+	jr @
+
+Message:
+	db "Passed", $0A, 0
+`, b, c, d, e, h, l))
+}
+
+func TestTestMonitor(t *testing.T) {
+	gb := testROM(t, 3, 5, 8, 13, 21, 34)
+	m := emu.NewTestMonitor(gb)
+	for i := 0; i < 10 && m.Result == emu.TestRunning; i++ {
+		gb.RunFrame()
+	}
+	if m.Result != emu.TestPassed || m.Breakpoints != 1 || m.Serial.String() != "Passed\n" {
+		t.Errorf("test ROM should pass: result %v, serial %q", m.Result, m.Serial.String())
+	}
+
+	gb = testROM(t, 0x42, 0x42, 0x42, 0x42, 0x42, 0x42)
+	m = emu.NewTestMonitor(gb)
+	for i := 0; i < 10; i++ {
+		gb.RunFrame()
+	}
+	if m.Result != emu.TestFailed || m.Breakpoints != 1 {
+		t.Errorf("test ROM should fail: result %v", m.Result)
+	}
+}
+
+func TestFrameHash(t *testing.T) {
+	a, b := newTestGameBoy(t), newTestGameBoy(t)
+	for i := 0; i < 3; i++ {
+		a.RunFrame()
+		b.RunFrame()
+	}
+	if a.FrameHash() != b.FrameHash() || len(a.FrameHash()) != 40 {
+		t.Fatalf("frame hash should be deterministic, %v != %v", a.FrameHash(), b.FrameHash())
+	}
+
+	solidTile(b.Bus, 0x8000, 3)
+	b.RunFrame()
+	if a.FrameHash() == b.FrameHash() {
+		t.Error("frame hash should change with the screen")
+	}
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/emu"
+)
+
+func newTestTimer() (*emu.Timer, *uint8) {
+	var requested uint8
+	timer := emu.NewTimer(func(i uint8) { requested |= i })
+	timer.WriteRegister(0xFF04, 0)
+	return timer, &requested
+}
+
+func TestTimerCounting(t *testing.T) {
+	timer, _ := newTestTimer()
+	timer.Tick(256)
+	if timer.DIV() != 1 || timer.TIMA != 0 {
+		t.Errorf("DIV should increment every 256 cycles and TIMA should be stopped, DIV %d TIMA %d", timer.DIV(), timer.TIMA)
+	}
+
+	timer.WriteRegister(0xFF04, 0)
+	timer.WriteRegister(0xFF07, 0x05) // 262144Hz
+	timer.Tick(16 * 3)
+	if timer.TIMA != 3 {
+		t.Errorf("TIMA should increment every 16 cycles, TIMA %d", timer.TIMA)
+	}
+	if v := timer.ReadRegister(0xFF07); v != 0xFD {
+		t.Errorf("TAC upper bits should read as 1, read %02x", v)
+	}
+}
+
+func TestTimerOverflow(t *testing.T) {
+	timer, requested := newTestTimer()
+	timer.WriteRegister(0xFF07, 0x05)
+	timer.WriteRegister(0xFF06, 0x80)
+	timer.WriteRegister(0xFF05, 0xFF)
+
+	timer.Tick(16)
+	if timer.TIMA != 0 || *requested != 0 {
+		t.Fatalf("TIMA should read 0 before the reload, TIMA %02x", timer.TIMA)
+	}
+	timer.Tick(4)
+	if timer.TIMA != 0x80 || *requested != emu.IntTimer {
+		t.Errorf("TIMA should be reloaded with TMA one M-cycle after the overflow, TIMA %02x", timer.TIMA)
+	}
+
+	// Writing TIMA during the reload delay cancels it
+	*requested = 0
+	timer.WriteRegister(0xFF04, 0)
+	timer.WriteRegister(0xFF05, 0xFF)
+	timer.Tick(16)
+	timer.WriteRegister(0xFF05, 0x10)
+	timer.Tick(4)
+	if timer.TIMA != 0x10 || *requested != 0 {
+		t.Errorf("writing TIMA should cancel the reload, TIMA %02x", timer.TIMA)
+	}
+}
+
+func TestTimerFallingEdge(t *testing.T) {
+	timer, _ := newTestTimer()
+	timer.WriteRegister(0xFF07, 0x05)
+	timer.Tick(8) // bit 3 of the counter is set
+	timer.WriteRegister(0xFF04, 0)
+	if timer.TIMA != 1 {
+		t.Errorf("resetting DIV with the selected bit set should increment TIMA, TIMA %d", timer.TIMA)
+	}
+
+	timer.Tick(8)
+	timer.WriteRegister(0xFF07, 0x04) // select bit 9, which is clear
+	if timer.TIMA != 2 {
+		t.Errorf("changing the clock select should increment TIMA, TIMA %d", timer.TIMA)
+	}
+	timer.WriteRegister(0xFF07, 0x05)
+	timer.WriteRegister(0xFF07, 0x01) // disabling the timer with the selected bit set
+	if timer.TIMA != 3 {
+		t.Errorf("disabling the timer should increment TIMA, TIMA %d", timer.TIMA)
+	}
+}
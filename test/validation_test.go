@@ -0,0 +1,80 @@
+package test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+)
+
+func expectSeverity(t *testing.T, r *cartridge.ValidationReport, name string, s cartridge.Severity) {
+	t.Helper()
+	c, ok := r.Find(name)
+	if !ok {
+		t.Errorf("Check %q not found in report", name)
+		return
+	}
+	if c.Severity != s {
+		t.Errorf("Check %q expected %v got %v (%s)", name, s, c.Severity, c.Message)
+	}
+}
+
+func TestValidationReportValidROM(t *testing.T) {
+	rom := generatedROM(t, testrom.Options{Title: "VALID", CartridgeType: cartridge.MBC1RAMBattery, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.RAM8KB})
+	r := cartridge.ValidateROM(rom)
+	if r.Worst() != cartridge.SeverityOK {
+		var buf bytes.Buffer
+		r.Write(&buf)
+		t.Errorf("Expected every check to pass:\n%s", buf.String())
+	}
+
+	c, err := cartridge.CartridgeFromBytes(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.ValidationReport().OK() {
+		t.Error("Cartridge report should be OK")
+	}
+}
+
+func TestValidationReportProblems(t *testing.T) {
+	rom := generatedROM(t, testrom.Options{Title: "BROKEN", CartridgeType: cartridge.MBC1, ROMSize: cartridge.ROM4MB, RAMSize: cartridge.RAM8KB})
+	rom[0x104+0x20] ^= 0xFF // bottom half of the logo
+	rom[0x14D]++
+
+	r := cartridge.ValidateROM(rom[:3*cartridge.ROMBankSize])
+	expectSeverity(t, r, cartridge.CheckLogo, cartridge.SeverityWarning)
+	expectSeverity(t, r, cartridge.CheckHeaderChecksum, cartridge.SeverityError)
+	expectSeverity(t, r, cartridge.CheckGlobalChecksum, cartridge.SeverityWarning)
+	expectSeverity(t, r, cartridge.CheckFileSize, cartridge.SeverityError)
+	expectSeverity(t, r, cartridge.CheckPowerOfTwo, cartridge.SeverityWarning)
+	expectSeverity(t, r, cartridge.CheckTypeSize, cartridge.SeverityError)
+	expectSeverity(t, r, cartridge.CheckRAMSize, cartridge.SeverityWarning)
+	if r.OK() {
+		t.Error("Report should not be OK")
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "[FAIL] file size: file is 48KB but header declares 4MB") {
+		t.Errorf("Unexpected report:\n%s", buf.String())
+	}
+
+	r = cartridge.ValidateROM(rom[:0x100])
+	expectSeverity(t, r, cartridge.CheckHeader, cartridge.SeverityError)
+}
+
+func TestValidationRAMTypes(t *testing.T) {
+	for _, cartType := range []uint8{cartridge.MBC3TimerRAMBattery, cartridge.MBC5RAM} {
+		rom := generatedROM(t, testrom.Options{Title: "RAM", CartridgeType: cartType, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.RAM32KB})
+		r := cartridge.ValidateROM(rom)
+		expectSeverity(t, r, cartridge.CheckRAMSize, cartridge.SeverityOK)
+
+		rom = generatedROM(t, testrom.Options{Title: "RAM", CartridgeType: cartType, ROMSize: cartridge.ROM64KB, RAMSize: cartridge.None})
+		expectSeverity(t, cartridge.ValidateROM(rom), cartridge.CheckRAMSize, cartridge.SeverityError)
+	}
+}
@@ -0,0 +1,142 @@
+package test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/cartridge/testrom"
+	"github.com/Guillem96/gameboy-tools/vault"
+)
+
+// fakeSRAMProxy emulates the external RAM and clock registers of an MBC3 cartridge behind a
+// GameBoyProxy
+type fakeSRAMProxy struct {
+	ram     []uint8
+	rtc     [5]uint8
+	enabled bool
+	bank    int
+	write   bool
+	addr    uint
+}
+
+func (p *fakeSRAMProxy) SetReadMode()         { p.write = false }
+func (p *fakeSRAMProxy) SetWriteMode()        { p.write = true }
+func (p *fakeSRAMProxy) SelectAddress(a uint) { p.addr = a }
+
+func (p *fakeSRAMProxy) Read() uint8 {
+	if !p.enabled || p.addr < 0xA000 || p.addr >= 0xC000 {
+		return 0xFF
+	}
+	if p.bank >= 0x08 {
+		return p.rtc[p.bank-0x08]
+	}
+	return p.ram[p.bank*cartridge.RAMBankSize+int(p.addr-0xA000)]
+}
+
+func (p *fakeSRAMProxy) Write(v uint8) {
+	switch {
+	case p.addr < 0x2000:
+		p.enabled = v&0x0F == 0x0A
+	case p.addr >= 0x4000 && p.addr < 0x6000:
+		p.bank = int(v & 0x0F)
+	case p.addr >= 0xA000 && p.addr < 0xC000 && p.enabled && p.bank >= 0x08:
+		p.rtc[p.bank-0x08] = v
+	case p.addr >= 0xA000 && p.addr < 0xC000 && p.enabled:
+		p.ram[p.bank*cartridge.RAMBankSize+int(p.addr-0xA000)] = v
+	}
+}
+
+func TestVaultHistory(t *testing.T) {
+	v, err := vault.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	save := make([]uint8, 32*1024)
+	first, err := v.Store("PM_CRYSTAL-1234", save, "new game")
+	if err != nil {
+		t.Fatal(err)
+	}
+	save[0x2001] = 0x42
+	save[0x6000] = 0x01
+	second, err := v.Store("PM_CRYSTAL-1234", save, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snaps, err := v.History("PM_CRYSTAL-1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 2 || snaps[0].Label != "new game" {
+		t.Fatalf("History() = %+v", snaps)
+	}
+
+	for ref, want := range map[string]string{
+		"latest":                         second.Hash,
+		"~1":                             first.Hash,
+		first.Hash[:8]:                   first.Hash,
+		strings.ToUpper(second.Hash[:8]): second.Hash,
+	} {
+		snap, err := v.Find("PM_CRYSTAL-1234", ref)
+		if err != nil || snap.Hash != want {
+			t.Errorf("Find(%q) = %v, %v; want %v", ref, snap.Hash, err, want)
+		}
+	}
+	if _, err := v.Find("PM_CRYSTAL-1234", "~2"); err == nil {
+		t.Error("Find(~2) should fail with two snapshots")
+	}
+
+	old, _ := v.Load(first)
+	d := vault.Compare(old, save)
+	if len(d.Bytes) != 2 || len(d.Banks) != 2 || d.Banks[0].Bank != 1 || d.Banks[1].Bank != 3 {
+		t.Errorf("Compare() = %+v", d)
+	}
+	var out bytes.Buffer
+	d.Write(&out, -1)
+	if !strings.Contains(out.String(), "01:a001 (offset 0x02001): 00 -> 42") {
+		t.Errorf("unexpected diff output:\n%s", out.String())
+	}
+
+	fname := filepath.Join(t.TempDir(), "crystal.sav")
+	if err := v.RestoreFile(first, fname); err != nil {
+		t.Fatal(err)
+	}
+	if restored, _ := ioutil.ReadFile(fname); !bytes.Equal(restored, old) {
+		t.Error("restored file differs from the snapshot")
+	}
+}
+
+func TestVaultRestoreCartridge(t *testing.T) {
+	c := generatedCartridge(t, testrom.Options{Title: "PM_CRYSTAL", CartridgeType: cartridge.MBC3TimerRAMBattery, ROMSize: cartridge.ROM128KB, RAMSize: cartridge.RAM32KB})
+	v, _ := vault.Open(t.TempDir())
+
+	save := make([]uint8, 32*1024)
+	for i := range save {
+		save[i] = uint8(i / cartridge.RAMBankSize)
+	}
+	snap, err := v.Store(vault.CartID(c.Header), save, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &fakeSRAMProxy{ram: make([]uint8, len(save))}
+	if err := v.RestoreCartridge(snap, p, c.Header); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.ram, save) {
+		t.Error("cartridge RAM differs from the restored snapshot")
+	}
+	if p.enabled {
+		t.Error("RAM should be disabled after restoring")
+	}
+
+	read, err := cartridge.ReadSRAM(p, c.Header)
+	if err != nil || !bytes.Equal(read, save) {
+		t.Errorf("ReadSRAM() does not return the restored save (err %v)", err)
+	}
+}
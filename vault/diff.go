@@ -0,0 +1,94 @@
+package vault
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+)
+
+// ByteChange is a byte that differs between two snapshots
+type ByteChange struct {
+	Offset int
+	Old    uint8
+	New    uint8
+}
+
+// BankChange summarises the changes of a single RAM bank
+type BankChange struct {
+	Bank    int
+	Changed int // number of bytes that differ
+}
+
+// Diff is the difference between two save snapshots
+type Diff struct {
+	OldSize int
+	NewSize int
+	Bytes   []ByteChange
+	Banks   []BankChange
+}
+
+// Compare returns the byte and bank level differences between two saves. If the sizes
+// differ, missing bytes are compared as 0xFF (the usual value of uninitialised SRAM)
+func Compare(old, new []uint8) *Diff {
+	d := &Diff{OldSize: len(old), NewSize: len(new)}
+	size := len(old)
+	if len(new) > size {
+		size = len(new)
+	}
+
+	at := func(b []uint8, i int) uint8 {
+		if i < len(b) {
+			return b[i]
+		}
+		return 0xFF
+	}
+
+	for i := 0; i < size; i++ {
+		o, n := at(old, i), at(new, i)
+		if o == n {
+			continue
+		}
+		d.Bytes = append(d.Bytes, ByteChange{Offset: i, Old: o, New: n})
+
+		bank := i / cartridge.RAMBankSize
+		if len(d.Banks) == 0 || d.Banks[len(d.Banks)-1].Bank != bank {
+			d.Banks = append(d.Banks, BankChange{Bank: bank})
+		}
+		d.Banks[len(d.Banks)-1].Changed++
+	}
+	return d
+}
+
+// Empty returns true if both saves are equal
+func (d *Diff) Empty() bool {
+	return len(d.Bytes) == 0 && d.OldSize == d.NewSize
+}
+
+// Write prints the bank summary followed by at most maxBytes byte changes (all of them if
+// maxBytes is negative). Addresses are shown as they are mapped by the cartridge (bank:A000-BFFF)
+func (d *Diff) Write(w io.Writer, maxBytes int) error {
+	if d.OldSize != d.NewSize {
+		if _, err := fmt.Fprintf(w, "size changed from %d to %d bytes\n", d.OldSize, d.NewSize); err != nil {
+			return err
+		}
+	}
+	for _, b := range d.Banks {
+		if _, err := fmt.Fprintf(w, "bank %d: %d bytes changed\n", b.Bank, b.Changed); err != nil {
+			return err
+		}
+	}
+
+	for i, c := range d.Bytes {
+		if maxBytes >= 0 && i >= maxBytes {
+			_, err := fmt.Fprintf(w, "... %d more\n", len(d.Bytes)-i)
+			return err
+		}
+		addr := 0xA000 + c.Offset%cartridge.RAMBankSize
+		_, err := fmt.Fprintf(w, "%02x:%04x (offset 0x%05x): %02x -> %02x\n", c.Offset/cartridge.RAMBankSize, addr, c.Offset, c.Old, c.New)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
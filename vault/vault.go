@@ -0,0 +1,208 @@
+// Package vault keeps the history of cartridge saves. Snapshots are stored content addressed
+// (by SHA-1), so backing up an unchanged save does not use more space, and each cartridge has
+// an append only history that lists its snapshots in order.
+//
+// Layout of a vault directory:
+//
+//	objects/ab/ab12...ef        snapshot contents
+//	carts/TETRIS-BF16.jsonl     snapshot history of a cartridge
+package vault
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Guillem96/gameboy-tools/cartridge"
+	"github.com/Guillem96/gameboy-tools/gbproxy"
+)
+
+// Snapshot is an entry in the history of a cartridge save
+type Snapshot struct {
+	Hash  string    `json:"sha1"`
+	Size  int       `json:"size"`
+	Time  time.Time `json:"time"`
+	Label string    `json:"label,omitempty"`
+}
+
+// Vault is a directory containing save snapshots
+type Vault struct {
+	root string
+}
+
+// Open opens (and creates if needed) the vault stored in root
+func Open(root string) (*Vault, error) {
+	for _, dir := range []string{"objects", "carts"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0755); err != nil {
+			return nil, fmt.Errorf("creating vault: %v", err)
+		}
+	}
+	return &Vault{root: root}, nil
+}
+
+// CartID returns the identifier used to group the snapshots of a cartridge: header title plus
+// global checksum
+func CartID(h *cartridge.CartridgeHeader) string {
+	return h.Identifier()
+}
+
+func (v *Vault) objectPath(hash string) string {
+	return filepath.Join(v.root, "objects", hash[:2], hash)
+}
+
+func (v *Vault) historyPath(cartID string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, cartID)
+	return filepath.Join(v.root, "carts", safe+".jsonl")
+}
+
+// Store adds a snapshot of the save to the history of the cartridge
+func (v *Vault) Store(cartID string, save []uint8, label string) (Snapshot, error) {
+	sum := sha1.Sum(save)
+	snap := Snapshot{
+		Hash:  hex.EncodeToString(sum[:]),
+		Size:  len(save),
+		Time:  time.Now().UTC(),
+		Label: label,
+	}
+
+	obj := v.objectPath(snap.Hash)
+	if _, err := os.Stat(obj); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(obj), 0755); err != nil {
+			return snap, fmt.Errorf("storing snapshot: %v", err)
+		}
+		// Write to a temporary file first so a crash never leaves a truncated object
+		tmp := obj + ".tmp"
+		if err := ioutil.WriteFile(tmp, save, 0444); err != nil {
+			return snap, fmt.Errorf("storing snapshot: %v", err)
+		}
+		if err := os.Rename(tmp, obj); err != nil {
+			return snap, fmt.Errorf("storing snapshot: %v", err)
+		}
+	}
+
+	line, err := json.Marshal(snap)
+	if err != nil {
+		return snap, err
+	}
+	f, err := os.OpenFile(v.historyPath(cartID), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return snap, fmt.Errorf("opening history: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return snap, fmt.Errorf("writing history: %v", err)
+	}
+	return snap, nil
+}
+
+// StoreCartridge stores the RAM banks of the cartridge
+func (v *Vault) StoreCartridge(c *cartridge.Cartridge, label string) (Snapshot, error) {
+	if len(c.RAMBanks) == 0 {
+		return Snapshot{}, fmt.Errorf("cartridge has no save to store")
+	}
+	return v.Store(CartID(c.Header), c.RAM(), label)
+}
+
+// History returns the snapshots of a cartridge from the oldest to the newest
+func (v *Vault) History(cartID string) ([]Snapshot, error) {
+	f, err := os.Open(v.historyPath(cartID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("opening history: %v", err)
+	}
+	defer f.Close()
+
+	var snaps []Snapshot
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var snap Snapshot
+		if err := json.Unmarshal(s.Bytes(), &snap); err != nil {
+			return nil, fmt.Errorf("reading history of %v: %v", cartID, err)
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, s.Err()
+}
+
+// Find resolves a snapshot reference. A reference is either a hash prefix, "latest", or
+// "~N" meaning N snapshots before the latest one
+func (v *Vault) Find(cartID, ref string) (Snapshot, error) {
+	snaps, err := v.History(cartID)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snaps) == 0 {
+		return Snapshot{}, fmt.Errorf("no snapshots for %v", cartID)
+	}
+
+	if ref == "latest" {
+		ref = "~0"
+	}
+	if strings.HasPrefix(ref, "~") {
+		n, err := strconv.Atoi(ref[1:])
+		if err != nil || n < 0 || n >= len(snaps) {
+			return Snapshot{}, fmt.Errorf("invalid snapshot reference %q (%d snapshots)", ref, len(snaps))
+		}
+		return snaps[len(snaps)-1-n], nil
+	}
+
+	var found []Snapshot
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if strings.HasPrefix(snaps[i].Hash, strings.ToLower(ref)) {
+			if len(found) == 0 || found[0].Hash != snaps[i].Hash {
+				found = append(found, snaps[i])
+			}
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Snapshot{}, fmt.Errorf("snapshot %q not found", ref)
+	case 1:
+		return found[0], nil
+	}
+	return Snapshot{}, fmt.Errorf("snapshot reference %q is ambiguous", ref)
+}
+
+// Load returns the contents of a snapshot, verifying its hash
+func (v *Vault) Load(snap Snapshot) ([]uint8, error) {
+	data, err := ioutil.ReadFile(v.objectPath(snap.Hash))
+	if err != nil {
+		return nil, fmt.Errorf("loading snapshot: %v", err)
+	}
+	if sum := sha1.Sum(data); hex.EncodeToString(sum[:]) != snap.Hash {
+		return nil, fmt.Errorf("snapshot %v is corrupted", snap.Hash)
+	}
+	return data, nil
+}
+
+// RestoreFile writes the snapshot to a .sav file
+func (v *Vault) RestoreFile(snap Snapshot, fname string) error {
+	data, err := v.Load(snap)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fname, data, 0644)
+}
+
+// RestoreCartridge writes the snapshot to the RAM of a physical cartridge through the proxy
+func (v *Vault) RestoreCartridge(snap Snapshot, p gbproxy.GameBoyProxy, h *cartridge.CartridgeHeader) error {
+	data, err := v.Load(snap)
+	if err != nil {
+		return err
+	}
+	return cartridge.WriteSRAM(p, h, data)
+}